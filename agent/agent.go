@@ -0,0 +1,325 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"x-ui/config"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/entity"
+	"x-ui/web/job"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	shutdownTimeout = 30 * time.Second
+	readTimeout     = 15 * time.Second
+	writeTimeout    = 15 * time.Second
+	maxHeaderBytes  = 1 << 20 // 1MB
+)
+
+// Config agent 的启动参数
+type Config struct {
+	Listen   string // 监听地址，如 0.0.0.0:54322
+	CertFile string // agent 证书，同时作为上报流量时的客户端证书
+	KeyFile  string
+	CaFile   string // 签发控制端和 agent 证书的私有CA
+	// 控制端面板地址，包含 basePath，为空时只在本机记录流量
+	Controller string
+	// 允许访问的控制端证书 CommonName，为空时接受该CA签发的任何证书
+	ControllerName string
+}
+
+// Server 无界面的 agent，只运行 xray、采集流量，并提供由控制端通过双向 TLS 访问的 API
+type Server struct {
+	config *Config
+
+	xrayService    service.XrayService
+	settingService service.SettingService
+	inboundService service.InboundService
+	serverService  service.ServerService
+
+	reporter *trafficReporter
+
+	lastStatus *service.Status
+	statusLock sync.Mutex
+
+	httpServer *http.Server
+	listener   net.Listener
+	cron       *cron.Cron
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewServer(config *Config) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// loadTLSConfig 加载 agent 证书和CA，要求客户端出示该CA签发的证书
+func (s *Server) loadTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(s.config.CertFile, s.config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载证书文件失败: %v", err)
+	}
+	caPem, err := os.ReadFile(s.config.CaFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取CA证书失败: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return nil, errors.New("无效的CA证书")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func (s *Server) initServices(tlsConfig *tls.Config) {
+	s.xrayService = service.NewXrayService(s.ctx)
+	s.xrayService.SetInboundService(&s.inboundService)
+	s.xrayService.SetSettingService(&s.settingService)
+	s.serverService = service.NewServerService(s.ctx)
+	s.serverService.SetXrayService(s.xrayService)
+	s.reporter = newTrafficReporter(s.ctx, s.xrayService, s.config.Controller, tlsConfig)
+}
+
+func (s *Server) initRouter() *gin.Engine {
+	if config.IsDebug() {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.DefaultWriter = io.Discard
+		gin.DefaultErrorWriter = io.Discard
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	engine.Use(s.checkController)
+
+	// 与面板相同的路径，控制端可以用同一套客户端管理面板节点和 agent 节点
+	engine.POST("/server/status", s.status)
+	g := engine.Group("/xui/inbound")
+	g.POST("/list", s.getInbounds)
+	g.POST("/add", s.addInbound)
+	g.POST("/update/:id", s.updateInbound)
+	g.POST("/del/:id", s.delInbound)
+	engine.POST("/agent/inbounds", s.setInbounds)
+	return engine
+}
+
+// checkController 客户端证书已由 TLS 校验，这里再限制控制端证书的 CommonName
+func (s *Server) checkController(c *gin.Context) {
+	if s.config.ControllerName == "" {
+		c.Next()
+		return
+	}
+	tlsState := c.Request.TLS
+	if tlsState == nil || len(tlsState.VerifiedChains) == 0 ||
+		tlsState.VerifiedChains[0][0].Subject.CommonName != s.config.ControllerName {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) startTask() error {
+	s.cron = cron.New(cron.WithSeconds())
+	c := s.cron
+
+	xrayReloadJob := job.NewXrayReloadJob(s.xrayService)
+	if err := xrayReloadJob.Add(c); err != nil {
+		return fmt.Errorf("添加Xray重载任务失败: %v", err)
+	}
+	checkXrayRunningJob := job.NewCheckXrayRunningJob(s.xrayService, nil)
+	if err := checkXrayRunningJob.Add(c); err != nil {
+		return fmt.Errorf("添加Xray运行检查任务失败: %v", err)
+	}
+	if err := s.reporter.Add(c); err != nil {
+		return fmt.Errorf("添加流量上报任务失败: %v", err)
+	}
+
+	c.Start()
+	return nil
+}
+
+func (s *Server) Start() error {
+	tlsConfig, err := s.loadTLSConfig()
+	if err != nil {
+		return err
+	}
+	s.initServices(tlsConfig)
+	engine := s.initRouter()
+
+	listener, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return err
+	}
+	s.listener = tls.NewListener(listener, tlsConfig)
+
+	if err := s.xrayService.ReconcileTraffic(); err != nil {
+		logger.Warning("补记流量失败:", err)
+	}
+	if err := s.xrayService.RestartXray(true); err != nil {
+		logger.Warning("启动 Xray 失败:", err)
+	}
+	if err := s.startTask(); err != nil {
+		s.listener.Close()
+		return err
+	}
+
+	s.httpServer = &http.Server{
+		Handler:        engine,
+		ReadTimeout:    readTimeout,
+		WriteTimeout:   writeTimeout,
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+	logger.Info("agent 启动在", s.config.Listen)
+	go func() {
+		if err := s.httpServer.Serve(s.listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("agent 服务失败: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Stop() error {
+	if s.cron != nil {
+		s.cron.Stop()
+	}
+	// 退出前尽量上报尚未送达的流量
+	if s.reporter != nil {
+		s.reporter.Run()
+	}
+	s.cancel()
+	if s.xrayService != nil {
+		if err := s.xrayService.StopXray(); err != nil {
+			logger.Warning("停止 Xray 失败:", err)
+		}
+	}
+	if s.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return s.httpServer.Shutdown(ctx)
+	}
+	return nil
+}
+
+func jsonMsg(c *gin.Context, msg string, err error) {
+	jsonMsgObj(c, msg, nil, err)
+}
+
+func jsonMsgObj(c *gin.Context, msg string, obj interface{}, err error) {
+	m := entity.Msg{
+		Obj: obj,
+	}
+	if err == nil {
+		m.Success = true
+		if msg != "" {
+			m.Msg = msg + "成功"
+		}
+	} else {
+		m.Msg = msg + "失败: " + err.Error()
+		logger.Warning(msg+"失败: ", err)
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+func (s *Server) status(c *gin.Context) {
+	s.statusLock.Lock()
+	s.lastStatus = s.serverService.GetStatus(s.lastStatus)
+	status := s.lastStatus
+	s.statusLock.Unlock()
+	jsonMsgObj(c, "", status, nil)
+}
+
+func (s *Server) getInbounds(c *gin.Context) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	jsonMsgObj(c, "获取", inbounds, err)
+}
+
+func (s *Server) addInbound(c *gin.Context) {
+	inbound := &model.Inbound{}
+	err := c.ShouldBind(inbound)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	err = s.inboundService.AddInbound(inbound)
+	jsonMsg(c, "添加", err)
+	if err == nil {
+		s.xrayService.SetToNeedRestart()
+	}
+}
+
+func (s *Server) updateInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	inbound := &model.Inbound{
+		Id: id,
+	}
+	err = c.ShouldBind(inbound)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	err = s.inboundService.UpdateInbound(inbound)
+	jsonMsg(c, "修改", err)
+	if err == nil {
+		s.xrayService.SetToNeedRestart()
+	}
+}
+
+func (s *Server) delInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = s.inboundService.DelInbound(id)
+	jsonMsg(c, "删除", err)
+	if err == nil {
+		s.xrayService.SetToNeedRestart()
+	}
+}
+
+// setInbounds 用控制端下发的集合替换全部入站
+func (s *Server) setInbounds(c *gin.Context) {
+	inbounds := make([]*model.Inbound, 0)
+	err := json.Unmarshal([]byte(c.PostForm("inbounds")), &inbounds)
+	if err != nil {
+		jsonMsg(c, "下发", err)
+		return
+	}
+	err = s.inboundService.ReplaceInbounds(inbounds)
+	jsonMsg(c, "下发", err)
+	if err == nil {
+		s.xrayService.SetToNeedRestart()
+	}
+}
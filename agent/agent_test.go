@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"x-ui/database"
+	"x-ui/util/pki"
+	"x-ui/web/service"
+	"x-ui/xray"
+)
+
+// testCA 测试用的私有CA
+type testCA struct {
+	certPem []byte
+	keyPem  []byte
+	pool    *x509.CertPool
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	certPem, keyPem, err := pki.GenerateCA(&pki.Options{CommonName: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPem)
+	return &testCA{certPem: certPem, keyPem: keyPem, pool: pool}
+}
+
+func (ca *testCA) issuePem(t *testing.T, commonName string, hosts ...string) ([]byte, []byte) {
+	t.Helper()
+	certPem, keyPem, err := pki.GenerateLeaf(&pki.Options{CommonName: commonName, Hosts: hosts}, ca.certPem, ca.keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPem, keyPem
+}
+
+func (ca *testCA) issue(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+	cert, err := tls.X509KeyPair(ca.issuePem(t, commonName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writeFile(t *testing.T, dir string, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestAgent 以 agent 的 TLS 配置和路由启动 HTTPS 服务，只允许 CommonName 为 controller 的控制端访问
+func newTestAgent(t *testing.T, ca *testCA) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	if err := database.InitDB(filepath.Join(dir, "x-ui.db")); err != nil {
+		t.Fatal(err)
+	}
+	certPem, keyPem := ca.issuePem(t, "agent-1", "127.0.0.1")
+	s := NewServer(&Config{
+		CertFile:       writeFile(t, dir, "agent.crt", certPem),
+		KeyFile:        writeFile(t, dir, "agent.key", keyPem),
+		CaFile:         writeFile(t, dir, "ca.crt", ca.certPem),
+		ControllerName: "controller",
+	})
+	tlsConfig, err := s.loadTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(s.initRouter())
+	server.TLS = tlsConfig
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckController(t *testing.T) {
+	ca := newTestCA(t, "node-ca")
+	server := newTestAgent(t, ca)
+
+	controllerCert := ca.issue(t, "controller")
+	otherNameCert := ca.issue(t, "agent-2")
+	otherCACert := newTestCA(t, "other-ca").issue(t, "controller")
+	cases := []struct {
+		name string
+		cert *tls.Certificate
+		// 为 0 时期望 TLS 握手失败
+		want int
+	}{
+		{"没有客户端证书", nil, 0},
+		{"其他CA签发的证书", &otherCACert, 0},
+		{"其他名称的证书", &otherNameCert, http.StatusForbidden},
+		{"控制端证书", &controllerCert, http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tlsConfig := &tls.Config{RootCAs: ca.pool}
+			if c.cert != nil {
+				cert := *c.cert
+				// 始终出示证书，不因CA不匹配而省略
+				tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &cert, nil
+				}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			resp, err := client.Post(server.URL+"/xui/inbound/list", "application/x-www-form-urlencoded", nil)
+			if c.want == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("TLS 握手成功，返回 %d", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != c.want {
+				t.Fatalf("返回 %d，期望 %d", resp.StatusCode, c.want)
+			}
+		})
+	}
+}
+
+// stoppedXrayService 模拟没有运行的 xray，只上报日志中已有的增量
+type stoppedXrayService struct {
+	service.XrayService
+}
+
+func (s *stoppedXrayService) IsXrayRunning() bool {
+	return false
+}
+
+func TestTrafficReporterRetriesWithSameSeq(t *testing.T) {
+	var mu sync.Mutex
+	seqs := make([]int64, 0)
+	fail := true
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		seq, _ := strconv.ParseInt(r.PostFormValue("seq"), 10, 64)
+		seqs = append(seqs, seq)
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"success":true}`))
+	}))
+	t.Cleanup(controller.Close)
+
+	r := newTrafficReporter(context.Background(), &stoppedXrayService{}, controller.URL, nil)
+	r.journalPath = filepath.Join(t.TempDir(), "agent-traffic.json")
+	r.accumulate([]*xray.Traffic{{IsInbound: true, Tag: "in-1", Up: 1, Down: 2}})
+
+	r.Run()
+	if r.journal.Batch == nil {
+		t.Fatal("上报失败后批次被丢弃")
+	}
+	// agent 重启后从日志继续上报同一批次
+	journal, err := loadTrafficJournal(r.journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if journal.Batch == nil || journal.Batch.Seq != r.journal.Batch.Seq {
+		t.Fatalf("日志中的批次为 %+v，期望 seq %d", journal.Batch, r.journal.Batch.Seq)
+	}
+
+	r.accumulate([]*xray.Traffic{{IsInbound: true, Tag: "in-1", Up: 3, Down: 4}})
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	r.Run()
+	if r.journal.Batch != nil {
+		t.Fatal("上报成功后批次没有清除")
+	}
+	r.Run()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seqs) != 3 || seqs[0] != seqs[1] || seqs[2] <= seqs[1] {
+		t.Fatalf("上报的 seq 为 %v，期望重试时不变，下一批递增", seqs)
+	}
+}
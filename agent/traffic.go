@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/config"
+	"x-ui/logger"
+	"x-ui/web/entity"
+	"x-ui/web/service"
+	"x-ui/xray"
+
+	"github.com/robfig/cron/v3"
+)
+
+const reportTimeout = 10 * time.Second
+
+// trafficBatch 已分配序号、等待控制端确认的一批增量，重试时序号不变，控制端据此去重
+type trafficBatch struct {
+	Seq      int64           `json:"seq"`
+	Traffics []*xray.Traffic `json:"traffics"`
+}
+
+// trafficJournal 未被控制端确认的增量，每次变化后写入磁盘，agent 重启后继续上报
+type trafficJournal struct {
+	LastSeq int64         `json:"lastSeq"`
+	Batch   *trafficBatch `json:"batch"`
+	// 按入站 tag 或客户端 email 合并的尚未分批的增量
+	Pending map[string]*xray.Traffic `json:"pending"`
+}
+
+// trafficReporter 采集本机流量写入数据库，并把增量上报控制端，上报失败的增量累积到下次一起上报
+type trafficReporter struct {
+	ctx         context.Context
+	xrayService service.XrayService
+	controller  string
+	httpClient  *http.Client
+	journalPath string
+
+	mu      sync.Mutex
+	journal *trafficJournal
+}
+
+// getJournalPath 增量日志与数据库放在同一目录
+func getJournalPath() string {
+	return filepath.Join(filepath.Dir(config.GetDBPath()), "agent-traffic.json")
+}
+
+func newTrafficReporter(ctx context.Context, xrayService service.XrayService, controller string, tlsConfig *tls.Config) *trafficReporter {
+	r := &trafficReporter{
+		ctx:         ctx,
+		xrayService: xrayService,
+		controller:  controller,
+		httpClient: &http.Client{
+			Timeout: reportTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+			},
+		},
+		journalPath: getJournalPath(),
+	}
+	journal, err := loadTrafficJournal(r.journalPath)
+	if err != nil {
+		logger.Warning("读取未上报的流量失败:", err)
+		journal = &trafficJournal{}
+	}
+	if journal.Pending == nil {
+		journal.Pending = map[string]*xray.Traffic{}
+	}
+	r.journal = journal
+	return r
+}
+
+func loadTrafficJournal(path string) (*trafficJournal, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &trafficJournal{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	journal := &trafficJournal{}
+	if err := json.Unmarshal(data, journal); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// save 先写临时文件再重命名，避免断电时留下不完整的日志
+func (r *trafficReporter) save() error {
+	data, err := json.Marshal(r.journal)
+	if err != nil {
+		return err
+	}
+	tmpPath := r.journalPath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, r.journalPath)
+}
+
+func (r *trafficReporter) Add(c *cron.Cron) error {
+	_, err := c.AddFunc("@every 10s", func() {
+		r.Run()
+	})
+	return err
+}
+
+func (r *trafficReporter) Run() {
+	defer service.ObserveJob("agent_traffic", time.Now())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.controller == "" {
+		// 不上报时流量已由 GetXrayTraffic 记入本机数据库
+		if r.xrayService.IsXrayRunning() {
+			if _, err := r.xrayService.GetXrayTraffic(); err != nil {
+				logger.Warning("get xray traffic failed:", err)
+			}
+		}
+		return
+	}
+	if r.xrayService.IsXrayRunning() {
+		traffics, err := r.xrayService.GetXrayTraffic()
+		if err != nil {
+			logger.Warning("get xray traffic failed:", err)
+		} else if r.accumulate(traffics) {
+			if err := r.save(); err != nil {
+				logger.Warning("保存未上报的流量失败:", err)
+			}
+		}
+	}
+	if r.journal.Batch == nil {
+		if len(r.journal.Pending) == 0 {
+			return
+		}
+		r.journal.Batch = r.nextBatch()
+		if err := r.save(); err != nil {
+			logger.Warning("保存未上报的流量失败:", err)
+		}
+	}
+	if err := r.report(r.journal.Batch); err != nil {
+		logger.Warning("上报流量到控制端失败:", err)
+		return
+	}
+	r.journal.Batch = nil
+	if err := r.save(); err != nil {
+		logger.Warning("保存未上报的流量失败:", err)
+	}
+}
+
+func (r *trafficReporter) accumulate(traffics []*xray.Traffic) bool {
+	changed := false
+	for _, traffic := range traffics {
+		if traffic.Up == 0 && traffic.Down == 0 {
+			continue
+		}
+		changed = true
+		key := fmt.Sprintf("%v|%v|%v", traffic.IsInbound, traffic.IsUser, traffic.Tag)
+		if pending, ok := r.journal.Pending[key]; ok {
+			pending.Up += traffic.Up
+			pending.Down += traffic.Down
+			continue
+		}
+		t := *traffic
+		r.journal.Pending[key] = &t
+	}
+	return changed
+}
+
+// nextBatch 把待上报的增量分为一批，序号取毫秒时间戳且大于上一批，日志丢失后序号仍然递增
+func (r *trafficReporter) nextBatch() *trafficBatch {
+	seq := time.Now().UnixMilli()
+	if seq <= r.journal.LastSeq {
+		seq = r.journal.LastSeq + 1
+	}
+	r.journal.LastSeq = seq
+	batch := &trafficBatch{
+		Seq:      seq,
+		Traffics: make([]*xray.Traffic, 0, len(r.journal.Pending)),
+	}
+	for _, traffic := range r.journal.Pending {
+		batch.Traffics = append(batch.Traffics, traffic)
+	}
+	r.journal.Pending = map[string]*xray.Traffic{}
+	return batch
+}
+
+func (r *trafficReporter) report(batch *trafficBatch) error {
+	data, err := json.Marshal(batch.Traffics)
+	if err != nil {
+		return err
+	}
+	form := url.Values{}
+	form.Set("seq", strconv.FormatInt(batch.Seq, 10))
+	form.Set("traffics", string(data))
+
+	u := strings.TrimSuffix(r.controller, "/") + "/node/agent/traffic"
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("控制端返回 HTTP %d", resp.StatusCode)
+	}
+	msg := entity.Msg{}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return fmt.Errorf("控制端返回的数据无效: %w", err)
+	}
+	if !msg.Success {
+		return errors.New(msg.Msg)
+	}
+	return nil
+}
@@ -48,3 +48,11 @@ func IsDebug() bool {
 func GetDBPath() string {
 	return fmt.Sprintf("/etc/%s/%s.db", GetName(), GetName())
 }
+
+// GetCertDir 面板管理的证书文件目录，可通过 XUI_CERT_DIR 修改
+func GetCertDir() string {
+	if dir := os.Getenv("XUI_CERT_DIR"); dir != "" {
+		return dir
+	}
+	return fmt.Sprintf("/etc/%s/certs", GetName())
+}
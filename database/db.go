@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"strings"
 	"x-ui/config"
 	"x-ui/database/model"
 )
@@ -34,13 +35,129 @@ func initUser() error {
 }
 
 func initInbound() error {
-	return db.AutoMigrate(&model.Inbound{})
+	err := db.AutoMigrate(&model.Inbound{})
+	if err != nil {
+		return err
+	}
+	return dropInboundPortUnique()
+}
+
+// dropInboundPortUnique 删除旧版本在 port 上建立的唯一约束，不同监听地址的入站可以使用相同端口。
+// AutoMigrate 不会删除已有的唯一约束，列约束无法单独删除，需要重建表
+func dropInboundPortUnique() error {
+	var indexes []struct {
+		Name   string
+		Unique bool
+		Origin string
+	}
+	err := db.Raw("PRAGMA index_list(`inbounds`)").Scan(&indexes).Error
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if !index.Unique {
+			continue
+		}
+		var columns []string
+		err = db.Raw("SELECT name FROM pragma_index_info(?)", index.Name).Scan(&columns).Error
+		if err != nil {
+			return err
+		}
+		if len(columns) != 1 || columns[0] != "port" {
+			continue
+		}
+		if index.Origin == "c" {
+			err = db.Migrator().DropIndex(&model.Inbound{}, index.Name)
+		} else {
+			err = rebuildInboundTable()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildInboundTable 按当前模型重建入站表并复制原有数据
+func rebuildInboundTable() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Migrator().RenameTable("inbounds", "inbounds_old")
+		if err != nil {
+			return err
+		}
+		err = tx.Migrator().CreateTable(&model.Inbound{})
+		if err != nil {
+			return err
+		}
+		columns, err := tx.Migrator().ColumnTypes(&model.Inbound{})
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(columns))
+		for _, column := range columns {
+			names = append(names, "`"+column.Name()+"`")
+		}
+		list := strings.Join(names, ",")
+		err = tx.Exec("INSERT INTO `inbounds` (" + list + ") SELECT " + list + " FROM `inbounds_old`").Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable("inbounds_old")
+	})
 }
 
 func initSetting() error {
 	return db.AutoMigrate(&model.Setting{})
 }
 
+func initClientIpBlock() error {
+	return db.AutoMigrate(&model.ClientIpBlock{})
+}
+
+func initWebhook() error {
+	return db.AutoMigrate(&model.Webhook{}, &model.WebhookDelivery{})
+}
+
+func initReminderLog() error {
+	return db.AutoMigrate(&model.ReminderLog{})
+}
+
+func initCertificate() error {
+	return db.AutoMigrate(&model.Certificate{})
+}
+
+func initNode() error {
+	return db.AutoMigrate(&model.Node{}, &model.NodeSnapshot{}, &model.NodeTraffic{})
+}
+
+func initInboundFallback() error {
+	return db.AutoMigrate(&model.InboundFallback{})
+}
+
+func initTrafficJournal() error {
+	return db.AutoMigrate(&model.TrafficJournal{})
+}
+
+func initClientTraffic() error {
+	return db.AutoMigrate(&model.ClientTraffic{})
+}
+
+func initOutboundTraffic() error {
+	return db.AutoMigrate(&model.OutboundTraffic{}, &model.OutboundTrafficHistory{})
+}
+
+func initBalancer() error {
+	return db.AutoMigrate(&model.Balancer{})
+}
+
+func initWireGuardOutbound() error {
+	return db.AutoMigrate(&model.WireGuardOutbound{})
+}
+
+func initGeoCustomList() error {
+	return db.AutoMigrate(&model.GeoCustomList{})
+}
+
 func InitDB(dbPath string) error {
 	dir := path.Dir(dbPath)
 	err := os.MkdirAll(dir, fs.ModeDir)
@@ -76,6 +193,54 @@ func InitDB(dbPath string) error {
 	if err != nil {
 		return err
 	}
+	err = initClientIpBlock()
+	if err != nil {
+		return err
+	}
+	err = initWebhook()
+	if err != nil {
+		return err
+	}
+	err = initReminderLog()
+	if err != nil {
+		return err
+	}
+	err = initCertificate()
+	if err != nil {
+		return err
+	}
+	err = initInboundFallback()
+	if err != nil {
+		return err
+	}
+	err = initNode()
+	if err != nil {
+		return err
+	}
+	err = initTrafficJournal()
+	if err != nil {
+		return err
+	}
+	err = initClientTraffic()
+	if err != nil {
+		return err
+	}
+	err = initOutboundTraffic()
+	if err != nil {
+		return err
+	}
+	err = initBalancer()
+	if err != nil {
+		return err
+	}
+	err = initWireGuardOutbound()
+	if err != nil {
+		return err
+	}
+	err = initGeoCustomList()
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
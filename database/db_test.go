@@ -0,0 +1,52 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"x-ui/database/model"
+)
+
+// 旧版本在 port 上建立的列唯一约束和唯一索引
+var legacyInboundTables = map[string]string{
+	"column": "CREATE TABLE `inbounds` (`id` integer,`port` integer UNIQUE,`tag` text UNIQUE,`remark` text,PRIMARY KEY (`id`))",
+	"index":  "CREATE TABLE `inbounds` (`id` integer,`port` integer,`tag` text UNIQUE,`remark` text,PRIMARY KEY (`id`)); CREATE UNIQUE INDEX `idx_inbounds_port` ON `inbounds`(`port`)",
+}
+
+func TestInitDBDropsInboundPortUnique(t *testing.T) {
+	for name, ddl := range legacyInboundTables {
+		t.Run(name, func(t *testing.T) {
+			dbPath := filepath.Join(t.TempDir(), "x-ui.db")
+			if err := InitDB(dbPath); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Migrator().DropTable("inbounds"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Exec(ddl).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Exec("INSERT INTO `inbounds` (`id`,`port`,`tag`,`remark`) VALUES (7,1000,'inbound-1000','old')").Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if err := InitDB(dbPath); err != nil {
+				t.Fatal(err)
+			}
+			old := &model.Inbound{}
+			if err := db.First(old, 7).Error; err != nil {
+				t.Fatal(err)
+			}
+			if old.Port != 1000 || old.Tag != "inbound-1000" || old.Remark != "old" {
+				t.Fatalf("existing inbound not preserved: %+v", old)
+			}
+			inbound := &model.Inbound{Listen: "127.0.0.2", Port: 1000, Tag: "inbound-127.0.0.2:1000"}
+			if err := db.Create(inbound).Error; err != nil {
+				t.Fatalf("inbound with a used port on another listen address rejected: %v", err)
+			}
+			duplicate := &model.Inbound{Port: 2000, Tag: "inbound-1000"}
+			if err := db.Create(duplicate).Error; err == nil {
+				t.Fatal("duplicate tag accepted")
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"x-ui/util/json_util"
 	"x-ui/xray"
 )
@@ -15,6 +18,9 @@ const (
 	Http        Protocol = "http"
 	Trojan      Protocol = "trojan"
 	Shadowsocks Protocol = "shadowsocks"
+	Socks       Protocol = "socks"
+	WireGuard   Protocol = "wireguard"
+	Tunnel      Protocol = "tunnel"
 )
 
 type User struct {
@@ -32,31 +38,165 @@ type Inbound struct {
 	Remark     string `json:"remark" form:"remark"`
 	Enable     bool   `json:"enable" form:"enable"`
 	ExpiryTime int64  `json:"expiryTime" form:"expiryTime"`
+	// 接收到期和流量提醒的邮箱，可选
+	Email string `json:"email" form:"email"`
 
 	// config part
-	Listen         string   `json:"listen" form:"listen"`
-	Port           int      `json:"port" form:"port" gorm:"unique"`
+	// 监听地址，多个地址用逗号分隔，以 / 或 @ 开头的是 Unix domain socket
+	Listen string `json:"listen" form:"listen"`
+	// 单个端口，设置 PortRange 时为范围中的第一个端口
+	Port int `json:"port" form:"port"`
+	// 端口范围，如 "1000-2000" 或 "80,443"，不为空时代替 Port
+	PortRange      string   `json:"portRange" form:"portRange"`
 	Protocol       Protocol `json:"protocol" form:"protocol"`
 	Settings       string   `json:"settings" form:"settings"`
 	StreamSettings string   `json:"streamSettings" form:"streamSettings"`
-	Tag            string   `json:"tag" form:"tag" gorm:"unique"`
-	Sniffing       string   `json:"sniffing" form:"sniffing"`
+	// 不随端口变化，供路由规则和流量统计引用
+	Tag      string `json:"tag" form:"tag" gorm:"unique"`
+	Sniffing string `json:"sniffing" form:"sniffing"`
 }
 
-func (i *Inbound) GenXrayInboundConfig() *xray.InboundConfig {
-	listen := i.Listen
-	if listen != "" {
-		listen = fmt.Sprintf("\"%v\"", listen)
+// ListenTagSeparator 多监听地址时，除第一个地址外的入站 tag 为 "<tag>@<序号>"
+const ListenTagSeparator = "@"
+
+// BaseInboundTag 去掉多监听地址附加的序号，返回数据库中的入站 tag。
+// 只识别 "@<数字>" 后缀，旧版本保存的含 @ 的 tag 原样返回
+func BaseInboundTag(tag string) string {
+	i := strings.LastIndex(tag, ListenTagSeparator)
+	if i <= 0 {
+		return tag
+	}
+	if _, err := strconv.Atoi(tag[i+len(ListenTagSeparator):]); err != nil {
+		return tag
+	}
+	return tag[:i]
+}
+
+// IsUnixListen 监听地址是否为 Unix domain socket，@ 开头为抽象命名空间
+func IsUnixListen(listen string) bool {
+	return strings.HasPrefix(listen, "/") || strings.HasPrefix(listen, "@")
+}
+
+// GetListens 返回所有监听地址，未设置时返回一个空地址表示监听所有网卡
+func (i *Inbound) GetListens() []string {
+	listens := make([]string, 0)
+	for _, listen := range strings.Split(i.Listen, ",") {
+		if listen = strings.TrimSpace(listen); listen != "" {
+			listens = append(listens, listen)
+		}
+	}
+	if len(listens) == 0 {
+		listens = append(listens, "")
+	}
+	return listens
+}
+
+// GetPortString 返回 xray 格式的端口
+func (i *Inbound) GetPortString() string {
+	if i.PortRange != "" {
+		return i.PortRange
+	}
+	return strconv.Itoa(i.Port)
+}
+
+// GetPorts 解析入站占用的所有端口范围
+func (i *Inbound) GetPorts() ([]xray.PortRange, error) {
+	return xray.ParsePortList(i.GetPortString())
+}
+
+// GenXrayInboundConfigs 每个监听地址生成一个入站配置，Unix domain socket 不设置端口
+func (i *Inbound) GenXrayInboundConfigs() []*xray.InboundConfig {
+	port := json_util.RawMessage(strconv.Itoa(i.Port))
+	if i.PortRange != "" {
+		port = json_util.RawMessage(strconv.Quote(i.PortRange))
+	}
+	configs := make([]*xray.InboundConfig, 0)
+	for index, listen := range i.GetListens() {
+		config := &xray.InboundConfig{
+			Port:           port,
+			Protocol:       string(i.Protocol),
+			Settings:       json_util.RawMessage(i.Settings),
+			StreamSettings: json_util.RawMessage(i.StreamSettings),
+			Tag:            i.Tag,
+			Sniffing:       json_util.RawMessage(i.Sniffing),
+		}
+		if listen != "" {
+			config.Listen = json_util.RawMessage(strconv.Quote(listen))
+		}
+		if IsUnixListen(listen) {
+			config.Port = nil
+		}
+		if index > 0 {
+			config.Tag = fmt.Sprintf("%v%v%d", i.Tag, ListenTagSeparator, index)
+		}
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// GetStreamSettings 解析传输设置，为空时返回空结构
+func (i *Inbound) GetStreamSettings() (*xray.StreamSettings, error) {
+	stream := &xray.StreamSettings{}
+	if strings.TrimSpace(i.StreamSettings) == "" {
+		return stream, nil
+	}
+	if err := json.Unmarshal([]byte(i.StreamSettings), stream); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (i *Inbound) SetStreamSettings(stream *xray.StreamSettings) error {
+	data, err := json.Marshal(stream)
+	if err != nil {
+		return err
+	}
+	i.StreamSettings = string(data)
+	return nil
+}
+
+// GetSettings 按协议解析设置，返回 xray 包中对应的结构指针
+func (i *Inbound) GetSettings() (interface{}, error) {
+	settings := xray.NewInboundSettings(string(i.Protocol))
+	if settings == nil {
+		return nil, fmt.Errorf("不支持的协议: %v", i.Protocol)
+	}
+	if err := json.Unmarshal([]byte(i.Settings), settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (i *Inbound) SetSettings(settings interface{}) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	i.Settings = string(data)
+	return nil
+}
+
+// GetClients 获取客户端列表，协议没有客户端时返回空
+func (i *Inbound) GetClients() ([]*xray.Client, error) {
+	settings, err := i.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	if clientSettings, ok := settings.(xray.ClientSettings); ok {
+		return clientSettings.GetClients(), nil
+	}
+	return nil, nil
+}
+
+func (i *Inbound) GetSniffing() (*xray.Sniffing, error) {
+	sniffing := &xray.Sniffing{}
+	if strings.TrimSpace(i.Sniffing) == "" {
+		return sniffing, nil
 	}
-	return &xray.InboundConfig{
-		Listen:         json_util.RawMessage(listen),
-		Port:           i.Port,
-		Protocol:       string(i.Protocol),
-		Settings:       json_util.RawMessage(i.Settings),
-		StreamSettings: json_util.RawMessage(i.StreamSettings),
-		Tag:            i.Tag,
-		Sniffing:       json_util.RawMessage(i.Sniffing),
+	if err := json.Unmarshal([]byte(i.Sniffing), sniffing); err != nil {
+		return nil, err
 	}
+	return sniffing, nil
 }
 
 type Setting struct {
@@ -64,3 +204,202 @@ type Setting struct {
 	Key   string `json:"key" form:"key"`
 	Value string `json:"value" form:"value"`
 }
+
+// ClientIpBlock 记录因超出IP数量限制而被临时封禁的客户端IP
+type ClientIpBlock struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	InboundTag string `json:"inboundTag"`
+	Email      string `json:"email"`
+	Ip         string `json:"ip"`
+	CreatedAt  int64  `json:"createdAt"`
+	ExpiryTime int64  `json:"expiryTime"`
+}
+
+// Webhook 接收面板事件的HTTP端点
+type Webhook struct {
+	Id     int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name   string `json:"name" form:"name"`
+	Url    string `json:"url" form:"url"`
+	Secret string `json:"secret" form:"secret"`
+	// 订阅的事件类型，逗号分隔，为空表示订阅全部
+	Events string `json:"events" form:"events"`
+	Enable bool   `json:"enable" form:"enable"`
+}
+
+// WebhookDelivery Webhook 每次投递的记录
+type WebhookDelivery struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	WebhookId  int    `json:"webhookId" gorm:"index"`
+	EventType  string `json:"eventType"`
+	Payload    string `json:"payload"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"statusCode"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+// ReminderLog 已发送的提醒，避免重复发送
+type ReminderLog struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	InboundId int    `json:"inboundId" gorm:"index"`
+	Email     string `json:"email"` // 收件人，每个收件人单独提醒
+	Kind      string `json:"kind"`
+	Threshold int    `json:"threshold"`
+	// 发送时的到期时间或流量上限，修改后重新提醒
+	Reference int64 `json:"reference"`
+	CreatedAt int64 `json:"createdAt"`
+}
+
+// TrafficJournal 已从 xray 读出并清零、尚未累加到入站的流量，累加和删除在同一事务中完成
+type TrafficJournal struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	IsInbound bool   `json:"isInbound"`
+	IsUser    bool   `json:"isUser"`
+	Tag       string `json:"tag"`
+	Up        int64  `json:"up"`
+	Down      int64  `json:"down"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// ClientTraffic 客户端的累计流量，Email 为生成的 xray 配置中的客户端 email，即 "<入站 tag>|<email>"，
+// 旧版本的记录只有 email
+type ClientTraffic struct {
+	Id    int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email string `json:"email" gorm:"unique"`
+	Up    int64  `json:"up"`
+	Down  int64  `json:"down"`
+}
+
+// OutboundTraffic 出站的累计流量
+type OutboundTraffic struct {
+	Id   int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Tag  string `json:"tag" gorm:"unique"`
+	Up   int64  `json:"up"`
+	Down int64  `json:"down"`
+}
+
+// OutboundTrafficHistory 出站每小时的流量
+type OutboundTrafficHistory struct {
+	Id   int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Tag  string `json:"tag" gorm:"uniqueIndex:idx_outbound_hour"`
+	Hour int64  `json:"hour" gorm:"uniqueIndex:idx_outbound_hour"` // 整点的毫秒时间戳
+	Up   int64  `json:"up"`
+	Down int64  `json:"down"`
+}
+
+// Balancer 面板管理的负载均衡器，生成 xray 配置时写入 routing.balancers
+type Balancer struct {
+	Id       int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Tag      string `json:"tag" form:"tag" gorm:"unique"`
+	Selector string `json:"selector" form:"selector"` // 出站 tag 前缀，逗号分隔
+	// random、roundRobin、leastPing 或 leastLoad，后两者需要观测出站
+	Strategy    string `json:"strategy" form:"strategy"`
+	FallbackTag string `json:"fallbackTag" form:"fallbackTag"` // 所有出站都不可用时使用的出站
+	Enable      bool   `json:"enable" form:"enable"`
+}
+
+// WireGuardOutbound 面板管理的 WireGuard 出站，如 Cloudflare WARP，Domains 中的流量经该出站转发
+type WireGuardOutbound struct {
+	Id            int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Tag           string `json:"tag" form:"tag" gorm:"unique"`
+	SecretKey     string `json:"secretKey" form:"secretKey"`
+	Address       string `json:"address" form:"address"` // 本端地址，逗号分隔的 CIDR
+	PeerPublicKey string `json:"peerPublicKey" form:"peerPublicKey"`
+	PreSharedKey  string `json:"preSharedKey" form:"preSharedKey"`
+	Endpoint      string `json:"endpoint" form:"endpoint"`
+	Reserved      string `json:"reserved" form:"reserved"` // WARP 的 client_id，逗号分隔的 3 个字节
+	MTU           int    `json:"mtu" form:"mtu"`
+	// 路由到该出站的域名，逗号分隔，支持 xray 的 domain:、full:、geosite: 等前缀
+	Domains string `json:"domains" form:"domains"`
+	Enable  bool   `json:"enable" form:"enable"`
+
+	// 通过面板注册的 WARP 设备，删除出站时用于注销
+	WarpDeviceId string `json:"warpDeviceId" form:"-"`
+	WarpToken    string `json:"-" form:"-"`
+}
+
+// GeoCustomList 自定义的域名或 IP 列表，编译到 custom.dat 后在路由中以 ext:custom.dat:tag 引用
+type GeoCustomList struct {
+	Id      int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Tag     string `json:"tag" form:"tag" gorm:"unique"`
+	Type    string `json:"type" form:"type"`       // domain 或 ip
+	Entries string `json:"entries" form:"entries"` // 每行一条，域名支持 domain:、full:、keyword:、regexp: 前缀
+	Remark  string `json:"remark" form:"remark"`
+}
+
+// InboundFallback VLESS/Trojan 入站的回落，目标为其他入站或 Dest 指定的本地服务
+type InboundFallback struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	InboundId int    `json:"inboundId" gorm:"index"`
+	Name      string `json:"name"` // 匹配 SNI
+	Alpn      string `json:"alpn"`
+	Path      string `json:"path"`
+	// 回落到的入站ID，为 0 时使用 Dest
+	TargetId int `json:"targetId"`
+	// 端口、地址:端口或 Unix domain socket 路径，如 80、127.0.0.1:8080、/dev/shm/nginx.sock
+	Dest string `json:"dest"`
+	Xver int    `json:"xver"`
+}
+
+// Certificate 面板管理的证书，可由入站 TLS 设置按名称引用
+type Certificate struct {
+	Id          int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string `json:"name" form:"name" gorm:"unique"`
+	Domains     string `json:"domains" form:"domains"` // 逗号分隔
+	Source      string `json:"source" form:"source"`
+	Challenge   string `json:"challenge" form:"challenge"`
+	DnsProvider string `json:"dnsProvider" form:"dnsProvider"`
+	DnsConfig   string `json:"dnsConfig" form:"dnsConfig"` // DNS服务商配置，JSON对象
+	AutoRenew   bool   `json:"autoRenew" form:"autoRenew"`
+	CertPem     string `json:"certPem" form:"certPem"`
+	KeyPem      string `json:"-" form:"keyPem"`
+	NotBefore   int64  `json:"notBefore"`
+	NotAfter    int64  `json:"notAfter"`
+	LastError   string `json:"lastError"`
+}
+
+const (
+	// NodeModePanel 完整的远程面板，通过 API Token 访问
+	NodeModePanel = "panel"
+	// NodeModeAgent 以 x-ui agent 运行的无界面节点，通过双向 TLS 访问，名称必须与其证书的 CommonName 一致
+	NodeModeAgent = "agent"
+)
+
+// Node 由本面板集中管理的远程 x-ui 面板或 agent
+type Node struct {
+	Id     int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name   string `json:"name" form:"name" gorm:"unique"`
+	Mode   string `json:"mode" form:"mode"`
+	Url    string `json:"url" form:"url"` // 远程面板地址，包含 basePath，如 https://example.com:54321/
+	Token  string `json:"-" form:"token"`
+	Enable bool   `json:"enable" form:"enable"`
+	// 最近一次同步的结果
+	Online    bool   `json:"online"`
+	Latency   int64  `json:"latency"` // 毫秒
+	LastError string `json:"lastError"`
+	LastSync  int64  `json:"lastSync"` // 最近一次同步成功的时间，毫秒时间戳
+	// agent 最近一次已累加的流量上报序号，重复上报的序号不再累加
+	TrafficSeq int64 `json:"-"`
+}
+
+// NodeSnapshot 最近一次同步成功时从节点拉取的状态和入站，Data 为 JSON
+type NodeSnapshot struct {
+	NodeId   int    `json:"nodeId" gorm:"primaryKey;autoIncrement:false"`
+	Data     string `json:"data"`
+	SyncTime int64  `json:"syncTime"`
+}
+
+// NodeTraffic agent 节点上报的入站和客户端累计流量
+type NodeTraffic struct {
+	Id     int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	NodeId int    `json:"nodeId" gorm:"uniqueIndex:idx_node_traffic"`
+	IsUser bool   `json:"isUser" gorm:"uniqueIndex:idx_node_traffic"`
+	Tag    string `json:"tag" gorm:"uniqueIndex:idx_node_traffic"` // 入站 tag 或客户端 email
+	Up     int64  `json:"up"`
+	Down   int64  `json:"down"`
+}
+
+func (n *Node) IsAgent() bool {
+	return n.Mode == NodeModeAgent
+}
@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
-	"strings"
+	"x-ui/util/keygen"
+	"x-ui/xray"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -31,62 +31,9 @@ type Inbound struct {
 	Sniffing       string `json:"sniffing"`
 }
 
-// Reality配置结构
-type RealitySettings struct {
-	Show         bool     `json:"show"`
-	Dest         string   `json:"dest"`
-	Xver         int      `json:"xver"`
-	ServerNames  string   `json:"serverNames"`
-	PrivateKey   string   `json:"privateKey"`
-	MinClientVer string   `json:"minClientVer"`
-	MaxClientVer string   `json:"maxClientVer"`
-	MaxTimeDiff  int      `json:"maxTimeDiff"`
-	ShortIds     []string `json:"shortIds"`
-	Settings     struct {
-		PublicKey   string `json:"publicKey"`
-		Fingerprint string `json:"fingerprint"`
-		ServerName  string `json:"serverName"`
-		SpiderX     string `json:"spiderX"`
-	} `json:"settings"`
-}
-
-// StreamSettings结构
-type StreamSettings struct {
-	Network     string           `json:"network"`
-	Security    string           `json:"security"`
-	TlsSettings json.RawMessage  `json:"tlsSettings,omitempty"`
-	Reality     *RealitySettings `json:"realitySettings,omitempty"`
-	// 其他字段省略
-}
-
 // 生成Reality密钥对
 func generateRealityKeyPair() (string, string, error) {
-	// 调用xray命令生成密钥对
-	cmd := exec.Command("xray", "x25519")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", "", err
-	}
-
-	// 解析输出
-	outputStr := string(output)
-	lines := strings.Split(outputStr, "\n")
-
-	// 提取私钥和公钥
-	var privateKey, publicKey string
-	for _, line := range lines {
-		if strings.Contains(line, "Private key:") {
-			privateKey = strings.TrimSpace(strings.TrimPrefix(line, "Private key:"))
-		} else if strings.Contains(line, "Public key:") {
-			publicKey = strings.TrimSpace(strings.TrimPrefix(line, "Public key:"))
-		}
-	}
-
-	if privateKey == "" || publicKey == "" {
-		return "", "", fmt.Errorf("无法生成Reality密钥对")
-	}
-
-	return privateKey, publicKey, nil
+	return keygen.GenerateX25519()
 }
 
 func main() {
@@ -140,8 +87,9 @@ func main() {
 			continue
 		}
 
-		var streamSettings StreamSettings
-		err = json.Unmarshal([]byte(inbound.StreamSettings), &streamSettings)
+		// 使用面板的传输设置结构，保留未知字段
+		streamSettings := &xray.StreamSettings{}
+		err = json.Unmarshal([]byte(inbound.StreamSettings), streamSettings)
 		if err != nil {
 			fmt.Printf("解析入站配置#%d流设置失败，跳过: %v\n", inbound.Id, err)
 			continue
@@ -155,9 +103,11 @@ func main() {
 		fmt.Printf("正在处理入站配置 #%d (%s)...\n", inbound.Id, inbound.Remark)
 
 		// 检查是否需要修复Reality配置
-		if streamSettings.Reality == nil ||
-			streamSettings.Reality.PrivateKey == "" ||
-			streamSettings.Reality.Settings.PublicKey == "" {
+		reality := streamSettings.RealitySettings
+		if reality == nil ||
+			reality.PrivateKey == "" ||
+			reality.Settings == nil ||
+			reality.Settings.PublicKey == "" {
 
 			fmt.Printf("  检测到Reality密钥丢失，正在生成新密钥...\n")
 
@@ -169,22 +119,26 @@ func main() {
 			}
 
 			// 如果Reality结构为nil，需要初始化
-			if streamSettings.Reality == nil {
-				streamSettings.Reality = &RealitySettings{
+			if reality == nil {
+				reality = &xray.RealitySettings{
 					Show:        true,
 					Dest:        "www.microsoft.com:443",
-					ServerNames: "www.microsoft.com",
+					ServerNames: []string{"www.microsoft.com"},
 					ShortIds:    []string{""},
 				}
+				streamSettings.RealitySettings = reality
+			}
+			if reality.Settings == nil {
+				reality.Settings = &xray.RealityClientSettings{}
 			}
 
 			// 更新密钥
-			streamSettings.Reality.PrivateKey = privateKey
-			streamSettings.Reality.Settings.PublicKey = publicKey
+			reality.PrivateKey = privateKey
+			reality.Settings.PublicKey = publicKey
 
 			// 如果fingerprint为空，设置为默认值
-			if streamSettings.Reality.Settings.Fingerprint == "" {
-				streamSettings.Reality.Settings.Fingerprint = "chrome"
+			if reality.Settings.Fingerprint == "" {
+				reality.Settings.Fingerprint = "chrome"
 			}
 
 			// 更新流设置
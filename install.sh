@@ -216,6 +216,19 @@ install_x-ui() {
     cd x-ui
     chmod +x x-ui bin/xray-linux-${arch}
     cp -f x-ui.service /etc/systemd/system/
+    # 面板只增量读取访问日志，由 logrotate 控制大小；保留未压缩的 access.log.1 供面板读完轮转前的记录
+    cat > /etc/logrotate.d/x-ui <<EOF
+/usr/local/x-ui/bin/access.log {
+    daily
+    maxsize 20M
+    rotate 2
+    copytruncate
+    compress
+    delaycompress
+    missingok
+    notifempty
+}
+EOF
     
     echo -e "${yellow}开始下载脚本文件...${plain}"
     wget --no-check-certificate -O /usr/bin/x-ui https://raw.githubusercontent.com/875706361/x-ui_he/master/x-ui.sh
@@ -11,9 +11,11 @@ import (
 	"syscall"
 	"time"
 	_ "unsafe"
+	"x-ui/agent"
 	"x-ui/config"
 	"x-ui/database"
 	"x-ui/logger"
+	"x-ui/util/sys"
 	"x-ui/v2ui"
 	"x-ui/web"
 	"x-ui/web/global"
@@ -90,8 +92,11 @@ func runWebServer() {
 		if err := server.Start(); err != nil {
 			logger.Error("启动服务器失败: %v", err)
 			cancel()
+			return
 		}
+		notifyReady()
 	}()
+	go runWatchdog(ctx)
 
 	// 监听系统信号
 	sigCh := make(chan os.Signal, 1)
@@ -104,6 +109,7 @@ func runWebServer() {
 			case syscall.SIGHUP:
 				// 重新加载配置
 				logger.Info("接收到 SIGHUP 信号，重新加载服务...")
+				sys.SdNotify(sys.SdNotifyReloading)
 				if err := server.Stop(); err != nil {
 					logger.Warning("停止服务器失败:", err)
 				}
@@ -113,11 +119,14 @@ func runWebServer() {
 					if err := server.Start(); err != nil {
 						logger.Error("重启服务器失败: %v", err)
 						cancel()
+						return
 					}
+					notifyReady()
 				}()
 			default:
 				// 优雅关闭
 				logger.Info("接收到信号 %v，开始优雅关闭...", sig)
+				sys.SdNotify(sys.SdNotifyStopping)
 				shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 				defer shutdownCancel()
 
@@ -141,6 +150,71 @@ func runWebServer() {
 	}
 }
 
+// runWatchdog 在启用 WatchdogSec 时定期向 systemd 发送心跳，面板不健康时停止发送
+func runWatchdog(ctx context.Context) {
+	interval := sys.SdWatchdogInterval()
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			server, ok := global.GetWebServer().(*web.Server)
+			if !ok || !server.IsHealthy() {
+				logger.Warning("面板健康检查失败，跳过 watchdog 通知")
+				continue
+			}
+			if _, err := sys.SdNotify(sys.SdNotifyWatchdog); err != nil {
+				logger.Warning("发送 watchdog 通知失败:", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// notifyReady 服务器启动完成后通知 systemd
+func notifyReady() {
+	if _, err := sys.SdNotify(sys.SdNotifyReady); err != nil {
+		logger.Warning("发送 systemd 就绪通知失败:", err)
+	}
+}
+
+// runAgent 以无界面的 agent 运行，只启动 xray、流量采集和供控制端访问的 API
+func runAgent(agentConfig *agent.Config) {
+	log.Printf("%v agent %v (构建时间: %v)", config.GetName(), version, buildTime)
+
+	if agentConfig.CertFile == "" || agentConfig.KeyFile == "" || agentConfig.CaFile == "" {
+		log.Fatal("agent 必须指定证书、私钥和CA证书")
+	}
+	if err := initEnvironment(); err != nil {
+		log.Fatal("初始化环境失败:", err)
+	}
+	if err := initLogger(); err != nil {
+		log.Fatal("初始化日志失败:", err)
+	}
+	if err := database.InitDB(config.GetDBPath()); err != nil {
+		log.Fatal("初始化数据库失败:", err)
+	}
+
+	server := agent.NewServer(agentConfig)
+	if err := server.Start(); err != nil {
+		log.Fatal("启动 agent 失败:", err)
+	}
+	notifyReady()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	sig := <-sigCh
+	logger.Info("接收到信号 %v，停止 agent...", sig)
+	sys.SdNotify(sys.SdNotifyStopping)
+	if err := server.Stop(); err != nil {
+		logger.Error("停止 agent 时发生错误: %v", err)
+	}
+}
+
 func resetSetting() {
 	if err := database.InitDB(config.GetDBPath()); err != nil {
 		fmt.Printf("初始化数据库失败: %v\n", err)
@@ -194,6 +268,32 @@ func updateSetting(port int, username string, password string) {
 	}
 }
 
+func generateCert(opts *service.CertGenerateOptions) {
+	if err := database.InitDB(config.GetDBPath()); err != nil {
+		fmt.Printf("初始化数据库失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	certService := service.CertService{}
+	cert, err := certService.GenerateCertificate(opts)
+	if err != nil {
+		if cert != nil {
+			// 证书已保存到证书库，只是应用失败
+			fmt.Printf("证书 %v 已保存，但应用到 %v 失败: %v\n", cert.Name, opts.Apply, err)
+		} else {
+			fmt.Printf("生成证书失败: %v\n", err)
+		}
+		os.Exit(1)
+	}
+	certFile, keyFile := service.GetCertPaths(cert.Name)
+	fmt.Printf("生成证书 %v 成功，有效期至 %v\n", cert.Name, time.UnixMilli(cert.NotAfter).Format("2006-01-02 15:04:05"))
+	fmt.Println("证书文件:", certFile)
+	fmt.Println("私钥文件:", keyFile)
+	if opts.Apply != "" {
+		fmt.Println("已应用到", opts.Apply, "，重启面板后生效")
+	}
+}
+
 func showBanner() {
 	banner := `
 ██╗  ██╗      ██╗   ██╗██╗
@@ -242,6 +342,27 @@ func main() {
 	settingCmd.StringVar(&username, "username", "", "设置登录用户名")
 	settingCmd.StringVar(&password, "password", "", "设置登录密码")
 
+	certCmd := flag.NewFlagSet("cert", flag.ExitOnError)
+	certOpts := &service.CertGenerateOptions{}
+	certCmd.StringVar(&certOpts.Name, "name", "", "证书名称")
+	certCmd.StringVar(&certOpts.Type, "type", service.CertSourceSelfSigned, "证书类型: selfsigned、ca、localca")
+	certCmd.StringVar(&certOpts.CaName, "ca", "", "签发证书的私有CA名称，type 为 localca 时使用")
+	certCmd.StringVar(&certOpts.CommonName, "cn", "", "CommonName，默认使用第一个域名")
+	certCmd.StringVar(&certOpts.Hosts, "hosts", "", "域名或IP，逗号分隔")
+	certCmd.StringVar(&certOpts.KeyType, "key", "ecdsa", "密钥类型: ecdsa、rsa")
+	certCmd.IntVar(&certOpts.KeyBits, "bits", 0, "密钥长度，默认 ECDSA P-256、RSA 2048")
+	certCmd.IntVar(&certOpts.ValidDays, "days", 365, "有效天数")
+	certCmd.StringVar(&certOpts.Apply, "apply", "", "应用到 panel 或入站ID")
+
+	agentCmd := flag.NewFlagSet("agent", flag.ExitOnError)
+	agentConfig := &agent.Config{}
+	agentCmd.StringVar(&agentConfig.Listen, "listen", "0.0.0.0:54322", "监听地址")
+	agentCmd.StringVar(&agentConfig.CertFile, "cert", "", "agent 证书文件，需由 -ca 签发，同时用作客户端证书")
+	agentCmd.StringVar(&agentConfig.KeyFile, "key", "", "agent 私钥文件")
+	agentCmd.StringVar(&agentConfig.CaFile, "ca", "", "签发控制端和 agent 证书的CA证书文件")
+	agentCmd.StringVar(&agentConfig.Controller, "controller", "", "控制端面板地址，用于上报流量，如 https://panel.example.com:54321/")
+	agentCmd.StringVar(&agentConfig.ControllerName, "controller-cn", "", "只允许该 CommonName 的控制端证书访问")
+
 	oldUsage := flag.Usage
 	flag.Usage = func() {
 		oldUsage()
@@ -250,6 +371,8 @@ func main() {
 		fmt.Println("    run            运行 Web 面板")
 		fmt.Println("    v2-ui         从 v2-ui 迁移")
 		fmt.Println("    setting        修改设置")
+		fmt.Println("    cert           生成自签名证书或私有CA")
+		fmt.Println("    agent          以无界面的 agent 运行，由控制端面板管理")
 	}
 
 	flag.Parse()
@@ -284,6 +407,18 @@ func main() {
 		} else {
 			updateSetting(port, username, password)
 		}
+	case "cert":
+		if err := certCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println("解析cert命令参数失败:", err)
+			return
+		}
+		generateCert(certOpts)
+	case "agent":
+		if err := agentCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Println("解析agent命令参数失败:", err)
+			return
+		}
+		runAgent(agentConfig)
 	default:
 		fmt.Println("未知命令:", os.Args[1])
 		flag.Usage()
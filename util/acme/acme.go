@@ -0,0 +1,252 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	LetsEncryptURL        = "https://acme-v02.api.letsencrypt.org/directory"
+	LetsEncryptStagingURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+
+	ChallengeHTTP01 = "http-01"
+	ChallengeDNS01  = "dns-01"
+)
+
+// Solver 完成一种 ACME 验证。
+// HTTP-01 时 value 为 key authorization，DNS-01 时为 TXT 记录值
+type Solver interface {
+	Present(ctx context.Context, domain string, token string, value string) error
+	CleanUp(ctx context.Context, domain string, token string, value string) error
+}
+
+// Client ACME 客户端，DirectoryURL 可指向本地 Pebble 进行测试
+type Client struct {
+	DirectoryURL string
+	Email        string
+	AccountKey   crypto.Signer
+	HTTPClient   *http.Client
+
+	client *acme.Client
+}
+
+func NewClient(directoryURL string, email string, accountKey crypto.Signer, skipVerify bool) *Client {
+	httpClient := &http.Client{
+		Timeout: 60 * time.Second,
+	}
+	if skipVerify {
+		httpClient.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	return &Client{
+		DirectoryURL: directoryURL,
+		Email:        email,
+		AccountKey:   accountKey,
+		HTTPClient:   httpClient,
+	}
+}
+
+// GenerateKey 生成 P-256 私钥，返回 PEM
+func GenerateKey() (crypto.Signer, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseKey 解析 PEM 格式的私钥
+func ParseKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("无效的私钥PEM")
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("不支持的私钥类型")
+	}
+	return signer, nil
+}
+
+func (c *Client) register(ctx context.Context) error {
+	c.client = &acme.Client{
+		Key:          c.AccountKey,
+		DirectoryURL: c.DirectoryURL,
+		HTTPClient:   c.HTTPClient,
+		UserAgent:    "x-ui",
+	}
+	account := &acme.Account{}
+	if c.Email != "" {
+		account.Contact = []string{"mailto:" + c.Email}
+	}
+	_, err := c.client.Register(ctx, account, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("注册ACME账户失败: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) challengeValue(challenge *acme.Challenge) (string, error) {
+	switch challenge.Type {
+	case ChallengeHTTP01:
+		return c.client.HTTP01ChallengeResponse(challenge.Token)
+	case ChallengeDNS01:
+		return c.client.DNS01ChallengeRecord(challenge.Token)
+	}
+	return "", fmt.Errorf("不支持的验证方式: %v", challenge.Type)
+}
+
+func (c *Client) authorize(ctx context.Context, authzURL string, challengeType string, solver Solver) error {
+	authz, err := c.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, ch := range authz.Challenges {
+		if ch.Type == challengeType {
+			challenge = ch
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("域名 %v 不支持 %v 验证", authz.Identifier.Value, challengeType)
+	}
+	value, err := c.challengeValue(challenge)
+	if err != nil {
+		return err
+	}
+	domain := authz.Identifier.Value
+	if err := solver.Present(ctx, domain, challenge.Token, value); err != nil {
+		return fmt.Errorf("准备 %v 验证失败: %w", domain, err)
+	}
+	defer solver.CleanUp(context.Background(), domain, challenge.Token, value)
+
+	if _, err := c.client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	if _, err := c.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("域名 %v 验证失败: %w", domain, err)
+	}
+	return nil
+}
+
+// Obtain 为域名申请证书，返回证书链和私钥的 PEM
+func (c *Client) Obtain(ctx context.Context, domains []string, challengeType string, solver Solver) ([]byte, []byte, error) {
+	if len(domains) == 0 {
+		return nil, nil, errors.New("域名不能为空")
+	}
+	if err := c.register(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	order, err := c.client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建订单失败: %w", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := c.authorize(ctx, authzURL, challengeType, solver); err != nil {
+			return nil, nil, err
+		}
+	}
+	order, err = c.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("等待订单失败: %w", err)
+	}
+
+	certKey, keyPEM, err := GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, certKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ders, _, err := c.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("签发证书失败: %w", err)
+	}
+	certPEM := make([]byte, 0)
+	for _, der := range ders {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return certPEM, keyPEM, nil
+}
+
+// HTTP01Solver 在 /.well-known/acme-challenge/ 下响应验证请求
+type HTTP01Solver struct {
+	mu     sync.RWMutex
+	tokens map[string]string
+}
+
+func NewHTTP01Solver() *HTTP01Solver {
+	return &HTTP01Solver{
+		tokens: make(map[string]string),
+	}
+}
+
+func (s *HTTP01Solver) Present(ctx context.Context, domain string, token string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = value
+	return nil
+}
+
+func (s *HTTP01Solver) CleanUp(ctx context.Context, domain string, token string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+	return nil
+}
+
+const http01Prefix = "/.well-known/acme-challenge/"
+
+func (s *HTTP01Solver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(r.URL.Path) <= len(http01Prefix) || r.URL.Path[:len(http01Prefix)] != http01Prefix {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.RLock()
+	value, ok := s.tokens[r.URL.Path[len(http01Prefix):]]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(value))
+}
@@ -0,0 +1,215 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSProvider 在域名解析服务商处添加和删除 TXT 记录
+type DNSProvider interface {
+	AddTXT(ctx context.Context, fqdn string, value string) error
+	RemoveTXT(ctx context.Context, fqdn string, value string) error
+}
+
+type DNSProviderFactory func(config map[string]string) (DNSProvider, error)
+
+var (
+	dnsProvidersLock sync.RWMutex
+	dnsProviders     = map[string]DNSProviderFactory{}
+)
+
+// RegisterDNSProvider 注册解析服务商，名称重复时覆盖
+func RegisterDNSProvider(name string, factory DNSProviderFactory) {
+	dnsProvidersLock.Lock()
+	defer dnsProvidersLock.Unlock()
+	dnsProviders[name] = factory
+}
+
+func GetDNSProviderNames() []string {
+	dnsProvidersLock.RLock()
+	defer dnsProvidersLock.RUnlock()
+	names := make([]string, 0, len(dnsProviders))
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func NewDNSProvider(name string, config map[string]string) (DNSProvider, error) {
+	dnsProvidersLock.RLock()
+	factory, ok := dnsProviders[name]
+	dnsProvidersLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("未知的DNS服务商: %v", name)
+	}
+	return factory(config)
+}
+
+// DNS01Solver 通过 DNSProvider 完成 DNS-01 验证
+type DNS01Solver struct {
+	Provider DNSProvider
+	// 添加记录后等待生效的时间
+	PropagationWait time.Duration
+}
+
+func challengeFQDN(domain string) string {
+	return "_acme-challenge." + strings.TrimPrefix(domain, "*.")
+}
+
+func (s *DNS01Solver) Present(ctx context.Context, domain string, token string, value string) error {
+	if err := s.Provider.AddTXT(ctx, challengeFQDN(domain), value); err != nil {
+		return err
+	}
+	if s.PropagationWait > 0 {
+		select {
+		case <-time.After(s.PropagationWait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (s *DNS01Solver) CleanUp(ctx context.Context, domain string, token string, value string) error {
+	return s.Provider.RemoveTXT(ctx, challengeFQDN(domain), value)
+}
+
+func init() {
+	RegisterDNSProvider("cloudflare", newCloudflareProvider)
+}
+
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// cloudflareProvider 使用 API Token 管理 Cloudflare 解析记录，需要 Zone.DNS 编辑权限
+type cloudflareProvider struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+func newCloudflareProvider(config map[string]string) (DNSProvider, error) {
+	token := config["apiToken"]
+	if token == "" {
+		return nil, fmt.Errorf("cloudflare apiToken 不能为空")
+	}
+	apiURL := config["apiUrl"]
+	if apiURL == "" {
+		apiURL = cloudflareAPI
+	}
+	return &cloudflareProvider{
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+type cloudflareResponse struct {
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (p *cloudflareProvider) request(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.apiURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	r := &cloudflareResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return err
+	}
+	if !r.Success {
+		msgs := make([]string, 0, len(r.Errors))
+		for _, e := range r.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("cloudflare api 错误: %v", strings.Join(msgs, "; "))
+	}
+	if result != nil {
+		return json.Unmarshal(r.Result, result)
+	}
+	return nil
+}
+
+// findZone 从完整域名向上查找所属的 zone
+func (p *cloudflareProvider) findZone(ctx context.Context, fqdn string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		name := strings.Join(labels[i:], ".")
+		zones := make([]struct {
+			Id string `json:"id"`
+		}, 0)
+		if err := p.request(ctx, http.MethodGet, "/zones?name="+name, nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].Id, nil
+		}
+	}
+	return "", fmt.Errorf("未找到 %v 所属的 cloudflare zone", fqdn)
+}
+
+func (p *cloudflareProvider) AddTXT(ctx context.Context, fqdn string, value string) error {
+	zoneId, err := p.findZone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	return p.request(ctx, http.MethodPost, "/zones/"+zoneId+"/dns_records", map[string]interface{}{
+		"type":    "TXT",
+		"name":    fqdn,
+		"content": value,
+		"ttl":     120,
+	}, nil)
+}
+
+func (p *cloudflareProvider) RemoveTXT(ctx context.Context, fqdn string, value string) error {
+	zoneId, err := p.findZone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	records := make([]struct {
+		Id      string `json:"id"`
+		Content string `json:"content"`
+	}, 0)
+	err = p.request(ctx, http.MethodGet, "/zones/"+zoneId+"/dns_records?type=TXT&name="+fqdn, nil, &records)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if record.Content != value {
+			continue
+		}
+		err := p.request(ctx, http.MethodDelete, "/zones/"+zoneId+"/dns_records/"+record.Id, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package keygen
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// Shadowsocks 2022 各加密方式的密钥长度
+var ss2022KeyLengths = map[string]int{
+	"2022-blake3-aes-128-gcm":       16,
+	"2022-blake3-aes-256-gcm":       32,
+	"2022-blake3-chacha20-poly1305": 32,
+}
+
+func generateX25519Key() ([]byte, []byte, error) {
+	privateKey := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(privateKey); err != nil {
+		return nil, nil, err
+	}
+	privateKey[0] &= 248
+	privateKey[31] &= 127
+	privateKey[31] |= 64
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	return privateKey, publicKey, nil
+}
+
+// GenerateX25519 生成 Reality 使用的 X25519 密钥对，格式与 xray x25519 一致(base64 URL 无填充)
+func GenerateX25519() (string, string, error) {
+	privateKey, publicKey, err := generateX25519Key()
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(privateKey), base64.RawURLEncoding.EncodeToString(publicKey), nil
+}
+
+// X25519PublicKey 由私钥计算公钥
+func X25519PublicKey(privateKey string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("无效的私钥: %w", err)
+	}
+	if len(key) != curve25519.ScalarSize {
+		return "", fmt.Errorf("私钥长度必须为 %d 字节", curve25519.ScalarSize)
+	}
+	publicKey, err := curve25519.X25519(key, curve25519.Basepoint)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(publicKey), nil
+}
+
+// GenerateWireGuardKey 生成 WireGuard 密钥对，格式与 wg genkey 一致(标准 base64)
+func GenerateWireGuardKey() (string, string, error) {
+	privateKey, publicKey, err := generateX25519Key()
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(privateKey), base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+// WireGuardPublicKey 由 WireGuard 私钥计算公钥
+func WireGuardPublicKey(privateKey string) (string, error) {
+	key, err := ParseWireGuardKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	publicKey, err := curve25519.X25519(key, curve25519.Basepoint)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+// ParseWireGuardKey 解析 base64 编码的 32 字节 WireGuard 密钥
+func ParseWireGuardKey(key string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("无效的WireGuard密钥: %w", err)
+	}
+	if len(b) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("WireGuard密钥长度必须为 %d 字节", curve25519.ScalarSize)
+	}
+	return b, nil
+}
+
+// GenerateWireGuardPSK 生成 WireGuard 预共享密钥
+func GenerateWireGuardPSK() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// GenerateShortId 生成 Reality shortId，length 为十六进制字符数，必须是 0-16 之间的偶数
+func GenerateShortId(length int) (string, error) {
+	if length < 0 || length > 16 || length%2 != 0 {
+		return "", fmt.Errorf("shortId 长度必须是 0-16 之间的偶数: %d", length)
+	}
+	b := make([]byte, length/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateUUID 生成随机 UUID (版本4)
+func GenerateUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// GenerateSS2022Key 按加密方式生成 Shadowsocks 2022 的 PSK，base64 编码
+func GenerateSS2022Key(method string) (string, error) {
+	length, ok := ss2022KeyLengths[method]
+	if !ok {
+		return "", fmt.Errorf("不是 Shadowsocks 2022 加密方式: %v", method)
+	}
+	key := make([]byte, length)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// SS2022KeyLength 返回加密方式要求的密钥长度，非 2022 加密方式返回 0
+func SS2022KeyLength(method string) int {
+	return ss2022KeyLengths[method]
+}
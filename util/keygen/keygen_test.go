@@ -0,0 +1,148 @@
+package keygen
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"testing"
+)
+
+// checkClamped 校验 X25519 私钥已按 RFC 7748 处理
+func checkClamped(t *testing.T, key []byte) {
+	t.Helper()
+	if len(key) != 32 {
+		t.Fatalf("私钥长度为 %d，期望 32", len(key))
+	}
+	if key[0]&7 != 0 || key[31]&128 != 0 || key[31]&64 == 0 {
+		t.Fatalf("私钥未处理: %x", key)
+	}
+}
+
+func TestGenerateX25519(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		privateKey, publicKey, err := GenerateX25519()
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := base64.RawURLEncoding.DecodeString(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkClamped(t, key)
+		derived, err := X25519PublicKey(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if derived != publicKey {
+			t.Fatalf("由私钥计算的公钥为 %v，期望 %v", derived, publicKey)
+		}
+	}
+}
+
+func TestX25519PublicKey(t *testing.T) {
+	// RFC 7748 6.1 的测试向量
+	privateKey := base64.RawURLEncoding.EncodeToString(mustHex(t, "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"))
+	want := base64.RawURLEncoding.EncodeToString(mustHex(t, "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a"))
+	got, err := X25519PublicKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("公钥为 %v，期望 %v", got, want)
+	}
+
+	for _, key := range []string{"not base64!", base64.RawURLEncoding.EncodeToString(make([]byte, 16))} {
+		if _, err := X25519PublicKey(key); err == nil {
+			t.Fatalf("X25519PublicKey(%q) 没有返回错误", key)
+		}
+	}
+}
+
+func TestGenerateWireGuardKey(t *testing.T) {
+	privateKey, publicKey, err := GenerateWireGuardKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseWireGuardKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkClamped(t, key)
+	derived, err := WireGuardPublicKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if derived != publicKey {
+		t.Fatalf("由私钥计算的公钥为 %v，期望 %v", derived, publicKey)
+	}
+	if _, err := ParseWireGuardKey(base64.StdEncoding.EncodeToString(make([]byte, 31))); err == nil {
+		t.Fatal("31 字节的 WireGuard 密钥没有返回错误")
+	}
+}
+
+func TestGenerateSS2022Key(t *testing.T) {
+	cases := map[string]int{
+		"2022-blake3-aes-128-gcm":       16,
+		"2022-blake3-aes-256-gcm":       32,
+		"2022-blake3-chacha20-poly1305": 32,
+	}
+	for method, length := range cases {
+		key, err := GenerateSS2022Key(method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) != length || SS2022KeyLength(method) != length {
+			t.Fatalf("%v 的密钥长度为 %d，期望 %d", method, len(b), length)
+		}
+	}
+
+	for _, method := range []string{"aes-256-gcm", "chacha20-ietf-poly1305", "2022-blake3-aes-512-gcm", ""} {
+		if _, err := GenerateSS2022Key(method); err == nil {
+			t.Fatalf("GenerateSS2022Key(%q) 没有返回错误", method)
+		}
+		if n := SS2022KeyLength(method); n != 0 {
+			t.Fatalf("SS2022KeyLength(%q) = %d，期望 0", method, n)
+		}
+	}
+}
+
+func TestGenerateShortId(t *testing.T) {
+	for _, length := range []int{0, 2, 8, 16} {
+		id, err := GenerateShortId(length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := hex.DecodeString(id); err != nil || len(id) != length {
+			t.Fatalf("长度 %d 的 shortId 为 %q", length, id)
+		}
+	}
+	for _, length := range []int{-2, 3, 18} {
+		if _, err := GenerateShortId(length); err == nil {
+			t.Fatalf("GenerateShortId(%d) 没有返回错误", length)
+		}
+	}
+}
+
+func TestGenerateUUID(t *testing.T) {
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	id, err := GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !re.MatchString(id) {
+		t.Fatalf("UUID 为 %q，不是版本4", id)
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
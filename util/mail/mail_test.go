@@ -0,0 +1,209 @@
+package mail
+
+import (
+	"bufio"
+	"encoding/base64"
+	"mime"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpMessage 测试服务器收到的一次投递
+type smtpMessage struct {
+	from string
+	rcpt []string
+	data string
+}
+
+// smtpServer 只实现发信所需命令的 SMTP 服务器，不支持 STARTTLS 和 AUTH
+type smtpServer struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []*smtpMessage
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: listener}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *smtpServer) sender() *Sender {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return &Sender{
+		Host:    addr.IP.String(),
+		Port:    addr.Port,
+		From:    "x-ui@example.com",
+		Timeout: 5 * time.Second,
+	}
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	msg := &smtpMessage{}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250 8BITMIME")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg.from = smtpPath(line[len("MAIL FROM:"):])
+			tp.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.rcpt = append(msg.rcpt, smtpPath(line[len("RCPT TO:"):]))
+			tp.PrintfLine("250 OK")
+		case cmd == "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = &smtpMessage{}
+			tp.PrintfLine("250 OK")
+		case cmd == "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// smtpPath 取出 <addr> 中的地址，忽略后面的参数
+func smtpPath(arg string) string {
+	arg = strings.TrimSpace(arg)
+	if start := strings.Index(arg, "<"); start >= 0 {
+		if end := strings.Index(arg[start:], ">"); end >= 0 {
+			return arg[start+1 : start+end]
+		}
+	}
+	return arg
+}
+
+func (s *smtpServer) getMessages() []*smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*smtpMessage(nil), s.messages...)
+}
+
+// parseMessage 拆分邮件头和 base64 编码的正文
+func parseMessage(t *testing.T, data string) (textproto.MIMEHeader, string) {
+	t.Helper()
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(data)))
+	header, err := r.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded strings.Builder
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			break
+		}
+		encoded.WriteString(line)
+	}
+	body, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header, string(body)
+}
+
+func TestSendOneMessagePerRecipient(t *testing.T) {
+	server := newSMTPServer(t)
+	sender := server.sender()
+
+	recipients := []string{"alice@example.com", "bob@example.com"}
+	body := strings.Repeat("您的服务即将到期，请及时续期。", 10)
+	for i, to := range recipients {
+		subject := "[节点" + strconv.Itoa(i) + "] 将在 3 天后到期"
+		if err := sender.Send(to, subject, body); err != nil {
+			t.Fatalf("发送给 %v 失败: %v", to, err)
+		}
+	}
+
+	messages := server.getMessages()
+	if len(messages) != len(recipients) {
+		t.Fatalf("收到 %d 封邮件，期望 %d 封", len(messages), len(recipients))
+	}
+	for i, msg := range messages {
+		to := recipients[i]
+		if msg.from != sender.From {
+			t.Errorf("MAIL FROM 为 %v，期望 %v", msg.from, sender.From)
+		}
+		if len(msg.rcpt) != 1 || msg.rcpt[0] != to {
+			t.Errorf("RCPT TO 为 %v，期望只有 %v", msg.rcpt, to)
+		}
+		header, decoded := parseMessage(t, msg.data)
+		if got := header.Get("To"); got != to {
+			t.Errorf("To 头为 %q，期望 %q", got, to)
+		}
+		for _, other := range recipients {
+			if other != to && strings.Contains(msg.data, other) {
+				t.Errorf("发给 %v 的邮件包含其他收件人 %v", to, other)
+			}
+		}
+		subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "[节点" + strconv.Itoa(i) + "] 将在 3 天后到期"; subject != want {
+			t.Errorf("主题为 %q，期望 %q", subject, want)
+		}
+		if decoded != body {
+			t.Errorf("正文为 %q，期望 %q", decoded, body)
+		}
+	}
+}
+
+func TestSendEmptyRecipient(t *testing.T) {
+	server := newSMTPServer(t)
+	if err := server.sender().Send(" ", "subject", "body"); err == nil {
+		t.Fatal("收件人为空时应返回错误")
+	}
+	if messages := server.getMessages(); len(messages) != 0 {
+		t.Fatalf("不应发送邮件，实际收到 %d 封", len(messages))
+	}
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Labels map[string]string
+
+type metricType string
+
+const (
+	counterType metricType = "counter"
+	gaugeType   metricType = "gauge"
+)
+
+type sample struct {
+	labels Labels
+	value  float64
+}
+
+// Metric 一个指标及其按标签区分的所有取值
+type Metric struct {
+	name    string
+	help    string
+	typ     metricType
+	mu      sync.Mutex
+	samples map[string]*sample
+}
+
+func newMetric(name string, help string, typ metricType) *Metric {
+	return &Metric{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		samples: make(map[string]*sample),
+	}
+}
+
+func NewCounter(name string, help string) *Metric {
+	return newMetric(name, help, counterType)
+}
+
+func NewGauge(name string, help string) *Metric {
+	return newMetric(name, help, gaugeType)
+}
+
+func labelsKey(labels Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(labels[k]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func getSample(samples map[string]*sample, labels Labels) *sample {
+	key := labelsKey(labels)
+	s, ok := samples[key]
+	if !ok {
+		s = &sample{labels: labels}
+		samples[key] = s
+	}
+	return s
+}
+
+func (m *Metric) Add(value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	getSample(m.samples, labels).value += value
+}
+
+func (m *Metric) Inc(labels Labels) {
+	m.Add(1, labels)
+}
+
+func (m *Metric) Set(value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	getSample(m.samples, labels).value = value
+}
+
+// Snapshot 每次采集时整体重建的指标的所有取值，构建完成后通过 Metric.Swap 替换
+type Snapshot struct {
+	samples map[string]*sample
+}
+
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		samples: make(map[string]*sample),
+	}
+}
+
+func (s *Snapshot) Set(value float64, labels Labels) {
+	getSample(s.samples, labels).value = value
+}
+
+// Swap 用快照替换所有取值，并发输出时不会看到清空后还没有重建完的指标
+func (m *Metric) Swap(snapshot *Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples = snapshot.samples
+}
+
+// WriteText 以 Prometheus 文本格式输出
+func (m *Metric) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(m.samples))
+	for k := range m.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value := strconv.FormatFloat(m.samples[k].value, 'g', -1, 64)
+		var err error
+		if k == "" {
+			_, err = fmt.Fprintf(w, "%s %s\n", m.name, value)
+		} else {
+			_, err = fmt.Fprintf(w, "%s{%s} %s\n", m.name, k, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*Metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(metrics ...*Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, metrics...)
+}
+
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.metrics {
+		if err := m.WriteText(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	counter := NewCounter("test_requests_total", "Number of requests")
+	gauge := NewGauge("test_up", "Whether the target is up")
+	r.Register(counter, gauge)
+
+	counter.Inc(Labels{"path": "/b", "code": "200"})
+	counter.Add(2, Labels{"path": "/a", "code": "200"})
+	counter.Inc(Labels{"path": "/b", "code": "200"})
+	counter.Inc(Labels{"path": "a\"b\\c\nd"})
+	gauge.Set(0.5, nil)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_requests_total Number of requests
+# TYPE test_requests_total counter
+test_requests_total{code="200",path="/a"} 2
+test_requests_total{code="200",path="/b"} 2
+test_requests_total{path="a\"b\\c\nd"} 1
+# HELP test_up Whether the target is up
+# TYPE test_up gauge
+test_up 0.5
+`
+	if b.String() != want {
+		t.Fatalf("输出为\n%s\n期望\n%s", b.String(), want)
+	}
+}
+
+func TestSwap(t *testing.T) {
+	gauge := NewGauge("test_enabled", "Whether the item is enabled")
+	gauge.Set(1, Labels{"tag": "removed"})
+
+	snapshot := NewSnapshot()
+	snapshot.Set(1, Labels{"tag": "a"})
+	snapshot.Set(0, Labels{"tag": "b"})
+	gauge.Swap(snapshot)
+
+	var b strings.Builder
+	if err := gauge.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_enabled Whether the item is enabled
+# TYPE test_enabled gauge
+test_enabled{tag="a"} 1
+test_enabled{tag="b"} 0
+`
+	if b.String() != want {
+		t.Fatalf("输出为\n%s\n期望\n%s", b.String(), want)
+	}
+}
+
+func TestSwapWhileWriting(t *testing.T) {
+	gauge := NewGauge("test_items", "Items")
+	const count = 50
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			snapshot := NewSnapshot()
+			for j := 0; j < count; j++ {
+				snapshot.Set(float64(i), Labels{"id": strconv.Itoa(j)})
+			}
+			gauge.Swap(snapshot)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			var b strings.Builder
+			if err := gauge.WriteText(&b); err != nil {
+				t.Error(err)
+				return
+			}
+			// 除 HELP 和 TYPE 外，要么还没有取值，要么是完整的一次采集
+			lines := strings.Count(b.String(), "\n") - 2
+			if lines != 0 && lines != count {
+				t.Errorf("输出了 %d 个取值，期望 0 或 %d", lines, count)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,229 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	KeyTypeECDSA = "ecdsa"
+	KeyTypeRSA   = "rsa"
+
+	defaultRSABits   = 2048
+	defaultValidDays = 365
+)
+
+// Options 证书生成参数。Hosts 可以是域名或IP，第一个作为 CommonName
+type Options struct {
+	CommonName string
+	Hosts      []string
+	KeyType    string
+	// RSA 密钥长度，ECDSA 时为曲线位数(256/384/521)
+	KeyBits   int
+	ValidDays int
+}
+
+func generateKey(keyType string, bits int) (crypto.Signer, error) {
+	switch strings.ToLower(keyType) {
+	case KeyTypeECDSA, "":
+		var curve elliptic.Curve
+		switch bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的ECDSA曲线位数: %d", bits)
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case KeyTypeRSA:
+		if bits == 0 {
+			bits = defaultRSABits
+		}
+		if bits < 2048 || bits > 8192 {
+			return nil, fmt.Errorf("RSA密钥长度必须在2048-8192之间: %d", bits)
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	}
+	return nil, fmt.Errorf("不支持的密钥类型: %v", keyType)
+}
+
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func encodeCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newTemplate(opts *Options) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	validDays := opts.ValidDays
+	if validDays <= 0 {
+		validDays = defaultValidDays
+	}
+	commonName := opts.CommonName
+	if commonName == "" && len(opts.Hosts) > 0 {
+		commonName = opts.Hosts[0]
+	}
+	if commonName == "" {
+		return nil, errors.New("CommonName 和 Hosts 不能同时为空")
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{"x-ui"},
+		},
+		// 容忍少量时钟偏差
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Duration(validDays) * 24 * time.Hour),
+		BasicConstraintsValid: true,
+	}
+	for _, host := range opts.Hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	return template, nil
+}
+
+func setLeafUsage(template *x509.Certificate, key crypto.Signer) {
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	// 同时可作为客户端证书，用于控制端与 agent 之间的双向 TLS
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+}
+
+// GenerateSelfSigned 生成自签名服务器证书，返回证书和私钥的 PEM
+func GenerateSelfSigned(opts *Options) ([]byte, []byte, error) {
+	key, err := generateKey(opts.KeyType, opts.KeyBits)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := newTemplate(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	setLeafUsage(template, key)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeCert(der), keyPEM, nil
+}
+
+// GenerateCA 生成私有根证书，只能签发下级证书
+func GenerateCA(opts *Options) ([]byte, []byte, error) {
+	key, err := generateKey(opts.KeyType, opts.KeyBits)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := newTemplate(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.MaxPathLenZero = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeCert(der), keyPEM, nil
+}
+
+func parseCA(caCertPEM []byte, caKeyPEM []byte) (*x509.Certificate, crypto.Signer, error) {
+	block, _ := pem.Decode(caCertPEM)
+	if block == nil {
+		return nil, nil, errors.New("无效的CA证书PEM")
+	}
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !caCert.IsCA {
+		return nil, nil, errors.New("证书不是CA证书")
+	}
+	block, _ = pem.Decode(caKeyPEM)
+	if block == nil {
+		return nil, nil, errors.New("无效的CA私钥PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("不支持的CA私钥类型")
+	}
+	return caCert, signer, nil
+}
+
+// GenerateLeaf 用私有CA签发服务器证书，返回的证书 PEM 包含CA证书组成的链
+func GenerateLeaf(opts *Options, caCertPEM []byte, caKeyPEM []byte) ([]byte, []byte, error) {
+	caCert, caKey, err := parseCA(caCertPEM, caKeyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := generateKey(opts.KeyType, opts.KeyBits)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := newTemplate(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if template.NotAfter.After(caCert.NotAfter) {
+		template.NotAfter = caCert.NotAfter
+	}
+	setLeafUsage(template, key)
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := append(encodeCert(der), encodeCert(caCert.Raw)...)
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,258 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseChain 解析 PEM 中的所有证书
+func parseChain(t *testing.T, data []byte) []*x509.Certificate {
+	t.Helper()
+	certs := make([]*x509.Certificate, 0)
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			t.Fatalf("PEM 类型为 %v，期望 CERTIFICATE", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		t.Fatal("PEM 中没有证书")
+	}
+	return certs
+}
+
+func newTestCA(t *testing.T, opts *Options) ([]byte, []byte, *x509.Certificate) {
+	t.Helper()
+	caCertPem, caKeyPem, err := GenerateCA(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return caCertPem, caKeyPem, parseChain(t, caCertPem)[0]
+}
+
+func TestGenerateCA(t *testing.T) {
+	_, caKeyPem, ca := newTestCA(t, &Options{CommonName: "x-ui CA", ValidDays: 3650})
+	if !ca.IsCA || !ca.BasicConstraintsValid || ca.MaxPathLen != 0 || !ca.MaxPathLenZero {
+		t.Fatalf("CA 约束为 IsCA=%v MaxPathLen=%d MaxPathLenZero=%v", ca.IsCA, ca.MaxPathLen, ca.MaxPathLenZero)
+	}
+	if ca.KeyUsage != x509.KeyUsageCertSign|x509.KeyUsageCRLSign || len(ca.ExtKeyUsage) != 0 {
+		t.Fatalf("CA 用途为 %v %v，期望只能签发证书和 CRL", ca.KeyUsage, ca.ExtKeyUsage)
+	}
+	if ca.Subject.CommonName != "x-ui CA" || ca.Issuer.CommonName != "x-ui CA" {
+		t.Fatalf("CA 名称为 %v，签发者 %v", ca.Subject, ca.Issuer)
+	}
+	if days := ca.NotAfter.Sub(ca.NotBefore).Hours() / 24; days < 3650 || days > 3651 {
+		t.Fatalf("CA 有效期为 %.2f 天，期望 3650 天", days)
+	}
+	if err := ca.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("CA 不是自签名: %v", err)
+	}
+	block, _ := pem.Decode(caKeyPem)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		t.Fatal("CA 私钥不是 PKCS#8 PEM")
+	}
+}
+
+func TestGenerateLeafChain(t *testing.T) {
+	caCertPem, caKeyPem, ca := newTestCA(t, &Options{CommonName: "x-ui CA"})
+	certPem, keyPem, err := GenerateLeaf(&Options{Hosts: []string{"example.com", " ", "*.example.org", "10.0.0.1", "::1"}}, caCertPem, caKeyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := parseChain(t, certPem)
+	if len(chain) != 2 || !chain[1].Equal(ca) {
+		t.Fatalf("证书链有 %d 个证书，期望叶子证书和CA证书", len(chain))
+	}
+	leaf := chain[0]
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "example.com", KeyUsages: []x509.ExtKeyUsage{usage}})
+		if err != nil {
+			t.Fatalf("以 %v 用途验证证书链失败: %v", usage, err)
+		}
+	}
+	for _, host := range []string{"example.com", "www.example.org", "10.0.0.1", "::1"} {
+		if err := leaf.VerifyHostname(host); err != nil {
+			t.Fatalf("证书不包含 %v: %v", host, err)
+		}
+	}
+	if err := leaf.VerifyHostname("example.org"); err == nil {
+		t.Fatal("通配符证书匹配了上级域名")
+	}
+
+	if leaf.Subject.CommonName != "example.com" || leaf.Issuer.CommonName != "x-ui CA" {
+		t.Fatalf("证书名称为 %v，签发者 %v", leaf.Subject, leaf.Issuer)
+	}
+	if strings.Join(leaf.DNSNames, ",") != "example.com,*.example.org" {
+		t.Fatalf("DNS SAN 为 %v", leaf.DNSNames)
+	}
+	if len(leaf.IPAddresses) != 2 || !leaf.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")) || !leaf.IPAddresses[1].Equal(net.IPv6loopback) {
+		t.Fatalf("IP SAN 为 %v", leaf.IPAddresses)
+	}
+	if leaf.IsCA || leaf.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Fatalf("ECDSA 叶子证书 IsCA=%v KeyUsage=%v", leaf.IsCA, leaf.KeyUsage)
+	}
+
+	// 证书和私钥匹配，证书链可直接用于 TLS
+	pair, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pair.Certificate) != 2 {
+		t.Fatalf("TLS 证书链长度为 %d", len(pair.Certificate))
+	}
+
+	// 其他CA不能验证
+	_, _, other := newTestCA(t, &Options{CommonName: "x-ui CA"})
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(other)
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: otherRoots, DNSName: "example.com"}); err == nil {
+		t.Fatal("其他同名CA验证通过")
+	}
+}
+
+func TestGenerateLeafKeyUsage(t *testing.T) {
+	caCertPem, caKeyPem, _ := newTestCA(t, &Options{CommonName: "x-ui CA", KeyType: KeyTypeRSA})
+	certPem, keyPem, err := GenerateLeaf(&Options{CommonName: "agent-1", KeyType: KeyTypeRSA}, caCertPem, caKeyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := parseChain(t, certPem)[0]
+	if leaf.KeyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment {
+		t.Fatalf("RSA 叶子证书 KeyUsage 为 %v，期望包含 KeyEncipherment", leaf.KeyUsage)
+	}
+	if len(leaf.ExtKeyUsage) != 2 || leaf.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth || leaf.ExtKeyUsage[1] != x509.ExtKeyUsageClientAuth {
+		t.Fatalf("ExtKeyUsage 为 %v，期望 ServerAuth 和 ClientAuth", leaf.ExtKeyUsage)
+	}
+	if len(leaf.DNSNames) != 0 || len(leaf.IPAddresses) != 0 {
+		t.Fatalf("只指定 CommonName 时 SAN 为 %v %v", leaf.DNSNames, leaf.IPAddresses)
+	}
+	key, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsaKey, ok := key.PrivateKey.(*rsa.PrivateKey); !ok || rsaKey.N.BitLen() != 2048 {
+		t.Fatalf("私钥为 %T，期望 2048 位 RSA", key.PrivateKey)
+	}
+}
+
+func TestGenerateLeafValidity(t *testing.T) {
+	caCertPem, caKeyPem, ca := newTestCA(t, &Options{CommonName: "x-ui CA", ValidDays: 30})
+	certPem, _, err := GenerateLeaf(&Options{CommonName: "panel", ValidDays: 365}, caCertPem, caKeyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 叶子证书不能比CA更晚到期
+	if leaf := parseChain(t, certPem)[0]; !leaf.NotAfter.Equal(ca.NotAfter) {
+		t.Fatalf("叶子证书到期时间为 %v，期望截止到CA的 %v", leaf.NotAfter, ca.NotAfter)
+	}
+	if time.Until(ca.NotBefore) > -50*time.Minute {
+		t.Fatalf("生效时间为 %v，期望提前一小时以容忍时钟偏差", ca.NotBefore)
+	}
+}
+
+func TestGenerateLeafRejectsInvalidCA(t *testing.T) {
+	caCertPem, caKeyPem, _ := newTestCA(t, &Options{CommonName: "x-ui CA"})
+	_, otherKeyPem, _ := newTestCA(t, &Options{CommonName: "other CA"})
+	leafPem, leafKeyPem, err := GenerateLeaf(&Options{CommonName: "panel"}, caCertPem, caKeyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selfSignedPem, selfSignedKeyPem, err := GenerateSelfSigned(&Options{CommonName: "panel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		certPem []byte
+		keyPem  []byte
+	}{
+		{"证书不是PEM", []byte("not a cert"), caKeyPem},
+		{"私钥不是PEM", caCertPem, []byte("not a key")},
+		{"叶子证书", leafPem, leafKeyPem},
+		{"自签名服务器证书", selfSignedPem, selfSignedKeyPem},
+		{"私钥与CA不匹配", caCertPem, otherKeyPem},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, _, err := GenerateLeaf(&Options{CommonName: "agent-1"}, c.certPem, c.keyPem); err == nil {
+				t.Fatal("签发成功，期望返回错误")
+			}
+		})
+	}
+}
+
+func TestGenerateSelfSigned(t *testing.T) {
+	certPem, keyPem, err := GenerateSelfSigned(&Options{Hosts: []string{"203.0.113.1", "panel.example.com"}, KeyBits: 384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := parseChain(t, certPem)
+	if len(chain) != 1 {
+		t.Fatalf("自签名证书 PEM 中有 %d 个证书", len(chain))
+	}
+	cert := chain[0]
+	// 第一个 Host 作为 CommonName
+	if cert.Subject.CommonName != "203.0.113.1" || cert.IsCA {
+		t.Fatalf("证书为 CN=%v IsCA=%v", cert.Subject.CommonName, cert.IsCA)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "panel.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if days := cert.NotAfter.Sub(cert.NotBefore).Hours() / 24; days < defaultValidDays || days > defaultValidDays+1 {
+		t.Fatalf("默认有效期为 %.2f 天，期望 %d 天", days, defaultValidDays)
+	}
+	pair, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := pair.PrivateKey.(*ecdsa.PrivateKey); !ok || key.Curve != elliptic.P384() {
+		t.Fatalf("私钥为 %T，期望 P-384 ECDSA", pair.PrivateKey)
+	}
+}
+
+func TestGenerateInvalidOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		opts *Options
+	}{
+		{"没有名称", &Options{}},
+		{"只有空白的 Hosts 不能作为名称", &Options{Hosts: []string{""}}},
+		{"不支持的密钥类型", &Options{CommonName: "panel", KeyType: "ed448"}},
+		{"不支持的曲线", &Options{CommonName: "panel", KeyBits: 2048}},
+		{"RSA 密钥过短", &Options{CommonName: "panel", KeyType: KeyTypeRSA, KeyBits: 1024}},
+		{"RSA 密钥过长", &Options{CommonName: "panel", KeyType: KeyTypeRSA, KeyBits: 16384}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, _, err := GenerateSelfSigned(c.opts); err == nil {
+				t.Fatal("生成成功，期望返回错误")
+			}
+			if _, _, err := GenerateCA(c.opts); err == nil {
+				t.Fatal("生成CA成功，期望返回错误")
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package sys
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	SdNotifyReady     = "READY=1"
+	SdNotifyReloading = "RELOADING=1"
+	SdNotifyStopping  = "STOPPING=1"
+	SdNotifyWatchdog  = "WATCHDOG=1"
+)
+
+// SdNotify 向 systemd 发送状态通知，未在 systemd 下运行时返回 false
+func SdNotify(state string) (bool, error) {
+	socketAddr := &net.UnixAddr{
+		Name: os.Getenv("NOTIFY_SOCKET"),
+		Net:  "unixgram",
+	}
+	if socketAddr.Name == "" {
+		return false, nil
+	}
+	conn, err := net.DialUnix(socketAddr.Net, nil, socketAddr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SdWatchdogInterval 返回 systemd WatchdogSec 配置的间隔，未启用时返回 0
+func SdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	pid := os.Getenv("WATCHDOG_PID")
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
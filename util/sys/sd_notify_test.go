@@ -0,0 +1,100 @@
+package sys
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listenNotifySocket 模拟 systemd 的通知套接字，并设置 NOTIFY_SOCKET
+func listenNotifySocket(t *testing.T, name string) *net.UnixConn {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("不支持 unixgram")
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", name)
+	return conn
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestSdNotify(t *testing.T) {
+	conn := listenNotifySocket(t, filepath.Join(t.TempDir(), "notify.sock"))
+	for _, state := range []string{SdNotifyReady, SdNotifyReloading, SdNotifyWatchdog, SdNotifyStopping} {
+		sent, err := SdNotify(state)
+		if err != nil || !sent {
+			t.Fatalf("发送 %v 返回 %v, %v", state, sent, err)
+		}
+		// 每条通知是一个数据报，内容即 KEY=VALUE，不带换行
+		if got := readNotify(t, conn); got != state {
+			t.Fatalf("收到 %q，期望 %q", got, state)
+		}
+	}
+}
+
+func TestSdNotifyAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("抽象套接字只在 Linux 上可用")
+	}
+	conn := listenNotifySocket(t, "@x-ui-test-"+strconv.Itoa(os.Getpid()))
+	if sent, err := SdNotify(SdNotifyReady); err != nil || !sent {
+		t.Fatalf("发送到抽象套接字返回 %v, %v", sent, err)
+	}
+	if got := readNotify(t, conn); got != SdNotifyReady {
+		t.Fatalf("收到 %q，期望 %q", got, SdNotifyReady)
+	}
+}
+
+func TestSdNotifyWithoutSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := SdNotify(SdNotifyReady); err != nil || sent {
+		t.Fatalf("没有 NOTIFY_SOCKET 时返回 %v, %v", sent, err)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	if sent, err := SdNotify(SdNotifyReady); err == nil || sent {
+		t.Fatalf("套接字不存在时返回 %v, %v", sent, err)
+	}
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	cases := []struct {
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{"", "", 0},
+		{"abc", "", 0},
+		{"-1", "", 0},
+		{"30000000", "", 30 * time.Second},
+		{"30000000", pid, 30 * time.Second},
+		// 通知的是其他进程
+		{"30000000", "1", 0},
+	}
+	for _, c := range cases {
+		t.Setenv("WATCHDOG_USEC", c.usec)
+		t.Setenv("WATCHDOG_PID", c.pid)
+		if got := SdWatchdogInterval(); got != c.want {
+			t.Fatalf("WATCHDOG_USEC=%q WATCHDOG_PID=%q 时返回 %v，期望 %v", c.usec, c.pid, got, c.want)
+		}
+	}
+}
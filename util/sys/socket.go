@@ -0,0 +1,24 @@
+package sys
+
+import (
+	"fmt"
+	"net"
+)
+
+// ListenSocket 主机上处于监听状态的 TCP 套接字或已绑定的 UDP 套接字
+type ListenSocket struct {
+	Network string `json:"network"` // tcp 或 udp
+	IP      net.IP `json:"ip"`
+	Port    int    `json:"port"`
+	// 拥有套接字的进程，无权限读取时为 0
+	Pid     int    `json:"pid"`
+	Process string `json:"process"`
+}
+
+func (s *ListenSocket) String() string {
+	owner := "未知进程"
+	if s.Pid > 0 {
+		owner = fmt.Sprintf("%v(pid %d)", s.Process, s.Pid)
+	}
+	return fmt.Sprintf("%v %v 被 %v 占用", s.Network, net.JoinHostPort(s.IP.String(), fmt.Sprint(s.Port)), owner)
+}
@@ -0,0 +1,121 @@
+//go:build linux
+// +build linux
+
+package sys
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	tcpStateListen = "0A"
+	udpStateClose  = "07"
+)
+
+// parseProcNetAddr 解析 /proc/net/tcp 中的地址，IP 按 32 位小端分组存储
+func parseProcNetAddr(s string) (net.IP, int, error) {
+	host, port, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("无效的地址: %v", s)
+	}
+	b, err := hex.DecodeString(host)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("无效的地址: %v", s)
+	}
+	for i := 0; i < len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("无效的端口: %v", s)
+	}
+	return net.IP(b), int(p), nil
+}
+
+// readProcNet 读取 /proc/net 下的套接字表，返回 inode 到套接字的映射
+func readProcNet(filename string, network string, state string, sockets map[string]*ListenSocket) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // 表头
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+		ip, port, err := parseProcNetAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		sockets[fields[9]] = &ListenSocket{
+			Network: network,
+			IP:      ip,
+			Port:    port,
+		}
+	}
+	return scanner.Err()
+}
+
+// fillSocketOwners 遍历 /proc/<pid>/fd 查找套接字 inode 所属的进程
+func fillSocketOwners(sockets map[string]*ListenSocket) {
+	fds, _ := filepath.Glob(HostProc("[0-9]*", "fd", "*"))
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		socket, ok := sockets[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")]
+		if !ok || socket.Pid > 0 {
+			continue
+		}
+		pidDir := filepath.Dir(filepath.Dir(fd))
+		pid, err := strconv.Atoi(filepath.Base(pidDir))
+		if err != nil {
+			continue
+		}
+		socket.Pid = pid
+		if comm, err := os.ReadFile(filepath.Join(pidDir, "comm")); err == nil {
+			socket.Process = strings.TrimSpace(string(comm))
+		}
+	}
+}
+
+// GetListenSockets 返回主机上所有监听中的 TCP 套接字和已绑定的 UDP 套接字及其所属进程
+func GetListenSockets() ([]*ListenSocket, error) {
+	sockets := map[string]*ListenSocket{}
+	tables := []struct {
+		name    string
+		network string
+		state   string
+	}{
+		{"tcp", "tcp", tcpStateListen},
+		{"tcp6", "tcp", tcpStateListen},
+		{"udp", "udp", udpStateClose},
+		{"udp6", "udp", udpStateClose},
+	}
+	for _, table := range tables {
+		err := readProcNet(HostProc("net", table.name), table.network, table.state, sockets)
+		// 未启用 IPv6 时没有 tcp6/udp6
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	fillSocketOwners(sockets)
+
+	result := make([]*ListenSocket, 0, len(sockets))
+	for _, socket := range sockets {
+		result = append(result, socket)
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+//go:build linux
+// +build linux
+
+package sys
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 00000000:D431 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:9C40 0100007F:1F90 01 00000000:00000000 00:00000000 00000000     0        0 1003 1 0000000000000000 20 4 30 10 -1
+`
+
+const procNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:01BB 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2001 1 0000000000000000 100 0 0 10 0
+   1: 000080FE00000000FF005002E9FF7BFE:0050 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2002 1 0000000000000000 100 0 0 10 0
+`
+
+const procNetUDP = `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  100: 00000000:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 3001 2 0000000000000000 0
+  101: 0100007F:A1B2 0100007F:0035 01 00000000:00000000 00:00000000 00000000     0        0 3002 2 0000000000000000 0
+`
+
+func writeProcNet(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "net")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseProcNetAddr(t *testing.T) {
+	cases := []struct {
+		addr string
+		ip   string
+		port int
+	}{
+		{"0100007F:1F90", "127.0.0.1", 8080},
+		{"00000000:0035", "0.0.0.0", 53},
+		{"00000000000000000000000001000000:01BB", "::1", 443},
+		{"000080FE00000000FF005002E9FF7BFE:0050", "fe80::250:ff:fe7b:ffe9", 80},
+	}
+	for _, c := range cases {
+		ip, port, err := parseProcNetAddr(c.addr)
+		if err != nil {
+			t.Fatalf("解析 %v 失败: %v", c.addr, err)
+		}
+		if !ip.Equal(net.ParseIP(c.ip)) || port != c.port {
+			t.Fatalf("解析 %v 得到 %v:%d，期望 %v:%d", c.addr, ip, port, c.ip, c.port)
+		}
+	}
+
+	for _, addr := range []string{"0100007F", "0100007:1F90", "zz00007F:1F90", "0100007F:zzzz", "0100007F:10000"} {
+		if _, _, err := parseProcNetAddr(addr); err == nil {
+			t.Fatalf("解析无效地址 %v 没有返回错误", addr)
+		}
+	}
+}
+
+func TestReadProcNet(t *testing.T) {
+	sockets := map[string]*ListenSocket{}
+	tables := []struct {
+		content string
+		network string
+		state   string
+	}{
+		{procNetTCP, "tcp", tcpStateListen},
+		{procNetTCP6, "tcp", tcpStateListen},
+		{procNetUDP, "udp", udpStateClose},
+	}
+	for _, table := range tables {
+		if err := readProcNet(writeProcNet(t, table.content), table.network, table.state, sockets); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]ListenSocket{
+		"1001": {Network: "tcp", IP: net.ParseIP("127.0.0.1"), Port: 8080},
+		"1002": {Network: "tcp", IP: net.ParseIP("0.0.0.0"), Port: 54321},
+		"2001": {Network: "tcp", IP: net.ParseIP("::1"), Port: 443},
+		"2002": {Network: "tcp", IP: net.ParseIP("fe80::250:ff:fe7b:ffe9"), Port: 80},
+		"3001": {Network: "udp", IP: net.ParseIP("0.0.0.0"), Port: 53},
+	}
+	if len(sockets) != len(want) {
+		t.Fatalf("得到 %d 个套接字，期望 %d 个，已建立的连接不应计入", len(sockets), len(want))
+	}
+	for inode, w := range want {
+		got, ok := sockets[inode]
+		if !ok {
+			t.Fatalf("缺少 inode %v", inode)
+		}
+		if got.Network != w.Network || !got.IP.Equal(w.IP) || got.Port != w.Port {
+			t.Fatalf("inode %v 为 %+v，期望 %+v", inode, got, w)
+		}
+	}
+}
+
+func TestReadProcNetMissingFile(t *testing.T) {
+	err := readProcNet(filepath.Join(t.TempDir(), "tcp6"), "tcp", tcpStateListen, map[string]*ListenSocket{})
+	if !os.IsNotExist(err) {
+		t.Fatalf("文件不存在时返回 %v，期望 IsNotExist 错误", err)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build !linux
+// +build !linux
+
+package sys
+
+import (
+	"net"
+	"syscall"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// GetListenSockets 返回主机上所有监听中的 TCP 套接字和已绑定的 UDP 套接字及其所属进程
+func GetListenSockets() ([]*ListenSocket, error) {
+	stats, err := psnet.Connections("inet")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*ListenSocket, 0)
+	for _, stat := range stats {
+		socket := &ListenSocket{
+			IP:   net.ParseIP(stat.Laddr.IP),
+			Port: int(stat.Laddr.Port),
+			Pid:  int(stat.Pid),
+		}
+		switch {
+		case stat.Type == syscall.SOCK_STREAM && stat.Status == "LISTEN":
+			socket.Network = "tcp"
+		case stat.Type == syscall.SOCK_DGRAM && stat.Raddr.Port == 0:
+			socket.Network = "udp"
+		default:
+			continue
+		}
+		if socket.Pid > 0 {
+			if proc, err := process.NewProcess(stat.Pid); err == nil {
+				socket.Process, _ = proc.Name()
+			}
+		}
+		result = append(result, socket)
+	}
+	return result, nil
+}
@@ -0,0 +1,145 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultAPIURL = "https://api.telegram.org"
+
+// Client Telegram Bot API 客户端，APIURL 可指向本地模拟服务
+type Client struct {
+	APIURL     string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewClient(apiURL string, token string) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Client{
+		APIURL: strings.TrimSuffix(apiURL, "/"),
+		Token:  token,
+		HTTPClient: &http.Client{
+			Timeout: 70 * time.Second,
+		},
+	}
+}
+
+type Chat struct {
+	Id int64 `json:"id"`
+}
+
+type User struct {
+	Id       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type Message struct {
+	MessageId int64  `json:"message_id"`
+	From      *User  `json:"from"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+type Update struct {
+	UpdateId int64    `json:"update_id"`
+	Message  *Message `json:"message"`
+}
+
+type response struct {
+	Ok          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+}
+
+func (c *Client) methodURL(method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", c.APIURL, c.Token, method)
+}
+
+func (c *Client) do(req *http.Request, result interface{}) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	r := &response{}
+	if err := json.Unmarshal(body, r); err != nil {
+		return fmt.Errorf("telegram api 返回状态码 %d: %w", resp.StatusCode, err)
+	}
+	if !r.Ok {
+		return fmt.Errorf("telegram api 错误: %s", r.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(r.Result, result)
+	}
+	return nil
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.methodURL(method), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, result)
+}
+
+// GetUpdates 长轮询获取新消息
+func (c *Client) GetUpdates(ctx context.Context, offset int64, timeout int) ([]*Update, error) {
+	updates := make([]*Update, 0)
+	err := c.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         timeout,
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+func (c *Client) SendMessage(ctx context.Context, chatId int64, text string) error {
+	return c.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id":    chatId,
+		"text":       text,
+		"parse_mode": "HTML",
+	}, nil)
+}
+
+func (c *Client) SendDocument(ctx context.Context, chatId int64, fileName string, content io.Reader) error {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.WriteField("chat_id", fmt.Sprint(chatId)); err != nil {
+		return err
+	}
+	part, err := writer.CreateFormFile("document", fileName)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.methodURL("sendDocument"), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return c.do(req, nil)
+}
@@ -3,9 +3,12 @@ axios.defaults.headers.common['X-Requested-With'] = 'XMLHttpRequest';
 
 axios.interceptors.request.use(
     config => {
-        config.data = Qs.stringify(config.data, {
-            arrayFormat: 'repeat'
-        });
+        // 上传文件时由浏览器生成 multipart 请求体
+        if (!(config.data instanceof FormData)) {
+            config.data = Qs.stringify(config.data, {
+                arrayFormat: 'repeat'
+            });
+        }
         return config;
     },
     error => Promise.reject(error)
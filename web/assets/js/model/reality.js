@@ -66,7 +66,7 @@ class RealityStreamSettings extends XrayCommonClass {
     generateKeyPair() {
         // 向后端请求生成密钥对
         return new Promise((resolve, reject) => {
-            HttpUtil.post('/xray/generateRealityKeyPair')
+            HttpUtil.post('/server/generateRealityKeyPair')
                 .then(response => {
                     if (response.success) {
                         const keyPair = response.obj;
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BalancerController struct {
+	BaseController
+
+	balancerService service.BalancerService
+	xrayService     service.XrayService
+}
+
+func NewBalancerController(xrayService service.XrayService) *BalancerController {
+	return &BalancerController{
+		xrayService: xrayService,
+	}
+}
+
+func (c *BalancerController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/balancer")
+	g.Use(c.checkLogin)
+
+	g.POST("/list", c.getBalancers)
+	g.POST("/add", c.addBalancer)
+	g.POST("/update/:id", c.updateBalancer)
+	g.POST("/del/:id", c.delBalancer)
+	g.POST("/health", c.getHealth)
+}
+
+func (a *BalancerController) getBalancers(c *gin.Context) {
+	balancers, err := a.balancerService.GetBalancers()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, balancers, nil)
+}
+
+func (a *BalancerController) addBalancer(c *gin.Context) {
+	balancer := &model.Balancer{}
+	err := c.ShouldBind(balancer)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	err = a.balancerService.AddBalancer(balancer)
+	jsonMsg(c, "添加", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *BalancerController) updateBalancer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	balancer := &model.Balancer{
+		Id: id,
+	}
+	err = c.ShouldBind(balancer)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	err = a.balancerService.UpdateBalancer(balancer)
+	jsonMsg(c, "修改", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *BalancerController) delBalancer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.balancerService.DelBalancer(id)
+	jsonMsg(c, "删除", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// getHealth 返回 xray 观测到的出站连通性和延迟
+func (a *BalancerController) getHealth(c *gin.Context) {
+	statuses, err := a.balancerService.GetOutboundHealth()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, statuses, nil)
+}
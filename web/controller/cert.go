@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CertController struct {
+	BaseController
+
+	certService *service.CertService
+	xrayService service.XrayService
+}
+
+func NewCertController(g *gin.RouterGroup, certService *service.CertService, xrayService service.XrayService) *CertController {
+	a := &CertController{
+		certService: certService,
+		xrayService: xrayService,
+	}
+	a.initRouter(g)
+	return a
+}
+
+func (a *CertController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/cert")
+
+	g.Use(a.checkLogin)
+	g.POST("/list", a.getCertificates)
+	g.POST("/inventory", a.getInventory)
+	g.POST("/dnsProviders", a.getDNSProviders)
+	g.POST("/issue", a.issueCertificate)
+	g.POST("/upload", a.uploadCertificate)
+	g.POST("/generate", a.generateCertificate)
+	g.POST("/apply", a.applyCertificate)
+	g.POST("/renew/:id", a.renewCertificate)
+	g.POST("/del/:id", a.delCertificate)
+}
+
+func (a *CertController) getCertificates(c *gin.Context) {
+	certs, err := a.certService.GetCertificates()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, certs, nil)
+}
+
+func (a *CertController) getInventory(c *gin.Context) {
+	infos, err := a.certService.ScanCertificates()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, infos, nil)
+}
+
+func (a *CertController) getDNSProviders(c *gin.Context) {
+	jsonObj(c, a.certService.GetDNSProviders(), nil)
+}
+
+func (a *CertController) issueCertificate(c *gin.Context) {
+	cert := &model.Certificate{}
+	err := c.ShouldBind(cert)
+	if err != nil {
+		jsonMsg(c, "申请证书", err)
+		return
+	}
+	cert.Id = 0
+	err = a.certService.IssueCertificate(cert)
+	jsonMsg(c, "申请证书", err)
+}
+
+func (a *CertController) uploadCertificate(c *gin.Context) {
+	cert := &model.Certificate{}
+	err := c.ShouldBind(cert)
+	if err != nil {
+		jsonMsg(c, "上传证书", err)
+		return
+	}
+	cert.Id = 0
+	err = a.certService.UploadCertificate(cert)
+	jsonMsg(c, "上传证书", err)
+}
+
+func (a *CertController) generateCertificate(c *gin.Context) {
+	opts := &service.CertGenerateOptions{}
+	err := c.ShouldBind(opts)
+	if err != nil {
+		jsonMsg(c, "生成证书", err)
+		return
+	}
+	cert, err := a.certService.GenerateCertificate(opts)
+	jsonMsgObj(c, "生成证书", cert, err)
+	if err == nil && opts.Apply != "" {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *CertController) applyCertificate(c *gin.Context) {
+	name := c.PostForm("name")
+	target := c.PostForm("target")
+	err := a.certService.ApplyCertificate(name, target)
+	jsonMsg(c, "应用证书", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *CertController) renewCertificate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "续期证书", err)
+		return
+	}
+	err = a.certService.RenewCertificate(id)
+	jsonMsg(c, "续期证书", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *CertController) delCertificate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.certService.DelCertificate(id)
+	jsonMsg(c, "删除", err)
+}
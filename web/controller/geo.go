@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GeoController struct {
+	BaseController
+
+	geoService  service.GeoService
+	xrayService service.XrayService
+}
+
+func NewGeoController(xrayService service.XrayService) *GeoController {
+	return &GeoController{
+		xrayService: xrayService,
+	}
+}
+
+func (c *GeoController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/geo")
+	g.Use(c.checkLogin)
+
+	g.POST("/files", c.getGeoFiles)
+	g.POST("/update", c.updateGeoFiles)
+	g.POST("/custom/list", c.getCustomLists)
+	g.POST("/custom/add", c.addCustomList)
+	g.POST("/custom/update/:id", c.updateCustomList)
+	g.POST("/custom/del/:id", c.delCustomList)
+}
+
+// restartXray xray 只在启动时加载 geo 文件，配置没有变化，需要强制重启
+func (a *GeoController) restartXray() {
+	if !a.xrayService.IsXrayRunning() {
+		return
+	}
+	if err := a.xrayService.RestartXray(true); err != nil {
+		logger.Warning("重启 xray 失败:", err)
+	}
+}
+
+func (a *GeoController) getGeoFiles(c *gin.Context) {
+	files, err := a.geoService.GetGeoFiles()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, files, nil)
+}
+
+func (a *GeoController) updateGeoFiles(c *gin.Context) {
+	updated, err := a.geoService.UpdateGeoFiles()
+	if updated {
+		a.restartXray()
+	}
+	jsonMsgObj(c, "更新 geo 文件", updated, err)
+}
+
+func (a *GeoController) getCustomLists(c *gin.Context) {
+	lists, err := a.geoService.GetCustomLists()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, lists, nil)
+}
+
+func (a *GeoController) addCustomList(c *gin.Context) {
+	list := &model.GeoCustomList{}
+	err := c.ShouldBind(list)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	err = a.geoService.AddCustomList(list)
+	jsonMsgObj(c, "添加", list, err)
+	if err == nil {
+		a.restartXray()
+	}
+}
+
+func (a *GeoController) updateCustomList(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	list := &model.GeoCustomList{
+		Id: id,
+	}
+	err = c.ShouldBind(list)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	err = a.geoService.UpdateCustomList(list)
+	jsonMsg(c, "修改", err)
+	if err == nil {
+		a.restartXray()
+	}
+}
+
+func (a *GeoController) delCustomList(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.geoService.DelCustomList(id)
+	jsonMsg(c, "删除", err)
+	if err == nil {
+		a.restartXray()
+	}
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"net/http"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthController 提供无需登录的存活与就绪探针
+type HealthController struct {
+	healthService *service.HealthService
+}
+
+func NewHealthController(g *gin.RouterGroup, healthService *service.HealthService) *HealthController {
+	a := &HealthController{
+		healthService: healthService,
+	}
+	a.initRouter(g)
+	return a
+}
+
+func (a *HealthController) initRouter(g *gin.RouterGroup) {
+	g.GET("/healthz", a.healthz)
+	g.GET("/readyz", a.readyz)
+}
+
+func healthResponse(c *gin.Context, checks []*service.HealthCheck, ok bool) {
+	code := http.StatusOK
+	status := "ok"
+	if !ok {
+		code = http.StatusServiceUnavailable
+		status = "fail"
+	}
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+func (a *HealthController) healthz(c *gin.Context) {
+	checks, ok := a.healthService.Liveness()
+	healthResponse(c, checks, ok)
+}
+
+func (a *HealthController) readyz(c *gin.Context) {
+	checks, ok := a.healthService.Readiness()
+	healthResponse(c, checks, ok)
+}
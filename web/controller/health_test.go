@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"x-ui/database"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeHealthXrayService 模拟 xray 的运行状态和 API 端口
+type fakeHealthXrayService struct {
+	service.XrayService
+	running bool
+	apiPort int
+}
+
+func (s *fakeHealthXrayService) IsXrayRunning() bool {
+	return s.running
+}
+
+func (s *fakeHealthXrayService) GetXrayAPIPort() int {
+	return s.apiPort
+}
+
+type healthBody struct {
+	Status string                 `json:"status"`
+	Checks []*service.HealthCheck `json:"checks"`
+}
+
+func getHealth(t *testing.T, engine *gin.Engine, path string) (int, healthBody) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	body := healthBody{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%v 返回 %q: %v", path, w.Body.String(), err)
+	}
+	return w.Code, body
+}
+
+func newHealthTestEngine(t *testing.T, xrayService service.XrayService) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	healthService := service.NewHealthService(context.Background())
+	healthService.SetXrayService(xrayService)
+	NewHealthController(engine.Group("/"), healthService)
+	return engine
+}
+
+func TestHealthz(t *testing.T) {
+	initTestDB(t)
+	// 存活探针不依赖 xray
+	engine := newHealthTestEngine(t, &fakeHealthXrayService{})
+
+	code, body := getHealth(t, engine, "/healthz")
+	if code != http.StatusOK || body.Status != "ok" || len(body.Checks) != 1 || body.Checks[0].Name != "db" || !body.Checks[0].OK {
+		t.Fatalf("数据库可用时返回 %d %+v", code, body)
+	}
+
+	sqlDB, err := database.GetDB().DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+	code, body = getHealth(t, engine, "/healthz")
+	if code != http.StatusServiceUnavailable || body.Status != "fail" || body.Checks[0].OK || body.Checks[0].Error == "" {
+		t.Fatalf("数据库不可用时返回 %d %+v", code, body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	initTestDB(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	apiPort := listener.Addr().(*net.TCPAddr).Port
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	cases := []struct {
+		name        string
+		xrayService *fakeHealthXrayService
+		want        int
+		// 期望各项检查的结果: db、xray、xrayApi
+		checks []bool
+	}{
+		{"xray 未运行", &fakeHealthXrayService{}, http.StatusServiceUnavailable, []bool{true, false, false}},
+		{"API 端口无法连接", &fakeHealthXrayService{running: true, apiPort: closedPort}, http.StatusServiceUnavailable, []bool{true, true, false}},
+		{"就绪", &fakeHealthXrayService{running: true, apiPort: apiPort}, http.StatusOK, []bool{true, true, true}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			code, body := getHealth(t, newHealthTestEngine(t, c.xrayService), "/readyz")
+			if code != c.want || len(body.Checks) != len(c.checks) {
+				t.Fatalf("返回 %d %+v，期望 %d", code, body, c.want)
+			}
+			for i, name := range []string{"db", "xray", "xrayApi"} {
+				if body.Checks[i].Name != name || body.Checks[i].OK != c.checks[i] {
+					t.Fatalf("检查 %v 为 %+v，期望 %v", name, body.Checks[i], c.checks[i])
+				}
+			}
+		})
+	}
+}
@@ -1,10 +1,15 @@
 package controller
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"net"
 	"strconv"
+	"strings"
 	"x-ui/database/model"
 	"x-ui/logger"
+	"x-ui/util/keygen"
+	"x-ui/web/event"
 	"x-ui/web/global"
 	"x-ui/web/service"
 	"x-ui/web/session"
@@ -13,24 +18,40 @@ import (
 )
 
 type InboundController struct {
-	inboundService service.InboundService
-	xrayService    service.XrayService
-	router         *gin.RouterGroup
+	BaseController
+
+	inboundService  service.InboundService
+	xrayService     service.XrayService
+	realityService  service.RealityService
+	wgService       service.WireGuardService
+	fallbackService service.FallbackService
+	router          *gin.RouterGroup
 }
 
-func NewInboundController(router *gin.RouterGroup) *InboundController {
+func NewInboundController(router *gin.RouterGroup, xrayService service.XrayService) *InboundController {
 	return &InboundController{
-		router: router,
+		router:      router,
+		xrayService: xrayService,
 	}
 }
 
 func (c *InboundController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/inbound")
+	g.Use(c.checkLogin)
 
 	g.POST("/list", c.getInbounds)
 	g.POST("/add", c.addInbound)
 	g.POST("/del/:id", c.delInbound)
 	g.POST("/update/:id", c.updateInbound)
+	g.POST("/reality/probe", c.probeRealityDest)
+	g.POST("/reality/add", c.addRealityInbound)
+	g.POST("/wireguard/genKey", c.genWireGuardKey)
+	g.POST("/wireguard/addPeer/:id", c.addWireGuardPeer)
+	g.POST("/wireguard/delPeer/:id", c.delWireGuardPeer)
+	g.POST("/wireguard/peerConfig/:id", c.getWireGuardPeerConfig)
+	g.POST("/socksLinks/:id", c.getSocksLinks)
+	g.POST("/fallbacks/:id", c.getFallbacks)
+	g.POST("/fallbacks/set/:id", c.setFallbacks)
 }
 
 func (a *InboundController) startTask() {
@@ -66,14 +87,23 @@ func (a *InboundController) addInbound(c *gin.Context) {
 	user := session.GetLoginUser(c)
 	inbound.UserId = user.Id
 	inbound.Enable = true
-	inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
 	err = a.inboundService.AddInbound(inbound)
-	jsonMsg(c, "添加", err)
+	jsonMsgObj(c, "添加", validationErrors(err), err)
 	if err == nil {
 		a.xrayService.SetToNeedRestart()
+		event.Publish(event.InboundCreated, inbound)
 	}
 }
 
+// validationErrors 配置校验失败时返回字段错误，便于前端定位
+func validationErrors(err error) interface{} {
+	var validationErr *service.InboundValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Errors
+	}
+	return nil
+}
+
 func (a *InboundController) delInbound(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -84,6 +114,7 @@ func (a *InboundController) delInbound(c *gin.Context) {
 	jsonMsg(c, "删除", err)
 	if err == nil {
 		a.xrayService.SetToNeedRestart()
+		event.Publish(event.InboundDeleted, gin.H{"id": id})
 	}
 }
 
@@ -101,10 +132,143 @@ func (a *InboundController) updateInbound(c *gin.Context) {
 		jsonMsg(c, "修改", err)
 		return
 	}
-	err = a.inboundService.UpdateInbound(inbound)
-	jsonMsg(c, "修改", err)
+	warnings, err := a.inboundService.UpdateInboundWithWarnings(inbound)
+	if err != nil {
+		jsonMsgObj(c, "修改", validationErrors(err), err)
+		return
+	}
+	// 旧入站原本就存在的配置错误允许保存，作为警告返回
+	jsonMsgObj(c, "修改", warnings, nil)
+	a.xrayService.SetToNeedRestart()
+	event.Publish(event.InboundUpdated, inbound)
+}
+
+func (a *InboundController) probeRealityDest(c *gin.Context) {
+	result, err := a.realityService.ProbeDest(c.PostForm("dest"), strings.Split(c.PostForm("serverNames"), ","))
+	jsonObj(c, result, err)
+}
+
+func (a *InboundController) addRealityInbound(c *gin.Context) {
+	opts := &service.RealityInboundOptions{}
+	err := c.ShouldBind(opts)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	inbound, result, err := a.realityService.CreateRealityInbound(user.Id, opts)
+	if err != nil {
+		// 探测失败时返回探测结果，便于前端展示原因
+		jsonMsgObj(c, "添加", result, err)
+		return
+	}
+	jsonMsgObj(c, "添加", inbound, nil)
+	a.xrayService.SetToNeedRestart()
+	event.Publish(event.InboundCreated, inbound)
+}
+
+// shareHost 客户端配置中使用的服务器地址，未指定时使用访问面板的域名
+func shareHost(c *gin.Context) string {
+	if host := c.PostForm("host"); host != "" {
+		return host
+	}
+	host, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		return c.Request.Host
+	}
+	return host
+}
+
+func (a *InboundController) genWireGuardKey(c *gin.Context) {
+	privateKey, publicKey, err := keygen.GenerateWireGuardKey()
+	jsonObj(c, gin.H{"privateKey": privateKey, "publicKey": publicKey}, err)
+}
+
+func (a *InboundController) addWireGuardPeer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	opts := &service.WireGuardPeerOptions{}
+	err = c.ShouldBind(opts)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	peer, err := a.wgService.AddPeer(id, opts)
+	if err != nil {
+		jsonMsgObj(c, "添加", validationErrors(err), err)
+		return
+	}
+	jsonMsgObj(c, "添加", peer, nil)
+	a.xrayService.SetToNeedRestart()
+	event.Publish(event.InboundUpdated, gin.H{"id": id})
+}
+
+func (a *InboundController) delWireGuardPeer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.wgService.DelPeer(id, c.PostForm("publicKey"))
+	jsonMsgObj(c, "删除", validationErrors(err), err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+		event.Publish(event.InboundUpdated, gin.H{"id": id})
+	}
+}
+
+func (a *InboundController) getWireGuardPeerConfig(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	config, err := a.wgService.GetPeerConfig(id, c.PostForm("publicKey"), shareHost(c))
+	jsonObj(c, config, err)
+}
+
+func (a *InboundController) getSocksLinks(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	links, err := a.inboundService.GetSocksLinks(id, shareHost(c))
+	jsonObj(c, links, err)
+}
+
+func (a *InboundController) getFallbacks(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	fallbacks, err := a.fallbackService.GetFallbacks(id)
+	jsonObj(c, fallbacks, err)
+}
+
+// setFallbacks fallbacks 参数为回落列表的 JSON 数组
+func (a *InboundController) setFallbacks(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	fallbacks := make([]*model.InboundFallback, 0)
+	if data := c.PostForm("fallbacks"); data != "" {
+		if err := json.Unmarshal([]byte(data), &fallbacks); err != nil {
+			jsonMsg(c, "修改", err)
+			return
+		}
+	}
+	err = a.fallbackService.SetFallbacks(id, fallbacks)
+	jsonMsgObj(c, "修改", validationErrors(err), err)
 	if err == nil {
 		a.xrayService.SetToNeedRestart()
+		event.Publish(event.InboundUpdated, gin.H{"id": id})
 	}
 }
 
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/web/service"
+)
+
+// fakeXrayService 只记录是否需要重启 xray
+type fakeXrayService struct {
+	service.XrayService
+	needRestart bool
+}
+
+func (s *fakeXrayService) SetToNeedRestart() {
+	s.needRestart = true
+}
+
+func TestDelInboundRestartsXray(t *testing.T) {
+	initTestDB(t)
+	inbound := &model.Inbound{Port: 20000, Tag: "inbound-20000", Protocol: model.Socks, Settings: `{"auth":"noauth"}`}
+	if err := database.GetDB().Create(inbound).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	engine := newTestEngine(t)
+	xrayService := &fakeXrayService{}
+	NewXUIController(engine.Group("/"), xrayService)
+	cookies := testLogin(t, engine)
+
+	msg := postForm(t, engine, "/xui/inbound/del/"+strconv.Itoa(inbound.Id), url.Values{}, cookies)
+	if !msg.Success {
+		t.Fatalf("删除入站返回 %+v", msg)
+	}
+	if !xrayService.needRestart {
+		t.Fatal("删除入站后没有通知 xray 重启")
+	}
+}
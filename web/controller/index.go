@@ -3,6 +3,7 @@ package controller
 import (
 	"net/http"
 	"x-ui/logger"
+	"x-ui/web/event"
 	"x-ui/web/service"
 	"x-ui/web/session"
 
@@ -18,6 +19,7 @@ type IndexController struct {
 	router *gin.RouterGroup
 
 	userService service.UserService
+	tgbot       service.Tgbot
 }
 
 func NewIndexController(router *gin.RouterGroup) *IndexController {
@@ -57,6 +59,8 @@ func (a *IndexController) login(c *gin.Context) {
 	}
 	user := a.userService.CheckUser(form.Username, form.Password)
 	if user == nil {
+		service.LoginFailureCounter.Inc(nil)
+		event.Publish(event.LoginFailure, gin.H{"username": form.Username, "ip": getRemoteIp(c)})
 		logger.Infof("wrong username or password: \"%s\" \"%s\"", form.Username, form.Password)
 		pureJsonMsg(c, false, "用户名或密码错误")
 		return
@@ -64,6 +68,10 @@ func (a *IndexController) login(c *gin.Context) {
 
 	err = session.SetLoginUser(c, user)
 	logger.Info("user", user.Id, "login success")
+	if err == nil {
+		go a.tgbot.NotifyLogin(user.Username, getRemoteIp(c))
+		event.Publish(event.LoginSuccess, gin.H{"username": user.Username, "ip": getRemoteIp(c)})
+	}
 	jsonMsg(c, "登录", err)
 }
 
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct {
+	metricsService *service.MetricsService
+	settingService service.SettingService
+}
+
+func NewMetricsController(g *gin.RouterGroup, metricsService *service.MetricsService) *MetricsController {
+	a := &MetricsController{
+		metricsService: metricsService,
+	}
+	a.initRouter(g)
+	return a
+}
+
+func (a *MetricsController) initRouter(g *gin.RouterGroup) {
+	g.GET("/metrics", a.checkAccess, a.metrics)
+}
+
+// checkAccess 校验 Bearer Token，未设置 Token 时拒绝访问
+//
+// 面板常部署在反向代理之后，代理转发的请求来源都是本机，不能以来源地址判断是否可信
+func (a *MetricsController) checkAccess(c *gin.Context) {
+	enable, err := a.settingService.GetMetricsEnable()
+	if err != nil || !enable {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	token, err := a.settingService.GetMetricsToken()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if token == "" {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	auth, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Next()
+}
+
+func (a *MetricsController) metrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := a.metricsService.WriteMetrics(c.Writer); err != nil {
+		logger.Warning("输出监控指标失败:", err)
+	}
+}
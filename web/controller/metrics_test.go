@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsAccess(t *testing.T) {
+	initTestDB(t)
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	NewMetricsController(engine.Group("/"), service.NewMetricsService(context.Background()))
+
+	get := func(auth string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get(""); w.Code != http.StatusNotFound {
+		t.Fatalf("未开启时返回 %d，期望 404", w.Code)
+	}
+	setTestSetting(t, "metricsEnable", "true")
+	if w := get("Bearer "); w.Code != http.StatusForbidden {
+		t.Fatalf("未设置 Token 时返回 %d，期望 403", w.Code)
+	}
+
+	token := "0123456789abcdef"
+	setTestSetting(t, "metricsToken", token)
+	for _, auth := range []string{"", token, "Bearer wrong-token", "Basic " + token} {
+		if w := get(auth); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Authorization 为 %q 时返回 %d，期望 401", auth, w.Code)
+		}
+	}
+	w := get("Bearer " + token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Token 正确时返回 %d，期望 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "# TYPE xui_inbound_up_bytes_total counter\n") {
+		t.Fatalf("输出中没有入站流量指标:\n%s", w.Body.String())
+	}
+}
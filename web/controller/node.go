@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+	"x-ui/xray"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NodeController struct {
+	BaseController
+
+	nodeService *service.NodeService
+}
+
+func NewNodeController(g *gin.RouterGroup, nodeService *service.NodeService) *NodeController {
+	a := &NodeController{
+		nodeService: nodeService,
+	}
+	a.initRouter(g)
+	return a
+}
+
+func (a *NodeController) initRouter(g *gin.RouterGroup) {
+	// agent 以客户端证书认证，不经过登录检查
+	g.POST("/node/agent/traffic", a.checkAgentCert, a.addAgentTraffic)
+
+	g = g.Group("/node")
+
+	g.Use(a.checkLogin)
+	g.POST("/list", a.getOverview)
+	g.POST("/add", a.addNode)
+	g.POST("/update/:id", a.updateNode)
+	g.POST("/del/:id", a.delNode)
+	g.POST("/sync/:id", a.syncNode)
+	g.POST("/snapshot/:id", a.getSnapshot)
+	g.POST("/traffic/:id", a.getNodeTraffics)
+	g.POST("/inbound/add/:id", a.addNodeInbound)
+	g.POST("/inbound/update/:id/:inboundId", a.updateNodeInbound)
+	g.POST("/inbound/del/:id/:inboundId", a.delNodeInbound)
+	g.POST("/inbound/set/:id", a.setNodeInbounds)
+}
+
+// checkAgentCert 要求请求携带由节点CA签发的客户端证书，证书的 CommonName 对应 agent 节点名称
+//
+// TLS 握手时只索取客户端证书，在这里校验，证书无效时返回 403 而不是断开连接
+func (a *NodeController) checkAgentCert(c *gin.Context) {
+	tlsState := c.Request.TLS
+	if tlsState == nil || len(tlsState.PeerCertificates) == 0 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	pool, err := a.nodeService.GetNodeCertPool()
+	if err != nil || pool == nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	leaf := tlsState.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range tlsState.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	node, err := a.nodeService.GetAgentNode(leaf.Subject.CommonName)
+	if err != nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	c.Set("agentNode", node)
+	c.Next()
+}
+
+func (a *NodeController) getOverview(c *gin.Context) {
+	overviews, err := a.nodeService.GetOverview()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, overviews, nil)
+}
+
+func (a *NodeController) addNode(c *gin.Context) {
+	node := &model.Node{}
+	err := c.ShouldBind(node)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	err = a.nodeService.AddNode(node)
+	jsonMsgObj(c, "添加", node, err)
+}
+
+func (a *NodeController) updateNode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	node := &model.Node{}
+	err = c.ShouldBind(node)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	node.Id = id
+	err = a.nodeService.UpdateNode(node)
+	jsonMsg(c, "修改", err)
+}
+
+func (a *NodeController) delNode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.nodeService.DelNode(id)
+	jsonMsg(c, "删除", err)
+}
+
+func (a *NodeController) syncNode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "同步", err)
+		return
+	}
+	node, err := a.nodeService.GetNode(id)
+	if err != nil {
+		jsonMsg(c, "同步", err)
+		return
+	}
+	snapshot, err := a.nodeService.SyncNode(node)
+	jsonMsgObj(c, "同步", snapshot, err)
+}
+
+func (a *NodeController) getSnapshot(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	snapshot, err := a.nodeService.GetSnapshot(id)
+	jsonObj(c, snapshot, err)
+}
+
+func (a *NodeController) addNodeInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	inbound := &model.Inbound{}
+	err = c.ShouldBind(inbound)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	err = a.nodeService.AddNodeInbound(id, inbound)
+	jsonMsg(c, "添加", err)
+}
+
+func (a *NodeController) updateNodeInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	inboundId, err := strconv.Atoi(c.Param("inboundId"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	inbound := &model.Inbound{}
+	err = c.ShouldBind(inbound)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	inbound.Id = inboundId
+	err = a.nodeService.UpdateNodeInbound(id, inbound)
+	jsonMsg(c, "修改", err)
+}
+
+func (a *NodeController) delNodeInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	inboundId, err := strconv.Atoi(c.Param("inboundId"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.nodeService.DelNodeInbound(id, inboundId)
+	jsonMsg(c, "删除", err)
+}
+
+func (a *NodeController) setNodeInbounds(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "下发", err)
+		return
+	}
+	inbounds := make([]*model.Inbound, 0)
+	err = json.Unmarshal([]byte(c.PostForm("inbounds")), &inbounds)
+	if err != nil {
+		jsonMsg(c, "下发", err)
+		return
+	}
+	err = a.nodeService.SetNodeInbounds(id, inbounds)
+	jsonMsg(c, "下发", err)
+}
+
+// addAgentTraffic 接收 agent 上报的一批流量增量，seq 为该批次的序号
+func (a *NodeController) addAgentTraffic(c *gin.Context) {
+	node := c.MustGet("agentNode").(*model.Node)
+	seq, err := strconv.ParseInt(c.PostForm("seq"), 10, 64)
+	if err != nil {
+		jsonMsg(c, "上报流量", err)
+		return
+	}
+	traffics := make([]*xray.Traffic, 0)
+	err = json.Unmarshal([]byte(c.PostForm("traffics")), &traffics)
+	if err != nil {
+		jsonMsg(c, "上报流量", err)
+		return
+	}
+	err = a.nodeService.AddAgentTraffic(node, seq, traffics)
+	jsonMsg(c, "上报流量", err)
+}
+
+func (a *NodeController) getNodeTraffics(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	traffics, err := a.nodeService.GetNodeTraffics(id)
+	jsonObj(c, traffics, err)
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/pki"
+	"x-ui/web/entity"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testCA 测试用的私有CA
+type testCA struct {
+	certPem []byte
+	keyPem  []byte
+	pool    *x509.CertPool
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	certPem, keyPem, err := pki.GenerateCA(&pki.Options{CommonName: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPem)
+	return &testCA{certPem: certPem, keyPem: keyPem, pool: pool}
+}
+
+// issue 签发同时可用作服务器和客户端的证书
+func (ca *testCA) issue(t *testing.T, commonName string, hosts ...string) tls.Certificate {
+	t.Helper()
+	certPem, keyPem, err := pki.GenerateLeaf(&pki.Options{CommonName: commonName, Hosts: hosts}, ca.certPem, ca.keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// newAgentTrafficServer 按面板的方式启动 HTTPS 服务：设置了节点CA，握手时只索取客户端证书
+func newAgentTrafficServer(t *testing.T, ca *testCA) *httptest.Server {
+	t.Helper()
+	initTestDB(t)
+	err := database.GetDB().Create(&model.Certificate{
+		Name:    "node-ca",
+		Source:  service.CertSourceCA,
+		CertPem: string(ca.certPem),
+		KeyPem:  string(ca.keyPem),
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTestSetting(t, "nodeCaName", "node-ca")
+	err = database.GetDB().Create(&model.Node{Name: "agent-1", Mode: model.NodeModeAgent, Enable: true}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	NewNodeController(engine.Group("/"), service.NewNodeService(context.Background()))
+	server := httptest.NewUnstartedServer(engine)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "panel", "127.0.0.1")},
+		ClientAuth:   tls.RequestClientCert,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// postAgentTraffic 以给定的客户端证书上报一批流量，cert 为 nil 时不出示证书
+func postAgentTraffic(t *testing.T, server *httptest.Server, ca *testCA, cert *tls.Certificate, seq string, traffics string) *http.Response {
+	t.Helper()
+	tlsConfig := &tls.Config{RootCAs: ca.pool}
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	form := url.Values{"seq": {seq}, "traffics": {traffics}}
+	resp, err := client.Post(server.URL+"/node/agent/traffic", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestCheckAgentCert(t *testing.T) {
+	ca := newTestCA(t, "node-ca")
+	server := newAgentTrafficServer(t, ca)
+
+	agentCert := ca.issue(t, "agent-1")
+	unknownCert := ca.issue(t, "agent-2")
+	otherCert := newTestCA(t, "other-ca").issue(t, "agent-1")
+	cases := []struct {
+		name string
+		cert *tls.Certificate
+		want int
+	}{
+		{"没有客户端证书", nil, http.StatusUnauthorized},
+		{"其他CA签发的证书", &otherCert, http.StatusForbidden},
+		{"未知的节点名称", &unknownCert, http.StatusForbidden},
+		{"节点证书", &agentCert, http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := postAgentTraffic(t, server, ca, c.cert, "1", "[]")
+			if resp.StatusCode != c.want {
+				t.Fatalf("返回 %d，期望 %d", resp.StatusCode, c.want)
+			}
+		})
+	}
+}
+
+func TestAgentTrafficIgnoresReplayedSeq(t *testing.T) {
+	ca := newTestCA(t, "node-ca")
+	server := newAgentTrafficServer(t, ca)
+	agentCert := ca.issue(t, "agent-1")
+
+	traffics := `[{"isInbound":true,"tag":"in-1","up":100,"down":200}]`
+	for _, seq := range []string{"10", "10", "9", "11"} {
+		resp := postAgentTraffic(t, server, ca, &agentCert, seq, traffics)
+		msg := entity.Msg{}
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		// 重复的批次也要确认，agent 才会停止重试
+		if !msg.Success {
+			t.Fatalf("seq %v 返回 %+v", seq, msg)
+		}
+	}
+
+	nodeTraffics := make([]*model.NodeTraffic, 0)
+	if err := database.GetDB().Find(&nodeTraffics).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeTraffics) != 1 || nodeTraffics[0].Up != 200 || nodeTraffics[0].Down != 400 {
+		t.Fatalf("节点流量为 %+v，期望只累加 seq 10 和 11 两批", nodeTraffics)
+	}
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OutboundController struct {
+	BaseController
+
+	outboundTrafficService   service.OutboundTrafficService
+	wireGuardOutboundService service.WireGuardOutboundService
+	xrayService              service.XrayService
+}
+
+func NewOutboundController(xrayService service.XrayService) *OutboundController {
+	return &OutboundController{
+		xrayService: xrayService,
+	}
+}
+
+func (c *OutboundController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/outbound")
+	g.Use(c.checkLogin)
+
+	g.POST("/traffic", c.getTraffic)
+	g.POST("/history", c.getHistory)
+	g.POST("/resetTraffic", c.resetTraffic)
+	g.POST("/wireguard/list", c.getWireGuardOutbounds)
+	g.POST("/wireguard/add", c.addWireGuardOutbound)
+	g.POST("/wireguard/import", c.importWireGuardProfile)
+	g.POST("/wireguard/warp", c.registerWarp)
+	g.POST("/wireguard/update/:id", c.updateWireGuardOutbound)
+	g.POST("/wireguard/del/:id", c.delWireGuardOutbound)
+}
+
+func (a *OutboundController) getTraffic(c *gin.Context) {
+	overview, err := a.outboundTrafficService.GetOverview()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, overview, nil)
+}
+
+// getHistory 表单参数 tag 为空时返回所有出站，hours 默认 24
+func (a *OutboundController) getHistory(c *gin.Context) {
+	hours, _ := strconv.Atoi(c.PostForm("hours"))
+	histories, err := a.outboundTrafficService.GetHistory(c.PostForm("tag"), hours)
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, histories, nil)
+}
+
+func (a *OutboundController) resetTraffic(c *gin.Context) {
+	err := a.outboundTrafficService.ResetTraffic(c.PostForm("tag"))
+	jsonMsg(c, "重置流量", err)
+}
+
+func (a *OutboundController) getWireGuardOutbounds(c *gin.Context) {
+	outbounds, err := a.wireGuardOutboundService.GetOutbounds()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, outbounds, nil)
+}
+
+func (a *OutboundController) addWireGuardOutbound(c *gin.Context) {
+	outbound := &model.WireGuardOutbound{}
+	err := c.ShouldBind(outbound)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	err = a.wireGuardOutboundService.AddOutbound(outbound)
+	jsonMsgObj(c, "添加", outbound, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// importWireGuardProfile 表单参数 profile 为 wgcf-profile.conf 的内容
+func (a *OutboundController) importWireGuardProfile(c *gin.Context) {
+	outbound, err := a.wireGuardOutboundService.ImportProfile(
+		c.PostForm("tag"), c.PostForm("profile"), c.PostForm("reserved"), c.PostForm("domains"))
+	jsonMsgObj(c, "导入", outbound, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *OutboundController) registerWarp(c *gin.Context) {
+	outbound, err := a.wireGuardOutboundService.RegisterWarp(c.PostForm("tag"), c.PostForm("domains"))
+	jsonMsgObj(c, "注册 WARP", outbound, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *OutboundController) updateWireGuardOutbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	outbound := &model.WireGuardOutbound{
+		Id: id,
+	}
+	err = c.ShouldBind(outbound)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	err = a.wireGuardOutboundService.UpdateOutbound(outbound)
+	jsonMsg(c, "修改", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *OutboundController) delWireGuardOutbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.wireGuardOutboundService.DelOutbound(id)
+	jsonMsg(c, "删除", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
@@ -1,13 +1,21 @@
 package controller
 
 import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
 	"time"
+	"x-ui/util/keygen"
 	"x-ui/web/global"
 	"x-ui/web/service"
 
 	"github.com/gin-gonic/gin"
 )
 
+// xrayZipMaxSize 上传的 Xray 安装包大小上限
+var xrayZipMaxSize int64 = 200 << 20
+
 type ServerController struct {
 	BaseController
 
@@ -22,9 +30,10 @@ type ServerController struct {
 	router *gin.RouterGroup
 }
 
-func NewServerController(router *gin.RouterGroup) *ServerController {
+func NewServerController(router *gin.RouterGroup, serverService service.ServerService) *ServerController {
 	a := &ServerController{
 		router:            router,
+		serverService:     serverService,
 		lastGetStatusTime: time.Now(),
 	}
 	a.initRouter(router)
@@ -39,6 +48,14 @@ func (a *ServerController) initRouter(g *gin.RouterGroup) {
 	g.POST("/status", a.status)
 	g.POST("/getXrayVersion", a.getXrayVersion)
 	g.POST("/installXray/:version", a.installXray)
+	g.POST("/uploadXray", a.uploadXray)
+	g.POST("/rollbackXray", a.rollbackXray)
+	g.POST("/getXrayBackupVersion", a.getXrayBackupVersion)
+	g.POST("/generateRealityKeyPair", a.generateRealityKeyPair)
+	g.POST("/realityPublicKey", a.getRealityPublicKey)
+	g.POST("/generateShortId", a.generateShortId)
+	g.POST("/generateUUID", a.generateUUID)
+	g.POST("/generateSS2022Key", a.generateSS2022Key)
 }
 
 func (a *ServerController) refreshStatus() {
@@ -87,3 +104,80 @@ func (a *ServerController) installXray(c *gin.Context) {
 	err := a.serverService.UpdateXray(version)
 	jsonMsg(c, "安装 xray", err)
 }
+
+// uploadXray 安装上传的 Xray 发布 ZIP，用于无法访问 GitHub 的服务器
+//
+// 表单参数 digest 可选，为 .dgst 文件的内容或 sha256 十六进制字符串
+func (a *ServerController) uploadXray(c *gin.Context) {
+	// 限制请求体大小，避免解析表单时把超大的上传写满临时目录；预留表单其他字段的空间
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, xrayZipMaxSize+1<<20)
+	file, err := c.FormFile("file")
+	if err != nil {
+		jsonMsg(c, "安装 xray", err)
+		return
+	}
+	if file.Size > xrayZipMaxSize {
+		jsonMsg(c, "安装 xray", errors.New("安装包过大"))
+		return
+	}
+	tmpFile, err := os.CreateTemp("", "xray-upload-*.zip")
+	if err != nil {
+		jsonMsg(c, "安装 xray", err)
+		return
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+	err = c.SaveUploadedFile(file, tmpFile.Name())
+	if err != nil {
+		jsonMsg(c, "安装 xray", err)
+		return
+	}
+	err = a.serverService.InstallXrayZip(tmpFile.Name(), c.PostForm("digest"))
+	jsonMsg(c, "安装 xray", err)
+}
+
+func (a *ServerController) rollbackXray(c *gin.Context) {
+	err := a.serverService.RollbackXray()
+	jsonMsg(c, "回滚 xray", err)
+}
+
+func (a *ServerController) getXrayBackupVersion(c *gin.Context) {
+	jsonObj(c, a.serverService.GetXrayBackupVersion(), nil)
+}
+
+func (a *ServerController) generateRealityKeyPair(c *gin.Context) {
+	privateKey, publicKey, err := keygen.GenerateX25519()
+	jsonObj(c, gin.H{"privateKey": privateKey, "publicKey": publicKey}, err)
+}
+
+// getRealityPublicKey 由私钥计算Reality公钥
+func (a *ServerController) getRealityPublicKey(c *gin.Context) {
+	publicKey, err := keygen.X25519PublicKey(c.PostForm("privateKey"))
+	jsonObj(c, gin.H{"publicKey": publicKey}, err)
+}
+
+// generateShortId 生成Reality shortId，默认8位
+func (a *ServerController) generateShortId(c *gin.Context) {
+	length := 8
+	if s := c.PostForm("length"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			jsonMsg(c, "生成 shortId", err)
+			return
+		}
+		length = n
+	}
+	shortId, err := keygen.GenerateShortId(length)
+	jsonObj(c, gin.H{"shortId": shortId}, err)
+}
+
+func (a *ServerController) generateUUID(c *gin.Context) {
+	uuid, err := keygen.GenerateUUID()
+	jsonObj(c, gin.H{"uuid": uuid}, err)
+}
+
+// generateSS2022Key 按加密方式生成 Shadowsocks 2022 密钥
+func (a *ServerController) generateSS2022Key(c *gin.Context) {
+	key, err := keygen.GenerateSS2022Key(c.PostForm("method"))
+	jsonObj(c, gin.H{"key": key}, err)
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"x-ui/web/entity"
+	"x-ui/web/service"
+)
+
+// fakeServerService 记录上传后安装的安装包内容
+type fakeServerService struct {
+	service.ServerService
+	installed []byte
+	digest    string
+}
+
+func (s *fakeServerService) InstallXrayZip(zipFileName string, digest string) error {
+	data, err := os.ReadFile(zipFileName)
+	if err != nil {
+		return err
+	}
+	s.installed = data
+	s.digest = digest
+	return nil
+}
+
+// postUpload 以 multipart 表单上传 size 字节的安装包
+func postUpload(t *testing.T, handler http.Handler, size int, digest string) (int, entity.Msg) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.WriteField("digest", digest); err != nil {
+		t.Fatal(err)
+	}
+	part, err := writer.CreateFormFile("file", "Xray-linux-64.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(bytes.Repeat([]byte{'x'}, size)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/xui/server/uploadXray", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	msg := entity.Msg{}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &msg); err != nil {
+			t.Fatalf("返回 %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, msg
+}
+
+func TestUploadXraySizeLimit(t *testing.T) {
+	maxSize := xrayZipMaxSize
+	xrayZipMaxSize = 1 << 10
+	t.Cleanup(func() { xrayZipMaxSize = maxSize })
+
+	engine := newTestEngine(t)
+	serverService := &fakeServerService{}
+	a := &ServerController{serverService: serverService}
+	a.initRouter(engine.Group("/xui"))
+	cookies := testLogin(t, engine)
+	// 带上登录 cookie 的 handler
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		engine.ServeHTTP(w, r)
+	})
+
+	_, msg := postUpload(t, handler, 1<<10, "SHA2-256= 00")
+	if !msg.Success {
+		t.Fatalf("上限以内的安装包返回 %+v", msg)
+	}
+	if len(serverService.installed) != 1<<10 || serverService.digest != "SHA2-256= 00" {
+		t.Fatalf("安装了 %d 字节，摘要 %q", len(serverService.installed), serverService.digest)
+	}
+
+	// 超过上限但在请求体限制以内，由文件大小检查拒绝
+	serverService.installed = nil
+	_, msg = postUpload(t, handler, 1<<10+1, "")
+	if msg.Success || msg.Msg != "安装 xray失败: 安装包过大" {
+		t.Fatalf("超过上限的安装包返回 %+v", msg)
+	}
+	// 超过请求体限制时在解析表单时中止
+	code, msg := postUpload(t, handler, 2<<20, "")
+	if code != http.StatusOK || msg.Success || !strings.Contains(msg.Msg, "request body too large") {
+		t.Fatalf("超过请求体限制的上传返回 %d %+v", code, msg)
+	}
+	if serverService.installed != nil {
+		t.Fatal("超过上限的安装包被安装")
+	}
+}
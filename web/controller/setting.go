@@ -4,6 +4,7 @@ import (
 	"errors"
 	"time"
 	"x-ui/web/entity"
+	"x-ui/web/event"
 	"x-ui/web/service"
 	"x-ui/web/session"
 
@@ -18,23 +19,27 @@ type updateUserForm struct {
 }
 
 type SettingController struct {
+	BaseController
+
 	settingService service.SettingService
 	userService    service.UserService
 	panelService   service.PanelService
-	router         *gin.RouterGroup
+	mailService    service.MailService
 }
 
-func NewSettingController(router *gin.RouterGroup) *SettingController {
-	return &SettingController{
-		router: router,
-	}
+func NewSettingController() *SettingController {
+	return &SettingController{}
 }
 
-func (c *SettingController) initRouter() {
-	c.router.POST("/all", c.getAllSetting)
-	c.router.POST("/update", c.updateSetting)
-	c.router.POST("/updateUser", c.updateUser)
-	c.router.POST("/restartPanel", c.restartPanel)
+func (c *SettingController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/setting")
+	g.Use(c.checkLogin)
+
+	g.POST("/all", c.getAllSetting)
+	g.POST("/update", c.updateSetting)
+	g.POST("/updateUser", c.updateUser)
+	g.POST("/restartPanel", c.restartPanel)
+	g.POST("/testMail", c.testMail)
 }
 
 func (a *SettingController) getAllSetting(c *gin.Context) {
@@ -55,6 +60,9 @@ func (a *SettingController) updateSetting(c *gin.Context) {
 	}
 	err = a.settingService.UpdateAllSetting(allSetting)
 	jsonMsg(c, "修改设置", err)
+	if err == nil {
+		event.Publish(event.SettingsChanged, nil)
+	}
 }
 
 func (a *SettingController) updateUser(c *gin.Context) {
@@ -87,6 +95,16 @@ func (a *SettingController) restartPanel(c *gin.Context) {
 	jsonMsg(c, "重启面板", err)
 }
 
+func (a *SettingController) testMail(c *gin.Context) {
+	to := c.PostForm("to")
+	if to == "" {
+		jsonMsg(c, "发送测试邮件", errors.New("收件人不能为空"))
+		return
+	}
+	err := a.mailService.SendTestMail(to)
+	jsonMsg(c, "发送测试邮件", err)
+}
+
 func (c *SettingController) index(ctx *gin.Context) {
 	ctx.HTML(200, "setting.html", nil)
 }
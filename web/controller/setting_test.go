@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/web/entity"
+	"x-ui/web/session"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+func initTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDB(filepath.Join(t.TempDir(), "x-ui.db")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setTestSetting(t *testing.T, key string, value string) {
+	t.Helper()
+	err := database.GetDB().Where(model.Setting{Key: key}).Assign(model.Setting{Value: value}).FirstOrCreate(&model.Setting{}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestEngine 创建带 session 的 gin 引擎，GET /testLogin 模拟登录
+func newTestEngine(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(sessions.Sessions("session", cookie.NewStore([]byte("test-secret"))))
+	engine.GET("/testLogin", func(c *gin.Context) {
+		if err := session.SetLoginUser(c, &model.User{Id: 1, Username: "admin", Password: "admin"}); err != nil {
+			t.Error(err)
+		}
+	})
+	return engine
+}
+
+// testLogin 登录并返回 session cookie
+func testLogin(t *testing.T, engine *gin.Engine) []*http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/testLogin", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("登录后没有返回 session cookie")
+	}
+	return cookies
+}
+
+// postForm 以 ajax 方式提交表单并解析返回的消息
+func postForm(t *testing.T, engine *gin.Engine, path string, form url.Values, cookies []*http.Cookie) entity.Msg {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%v 返回状态码 %d", path, w.Code)
+	}
+	msg := entity.Msg{}
+	if err := json.Unmarshal(w.Body.Bytes(), &msg); err != nil {
+		t.Fatalf("%v 返回 %q: %v", path, w.Body.String(), err)
+	}
+	return msg
+}
+
+func TestSettingRoutesRequireLogin(t *testing.T) {
+	engine := newTestEngine(t)
+	NewSettingController().initRouter(engine.Group("/xui"))
+
+	for _, path := range []string{"/xui/setting/all", "/xui/setting/update", "/xui/setting/updateUser", "/xui/setting/restartPanel", "/xui/setting/testMail"} {
+		msg := postForm(t, engine, path, url.Values{}, nil)
+		if msg.Success || msg.Msg != "登录时效已过，请重新登录" {
+			t.Fatalf("未登录时 %v 返回 %+v", path, msg)
+		}
+	}
+}
+
+func TestSettingTestMail(t *testing.T) {
+	engine := newTestEngine(t)
+	NewSettingController().initRouter(engine.Group("/xui"))
+	cookies := testLogin(t, engine)
+
+	msg := postForm(t, engine, "/xui/setting/testMail", url.Values{}, cookies)
+	if msg.Success || msg.Msg != "发送测试邮件失败: 收件人不能为空" {
+		t.Fatalf("没有收件人时返回 %+v", msg)
+	}
+}
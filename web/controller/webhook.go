@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/event"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController struct {
+	BaseController
+
+	webhookService *service.WebhookService
+}
+
+func NewWebhookController(g *gin.RouterGroup, webhookService *service.WebhookService) *WebhookController {
+	a := &WebhookController{
+		webhookService: webhookService,
+	}
+	a.initRouter(g)
+	return a
+}
+
+func (a *WebhookController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/webhook")
+
+	g.Use(a.checkLogin)
+	g.POST("/list", a.getWebhooks)
+	g.POST("/events", a.getEventTypes)
+	g.POST("/add", a.addWebhook)
+	g.POST("/update/:id", a.updateWebhook)
+	g.POST("/del/:id", a.delWebhook)
+	g.POST("/test/:id", a.testWebhook)
+	g.POST("/deliveries/:id", a.getDeliveries)
+}
+
+func (a *WebhookController) getWebhooks(c *gin.Context) {
+	webhooks, err := a.webhookService.GetWebhooks()
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, webhooks, nil)
+}
+
+func (a *WebhookController) getEventTypes(c *gin.Context) {
+	jsonObj(c, event.AllTypes, nil)
+}
+
+func (a *WebhookController) addWebhook(c *gin.Context) {
+	webhook := &model.Webhook{}
+	err := c.ShouldBind(webhook)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	err = a.webhookService.AddWebhook(webhook)
+	jsonMsg(c, "添加", err)
+}
+
+func (a *WebhookController) updateWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	webhook := &model.Webhook{}
+	err = c.ShouldBind(webhook)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	webhook.Id = id
+	err = a.webhookService.UpdateWebhook(webhook)
+	jsonMsg(c, "修改", err)
+}
+
+func (a *WebhookController) delWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "删除", err)
+		return
+	}
+	err = a.webhookService.DelWebhook(id)
+	jsonMsg(c, "删除", err)
+}
+
+func (a *WebhookController) testWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "测试", err)
+		return
+	}
+	err = a.webhookService.Test(id)
+	jsonMsg(c, "测试", err)
+}
+
+func (a *WebhookController) getDeliveries(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	deliveries, err := a.webhookService.GetDeliveries(id)
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	jsonObj(c, deliveries, nil)
+}
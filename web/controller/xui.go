@@ -1,21 +1,29 @@
 package controller
 
 import (
+	"x-ui/web/service"
+
 	"github.com/gin-gonic/gin"
 )
 
 type XUIController struct {
 	router *gin.RouterGroup
 
-	inboundController *InboundController
-	settingController *SettingController
+	inboundController  *InboundController
+	outboundController *OutboundController
+	balancerController *BalancerController
+	geoController      *GeoController
+	settingController  *SettingController
 }
 
-func NewXUIController(router *gin.RouterGroup) *XUIController {
+func NewXUIController(router *gin.RouterGroup, xrayService service.XrayService) *XUIController {
 	c := &XUIController{
-		router:            router,
-		inboundController: NewInboundController(router),
-		settingController: NewSettingController(router),
+		router:             router,
+		inboundController:  NewInboundController(router, xrayService),
+		outboundController: NewOutboundController(xrayService),
+		balancerController: NewBalancerController(xrayService),
+		geoController:      NewGeoController(xrayService),
+		settingController:  NewSettingController(),
 	}
 	c.initRouter()
 	return c
@@ -27,6 +35,12 @@ func (c *XUIController) initRouter() {
 	g.GET("/", c.index)
 	g.GET("/inbounds", c.inboundController.index)
 	g.GET("/setting", c.settingController.index)
+
+	c.inboundController.initRouter(g)
+	c.outboundController.initRouter(g)
+	c.balancerController.initRouter(g)
+	c.geoController.initRouter(g)
+	c.settingController.initRouter(g)
 }
 
 func (c *XUIController) checkLogin(ctx *gin.Context) {
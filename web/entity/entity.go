@@ -4,10 +4,15 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"net"
+	"net/mail"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 	"x-ui/util/common"
 	"x-ui/xray"
+
+	"github.com/robfig/cron/v3"
 )
 
 type Msg struct {
@@ -26,16 +31,67 @@ type Pager struct {
 	List     interface{} `json:"list"`
 }
 
+// SecretMask 已设置的密钥返回给前端时的占位符，提交空值或占位符时保留原有的值
+const SecretMask = "******"
+
+// AllSetting 中带有 secret:"true" 标签的字段是密钥，不会明文返回给前端
 type AllSetting struct {
 	WebListen   string `json:"webListen" form:"webListen"`
 	WebPort     int    `json:"webPort" form:"webPort"`
 	WebCertFile string `json:"webCertFile" form:"webCertFile"`
 	WebKeyFile  string `json:"webKeyFile" form:"webKeyFile"`
 	WebBasePath string `json:"webBasePath" form:"webBasePath"`
+	WebCertName string `json:"webCertName" form:"webCertName"`
 
 	XrayTemplateConfig string `json:"xrayTemplateConfig" form:"xrayTemplateConfig"`
 
 	TimeLocation string `json:"timeLocation" form:"timeLocation"`
+
+	IpLimitCooldown int `json:"ipLimitCooldown" form:"ipLimitCooldown"`
+
+	MetricsEnable bool   `json:"metricsEnable" form:"metricsEnable"`
+	MetricsToken  string `json:"metricsToken" form:"metricsToken" secret:"true"`
+
+	ApiToken     string `json:"apiToken" form:"apiToken" secret:"true"`
+	NodeCaName   string `json:"nodeCaName" form:"nodeCaName"`
+	NodeCertName string `json:"nodeCertName" form:"nodeCertName"`
+
+	TgBotEnable bool   `json:"tgBotEnable" form:"tgBotEnable"`
+	TgBotToken  string `json:"tgBotToken" form:"tgBotToken" secret:"true"`
+	TgBotChatId string `json:"tgBotChatId" form:"tgBotChatId"`
+	TgBotApiUrl string `json:"tgBotApiUrl" form:"tgBotApiUrl"`
+	TgRunTime   string `json:"tgRunTime" form:"tgRunTime"`
+
+	SmtpEnable         bool   `json:"smtpEnable" form:"smtpEnable"`
+	SmtpHost           string `json:"smtpHost" form:"smtpHost"`
+	SmtpPort           int    `json:"smtpPort" form:"smtpPort"`
+	SmtpUsername       string `json:"smtpUsername" form:"smtpUsername"`
+	SmtpPassword       string `json:"smtpPassword" form:"smtpPassword" secret:"true"`
+	SmtpFrom           string `json:"smtpFrom" form:"smtpFrom"`
+	SmtpTls            bool   `json:"smtpTls" form:"smtpTls"`
+	ExpiryRemindDays   string `json:"expiryRemindDays" form:"expiryRemindDays"`
+	QuotaRemindPercent string `json:"quotaRemindPercent" form:"quotaRemindPercent"`
+
+	AcmeDirectoryUrl string `json:"acmeDirectoryUrl" form:"acmeDirectoryUrl"`
+	AcmeEmail        string `json:"acmeEmail" form:"acmeEmail"`
+	AcmeHttpPort     int    `json:"acmeHttpPort" form:"acmeHttpPort"`
+	AcmeSkipVerify   bool   `json:"acmeSkipVerify" form:"acmeSkipVerify"`
+	AcmeRenewDays    int    `json:"acmeRenewDays" form:"acmeRenewDays"`
+	CertAlertDays    int    `json:"certAlertDays" form:"certAlertDays"`
+
+	// 为空时只在负载均衡器需要时启用 observatory，burst 使用 burstObservatory
+	ObservatoryMode          string `json:"observatoryMode" form:"observatoryMode"`
+	ObservatoryProbeUrl      string `json:"observatoryProbeUrl" form:"observatoryProbeUrl"`
+	ObservatoryProbeInterval string `json:"observatoryProbeInterval" form:"observatoryProbeInterval"`
+
+	// geo 文件的下载地址，同一路径下需要有 .sha256sum 校验文件
+	GeoUpdateEnable bool   `json:"geoUpdateEnable" form:"geoUpdateEnable"`
+	GeoUpdateTime   string `json:"geoUpdateTime" form:"geoUpdateTime"`
+	GeositeUrl      string `json:"geositeUrl" form:"geositeUrl"`
+	GeoipUrl        string `json:"geoipUrl" form:"geoipUrl"`
+
+	// 注册 WARP 设备使用的 API 地址，无法直接访问 Cloudflare 时可改为反向代理
+	WarpApiUrl string `json:"warpApiUrl" form:"warpApiUrl"`
 }
 
 func (s *AllSetting) CheckValid() error {
@@ -75,5 +131,118 @@ func (s *AllSetting) CheckValid() error {
 		return common.NewError("time location not exist:", s.TimeLocation)
 	}
 
+	if s.TgBotEnable {
+		if s.TgBotToken == "" {
+			return common.NewError("telegram bot token is empty")
+		}
+		if _, err := url.ParseRequestURI(s.TgBotApiUrl); err != nil {
+			return common.NewError("telegram bot api url invalid:", s.TgBotApiUrl)
+		}
+		for _, id := range strings.Split(s.TgBotChatId, ",") {
+			if _, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64); err != nil {
+				return common.NewError("telegram chat id invalid:", id)
+			}
+		}
+		parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+		if _, err := parser.Parse(s.TgRunTime); err != nil {
+			return common.NewError("telegram report time invalid:", s.TgRunTime)
+		}
+	}
+
+	// 面板可能在反向代理之后，来源地址不可信，开启监控指标时必须设置 Token
+	if s.MetricsEnable && len(s.MetricsToken) < 16 {
+		return common.NewError("metrics token must be at least 16 characters")
+	}
+
+	if s.SmtpEnable {
+		if s.SmtpHost == "" {
+			return common.NewError("smtp host is empty")
+		}
+		if s.SmtpPort <= 0 || s.SmtpPort > 65535 {
+			return common.NewError("smtp port is not a valid port:", s.SmtpPort)
+		}
+		if _, err := mail.ParseAddress(s.SmtpFrom); err != nil {
+			return common.NewError("smtp from address invalid:", s.SmtpFrom)
+		}
+	}
+	if _, err := ParseIntList(s.ExpiryRemindDays); err != nil {
+		return common.NewError("expiry remind days invalid:", s.ExpiryRemindDays)
+	}
+	if _, err := ParseIntList(s.QuotaRemindPercent); err != nil {
+		return common.NewError("quota remind percent invalid:", s.QuotaRemindPercent)
+	}
+
+	if _, err := url.ParseRequestURI(s.AcmeDirectoryUrl); err != nil {
+		return common.NewError("acme directory url invalid:", s.AcmeDirectoryUrl)
+	}
+	if s.AcmeHttpPort <= 0 || s.AcmeHttpPort > 65535 {
+		return common.NewError("acme http port is not a valid port:", s.AcmeHttpPort)
+	}
+	if s.AcmeRenewDays <= 0 {
+		return common.NewError("acme renew days is not valid:", s.AcmeRenewDays)
+	}
+	if s.CertAlertDays <= 0 {
+		return common.NewError("cert alert days is not valid:", s.CertAlertDays)
+	}
+
+	switch s.ObservatoryMode {
+	case "", "observatory", "burst":
+	default:
+		return common.NewError("observatory mode is not valid:", s.ObservatoryMode)
+	}
+	if u, err := url.ParseRequestURI(s.ObservatoryProbeUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return common.NewError("observatory probe url invalid:", s.ObservatoryProbeUrl)
+	}
+	if interval, err := time.ParseDuration(s.ObservatoryProbeInterval); err != nil || interval < time.Second {
+		return common.NewError("observatory probe interval is not valid:", s.ObservatoryProbeInterval)
+	}
+
+	for _, geoUrl := range []string{s.GeositeUrl, s.GeoipUrl} {
+		if u, err := url.ParseRequestURI(geoUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return common.NewError("geo file url invalid:", geoUrl)
+		}
+	}
+	if u, err := url.ParseRequestURI(s.WarpApiUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return common.NewError("warp api url invalid:", s.WarpApiUrl)
+	}
+	if s.GeoUpdateEnable {
+		parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+		if _, err := parser.Parse(s.GeoUpdateTime); err != nil {
+			return common.NewError("geo update time invalid:", s.GeoUpdateTime)
+		}
+	}
+
+	if s.ApiToken != "" && len(s.ApiToken) < 16 {
+		return common.NewError("api token must be at least 16 characters")
+	}
+
+	if (s.NodeCaName == "") != (s.NodeCertName == "") {
+		return common.NewError("node ca and node cert must be set together")
+	}
+
+	if s.IpLimitCooldown <= 0 {
+		return common.NewError("ip limit cooldown is not valid:", s.IpLimitCooldown)
+	}
+
 	return nil
 }
+
+// ParseIntList 解析逗号分隔的正整数列表
+func ParseIntList(s string) ([]int, error) {
+	list := make([]int, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return nil, common.NewError("not a positive number:", n)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
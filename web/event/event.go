@@ -0,0 +1,103 @@
+package event
+
+import (
+	"sync"
+	"time"
+	"x-ui/util/common"
+)
+
+type Type string
+
+const (
+	InboundCreated  Type = "inbound.created"
+	InboundUpdated  Type = "inbound.updated"
+	InboundDeleted  Type = "inbound.deleted"
+	ClientExhausted Type = "client.exhausted"
+	ClientExpired   Type = "client.expired"
+	XrayRestarted   Type = "xray.restarted"
+	XrayCrashed     Type = "xray.crashed"
+	SettingsChanged Type = "settings.changed"
+	LoginSuccess    Type = "login.success"
+	LoginFailure    Type = "login.failure"
+	CertExpiring    Type = "cert.expiring"
+)
+
+// AllTypes 所有事件类型，用于校验订阅过滤条件
+var AllTypes = []Type{
+	InboundCreated, InboundUpdated, InboundDeleted,
+	ClientExhausted, ClientExpired,
+	XrayRestarted, XrayCrashed,
+	SettingsChanged,
+	LoginSuccess, LoginFailure,
+	CertExpiring,
+}
+
+func IsValidType(t Type) bool {
+	for _, typ := range AllTypes {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+type Event struct {
+	Type Type        `json:"type"`
+	Time int64       `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+type Handler func(e *Event)
+
+// Bus 进程内事件总线，处理函数在独立 goroutine 中执行，不阻塞发布方
+type Bus struct {
+	mu       sync.RWMutex
+	nextId   int
+	handlers map[int]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		handlers: make(map[int]Handler),
+	}
+}
+
+// Subscribe 注册处理函数，返回取消订阅函数
+func (b *Bus) Subscribe(handler Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextId
+	b.nextId++
+	b.handlers[id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+func (b *Bus) Publish(t Type, data interface{}) {
+	e := &Event{
+		Type: t,
+		Time: time.Now().UnixMilli(),
+		Data: data,
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		go func(handler Handler) {
+			defer common.Recover("事件处理")
+			handler(e)
+		}(handler)
+	}
+}
+
+var defaultBus = NewBus()
+
+func Subscribe(handler Handler) func() {
+	return defaultBus.Subscribe(handler)
+}
+
+func Publish(t Type, data interface{}) {
+	defaultBus.Publish(t, data)
+}
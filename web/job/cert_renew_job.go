@@ -0,0 +1,42 @@
+package job
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
+)
+
+type CertRenewJob struct {
+	xrayService service.XrayService
+	certService *service.CertService
+}
+
+func NewCertRenewJob(xrayService service.XrayService, certService *service.CertService) *CertRenewJob {
+	return &CertRenewJob{
+		xrayService: xrayService,
+		certService: certService,
+	}
+}
+
+func (j *CertRenewJob) Add(c *cron.Cron) error {
+	_, err := c.AddFunc("@every 12h", func() {
+		j.Run()
+	})
+	return err
+}
+
+func (j *CertRenewJob) Run() {
+	defer service.ObserveJob("cert_renew", time.Now())
+
+	count, err := j.certService.RenewDueCertificates()
+	if err != nil {
+		logger.Warning("续期证书失败:", err)
+	}
+	if count > 0 {
+		logger.Infof("已续期 %d 个证书", count)
+		// xray 只在启动时读取证书文件
+		j.xrayService.SetToNeedRestart()
+	}
+}
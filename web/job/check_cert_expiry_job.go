@@ -0,0 +1,35 @@
+package job
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
+)
+
+type CheckCertExpiryJob struct {
+	certService *service.CertService
+}
+
+func NewCheckCertExpiryJob(certService *service.CertService) *CheckCertExpiryJob {
+	return &CheckCertExpiryJob{
+		certService: certService,
+	}
+}
+
+func (j *CheckCertExpiryJob) Add(c *cron.Cron) error {
+	// 同一证书每天只告警一次，这里频繁检查以便尽早发现新配置的证书
+	_, err := c.AddFunc("@every 1h", func() {
+		j.Run()
+	})
+	return err
+}
+
+func (j *CheckCertExpiryJob) Run() {
+	defer service.ObserveJob("check_cert_expiry", time.Now())
+
+	if err := j.certService.CheckCertExpiry(); err != nil {
+		logger.Warning("检查证书到期失败:", err)
+	}
+}
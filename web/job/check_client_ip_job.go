@@ -0,0 +1,170 @@
+package job
+
+import (
+	"sort"
+	"time"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/service"
+	"x-ui/xray"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 超过该时间未出现在访问日志中的IP不再计入在线IP
+const clientIpActiveWindow = time.Minute * 3
+
+type clientIpSeen struct {
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+type CheckClientIpJob struct {
+	xrayService     service.XrayService
+	clientIpService *service.ClientIpService
+
+	logReader *xray.AccessLogReader
+	// 入站 tag 加 email -> ip -> 出现时间
+	clientIps map[string]map[string]*clientIpSeen
+}
+
+func NewCheckClientIpJob(xrayService service.XrayService, clientIpService *service.ClientIpService) *CheckClientIpJob {
+	return &CheckClientIpJob{
+		xrayService:     xrayService,
+		clientIpService: clientIpService,
+		clientIps:       make(map[string]map[string]*clientIpSeen),
+	}
+}
+
+func (j *CheckClientIpJob) Add(c *cron.Cron) error {
+	_, err := c.AddFunc("@every 20s", func() {
+		j.Run()
+	})
+	return err
+}
+
+func (j *CheckClientIpJob) Run() {
+	defer service.ObserveJob("check_client_ip", time.Now())
+
+	needRestart := false
+
+	lifted, err := j.clientIpService.LiftExpiredBlocks()
+	if err != nil {
+		logger.Warning("解除客户端IP封禁失败:", err)
+	} else if lifted > 0 {
+		needRestart = true
+	}
+
+	limits, err := j.clientIpService.GetClientIpLimits()
+	if err != nil {
+		logger.Warning("获取客户端IP限制失败:", err)
+	} else if len(limits) > 0 {
+		j.readAccessLog()
+		for key, limit := range limits {
+			if j.checkClient(key, limit) {
+				needRestart = true
+			}
+		}
+	}
+
+	if needRestart && j.xrayService != nil {
+		j.xrayService.InvalidateCache()
+		j.xrayService.SetToNeedRestart()
+	}
+}
+
+// readAccessLog 从生成的配置中取访问日志路径并读取新增的记录
+//
+// 日志文件不做清空，面板开启的访问日志由安装脚本配置的 logrotate 轮转
+func (j *CheckClientIpJob) readAccessLog() {
+	config, err := j.xrayService.GetXrayConfig()
+	if err != nil {
+		logger.Warning("获取xray配置失败:", err)
+		return
+	}
+	path := config.GetAccessLog()
+	if path == "" {
+		return
+	}
+	if j.logReader == nil || j.logReader.GetPath() != path {
+		j.logReader = xray.NewAccessLogReader(path)
+	}
+	records, err := j.logReader.Read()
+	if err != nil {
+		logger.Debug("读取访问日志失败:", err)
+	}
+	j.collect(records)
+}
+
+func (j *CheckClientIpJob) collect(records []*xray.AccessRecord) {
+	for _, record := range records {
+		// 生成的 xray 配置中客户端 email 即为 ClientIpKey，重启 xray 前的日志只有 email
+		key := record.Email
+		if inboundTag, _ := service.SplitClientIpKey(key); inboundTag == "" {
+			key = service.ClientIpKey(model.BaseInboundTag(record.InboundTag), record.Email)
+		}
+		ips, ok := j.clientIps[key]
+		if !ok {
+			ips = make(map[string]*clientIpSeen)
+			j.clientIps[key] = ips
+		}
+		seen, ok := ips[record.IP]
+		if !ok {
+			ips[record.IP] = &clientIpSeen{
+				firstSeen: record.Time,
+				lastSeen:  record.Time,
+			}
+			continue
+		}
+		if record.Time.After(seen.lastSeen) {
+			seen.lastSeen = record.Time
+		}
+	}
+
+	now := time.Now()
+	for key, ips := range j.clientIps {
+		for ip, seen := range ips {
+			if now.Sub(seen.lastSeen) > clientIpActiveWindow {
+				delete(ips, ip)
+			}
+		}
+		if len(ips) == 0 {
+			delete(j.clientIps, key)
+		}
+	}
+}
+
+// checkClient 封禁超出限制的最新IP，返回是否新增了封禁
+func (j *CheckClientIpJob) checkClient(key string, limit *service.ClientIpLimit) bool {
+	ips := make([]string, 0)
+	for ip := range j.clientIps[key] {
+		blocked, err := j.clientIpService.IsBlocked(limit.InboundTag, limit.Email, ip)
+		if err != nil {
+			logger.Warning("查询客户端IP封禁失败:", err)
+			return false
+		}
+		if !blocked {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) <= limit.LimitIp {
+		return false
+	}
+
+	seen := j.clientIps[key]
+	sort.Slice(ips, func(a, b int) bool {
+		return seen[ips[a]].firstSeen.Before(seen[ips[b]].firstSeen)
+	})
+
+	added := false
+	for _, ip := range ips[limit.LimitIp:] {
+		err := j.clientIpService.BlockIp(limit.InboundTag, limit.Email, ip)
+		if err != nil {
+			logger.Warning("封禁客户端IP失败:", err)
+			continue
+		}
+		delete(seen, ip)
+		added = true
+	}
+	return added
+}
@@ -1,6 +1,7 @@
 package job
 
 import (
+	"time"
 	"x-ui/logger"
 	"x-ui/web/service"
 )
@@ -15,6 +16,8 @@ func NewCheckInboundJob() *CheckInboundJob {
 }
 
 func (j *CheckInboundJob) Run() {
+	defer service.ObserveJob("check_inbound", time.Now())
+
 	count, err := j.inboundService.DisableInvalidInbounds()
 	if err != nil {
 		logger.Warning("disable invalid inbounds err:", err)
@@ -0,0 +1,79 @@
+package job
+
+import (
+	"maps"
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 流量使用率提醒阈值(百分比)
+var quotaThresholds = []int{80, 90, 100}
+
+type CheckQuotaJob struct {
+	inboundService *service.InboundService
+	settingService *service.SettingService
+	tgbot          *service.Tgbot
+}
+
+func NewCheckQuotaJob(inboundService *service.InboundService, settingService *service.SettingService, tgbot *service.Tgbot) *CheckQuotaJob {
+	return &CheckQuotaJob{
+		inboundService: inboundService,
+		settingService: settingService,
+		tgbot:          tgbot,
+	}
+}
+
+func (j *CheckQuotaJob) Add(c *cron.Cron) error {
+	_, err := c.AddFunc("@every 1m", func() {
+		j.Run()
+	})
+	return err
+}
+
+func (j *CheckQuotaJob) Run() {
+	defer service.ObserveJob("check_quota", time.Now())
+
+	inbounds, err := j.inboundService.GetAllInbounds()
+	if err != nil {
+		logger.Warning("获取入站失败:", err)
+		return
+	}
+	// 入站id -> 已提醒过的最高阈值，保存在设置中，重启后不会重复提醒
+	notified, err := j.settingService.GetTgQuotaNotified()
+	if err != nil {
+		logger.Warning("获取流量提醒记录失败:", err)
+		return
+	}
+	current := make(map[int]int, len(notified))
+	for _, inbound := range inbounds {
+		if inbound.Total <= 0 {
+			continue
+		}
+		percent := int((inbound.Up + inbound.Down) * 100 / inbound.Total)
+		reached := 0
+		for _, threshold := range quotaThresholds {
+			if percent >= threshold {
+				reached = threshold
+			}
+		}
+		// 流量被重置或调高上限后重新开始提醒
+		if reached <= notified[inbound.Id] {
+			if reached > 0 {
+				current[inbound.Id] = reached
+			}
+			continue
+		}
+		current[inbound.Id] = reached
+		if j.tgbot != nil {
+			j.tgbot.NotifyQuota(inbound, reached)
+		}
+	}
+	if !maps.Equal(current, notified) {
+		if err := j.settingService.SetTgQuotaNotified(current); err != nil {
+			logger.Warning("保存流量提醒记录失败:", err)
+		}
+	}
+}
@@ -1,16 +1,66 @@
 package job
 
 import (
+	"time"
 	"x-ui/logger"
+	"x-ui/web/event"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
 )
 
-type CheckXrayRunningJob struct{}
+type CheckXrayRunningJob struct {
+	xrayService service.XrayService
+	tgbot       *service.Tgbot
+
+	wasRunning bool
+	// 连续检测到未运行的次数，避免把正常重启误判为崩溃
+	stopCount int
+}
 
-func NewCheckXrayRunningJob() *CheckXrayRunningJob {
-	return &CheckXrayRunningJob{}
+func NewCheckXrayRunningJob(xrayService service.XrayService, tgbot *service.Tgbot) *CheckXrayRunningJob {
+	return &CheckXrayRunningJob{
+		xrayService: xrayService,
+		tgbot:       tgbot,
+	}
+}
+
+func (j *CheckXrayRunningJob) Add(c *cron.Cron) error {
+	_, err := c.AddFunc("@every 30s", func() {
+		j.Run()
+	})
+	return err
 }
 
 func (j *CheckXrayRunningJob) Run() {
-	// 检查 Xray 是否正在运行
-	logger.Info("检查 Xray 运行状态...")
+	defer service.ObserveJob("check_xray_running", time.Now())
+
+	if j.xrayService == nil {
+		return
+	}
+	if j.xrayService.IsXrayRunning() {
+		j.wasRunning = true
+		j.stopCount = 0
+		return
+	}
+	if !j.wasRunning {
+		return
+	}
+	j.stopCount++
+	if j.stopCount < 2 {
+		return
+	}
+
+	j.wasRunning = false
+	j.stopCount = 0
+	errMsg := j.xrayService.GetXrayResult()
+	if err := j.xrayService.GetXrayErr(); err != nil {
+		errMsg = err.Error() + "\n" + errMsg
+	}
+	logger.Warning("检测到 Xray 异常退出:", errMsg)
+	if j.tgbot != nil {
+		j.tgbot.NotifyXrayCrash(errMsg)
+	}
+	event.Publish(event.XrayCrashed, map[string]string{"error": errMsg})
+	j.xrayService.SetToNeedRestart()
 }
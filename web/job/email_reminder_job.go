@@ -0,0 +1,34 @@
+package job
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
+)
+
+type EmailReminderJob struct {
+	mailService *service.MailService
+}
+
+func NewEmailReminderJob(mailService *service.MailService) *EmailReminderJob {
+	return &EmailReminderJob{
+		mailService: mailService,
+	}
+}
+
+func (j *EmailReminderJob) Add(c *cron.Cron) error {
+	_, err := c.AddFunc("@every 10m", func() {
+		j.Run()
+	})
+	return err
+}
+
+func (j *EmailReminderJob) Run() {
+	defer service.ObserveJob("email_reminder", time.Now())
+
+	if err := j.mailService.SendReminders(); err != nil {
+		logger.Warning("发送提醒邮件失败:", err)
+	}
+}
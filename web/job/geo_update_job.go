@@ -0,0 +1,54 @@
+package job
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
+)
+
+type GeoUpdateJob struct {
+	xrayService    service.XrayService
+	settingService *service.SettingService
+	geoService     *service.GeoService
+}
+
+func NewGeoUpdateJob(xrayService service.XrayService, settingService *service.SettingService, geoService *service.GeoService) *GeoUpdateJob {
+	return &GeoUpdateJob{
+		xrayService:    xrayService,
+		settingService: settingService,
+		geoService:     geoService,
+	}
+}
+
+// Add 未开启自动更新时不添加任务
+func (j *GeoUpdateJob) Add(c *cron.Cron) error {
+	enable, err := j.settingService.GetGeoUpdateEnable()
+	if err != nil || !enable {
+		return err
+	}
+	runTime, err := j.settingService.GetGeoUpdateTime()
+	if err != nil {
+		return err
+	}
+	_, err = c.AddFunc(runTime, func() {
+		j.Run()
+	})
+	return err
+}
+
+func (j *GeoUpdateJob) Run() {
+	defer service.ObserveJob("geo_update", time.Now())
+
+	updated, err := j.geoService.UpdateGeoFiles()
+	if err != nil {
+		logger.Warning("更新 geo 文件失败:", err)
+	}
+	// xray 只在启动时加载 geo 文件，配置没有变化，需要强制重启
+	if updated && j.xrayService.IsXrayRunning() {
+		if err := j.xrayService.RestartXray(true); err != nil {
+			logger.Warning("更新 geo 文件后重启 xray 失败:", err)
+		}
+	}
+}
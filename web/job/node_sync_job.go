@@ -0,0 +1,39 @@
+package job
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
+)
+
+type NodeSyncJob struct {
+	nodeService *service.NodeService
+}
+
+func NewNodeSyncJob(nodeService *service.NodeService) *NodeSyncJob {
+	return &NodeSyncJob{
+		nodeService: nodeService,
+	}
+}
+
+func (j *NodeSyncJob) Add(c *cron.Cron) error {
+	_, err := c.AddFunc("@every 30s", func() {
+		j.Run()
+	})
+	return err
+}
+
+func (j *NodeSyncJob) Run() {
+	defer service.ObserveJob("node_sync", time.Now())
+
+	failed, err := j.nodeService.SyncNodes()
+	if err != nil {
+		logger.Warning("同步节点失败:", err)
+		return
+	}
+	if failed > 0 {
+		logger.Warningf("%d 个节点同步失败", failed)
+	}
+}
@@ -0,0 +1,39 @@
+package job
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
+)
+
+type PruneOutboundHistoryJob struct {
+	outboundTrafficService *service.OutboundTrafficService
+}
+
+func NewPruneOutboundHistoryJob(outboundTrafficService *service.OutboundTrafficService) *PruneOutboundHistoryJob {
+	return &PruneOutboundHistoryJob{
+		outboundTrafficService: outboundTrafficService,
+	}
+}
+
+func (j *PruneOutboundHistoryJob) Add(c *cron.Cron) error {
+	_, err := c.AddFunc("@daily", func() {
+		j.Run()
+	})
+	return err
+}
+
+func (j *PruneOutboundHistoryJob) Run() {
+	defer service.ObserveJob("prune_outbound_history", time.Now())
+
+	count, err := j.outboundTrafficService.PruneHistory()
+	if err != nil {
+		logger.Warning("清理出站流量历史失败:", err)
+		return
+	}
+	if count > 0 {
+		logger.Info("清理过期的出站流量历史:", count)
+	}
+}
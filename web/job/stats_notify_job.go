@@ -1,27 +1,31 @@
 package job
 
 import (
+	"maps"
 	"runtime"
 	"time"
 	"x-ui/logger"
+	"x-ui/web/event"
 	"x-ui/web/service"
 
 	"github.com/robfig/cron/v3"
 )
 
 type StatsNotifyJob struct {
-	xrayService    *service.XrayService
+	xrayService    service.XrayService
 	settingService *service.SettingService
 	inboundService *service.InboundService
+	tgbot          *service.Tgbot
 	lastStatus     *runtime.MemStats
 	lastTime       time.Time
 }
 
-func NewStatsNotifyJob(xrayService *service.XrayService, settingService *service.SettingService, inboundService *service.InboundService) *StatsNotifyJob {
+func NewStatsNotifyJob(xrayService service.XrayService, settingService *service.SettingService, inboundService *service.InboundService, tgbot *service.Tgbot) *StatsNotifyJob {
 	return &StatsNotifyJob{
 		xrayService:    xrayService,
 		settingService: settingService,
 		inboundService: inboundService,
+		tgbot:          tgbot,
 		lastStatus:     &runtime.MemStats{},
 		lastTime:       time.Now(),
 	}
@@ -37,6 +41,7 @@ func (j *StatsNotifyJob) Add(c *cron.Cron) error {
 
 func (j *StatsNotifyJob) Run() {
 	now := time.Now()
+	defer service.ObserveJob("stats_notify", now)
 	defer func() {
 		j.lastTime = now
 	}()
@@ -61,26 +66,84 @@ func (j *StatsNotifyJob) Run() {
 	*j.lastStatus = memStats
 
 	// 检查是否需要处理到期账户
+	invalidInbounds, err := j.inboundService.GetInvalidInbounds()
+	if err != nil {
+		logger.Warning("获取失效入站时发生错误:", err)
+	}
 	count, err := j.inboundService.DisableInvalidInbounds()
 	if err != nil {
 		logger.Warning("禁用失效入站时发生错误:", err)
 	} else if count > 0 {
 		logger.Info("已禁用 %d 个到期入站", count)
+		if j.tgbot != nil {
+			j.tgbot.NotifyInboundsDisabled(invalidInbounds)
+		}
+		for _, inbound := range invalidInbounds {
+			inbound.Enable = false
+			event.Publish(event.InboundUpdated, inbound)
+		}
 		// 只有在实际禁用了入站时才重启xray
 		if j.xrayService != nil {
 			j.xrayService.SetToNeedRestart()
 		}
 	}
 
-	// 检查流量限制
-	overCount, err := j.inboundService.DisableExhaustedInbounds()
+	j.notifyClients(now)
+}
+
+// clientEventData client.exhausted 和 client.expired 事件的数据
+type clientEventData struct {
+	InboundId  int    `json:"inboundId"`
+	InboundTag string `json:"inboundTag"`
+	Email      string `json:"email"`
+	Up         int64  `json:"up"`
+	Down       int64  `json:"down"`
+	Total      int64  `json:"total"`
+	ExpiryTime int64  `json:"expiryTime"`
+}
+
+// notifyClients 按客户端自身的限额发布流量用完和到期事件，同一状态只发布一次，
+// 已发布的状态保存在设置中，重启后不会重复发布
+func (j *StatsNotifyJob) notifyClients(now time.Time) {
+	stats, err := j.inboundService.GetClientStats()
 	if err != nil {
-		logger.Warning("禁用流量超限入站时发生错误:", err)
-	} else if overCount > 0 {
-		logger.Info("已禁用 %d 个流量超限入站", overCount)
-		// 只有在实际禁用了入站时才重启xray
-		if j.xrayService != nil {
-			j.xrayService.SetToNeedRestart()
+		logger.Warning("获取客户端流量失败:", err)
+		return
+	}
+	notified, err := j.settingService.GetClientNotified()
+	if err != nil {
+		logger.Warning("获取客户端事件记录失败:", err)
+		return
+	}
+	current := make(map[string]string)
+	for _, stat := range stats {
+		var t event.Type
+		if stat.IsExpired(now) {
+			t = event.ClientExpired
+		} else if stat.IsExhausted() {
+			t = event.ClientExhausted
+		} else {
+			continue
+		}
+		key := service.ClientIpKey(stat.Inbound.Tag, stat.Client.Email)
+		current[key] = string(t)
+		if notified[key] == string(t) {
+			continue
 		}
+		event.Publish(t, &clientEventData{
+			InboundId:  stat.Inbound.Id,
+			InboundTag: stat.Inbound.Tag,
+			Email:      stat.Client.Email,
+			Up:         stat.Up,
+			Down:       stat.Down,
+			Total:      stat.Client.Total,
+			ExpiryTime: stat.Client.ExpiryTime,
+		})
+	}
+	if maps.Equal(current, notified) {
+		return
+	}
+	if err := j.settingService.SetClientNotified(current); err != nil {
+		logger.Warning("保存客户端事件记录失败:", err)
 	}
 }
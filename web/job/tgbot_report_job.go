@@ -0,0 +1,39 @@
+package job
+
+import (
+	"time"
+	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
+)
+
+type TgbotReportJob struct {
+	settingService *service.SettingService
+	tgbot          *service.Tgbot
+}
+
+func NewTgbotReportJob(settingService *service.SettingService, tgbot *service.Tgbot) *TgbotReportJob {
+	return &TgbotReportJob{
+		settingService: settingService,
+		tgbot:          tgbot,
+	}
+}
+
+func (j *TgbotReportJob) Add(c *cron.Cron) error {
+	runTime, err := j.settingService.GetTgRunTime()
+	if err != nil {
+		return err
+	}
+	_, err = c.AddFunc(runTime, func() {
+		j.Run()
+	})
+	return err
+}
+
+func (j *TgbotReportJob) Run() {
+	defer service.ObserveJob("tgbot_report", time.Now())
+
+	if j.tgbot != nil {
+		j.tgbot.SendReport()
+	}
+}
@@ -16,10 +16,10 @@ var (
 )
 
 type XrayReloadJob struct {
-	xrayService *service.XrayService
+	xrayService service.XrayService
 }
 
-func NewXrayReloadJob(xrayService *service.XrayService) *XrayReloadJob {
+func NewXrayReloadJob(xrayService service.XrayService) *XrayReloadJob {
 	return &XrayReloadJob{
 		xrayService: xrayService,
 	}
@@ -34,6 +34,8 @@ func (j *XrayReloadJob) Add(c *cron.Cron) error {
 }
 
 func (j *XrayReloadJob) Run() {
+	defer service.ObserveJob("xray_reload", time.Now())
+
 	// 如果没有Xray服务实例，直接返回
 	if j.xrayService == nil {
 		return
@@ -1,36 +1,38 @@
 package job
 
 import (
-	"context"
+	"time"
 	"x-ui/logger"
 	"x-ui/web/service"
+
+	"github.com/robfig/cron/v3"
 )
 
 type XrayTrafficJob struct {
-	ctx            context.Context
-	xrayService    service.XrayService
-	inboundService service.InboundService
+	xrayService service.XrayService
 }
 
-func NewXrayTrafficJob(ctx context.Context) *XrayTrafficJob {
+func NewXrayTrafficJob(xrayService service.XrayService) *XrayTrafficJob {
 	return &XrayTrafficJob{
-		ctx: ctx,
+		xrayService: xrayService,
 	}
 }
 
+func (j *XrayTrafficJob) Add(c *cron.Cron) error {
+	_, err := c.AddFunc("@every 10s", func() {
+		j.Run()
+	})
+	return err
+}
+
 func (j *XrayTrafficJob) Run() {
-	// 统计 Xray 流量
-	logger.Info("统计 Xray 流量...")
+	defer service.ObserveJob("xray_traffic", time.Now())
+
+	// 统计 Xray 流量，读出的流量先写入流量日志再累加到入站
 	if !j.xrayService.IsXrayRunning() {
 		return
 	}
-	traffics, err := j.xrayService.GetXrayTraffic()
-	if err != nil {
+	if _, err := j.xrayService.GetXrayTraffic(); err != nil {
 		logger.Warning("get xray traffic failed:", err)
-		return
-	}
-	err = j.inboundService.AddTraffic(traffics)
-	if err != nil {
-		logger.Warning("add traffic failed:", err)
 	}
 }
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"strings"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+var balancerStrategies = []string{"", "random", "roundRobin", "leastPing", "leastLoad"}
+
+// burstPingTimeout burstObservatory 单次探测的超时时间
+const burstPingTimeout = "5s"
+
+// BalancerService 管理负载均衡器和出站观测，生成 xray 配置时写入 routing.balancers 和 observatory
+type BalancerService struct {
+	settingService         SettingService
+	outboundTrafficService OutboundTrafficService
+}
+
+func (s *BalancerService) GetBalancers() ([]*model.Balancer, error) {
+	db := database.GetDB()
+	balancers := make([]*model.Balancer, 0)
+	err := db.Model(model.Balancer{}).Order("id").Find(&balancers).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return balancers, nil
+}
+
+func (s *BalancerService) GetBalancer(id int) (*model.Balancer, error) {
+	db := database.GetDB()
+	balancer := &model.Balancer{}
+	err := db.Model(model.Balancer{}).First(balancer, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return balancer, nil
+}
+
+func (s *BalancerService) checkBalancer(balancer *model.Balancer) error {
+	balancer.Tag = strings.TrimSpace(balancer.Tag)
+	if balancer.Tag == "" || balancer.Tag == "api" {
+		return common.NewError("负载均衡器 tag 无效:", balancer.Tag)
+	}
+	if !contains(balancerStrategies, balancer.Strategy) {
+		return common.NewError("不支持的负载均衡策略:", balancer.Strategy)
+	}
+	if balancer.Strategy == "leastLoad" {
+		mode, err := s.settingService.GetObservatoryMode()
+		if err != nil {
+			return err
+		}
+		if mode == "observatory" {
+			return common.NewError("leastLoad 需要 burst 观测方式")
+		}
+	}
+	selectors := splitList(balancer.Selector)
+	if len(selectors) == 0 {
+		return common.NewError("负载均衡器未选择出站:", balancer.Tag)
+	}
+	balancer.Selector = strings.Join(selectors, ",")
+
+	outbounds, err := s.outboundTrafficService.getOutbounds()
+	if err != nil {
+		return err
+	}
+	fallbackFound := balancer.FallbackTag == ""
+	for _, outbound := range outbounds {
+		if outbound.Tag == balancer.Tag {
+			return common.NewError("负载均衡器 tag 与出站重复:", balancer.Tag)
+		}
+		if outbound.Tag == balancer.FallbackTag {
+			fallbackFound = true
+		}
+	}
+	if !fallbackFound {
+		return common.NewError("回退出站不存在:", balancer.FallbackTag)
+	}
+	return nil
+}
+
+func (s *BalancerService) AddBalancer(balancer *model.Balancer) error {
+	if err := s.checkBalancer(balancer); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Create(balancer).Error
+}
+
+func (s *BalancerService) UpdateBalancer(balancer *model.Balancer) error {
+	if _, err := s.GetBalancer(balancer.Id); err != nil {
+		return err
+	}
+	if err := s.checkBalancer(balancer); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Save(balancer).Error
+}
+
+func (s *BalancerService) DelBalancer(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.Balancer{}, id).Error
+}
+
+// ApplyToConfig 把启用的负载均衡器写入路由，并按设置或负载均衡策略的需要生成出站观测
+//
+// 观测对象包括负载均衡器选择的出站和所有代理出站，以便在面板中查看出站健康状态
+func (s *BalancerService) ApplyToConfig(config *xray.Config) error {
+	balancers, err := s.GetBalancers()
+	if err != nil {
+		return err
+	}
+	xrayBalancers := make([]*xray.Balancer, 0)
+	selectors := make([]string, 0)
+	needPing, needLoad := false, false
+	for _, balancer := range balancers {
+		if !balancer.Enable {
+			continue
+		}
+		xrayBalancer := &xray.Balancer{
+			Tag:         balancer.Tag,
+			Selector:    splitList(balancer.Selector),
+			FallbackTag: balancer.FallbackTag,
+		}
+		if balancer.Strategy != "" {
+			xrayBalancer.Strategy = &xray.BalancerStrategy{Type: balancer.Strategy}
+		}
+		needPing = needPing || balancer.Strategy == "leastPing"
+		needLoad = needLoad || balancer.Strategy == "leastLoad"
+		xrayBalancers = append(xrayBalancers, xrayBalancer)
+		for _, selector := range xrayBalancer.Selector {
+			if !contains(selectors, selector) {
+				selectors = append(selectors, selector)
+			}
+		}
+	}
+	if err := config.SetBalancers(xrayBalancers); err != nil {
+		return err
+	}
+
+	mode, err := s.settingService.GetObservatoryMode()
+	if err != nil {
+		return err
+	}
+	if mode == "" && needLoad {
+		mode = "burst"
+	} else if mode == "" && needPing {
+		mode = "observatory"
+	}
+	if mode == "" {
+		return nil
+	}
+
+	outbounds, err := config.GetOutbounds()
+	if err != nil {
+		return err
+	}
+	for _, outbound := range outbounds {
+		if xray.OutboundCategory(outbound.Protocol) == xray.OutboundCategoryProxy && !contains(selectors, outbound.Tag) {
+			selectors = append(selectors, outbound.Tag)
+		}
+	}
+	if len(selectors) == 0 {
+		return nil
+	}
+	probeUrl, err := s.settingService.GetObservatoryProbeUrl()
+	if err != nil {
+		return err
+	}
+	interval, err := s.settingService.GetObservatoryProbeInterval()
+	if err != nil {
+		return err
+	}
+	if mode == "burst" {
+		err = config.SetObservatory(nil, &xray.BurstObservatoryConfig{
+			SubjectSelector: selectors,
+			PingConfig: &xray.BurstPingConfig{
+				Destination: probeUrl,
+				Interval:    interval,
+				Sampling:    10,
+				Timeout:     burstPingTimeout,
+			},
+		})
+	} else {
+		err = config.SetObservatory(&xray.ObservatoryConfig{
+			SubjectSelector:   selectors,
+			ProbeURL:          probeUrl,
+			ProbeInterval:     interval,
+			EnableConcurrency: true,
+		}, nil)
+	}
+	if err != nil {
+		return err
+	}
+	return config.EnableAPIService("ObservatoryService")
+}
+
+// GetOutboundHealth 通过正在运行的 xray 读取出站的连通性和延迟，xray 未运行时返回空
+func (s *BalancerService) GetOutboundHealth() ([]*xray.OutboundStatus, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	if p == nil || !p.IsRunning() {
+		return []*xray.OutboundStatus{}, nil
+	}
+	return p.GetObservatoryStatus()
+}
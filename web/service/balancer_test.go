@@ -0,0 +1,248 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/xray"
+)
+
+const balancerTestOutbounds = `[
+	{"protocol":"vmess","tag":"proxy-hk","settings":{}},
+	{"protocol":"vless","tag":"proxy-jp","settings":{}},
+	{"protocol":"trojan","tag":"backup","settings":{}},
+	{"protocol":"freedom","tag":"direct","settings":{}},
+	{"protocol":"blackhole","tag":"blocked","settings":{}}
+]`
+
+func newBalancerTestConfig() *xray.Config {
+	return &xray.Config{
+		RouterConfig:    []byte(`{"domainStrategy":"AsIs","balancers":[{"tag":"template","selector":["direct"]},{"tag":"auto","selector":["old"]}]}`),
+		OutboundConfigs: []byte(balancerTestOutbounds),
+		API:             []byte(`{"tag":"api","services":["HandlerService","StatsService"]}`),
+	}
+}
+
+func addTestBalancer(t *testing.T, tag string, selector string, strategy string, enable bool) {
+	t.Helper()
+	balancer := &model.Balancer{Tag: tag, Selector: selector, Strategy: strategy, FallbackTag: "direct", Enable: enable}
+	if err := database.GetDB().Create(balancer).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getRouterBalancers(t *testing.T, config *xray.Config) []map[string]interface{} {
+	t.Helper()
+	routing := struct {
+		DomainStrategy string                   `json:"domainStrategy"`
+		Balancers      []map[string]interface{} `json:"balancers"`
+	}{}
+	if err := json.Unmarshal(config.RouterConfig, &routing); err != nil {
+		t.Fatal(err)
+	}
+	if routing.DomainStrategy != "AsIs" {
+		t.Fatalf("路由中的其他配置丢失: %s", config.RouterConfig)
+	}
+	return routing.Balancers
+}
+
+func getAPIServices(t *testing.T, config *xray.Config) []string {
+	t.Helper()
+	api := struct {
+		Services []string `json:"services"`
+	}{}
+	if err := json.Unmarshal(config.API, &api); err != nil {
+		t.Fatal(err)
+	}
+	return api.Services
+}
+
+func TestApplyBalancersToConfig(t *testing.T) {
+	initTestDB(t)
+	addTestBalancer(t, "auto", "proxy", "roundRobin", true)
+	addTestBalancer(t, "disabled", "backup", "random", false)
+	config := newBalancerTestConfig()
+
+	s := &BalancerService{}
+	if err := s.ApplyToConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	balancers := getRouterBalancers(t, config)
+	tags := make([]string, 0, len(balancers))
+	for _, balancer := range balancers {
+		tags = append(tags, balancer["tag"].(string))
+	}
+	// 模板中同 tag 的负载均衡器被面板中的替换，其他保留，未启用的不写入
+	if !reflect.DeepEqual(tags, []string{"template", "auto"}) {
+		t.Fatalf("负载均衡器为 %v，期望 [template auto]", tags)
+	}
+	auto := balancers[1]
+	if !reflect.DeepEqual(auto["selector"], []interface{}{"proxy"}) || auto["fallbackTag"] != "direct" {
+		t.Fatalf("负载均衡器 auto 为 %v", auto)
+	}
+	if !reflect.DeepEqual(auto["strategy"], map[string]interface{}{"type": "roundRobin"}) {
+		t.Fatalf("负载均衡策略为 %v，期望 roundRobin", auto["strategy"])
+	}
+	// roundRobin 不需要观测
+	if config.HasObservatory() {
+		t.Fatalf("不需要观测时生成了 observatory: %s %s", config.Observatory, config.BurstObservatory)
+	}
+	if services := getAPIServices(t, config); len(services) != 2 {
+		t.Fatalf("不需要观测时 api 服务为 %v", services)
+	}
+}
+
+func TestApplyObservatoryToConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		mode     string
+		strategy string
+		// 期望生成的观测方式，为空时不生成
+		want string
+	}{
+		{"没有负载均衡器", "", "", ""},
+		{"random 不需要观测", "", "random", ""},
+		{"leastPing 启用 observatory", "", "leastPing", "observatory"},
+		{"leastLoad 启用 burstObservatory", "", "leastLoad", "burst"},
+		{"设置为 observatory", "observatory", "", "observatory"},
+		{"设置为 burst", "burst", "leastPing", "burst"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			initTestDB(t)
+			s := &BalancerService{}
+			if err := s.settingService.setString("observatoryMode", c.mode); err != nil {
+				t.Fatal(err)
+			}
+			if c.strategy != "" {
+				addTestBalancer(t, "auto", "proxy-hk", c.strategy, true)
+			}
+			config := newBalancerTestConfig()
+			if err := s.ApplyToConfig(config); err != nil {
+				t.Fatal(err)
+			}
+
+			switch c.want {
+			case "":
+				if config.HasObservatory() {
+					t.Fatalf("生成了 observatory: %s %s", config.Observatory, config.BurstObservatory)
+				}
+				return
+			case "observatory":
+				if len(config.BurstObservatory) > 0 {
+					t.Fatalf("同时生成了 burstObservatory: %s", config.BurstObservatory)
+				}
+				observatory := &xray.ObservatoryConfig{}
+				if err := json.Unmarshal(config.Observatory, observatory); err != nil {
+					t.Fatal(err)
+				}
+				want := &xray.ObservatoryConfig{
+					// 负载均衡器选择的出站在前，其后是其他代理出站，不包括直连和阻断
+					SubjectSelector:   []string{"proxy-hk", "proxy-jp", "backup"},
+					ProbeURL:          "https://www.google.com/generate_204",
+					ProbeInterval:     "1m",
+					EnableConcurrency: true,
+				}
+				if !reflect.DeepEqual(observatory, want) {
+					t.Fatalf("observatory 为 %+v，期望 %+v", observatory, want)
+				}
+			case "burst":
+				if len(config.Observatory) > 0 {
+					t.Fatalf("同时生成了 observatory: %s", config.Observatory)
+				}
+				burst := &xray.BurstObservatoryConfig{}
+				if err := json.Unmarshal(config.BurstObservatory, burst); err != nil {
+					t.Fatal(err)
+				}
+				want := &xray.BurstObservatoryConfig{
+					SubjectSelector: []string{"proxy-hk", "proxy-jp", "backup"},
+					PingConfig: &xray.BurstPingConfig{
+						Destination: "https://www.google.com/generate_204",
+						Interval:    "1m",
+						Sampling:    10,
+						Timeout:     burstPingTimeout,
+					},
+				}
+				if !reflect.DeepEqual(burst, want) {
+					t.Fatalf("burstObservatory 为 %+v，期望 %+v", burst, want)
+				}
+			}
+			services := getAPIServices(t, config)
+			if !reflect.DeepEqual(services, []string{"HandlerService", "StatsService", "ObservatoryService"}) {
+				t.Fatalf("api 服务为 %v，期望加入 ObservatoryService", services)
+			}
+		})
+	}
+}
+
+func TestApplyObservatoryWithoutProxyOutbounds(t *testing.T) {
+	initTestDB(t)
+	s := &BalancerService{}
+	if err := s.settingService.setString("observatoryMode", "observatory"); err != nil {
+		t.Fatal(err)
+	}
+	config := newBalancerTestConfig()
+	config.OutboundConfigs = []byte(`[{"protocol":"freedom","tag":"direct"},{"protocol":"blackhole","tag":"blocked"}]`)
+	if err := s.ApplyToConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	// 没有可观测的出站时不启用观测
+	if config.HasObservatory() {
+		t.Fatalf("没有代理出站时生成了 observatory: %s", config.Observatory)
+	}
+}
+
+func TestCheckBalancer(t *testing.T) {
+	initTestDB(t)
+	s := &BalancerService{}
+	template := `{"outbounds":[{"protocol":"vmess","tag":"proxy-hk"},{"protocol":"freedom","tag":"direct"}]}`
+	if err := s.settingService.setString("xrayTemplateConfig", template); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		mode     string
+		balancer *model.Balancer
+		// 期望的错误前缀，为空时期望通过
+		want string
+	}{
+		{"有效", "", &model.Balancer{Tag: "auto", Selector: " proxy , hk ", Strategy: "leastPing", FallbackTag: "direct"}, ""},
+		{"tag 为空", "", &model.Balancer{Tag: " ", Selector: "proxy"}, "负载均衡器 tag 无效"},
+		{"保留的 tag", "", &model.Balancer{Tag: "api", Selector: "proxy"}, "负载均衡器 tag 无效"},
+		{"不支持的策略", "", &model.Balancer{Tag: "auto", Selector: "proxy", Strategy: "fastest"}, "不支持的负载均衡策略"},
+		{"没有出站", "", &model.Balancer{Tag: "auto", Selector: " , "}, "负载均衡器未选择出站"},
+		{"tag 与出站重复", "", &model.Balancer{Tag: "direct", Selector: "proxy"}, "负载均衡器 tag 与出站重复"},
+		{"回退出站不存在", "", &model.Balancer{Tag: "auto", Selector: "proxy", FallbackTag: "missing"}, "回退出站不存在"},
+		{"leastLoad 需要 burst", "observatory", &model.Balancer{Tag: "auto", Selector: "proxy", Strategy: "leastLoad"}, "leastLoad 需要 burst 观测方式"},
+		{"leastLoad 自动选择 burst", "", &model.Balancer{Tag: "auto", Selector: "proxy", Strategy: "leastLoad"}, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := s.settingService.setString("observatoryMode", c.mode); err != nil {
+				t.Fatal(err)
+			}
+			err := s.checkBalancer(c.balancer)
+			if c.want == "" {
+				if err != nil {
+					t.Fatalf("返回 %v，期望通过", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), c.want) {
+				t.Fatalf("返回 %v，期望 %v", err, c.want)
+			}
+		})
+	}
+
+	balancer := &model.Balancer{Tag: "auto", Selector: " proxy , hk ,", FallbackTag: "direct"}
+	if err := s.checkBalancer(balancer); err != nil {
+		t.Fatal(err)
+	}
+	if balancer.Selector != "proxy,hk" {
+		t.Fatalf("出站前缀保存为 %q，期望 %q", balancer.Selector, "proxy,hk")
+	}
+}
@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/config"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/acme"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CertSourceAcme       = "acme"
+	CertSourceUpload     = "upload"
+	CertSourceSelfSigned = "selfsigned"
+	CertSourceCA         = "ca"
+	// 由面板内私有CA签发
+	CertSourceLocalCA = "localca"
+
+	// DNS-01 添加记录后等待生效的时间
+	dnsPropagationWait = 30 * time.Second
+	acmeTimeout        = 10 * time.Minute
+)
+
+var (
+	certNameRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+	// 同一时间只允许一个ACME申请，HTTP-01 需要独占验证端口
+	acmeLock sync.Mutex
+
+	// 面板使用的托管证书缓存，证书续期后失效
+	tlsCertCache sync.Map
+)
+
+type CertService struct {
+	ctx            context.Context
+	settingService SettingService
+	inboundService InboundService
+}
+
+func NewCertService(ctx context.Context) *CertService {
+	return &CertService{
+		ctx: ctx,
+	}
+}
+
+func (s *CertService) getContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// GetCertPaths 托管证书写入磁盘的路径，供 xray 使用
+func GetCertPaths(name string) (string, string) {
+	dir := config.GetCertDir()
+	return filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+}
+
+func splitDomains(domains string) []string {
+	result := make([]string, 0)
+	for _, d := range strings.Split(domains, ",") {
+		d = strings.TrimSpace(d)
+		if d != "" {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+func (s *CertService) GetCertificates() ([]*model.Certificate, error) {
+	db := database.GetDB()
+	certs := make([]*model.Certificate, 0)
+	err := db.Model(model.Certificate{}).Find(&certs).Error
+	if err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+func (s *CertService) GetCertificate(id int) (*model.Certificate, error) {
+	db := database.GetDB()
+	cert := &model.Certificate{}
+	err := db.Model(model.Certificate{}).First(cert, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (s *CertService) GetCertificateByName(name string) (*model.Certificate, error) {
+	db := database.GetDB()
+	cert := &model.Certificate{}
+	err := db.Model(model.Certificate{}).Where("name = ?", name).First(cert).Error
+	if database.IsNotFound(err) {
+		return nil, common.NewError("证书不存在:", name)
+	} else if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// fillValidity 解析证书，填充有效期
+func fillValidity(cert *model.Certificate) error {
+	block, _ := pem.Decode([]byte(cert.CertPem))
+	if block == nil {
+		return errors.New("无效的证书PEM")
+	}
+	x509Cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	if _, err := tls.X509KeyPair([]byte(cert.CertPem), []byte(cert.KeyPem)); err != nil {
+		return fmt.Errorf("证书与私钥不匹配: %w", err)
+	}
+	cert.NotBefore = x509Cert.NotBefore.UnixMilli()
+	cert.NotAfter = x509Cert.NotAfter.UnixMilli()
+	if cert.Domains == "" {
+		cert.Domains = strings.Join(x509Cert.DNSNames, ",")
+	}
+	return nil
+}
+
+func writeCertFiles(cert *model.Certificate) error {
+	if err := os.MkdirAll(config.GetCertDir(), 0700); err != nil {
+		return err
+	}
+	certFile, keyFile := GetCertPaths(cert.Name)
+	if err := os.WriteFile(certFile, []byte(cert.CertPem), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, []byte(cert.KeyPem), 0600)
+}
+
+// saveCertificate 保存证书并写入文件，写入文件失败时不更新数据库，避免数据库中的有效期与磁盘上的证书不一致
+func (s *CertService) saveCertificate(cert *model.Certificate) error {
+	if cert.CertPem != "" {
+		if err := fillValidity(cert); err != nil {
+			return err
+		}
+	}
+	db := database.GetDB()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(cert).Error; err != nil {
+			return err
+		}
+		if cert.CertPem == "" {
+			return nil
+		}
+		return writeCertFiles(cert)
+	})
+	if err != nil {
+		return err
+	}
+	tlsCertCache.Delete(cert.Name)
+	InvalidateCertInventory()
+	return nil
+}
+
+func checkCertificate(cert *model.Certificate) error {
+	if !certNameRegex.MatchString(cert.Name) {
+		return common.NewError("证书名称只能包含字母、数字、点、下划线和横线:", cert.Name)
+	}
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.Certificate{}).Where("name = ? and id != ?", cert.Name, cert.Id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("证书名称已存在:", cert.Name)
+	}
+	return nil
+}
+
+// UploadCertificate 保存用户提供的证书和私钥
+func (s *CertService) UploadCertificate(cert *model.Certificate) error {
+	if err := checkCertificate(cert); err != nil {
+		return err
+	}
+	cert.Source = CertSourceUpload
+	cert.AutoRenew = false
+	return s.saveCertificate(cert)
+}
+
+// IssueCertificate 通过ACME申请新证书
+func (s *CertService) IssueCertificate(cert *model.Certificate) error {
+	if err := checkCertificate(cert); err != nil {
+		return err
+	}
+	if len(splitDomains(cert.Domains)) == 0 {
+		return errors.New("域名不能为空")
+	}
+	cert.Source = CertSourceAcme
+	if err := s.obtain(cert); err != nil {
+		return err
+	}
+	return s.saveCertificate(cert)
+}
+
+// RenewCertificate 重新申请ACME证书，失败时保留旧证书并记录错误
+func (s *CertService) RenewCertificate(id int) error {
+	cert, err := s.GetCertificate(id)
+	if err != nil {
+		return err
+	}
+	if cert.Source != CertSourceAcme {
+		return common.NewError("证书不是通过ACME申请的:", cert.Name)
+	}
+	if err := s.obtain(cert); err != nil {
+		cert.LastError = err.Error()
+		if dbErr := database.GetDB().Model(cert).Update("last_error", cert.LastError).Error; dbErr != nil {
+			return common.Combine(err, dbErr)
+		}
+		return err
+	}
+	cert.LastError = ""
+	return s.saveCertificate(cert)
+}
+
+// RenewDueCertificates 续期即将到期的自动续期证书，返回续期成功的数量
+func (s *CertService) RenewDueCertificates() (int, error) {
+	renewDays, err := s.settingService.GetAcmeRenewDays()
+	if err != nil {
+		return 0, err
+	}
+	certs, err := s.GetCertificates()
+	if err != nil {
+		return 0, err
+	}
+	deadline := time.Now().Add(time.Duration(renewDays) * 24 * time.Hour).UnixMilli()
+	renewed := 0
+	errs := make([]error, 0)
+	for _, cert := range certs {
+		if cert.Source != CertSourceAcme || !cert.AutoRenew || cert.NotAfter > deadline {
+			continue
+		}
+		logger.Info("开始续期证书:", cert.Name)
+		if err := s.RenewCertificate(cert.Id); err != nil {
+			errs = append(errs, fmt.Errorf("续期证书 %v 失败: %w", cert.Name, err))
+			continue
+		}
+		renewed++
+	}
+	return renewed, common.Combine(errs...)
+}
+
+func (s *CertService) DelCertificate(id int) error {
+	cert, err := s.GetCertificate(id)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	if err := db.Delete(model.Certificate{}, id).Error; err != nil {
+		return err
+	}
+	tlsCertCache.Delete(cert.Name)
+	InvalidateCertInventory()
+	certFile, keyFile := GetCertPaths(cert.Name)
+	os.Remove(certFile)
+	os.Remove(keyFile)
+	return nil
+}
+
+func (s *CertService) newAcmeClient() (*acme.Client, error) {
+	directoryUrl, err := s.settingService.GetAcmeDirectoryUrl()
+	if err != nil {
+		return nil, err
+	}
+	email, err := s.settingService.GetAcmeEmail()
+	if err != nil {
+		return nil, err
+	}
+	skipVerify, err := s.settingService.GetAcmeSkipVerify()
+	if err != nil {
+		return nil, err
+	}
+	keyPem, err := s.settingService.GetAcmeAccountKey()
+	if err != nil {
+		return nil, err
+	}
+	accountKey, err := acme.ParseKey([]byte(keyPem))
+	if err != nil {
+		return nil, err
+	}
+	return acme.NewClient(directoryUrl, email, accountKey, skipVerify), nil
+}
+
+// startHTTP01Server 在 acmeHttpPort 上临时监听 HTTP-01 验证请求
+func (s *CertService) startHTTP01Server(solver *acme.HTTP01Solver) (*http.Server, error) {
+	port, err := s.settingService.GetAcmeHttpPort()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("监听HTTP-01验证端口 %d 失败: %w", port, err)
+	}
+	server := &http.Server{
+		Handler:     solver,
+		ReadTimeout: 10 * time.Second,
+	}
+	go server.Serve(listener)
+	return server, nil
+}
+
+func (s *CertService) obtain(cert *model.Certificate) error {
+	acmeLock.Lock()
+	defer acmeLock.Unlock()
+
+	client, err := s.newAcmeClient()
+	if err != nil {
+		return err
+	}
+
+	var solver acme.Solver
+	switch cert.Challenge {
+	case acme.ChallengeHTTP01, "":
+		cert.Challenge = acme.ChallengeHTTP01
+		httpSolver := acme.NewHTTP01Solver()
+		server, err := s.startHTTP01Server(httpSolver)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+		solver = httpSolver
+	case acme.ChallengeDNS01:
+		dnsConfig := map[string]string{}
+		if cert.DnsConfig != "" {
+			if err := json.Unmarshal([]byte(cert.DnsConfig), &dnsConfig); err != nil {
+				return fmt.Errorf("DNS服务商配置无效: %w", err)
+			}
+		}
+		provider, err := acme.NewDNSProvider(cert.DnsProvider, dnsConfig)
+		if err != nil {
+			return err
+		}
+		solver = &acme.DNS01Solver{
+			Provider:        provider,
+			PropagationWait: dnsPropagationWait,
+		}
+	default:
+		return common.NewError("不支持的验证方式:", cert.Challenge)
+	}
+
+	ctx, cancel := context.WithTimeout(s.getContext(), acmeTimeout)
+	defer cancel()
+	certPem, keyPem, err := client.Obtain(ctx, splitDomains(cert.Domains), cert.Challenge, solver)
+	if err != nil {
+		return err
+	}
+	cert.CertPem = string(certPem)
+	cert.KeyPem = string(keyPem)
+	logger.Info("成功申请证书:", cert.Name)
+	return nil
+}
+
+func (s *CertService) GetDNSProviders() []string {
+	return acme.GetDNSProviderNames()
+}
+
+// GetTLSCertificate 按名称获取托管证书，用于面板 HTTPS
+func (s *CertService) GetTLSCertificate(name string) (*tls.Certificate, error) {
+	if cached, ok := tlsCertCache.Load(name); ok {
+		return cached.(*tls.Certificate), nil
+	}
+	cert, err := s.GetCertificateByName(name)
+	if err != nil {
+		return nil, err
+	}
+	tlsCert, err := tls.X509KeyPair([]byte(cert.CertPem), []byte(cert.KeyPem))
+	if err != nil {
+		return nil, err
+	}
+	tlsCertCache.Store(name, &tlsCert)
+	return &tlsCert, nil
+}
+
+// ResolveStreamSettings 将 tlsSettings.certificates 中的 certificateName 替换为托管证书的文件路径
+func (s *CertService) ResolveStreamSettings(streamSettings string) (string, error) {
+	if !strings.Contains(streamSettings, "certificateName") {
+		return streamSettings, nil
+	}
+	stream := &xray.StreamSettings{}
+	if err := json.Unmarshal([]byte(streamSettings), stream); err != nil {
+		return "", err
+	}
+	tlsSettings := stream.GetTLSSettings()
+	if tlsSettings == nil {
+		return streamSettings, nil
+	}
+	for _, certificate := range tlsSettings.Certificates {
+		name := certificate.CertificateName
+		if name == "" {
+			continue
+		}
+		cert, err := s.GetCertificateByName(name)
+		if err != nil {
+			return "", err
+		}
+		certFile, keyFile := GetCertPaths(name)
+		if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+			if err := writeCertFiles(cert); err != nil {
+				return "", err
+			}
+		}
+		certificate.UseFiles(certFile, keyFile)
+	}
+	data, err := json.Marshal(stream)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/pki"
+	"x-ui/xray"
+)
+
+const (
+	CertApplyPanel = "panel"
+)
+
+// CertGenerateOptions 本地生成证书的参数
+type CertGenerateOptions struct {
+	Name string `json:"name" form:"name"`
+	// selfsigned、ca 或 localca(由 CaName 指定的私有CA签发)
+	Type       string `json:"type" form:"type"`
+	CaName     string `json:"caName" form:"caName"`
+	CommonName string `json:"commonName" form:"commonName"`
+	Hosts      string `json:"hosts" form:"hosts"` // 域名或IP，逗号分隔
+	KeyType    string `json:"keyType" form:"keyType"`
+	KeyBits    int    `json:"keyBits" form:"keyBits"`
+	ValidDays  int    `json:"validDays" form:"validDays"`
+	// 生成后应用到 panel 或入站ID，为空则只保存
+	Apply string `json:"apply" form:"apply"`
+}
+
+// GenerateCertificate 生成自签名证书、私有CA或由私有CA签发的证书并保存到证书库
+func (s *CertService) GenerateCertificate(opts *CertGenerateOptions) (*model.Certificate, error) {
+	cert := &model.Certificate{
+		Name:    opts.Name,
+		Domains: opts.Hosts,
+		Source:  opts.Type,
+	}
+	if err := checkCertificate(cert); err != nil {
+		return nil, err
+	}
+	pkiOpts := &pki.Options{
+		CommonName: opts.CommonName,
+		Hosts:      splitDomains(opts.Hosts),
+		KeyType:    opts.KeyType,
+		KeyBits:    opts.KeyBits,
+		ValidDays:  opts.ValidDays,
+	}
+
+	var certPem, keyPem []byte
+	var err error
+	switch opts.Type {
+	case CertSourceSelfSigned, "":
+		cert.Source = CertSourceSelfSigned
+		certPem, keyPem, err = pki.GenerateSelfSigned(pkiOpts)
+	case CertSourceCA:
+		if opts.Apply != "" {
+			return nil, errors.New("CA证书不能直接用于TLS")
+		}
+		certPem, keyPem, err = pki.GenerateCA(pkiOpts)
+	case CertSourceLocalCA:
+		var ca *model.Certificate
+		ca, err = s.GetCertificateByName(opts.CaName)
+		if err != nil {
+			return nil, err
+		}
+		if ca.Source != CertSourceCA {
+			return nil, common.NewError("证书不是私有CA:", opts.CaName)
+		}
+		certPem, keyPem, err = pki.GenerateLeaf(pkiOpts, []byte(ca.CertPem), []byte(ca.KeyPem))
+	default:
+		return nil, common.NewError("不支持的证书类型:", opts.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cert.CertPem = string(certPem)
+	cert.KeyPem = string(keyPem)
+	if err := s.saveCertificate(cert); err != nil {
+		return nil, err
+	}
+
+	if opts.Apply != "" {
+		if err := s.ApplyCertificate(cert.Name, opts.Apply); err != nil {
+			return cert, err
+		}
+	}
+	return cert, nil
+}
+
+// ApplyCertificate 将证书库中的证书应用到面板(target 为 panel)或指定ID的入站
+func (s *CertService) ApplyCertificate(name string, target string) error {
+	cert, err := s.GetCertificateByName(name)
+	if err != nil {
+		return err
+	}
+	if cert.Source == CertSourceCA {
+		return errors.New("CA证书不能直接用于TLS")
+	}
+	if target == CertApplyPanel {
+		return s.settingService.SetCertName(name)
+	}
+	inboundId, err := strconv.Atoi(target)
+	if err != nil {
+		return common.NewError("无效的应用目标:", target)
+	}
+	return s.applyToInbound(name, inboundId)
+}
+
+// applyToInbound 将入站的TLS证书替换为托管证书，未启用TLS时同时开启TLS
+func (s *CertService) applyToInbound(name string, inboundId int) error {
+	inbound, err := s.inboundService.GetInbound(inboundId)
+	if err != nil {
+		return err
+	}
+	stream, err := inbound.GetStreamSettings()
+	if err != nil {
+		return err
+	}
+	switch stream.Security {
+	case "tls", "xtls":
+	case "", "none":
+		stream.Security = "tls"
+	default:
+		return common.NewError("入站的传输安全类型不支持证书:", stream.Security)
+	}
+	tlsSettings := stream.GetTLSSettings()
+	if tlsSettings == nil {
+		tlsSettings = &xray.TLSSettings{}
+		if stream.Security == "xtls" {
+			stream.XTLSSettings = tlsSettings
+		} else {
+			stream.TLSSettings = tlsSettings
+		}
+	}
+	tlsSettings.Certificates = []*xray.TLSCertificate{
+		{CertificateName: name},
+	}
+	if err := inbound.SetStreamSettings(stream); err != nil {
+		return err
+	}
+	return s.inboundService.UpdateInbound(inbound)
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/event"
+	"x-ui/xray"
+)
+
+const (
+	CertUsagePanel   = "panel"
+	CertUsageInbound = "inbound"
+	CertUsageStore   = "store"
+
+	// 扫描结果缓存时间，状态接口会频繁调用
+	certInventoryTTL = time.Minute
+)
+
+var (
+	certInventoryLock sync.Mutex
+	certInventory     []*CertInfo
+	certInventoryTime time.Time
+
+	// 证书指纹 -> 最近一次告警的日期
+	certAlertTimes sync.Map
+)
+
+// CertInfo 面板或入站正在使用的一个证书
+type CertInfo struct {
+	Usage     string   `json:"usage"`
+	Name      string   `json:"name"`
+	InboundId int      `json:"inboundId,omitempty"`
+	Location  string   `json:"location"` // 文件路径、inline 或 store:<名称>
+	Subject   string   `json:"subject"`
+	Issuer    string   `json:"issuer"`
+	DNSNames  []string `json:"dnsNames"`
+	NotBefore int64    `json:"notBefore"`
+	NotAfter  int64    `json:"notAfter"`
+	DaysLeft  int      `json:"daysLeft"`
+	// 证书 DER 的 SHA256，用于识别同一个证书
+	Fingerprint string `json:"fingerprint"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (c *CertInfo) IsExpiringWithin(days int) bool {
+	return c.Error == "" && c.DaysLeft <= days
+}
+
+// parseCertInfo 解析 PEM 证书链中的第一个证书
+func parseCertInfo(info *CertInfo, certPem []byte) *CertInfo {
+	block, _ := pem.Decode(certPem)
+	if block == nil {
+		info.Error = "无效的证书PEM"
+		return info
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	fingerprint := sha256.Sum256(cert.Raw)
+	info.Subject = cert.Subject.String()
+	info.Issuer = cert.Issuer.String()
+	info.DNSNames = cert.DNSNames
+	for _, ip := range cert.IPAddresses {
+		info.DNSNames = append(info.DNSNames, ip.String())
+	}
+	info.NotBefore = cert.NotBefore.UnixMilli()
+	info.NotAfter = cert.NotAfter.UnixMilli()
+	info.DaysLeft = int(time.Until(cert.NotAfter).Hours() / 24)
+	info.Fingerprint = hex.EncodeToString(fingerprint[:])
+	return info
+}
+
+func parseCertFile(info *CertInfo, path string) *CertInfo {
+	info.Location = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	return parseCertInfo(info, data)
+}
+
+func (s *CertService) parseStoreCert(info *CertInfo, name string) *CertInfo {
+	info.Location = "store:" + name
+	cert, err := s.GetCertificateByName(name)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	return parseCertInfo(info, []byte(cert.CertPem))
+}
+
+func (s *CertService) scanPanelCert() (*CertInfo, error) {
+	info := &CertInfo{
+		Usage: CertUsagePanel,
+		Name:  "panel",
+	}
+	certName, err := s.settingService.GetCertName()
+	if err != nil {
+		return nil, err
+	}
+	if certName != "" {
+		return s.parseStoreCert(info, certName), nil
+	}
+	certFile, err := s.settingService.GetCertFile()
+	if err != nil {
+		return nil, err
+	}
+	if certFile == "" {
+		return nil, nil
+	}
+	return parseCertFile(info, certFile), nil
+}
+
+// scanInboundCerts 解析入站 TLS 设置中的证书，支持文件、内联PEM和托管证书
+func (s *CertService) scanInboundCerts(inbound *model.Inbound) []*CertInfo {
+	infos := make([]*CertInfo, 0)
+	stream, err := inbound.GetStreamSettings()
+	if err != nil {
+		return infos
+	}
+	for _, tlsSettings := range []*xray.TLSSettings{stream.TLSSettings, stream.XTLSSettings} {
+		if tlsSettings == nil {
+			continue
+		}
+		for _, c := range tlsSettings.Certificates {
+			info := &CertInfo{
+				Usage:     CertUsageInbound,
+				Name:      inbound.Remark,
+				InboundId: inbound.Id,
+			}
+			switch {
+			case c.CertificateName != "":
+				infos = append(infos, s.parseStoreCert(info, c.CertificateName))
+			case c.CertificateFile != "":
+				infos = append(infos, parseCertFile(info, c.CertificateFile))
+			case len(c.Certificate) > 0:
+				info.Location = "inline"
+				infos = append(infos, parseCertInfo(info, []byte(strings.Join(c.Certificate, "\n"))))
+			}
+		}
+	}
+	return infos
+}
+
+// ScanCertificates 扫描面板、所有入站及证书库中的证书
+func (s *CertService) ScanCertificates() ([]*CertInfo, error) {
+	infos := make([]*CertInfo, 0)
+	panelCert, err := s.scanPanelCert()
+	if err != nil {
+		return nil, err
+	}
+	if panelCert != nil {
+		infos = append(infos, panelCert)
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	for _, inbound := range inbounds {
+		infos = append(infos, s.scanInboundCerts(inbound)...)
+	}
+
+	certs, err := s.GetCertificates()
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		info := &CertInfo{
+			Usage:    CertUsageStore,
+			Name:     cert.Name,
+			Location: "store:" + cert.Name,
+		}
+		infos = append(infos, parseCertInfo(info, []byte(cert.CertPem)))
+	}
+	return infos, nil
+}
+
+// GetCertInventory 获取证书清单，结果缓存一分钟
+func (s *CertService) GetCertInventory() ([]*CertInfo, error) {
+	certInventoryLock.Lock()
+	defer certInventoryLock.Unlock()
+	if certInventory != nil && time.Since(certInventoryTime) < certInventoryTTL {
+		return certInventory, nil
+	}
+	infos, err := s.ScanCertificates()
+	if err != nil {
+		return nil, err
+	}
+	certInventory = infos
+	certInventoryTime = time.Now()
+	return infos, nil
+}
+
+// GetExpiringCertificates 获取在 certAlertDays 天内到期(含已过期)的证书
+func (s *CertService) GetExpiringCertificates() ([]*CertInfo, error) {
+	days, err := s.settingService.GetCertAlertDays()
+	if err != nil {
+		return nil, err
+	}
+	infos, err := s.GetCertInventory()
+	if err != nil {
+		return nil, err
+	}
+	expiring := make([]*CertInfo, 0)
+	for _, info := range infos {
+		if info.IsExpiringWithin(days) {
+			expiring = append(expiring, info)
+		}
+	}
+	return expiring, nil
+}
+
+// CheckCertExpiry 对即将到期的证书发布 cert.expiring 事件，同一证书每天最多告警一次
+func (s *CertService) CheckCertExpiry() error {
+	infos, err := s.GetExpiringCertificates()
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		return nil
+	}
+	today := time.Now().Format("2006-01-02")
+	alerted := map[string]bool{}
+	for _, info := range infos {
+		// 同一证书可能被多处引用，只告警一次并附带所有引用位置
+		if alerted[info.Fingerprint] {
+			continue
+		}
+		alerted[info.Fingerprint] = true
+		if last, ok := certAlertTimes.Load(info.Fingerprint); ok && last.(string) == today {
+			continue
+		}
+		certAlertTimes.Store(info.Fingerprint, today)
+
+		usages := make([]string, 0)
+		for _, other := range infos {
+			if other.Fingerprint == info.Fingerprint {
+				usages = append(usages, fmt.Sprintf("%v:%v", other.Usage, other.Name))
+			}
+		}
+		logger.Warningf("证书 %v 将在 %d 天后到期，使用位置: %v", info.Subject, info.DaysLeft, strings.Join(usages, ", "))
+		event.Publish(event.CertExpiring, map[string]interface{}{
+			"subject":     info.Subject,
+			"dnsNames":    info.DNSNames,
+			"notAfter":    info.NotAfter,
+			"daysLeft":    info.DaysLeft,
+			"fingerprint": info.Fingerprint,
+			"usages":      usages,
+		})
+	}
+	return nil
+}
+
+// InvalidateCertInventory 证书变更后清除缓存
+func InvalidateCertInventory() {
+	certInventoryLock.Lock()
+	defer certInventoryLock.Unlock()
+	certInventory = nil
+}
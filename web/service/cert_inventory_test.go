@@ -0,0 +1,225 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/pki"
+	"x-ui/web/event"
+	"x-ui/xray"
+)
+
+func generateTestCert(t *testing.T, host string, validDays int) []byte {
+	t.Helper()
+	certPem, _, err := pki.GenerateSelfSigned(&pki.Options{Hosts: []string{host, "127.0.0.1"}, ValidDays: validDays})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPem
+}
+
+// newTLSInbound 创建使用给定证书配置的 TLS 入站
+func newTLSInbound(t *testing.T, port int, remark string, certs ...*xray.TLSCertificate) *model.Inbound {
+	t.Helper()
+	stream, err := json.Marshal(map[string]interface{}{
+		"network":     "tcp",
+		"security":    "tls",
+		"tlsSettings": map[string]interface{}{"certificates": certs},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbound := &model.Inbound{
+		Port:           port,
+		Remark:         remark,
+		Tag:            "inbound-" + remark,
+		Protocol:       model.Trojan,
+		Settings:       `{"clients":[{"password":"password"}]}`,
+		StreamSettings: string(stream),
+	}
+	if err := database.GetDB().Create(inbound).Error; err != nil {
+		t.Fatal(err)
+	}
+	return inbound
+}
+
+func initCertInventoryTest(t *testing.T) *CertService {
+	t.Helper()
+	initTestDB(t)
+	InvalidateCertInventory()
+	t.Cleanup(InvalidateCertInventory)
+	certAlertTimes.Range(func(key, value interface{}) bool {
+		certAlertTimes.Delete(key)
+		return true
+	})
+
+	s := &CertService{}
+	dir := t.TempDir()
+	expiring := generateTestCert(t, "expiring.example.com", 5)
+	valid := generateTestCert(t, "valid.example.com", 365)
+
+	// 面板和入站 a 引用同一个即将到期的证书
+	panelCertFile := filepath.Join(dir, "panel.crt")
+	if err := os.WriteFile(panelCertFile, expiring, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.settingService.setString("webCertFile", panelCertFile); err != nil {
+		t.Fatal(err)
+	}
+	newTLSInbound(t, 1001, "a", &xray.TLSCertificate{Certificate: strings.Split(strings.TrimSpace(string(expiring)), "\n")})
+	newTLSInbound(t, 1002, "b",
+		&xray.TLSCertificate{CertificateFile: panelCertFile},
+		&xray.TLSCertificate{CertificateFile: filepath.Join(dir, "missing.crt")},
+		&xray.TLSCertificate{CertificateName: "stored"},
+	)
+	err := database.GetDB().Create(&model.Certificate{Name: "stored", Source: CertSourceUpload, CertPem: string(valid)}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScanCertificates(t *testing.T) {
+	s := initCertInventoryTest(t)
+
+	infos, err := s.ScanCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(infos))
+	for _, info := range infos {
+		location := info.Location
+		if strings.HasPrefix(location, "/") {
+			location = filepath.Base(location)
+		}
+		got = append(got, info.Usage+":"+info.Name+":"+location)
+	}
+	want := []string{
+		"panel:panel:panel.crt",
+		"inbound:a:inline",
+		"inbound:b:panel.crt",
+		"inbound:b:missing.crt",
+		"inbound:b:store:stored",
+		"store:stored:store:stored",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("扫描结果为 %v，期望 %v", got, want)
+	}
+
+	panel, inline, file, missingInfo, stored := infos[0], infos[1], infos[2], infos[3], infos[4]
+	if panel.Error != "" || panel.Subject != "CN=expiring.example.com,O=x-ui" || panel.DaysLeft != 4 {
+		t.Fatalf("面板证书为 %+v", panel)
+	}
+	sort.Strings(panel.DNSNames)
+	if strings.Join(panel.DNSNames, ",") != "127.0.0.1,expiring.example.com" {
+		t.Fatalf("证书名称为 %v，期望包含域名和 IP", panel.DNSNames)
+	}
+	// 内联PEM与文件中的同一证书指纹相同
+	if inline.Fingerprint != panel.Fingerprint || file.Fingerprint != panel.Fingerprint {
+		t.Fatalf("同一证书的指纹不同: %v %v %v", panel.Fingerprint, inline.Fingerprint, file.Fingerprint)
+	}
+	if inline.InboundId == 0 || inline.NotAfter <= time.Now().UnixMilli() {
+		t.Fatalf("内联证书为 %+v", inline)
+	}
+	if missingInfo.Error == "" || missingInfo.Fingerprint != "" {
+		t.Fatalf("证书文件不存在时为 %+v，期望带有错误", missingInfo)
+	}
+	if stored.Error != "" || stored.Subject != "CN=valid.example.com,O=x-ui" || stored.DaysLeft < 360 {
+		t.Fatalf("托管证书为 %+v", stored)
+	}
+}
+
+func TestScanInlineCertError(t *testing.T) {
+	initTestDB(t)
+	s := &CertService{}
+	inbound := newTLSInbound(t, 1001, "a", &xray.TLSCertificate{Certificate: []string{"-----BEGIN CERTIFICATE-----", "bm90IGEgY2VydA==", "-----END CERTIFICATE-----"}})
+	infos := s.scanInboundCerts(inbound)
+	if len(infos) != 1 || infos[0].Location != "inline" || infos[0].Error == "" {
+		t.Fatalf("无效的内联证书扫描为 %+v", infos)
+	}
+	// 解析失败的证书不参与到期告警
+	if infos[0].IsExpiringWithin(14) {
+		t.Fatal("解析失败的证书被当作即将到期")
+	}
+}
+
+func TestCertExpiringThreshold(t *testing.T) {
+	cases := []struct {
+		validDays int
+		daysLeft  int
+		expiring  bool
+	}{
+		{15, 14, true},
+		{16, 15, false},
+	}
+	for _, c := range cases {
+		info := parseCertInfo(&CertInfo{}, generateTestCert(t, "example.com", c.validDays))
+		if info.DaysLeft != c.daysLeft {
+			t.Fatalf("有效期 %d 天的证书剩余 %d 天，期望 %d 天", c.validDays, info.DaysLeft, c.daysLeft)
+		}
+		if got := info.IsExpiringWithin(14); got != c.expiring {
+			t.Fatalf("剩余 %d 天时告警为 %v，期望 %v", info.DaysLeft, got, c.expiring)
+		}
+	}
+}
+
+func TestCheckCertExpiry(t *testing.T) {
+	s := initCertInventoryTest(t)
+	events := make(chan *event.Event, 10)
+	unsubscribe := event.Subscribe(func(e *event.Event) {
+		if e.Type == event.CertExpiring {
+			events <- e
+		}
+	})
+	t.Cleanup(unsubscribe)
+
+	expiring, err := s.GetExpiringCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expiring) != 3 {
+		t.Fatalf("即将到期的证书有 %d 处，期望面板和两个入站共 3 处", len(expiring))
+	}
+
+	if err := s.CheckCertExpiry(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		data := e.Data.(map[string]interface{})
+		usages := data["usages"].([]string)
+		if data["subject"] != "CN=expiring.example.com,O=x-ui" || strings.Join(usages, ",") != "panel:panel,inbound:a,inbound:b" {
+			t.Fatalf("告警内容为 %v", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("没有发布证书到期事件")
+	}
+
+	// 同一证书当天只告警一次
+	if err := s.CheckCertExpiry(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("重复告警: %v", e.Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 提高阈值后有效期较长的证书也会告警
+	if err := s.settingService.setString("certAlertDays", "400"); err != nil {
+		t.Fatal(err)
+	}
+	expiring, err = s.GetExpiringCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expiring) != 5 {
+		t.Fatalf("阈值 400 天时有 %d 处证书告警，期望除缺失文件外的 5 处", len(expiring))
+	}
+}
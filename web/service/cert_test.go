@@ -0,0 +1,149 @@
+package service
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"x-ui/database/model"
+
+	"github.com/letsencrypt/pebble/v2/ca"
+	"github.com/letsencrypt/pebble/v2/db"
+	"github.com/letsencrypt/pebble/v2/va"
+	"github.com/letsencrypt/pebble/v2/wfe"
+)
+
+// freePort 返回一个当前空闲的本地端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// newPebbleServer 在本地启动 Pebble ACME 服务，HTTP-01 验证访问 httpPort
+func newPebbleServer(t *testing.T, httpPort int) string {
+	t.Helper()
+	t.Setenv("PEBBLE_VA_NOSLEEP", "1")
+	t.Setenv("PEBBLE_WFE_NONCEREJECT", "0")
+	logger := log.New(io.Discard, "", 0)
+	store := db.NewMemoryStore()
+	authority := ca.New(logger, store, "", 0, 1, 0)
+	validator := va.New(logger, httpPort, 0, false, "", store)
+	frontEnd := wfe.New(logger, store, validator, authority, false, false, 0, 0)
+	server := httptest.NewTLSServer(frontEnd.Handler())
+	t.Cleanup(server.Close)
+	return server.URL + wfe.DirectoryPath
+}
+
+func initCertTest(t *testing.T) *CertService {
+	t.Helper()
+	initTestDB(t)
+	t.Setenv("XUI_CERT_DIR", t.TempDir())
+	httpPort := freePort(t)
+	s := &CertService{}
+	settings := map[string]string{
+		"acmeDirectoryUrl": newPebbleServer(t, httpPort),
+		"acmeEmail":        "admin@example.com",
+		"acmeHttpPort":     strconv.Itoa(httpPort),
+		"acmeSkipVerify":   "true",
+	}
+	for key, value := range settings {
+		if err := s.settingService.setString(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// checkCertFiles 磁盘上的证书与数据库中的一致，返回证书序列号
+func checkCertFiles(t *testing.T, s *CertService, id int) string {
+	t.Helper()
+	cert, err := s.GetCertificate(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := GetCertPaths(cert.Name)
+	certPem, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPem, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(certPem) != cert.CertPem || string(keyPem) != cert.KeyPem {
+		t.Fatal("磁盘上的证书与数据库中的不一致")
+	}
+	block, _ := pem.Decode(certPem)
+	if block == nil {
+		t.Fatal("无效的证书PEM")
+	}
+	x509Cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x509Cert.NotAfter.UnixMilli() != cert.NotAfter {
+		t.Fatalf("数据库中的到期时间 %d 与证书 %d 不一致", cert.NotAfter, x509Cert.NotAfter.UnixMilli())
+	}
+	if len(x509Cert.DNSNames) != 1 || x509Cert.DNSNames[0] != "localhost" {
+		t.Fatalf("证书域名为 %v", x509Cert.DNSNames)
+	}
+	return x509Cert.SerialNumber.String()
+}
+
+func TestIssueAndRenewCertificate(t *testing.T) {
+	s := initCertTest(t)
+
+	cert := &model.Certificate{Name: "pebble", Domains: "localhost", AutoRenew: true}
+	if err := s.IssueCertificate(cert); err != nil {
+		t.Fatal(err)
+	}
+	if cert.Source != CertSourceAcme || cert.Challenge != "http-01" {
+		t.Fatalf("证书来源为 %v，验证方式为 %v", cert.Source, cert.Challenge)
+	}
+	serial := checkCertFiles(t, s, cert.Id)
+
+	if err := s.RenewCertificate(cert.Id); err != nil {
+		t.Fatal(err)
+	}
+	if renewed := checkCertFiles(t, s, cert.Id); renewed == serial {
+		t.Fatal("续期后证书未更新")
+	}
+}
+
+func TestRenewCertificateFailureKeepsOldCert(t *testing.T) {
+	s := initCertTest(t)
+
+	cert := &model.Certificate{Name: "pebble", Domains: "localhost", AutoRenew: true}
+	if err := s.IssueCertificate(cert); err != nil {
+		t.Fatal(err)
+	}
+	serial := checkCertFiles(t, s, cert.Id)
+
+	// ACME 服务不可用时续期失败，保留旧证书并记录错误
+	if err := s.settingService.setString("acmeDirectoryUrl", "https://127.0.0.1:1/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RenewCertificate(cert.Id); err == nil {
+		t.Fatal("ACME 服务不可用时续期应失败")
+	}
+	if checkCertFiles(t, s, cert.Id) != serial {
+		t.Fatal("续期失败后证书被修改")
+	}
+	saved, err := s.GetCertificate(cert.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.LastError == "" {
+		t.Fatal("续期失败后未记录错误")
+	}
+}
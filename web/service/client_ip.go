@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+)
+
+// ClientIpLimit 客户端允许同时使用的IP数量
+type ClientIpLimit struct {
+	InboundTag string
+	Email      string
+	LimitIp    int
+}
+
+type ClientIpService struct {
+	ctx            context.Context
+	inboundService InboundService
+	settingService SettingService
+}
+
+func NewClientIpService(ctx context.Context) *ClientIpService {
+	return &ClientIpService{
+		ctx: ctx,
+	}
+}
+
+const clientIpKeySeparator = "|"
+
+// ClientIpKey 限制、在线IP和客户端流量以入站 tag 加 email 区分，同一 email 出现在多个入站时分别计数
+func ClientIpKey(inboundTag string, email string) string {
+	return inboundTag + clientIpKeySeparator + email
+}
+
+// SplitClientIpKey 拆分 ClientIpKey，旧版本只按 email 记录时返回的 inboundTag 为空
+func SplitClientIpKey(key string) (string, string) {
+	if inboundTag, email, ok := strings.Cut(key, clientIpKeySeparator); ok {
+		return inboundTag, email
+	}
+	return "", key
+}
+
+// genClientStatsSettings 将 settings 中客户端的 email 替换为 ClientIpKey。
+// xray 按 email 统计用户流量，替换后同一 email 在不同入站中的流量分别统计，访问日志中的 email 也带有入站 tag
+func genClientStatsSettings(inboundTag string, settings string) (string, error) {
+	obj := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(settings), &obj); err != nil {
+		return "", err
+	}
+	data, ok := obj["clients"]
+	if !ok {
+		return settings, nil
+	}
+	clients := make([]map[string]json.RawMessage, 0)
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return "", err
+	}
+	for _, client := range clients {
+		var email string
+		if err := json.Unmarshal(client["email"], &email); err != nil || email == "" {
+			continue
+		}
+		key, err := json.Marshal(ClientIpKey(inboundTag, email))
+		if err != nil {
+			return "", err
+		}
+		client["email"] = key
+	}
+	data, err := json.Marshal(clients)
+	if err != nil {
+		return "", err
+	}
+	obj["clients"] = data
+	data, err = json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// GetClientIpLimits 从所有启用的入站中读取设置了 limitIp 的客户端，以 ClientIpKey 为键
+func (s *ClientIpService) GetClientIpLimits() (map[string]*ClientIpLimit, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	limits := make(map[string]*ClientIpLimit)
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		clients, err := inbound.GetClients()
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if client.Email == "" || client.LimitIp <= 0 {
+				continue
+			}
+			limits[ClientIpKey(inbound.Tag, client.Email)] = &ClientIpLimit{
+				InboundTag: inbound.Tag,
+				Email:      client.Email,
+				LimitIp:    client.LimitIp,
+			}
+		}
+	}
+	return limits, nil
+}
+
+func (s *ClientIpService) IsBlocked(inboundTag string, email string, ip string) (bool, error) {
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.ClientIpBlock{}).
+		Where("inbound_tag = ? and email = ? and ip = ? and expiry_time > ?", inboundTag, email, ip, time.Now().Unix()*1000).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BlockIp 在冷却时间内封禁客户端的某个IP
+func (s *ClientIpService) BlockIp(inboundTag string, email string, ip string) error {
+	cooldown, err := s.settingService.GetIpLimitCooldown()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	block := &model.ClientIpBlock{
+		InboundTag: inboundTag,
+		Email:      email,
+		Ip:         ip,
+		CreatedAt:  now.Unix() * 1000,
+		ExpiryTime: now.Add(time.Duration(cooldown)*time.Minute).Unix() * 1000,
+	}
+	logger.Warningf("客户端 %v 超出IP数量限制，封禁IP %v %v 分钟", email, ip, cooldown)
+	db := database.GetDB()
+	return db.Create(block).Error
+}
+
+func (s *ClientIpService) GetActiveBlocks() ([]*model.ClientIpBlock, error) {
+	db := database.GetDB()
+	blocks := make([]*model.ClientIpBlock, 0)
+	err := db.Model(model.ClientIpBlock{}).
+		Where("expiry_time > ?", time.Now().Unix()*1000).
+		Find(&blocks).Error
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// LiftExpiredBlocks 解除已过冷却时间的封禁
+func (s *ClientIpService) LiftExpiredBlocks() (int64, error) {
+	db := database.GetDB()
+	result := db.Where("expiry_time <= ?", time.Now().Unix()*1000).Delete(model.ClientIpBlock{})
+	if result.RowsAffected > 0 {
+		logger.Infof("已解除 %v 个客户端IP封禁", result.RowsAffected)
+	}
+	return result.RowsAffected, result.Error
+}
+
+// GenBlockRules 为封禁中的IP生成转发到 blocked 的路由规则，只匹配超出限制的客户端，
+// 同一IP(如 NAT 后)的其他客户端不受影响
+func (s *ClientIpService) GenBlockRules() ([]interface{}, error) {
+	blocks, err := s.GetActiveBlocks()
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		rules = append(rules, map[string]interface{}{
+			"type":        "field",
+			"inboundTag":  []string{block.InboundTag},
+			"source":      []string{block.Ip},
+			"user":        []string{ClientIpKey(block.InboundTag, block.Email)},
+			"outboundTag": "blocked",
+		})
+	}
+	return rules, nil
+}
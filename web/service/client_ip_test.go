@@ -0,0 +1,93 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+func TestGenClientStatsSettings(t *testing.T) {
+	settings := `{"clients":[{"id":"1","email":"alice","total":1700000000000},{"id":"2"},{"id":"3","email":""}],"decryption":"none"}`
+	got, err := genClientStatsSettings("in-a", settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := struct {
+		Clients    []map[string]interface{} `json:"clients"`
+		Decryption string                   `json:"decryption"`
+	}{}
+	if err := json.Unmarshal([]byte(got), &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Decryption != "none" || len(obj.Clients) != 3 {
+		t.Fatalf("settings 为 %v", got)
+	}
+	if email := obj.Clients[0]["email"]; email != "in-a|alice" {
+		t.Fatalf("email 为 %v，期望 in-a|alice", email)
+	}
+	if total := obj.Clients[0]["total"]; total != float64(1700000000000) {
+		t.Fatalf("其他字段被修改: %v", got)
+	}
+	if _, ok := obj.Clients[1]["email"]; ok {
+		t.Fatalf("没有 email 的客户端不应添加 email: %v", got)
+	}
+	if email := obj.Clients[2]["email"]; email != "" {
+		t.Fatalf("空 email 不应替换: %v", got)
+	}
+
+	// 没有客户端的协议原样返回
+	socks := `{"auth":"noauth"}`
+	if got, err := genClientStatsSettings("in-b", socks); err != nil || got != socks {
+		t.Fatalf("settings 为 %v, %v", got, err)
+	}
+}
+
+func TestSplitClientIpKey(t *testing.T) {
+	cases := []struct {
+		key  string
+		want []string
+	}{
+		{ClientIpKey("in-a", "alice"), []string{"in-a", "alice"}},
+		{ClientIpKey("in-a", "a|b"), []string{"in-a", "a|b"}},
+		{"alice", []string{"", "alice"}},
+	}
+	for _, c := range cases {
+		inboundTag, email := SplitClientIpKey(c.key)
+		if got := []string{inboundTag, email}; !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("SplitClientIpKey(%q) = %q，期望 %q", c.key, got, c.want)
+		}
+	}
+}
+
+func TestGenBlockRules(t *testing.T) {
+	initTestDB(t)
+	now := time.Now().UnixMilli()
+	blocks := []*model.ClientIpBlock{
+		{InboundTag: "in-a", Email: "alice", Ip: "1.2.3.4", CreatedAt: now, ExpiryTime: now + 60000},
+		// 已过冷却时间的封禁不生成规则
+		{InboundTag: "in-a", Email: "bob", Ip: "5.6.7.8", CreatedAt: now - 120000, ExpiryTime: now - 60000},
+	}
+	if err := database.GetDB().Create(&blocks).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := (&ClientIpService{}).GenBlockRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{
+		map[string]interface{}{
+			"type":        "field",
+			"inboundTag":  []string{"in-a"},
+			"source":      []string{"1.2.3.4"},
+			"user":        []string{"in-a|alice"},
+			"outboundTag": "blocked",
+		},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Fatalf("路由规则为 %v，期望 %v", rules, want)
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+var fallbackAlpns = []string{"", "h2", "http/1.1"}
+
+// FallbackService 管理 VLESS/Trojan 入站的结构化回落，保存时和生成 xray 配置时写入 settings.fallbacks
+type FallbackService struct {
+	inboundService InboundService
+}
+
+func (s *FallbackService) GetFallbacks(inboundId int) ([]*model.InboundFallback, error) {
+	db := database.GetDB()
+	fallbacks := make([]*model.InboundFallback, 0)
+	err := db.Model(model.InboundFallback{}).Where("inbound_id = ?", inboundId).Order("id").Find(&fallbacks).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return fallbacks, nil
+}
+
+// fallbackTargets 除 ignoreId 外所有入站的回落目标，用于检测回落环
+func (s *FallbackService) fallbackTargets(ignoreId int) (map[int][]int, error) {
+	db := database.GetDB()
+	var fallbacks []*model.InboundFallback
+	err := db.Model(model.InboundFallback{}).Where("inbound_id != ? and target_id > 0", ignoreId).Find(&fallbacks).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	targets := map[int][]int{}
+	for _, fallback := range fallbacks {
+		targets[fallback.InboundId] = append(targets[fallback.InboundId], fallback.TargetId)
+	}
+	return targets, nil
+}
+
+// reaches 判断从 from 沿回落能否到达 to
+func reaches(targets map[int][]int, from int, to int, visited map[int]bool) bool {
+	if from == to {
+		return true
+	}
+	if visited[from] {
+		return false
+	}
+	visited[from] = true
+	for _, next := range targets[from] {
+		if reaches(targets, next, to, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// inboundFallbackDest 回落到入站时优先使用其 Unix domain socket，本机地址只写端口
+func inboundFallbackDest(target *model.Inbound) json.RawMessage {
+	listens := target.GetListens()
+	for _, listen := range listens {
+		if model.IsUnixListen(listen) {
+			return json.RawMessage(strconv.Quote(listen))
+		}
+	}
+	listen := listens[0]
+	if ip := net.ParseIP(listen); isWildcardListen(listen) || (ip != nil && ip.IsLoopback()) {
+		return json.RawMessage(strconv.Itoa(target.Port))
+	}
+	return json.RawMessage(strconv.Quote(net.JoinHostPort(listen, strconv.Itoa(target.Port))))
+}
+
+// fallbackDest 纯数字的 Dest 按端口输出，其余按地址字符串输出
+func fallbackDest(dest string) json.RawMessage {
+	dest = strings.TrimSpace(dest)
+	if _, err := strconv.Atoi(dest); err == nil {
+		return json.RawMessage(dest)
+	}
+	return json.RawMessage(strconv.Quote(dest))
+}
+
+func (s *FallbackService) genFallbacks(fallbacks []*model.InboundFallback) ([]*xray.Fallback, error) {
+	result := make([]*xray.Fallback, 0, len(fallbacks))
+	for _, fallback := range fallbacks {
+		f := &xray.Fallback{
+			Name: fallback.Name,
+			Alpn: fallback.Alpn,
+			Path: fallback.Path,
+			Xver: fallback.Xver,
+		}
+		if fallback.TargetId > 0 {
+			target, err := s.inboundService.GetInbound(fallback.TargetId)
+			if err != nil {
+				return nil, fmt.Errorf("回落目标入站 %d 不存在: %w", fallback.TargetId, err)
+			}
+			f.Dest = inboundFallbackDest(target)
+		} else {
+			f.Dest = fallbackDest(fallback.Dest)
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// resolveSettings 用结构化回落替换 settings 中的 fallbacks
+func (s *FallbackService) resolveSettings(inbound *model.Inbound, fallbacks []*model.InboundFallback) (string, error) {
+	settings, err := inbound.GetSettings()
+	if err != nil {
+		return "", err
+	}
+	fallbackSettings, ok := settings.(xray.FallbackSettings)
+	if !ok {
+		return "", fmt.Errorf("%v 不支持回落", inbound.Protocol)
+	}
+	generated, err := s.genFallbacks(fallbacks)
+	if err != nil {
+		return "", err
+	}
+	fallbackSettings.SetFallbacks(generated)
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ResolveSettings 入站配置了结构化回落时，按回落目标的当前监听地址重新生成 settings.fallbacks
+func (s *FallbackService) ResolveSettings(inbound *model.Inbound) (string, error) {
+	fallbacks, err := s.GetFallbacks(inbound.Id)
+	if err != nil {
+		return "", err
+	}
+	if len(fallbacks) == 0 {
+		return inbound.Settings, nil
+	}
+	return s.resolveSettings(inbound, fallbacks)
+}
+
+func (s *FallbackService) lintFallbacks(inbound *model.Inbound, fallbacks []*model.InboundFallback) error {
+	l := &inboundLinter{
+		inbound: inbound,
+		errors:  make([]*FieldError, 0),
+	}
+	if inbound.Protocol != model.VLESS && inbound.Protocol != model.Trojan {
+		l.addError("fallbacks", "只有 vless 和 trojan 支持回落")
+		return &InboundValidationError{Errors: l.errors}
+	}
+	stream, err := inbound.GetStreamSettings()
+	if err == nil && stream.GetNetwork() != "tcp" && stream.GetNetwork() != "raw" {
+		l.addError("fallbacks", "只有 tcp 传输支持回落: %v", stream.GetNetwork())
+	}
+	targets, err := s.fallbackTargets(inbound.Id)
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]int{}
+	for i, fallback := range fallbacks {
+		field := fmt.Sprintf("fallbacks[%d]", i)
+		if !contains(fallbackAlpns, fallback.Alpn) {
+			l.addError(field+".alpn", "必须为空、h2 或 http/1.1: %v", fallback.Alpn)
+		}
+		if fallback.Path != "" && !strings.HasPrefix(fallback.Path, "/") {
+			l.addError(field+".path", "必须以 / 开头")
+		}
+		if fallback.Xver < 0 || fallback.Xver > 2 {
+			l.addError(field+".xver", "必须为 0、1 或 2")
+		}
+		key := fallback.Name + "|" + fallback.Alpn + "|" + fallback.Path
+		if j, ok := seen[key]; ok {
+			l.addError(field, "与 fallbacks[%d] 的匹配条件重复", j)
+		} else {
+			seen[key] = i
+		}
+
+		if fallback.TargetId > 0 {
+			if fallback.TargetId == inbound.Id {
+				l.addError(field+".targetId", "不能回落到自身")
+				continue
+			}
+			if _, err := s.inboundService.GetInbound(fallback.TargetId); err != nil {
+				l.addError(field+".targetId", "入站不存在: %d", fallback.TargetId)
+				continue
+			}
+			if reaches(targets, fallback.TargetId, inbound.Id, map[int]bool{}) {
+				l.addError(field+".targetId", "入站 %d 会回落到当前入站，形成环", fallback.TargetId)
+			}
+			continue
+		}
+		dest := strings.TrimSpace(fallback.Dest)
+		if port, err := strconv.Atoi(dest); err == nil {
+			if port <= 0 || port > 65535 {
+				l.addError(field+".dest", "端口无效: %d", port)
+			}
+		} else if dest == "" {
+			l.addError(field+".dest", "未指定回落目标")
+		} else if !model.IsUnixListen(dest) {
+			if _, _, err := net.SplitHostPort(dest); err != nil {
+				l.addError(field+".dest", "必须是端口、地址:端口或 Unix domain socket 路径: %v", dest)
+			}
+		}
+	}
+	if len(l.errors) > 0 {
+		return &InboundValidationError{Errors: l.errors}
+	}
+	return nil
+}
+
+// SetFallbacks 校验并替换入站的全部回落，同时写入入站的 settings，fallbacks 为空时清空回落
+func (s *FallbackService) SetFallbacks(inboundId int, fallbacks []*model.InboundFallback) error {
+	inbound, err := s.inboundService.GetInbound(inboundId)
+	if err != nil {
+		return err
+	}
+	if err := s.lintFallbacks(inbound, fallbacks); err != nil {
+		return err
+	}
+	settings, err := s.resolveSettings(inbound, fallbacks)
+	if err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("inbound_id = ?", inboundId).Delete(model.InboundFallback{}).Error
+		if err != nil {
+			return err
+		}
+		for _, fallback := range fallbacks {
+			fallback.Id = 0
+			fallback.InboundId = inboundId
+			if err := tx.Create(fallback).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(inbound).Update("settings", settings).Error
+	})
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+func TestReaches(t *testing.T) {
+	cases := []struct {
+		name    string
+		targets map[int][]int
+		from    int
+		to      int
+		want    bool
+	}{
+		{"自身", map[int][]int{}, 1, 1, true},
+		{"没有回落", map[int][]int{}, 1, 2, false},
+		{"自环", map[int][]int{1: {1}}, 1, 2, false},
+		{"经过自环到达", map[int][]int{1: {1, 2}}, 1, 2, true},
+		{"A→B→A 环中到达", map[int][]int{1: {2}, 2: {1}}, 2, 1, true},
+		{"A→B→A 环外不可达", map[int][]int{1: {2}, 2: {1}}, 1, 3, false},
+		{"环后到达", map[int][]int{1: {2}, 2: {1, 3}}, 1, 3, true},
+		{"重复路径", map[int][]int{1: {2, 2, 3}, 2: {4}, 3: {4}}, 1, 4, true},
+		{"重复路径不可达", map[int][]int{1: {2, 2, 3}, 2: {4}, 3: {4}}, 1, 5, false},
+		{"反向不可达", map[int][]int{1: {2}, 2: {3}}, 3, 1, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := reaches(c.targets, c.from, c.to, map[int]bool{}); got != c.want {
+				t.Fatalf("reaches(%v, %d, %d) = %v，期望 %v", c.targets, c.from, c.to, got, c.want)
+			}
+		})
+	}
+}
+
+func initFallbackTest(t *testing.T, count int) (*FallbackService, []*model.Inbound) {
+	t.Helper()
+	initTestDB(t)
+	inbounds := make([]*model.Inbound, 0, count)
+	for i := 0; i < count; i++ {
+		inbound := &model.Inbound{
+			Port:     20000 + i,
+			Tag:      "fallback-" + strconv.Itoa(i),
+			Protocol: model.VLESS,
+			Settings: `{"decryption":"none","clients":[{"id":"` + testUUID + `"}]}`,
+		}
+		if err := database.GetDB().Create(inbound).Error; err != nil {
+			t.Fatal(err)
+		}
+		inbounds = append(inbounds, inbound)
+	}
+	return &FallbackService{}, inbounds
+}
+
+// checkFallbackErrors 校验失败时返回的字段错误
+func checkFallbackErrors(t *testing.T, err error, want ...string) {
+	t.Helper()
+	var validationErr *InboundValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("返回 %v，期望 *InboundValidationError", err)
+	}
+	got := make([]string, 0, len(validationErr.Errors))
+	for _, fe := range validationErr.Errors {
+		got = append(got, fe.Field+": "+fe.Message)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("错误为 %q，期望 %q", got, want)
+	}
+}
+
+func TestSetFallbacksRejectsSelfLoop(t *testing.T) {
+	s, inbounds := initFallbackTest(t, 1)
+	a := inbounds[0]
+
+	err := s.SetFallbacks(a.Id, []*model.InboundFallback{{TargetId: a.Id}})
+	checkFallbackErrors(t, err, "fallbacks[0].targetId: 不能回落到自身")
+	fallbacks, err := s.GetFallbacks(a.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fallbacks) != 0 {
+		t.Fatalf("校验失败后保存了 %d 个回落", len(fallbacks))
+	}
+}
+
+func TestSetFallbacksRejectsCycle(t *testing.T) {
+	s, inbounds := initFallbackTest(t, 3)
+	a, b, c := inbounds[0], inbounds[1], inbounds[2]
+
+	if err := s.SetFallbacks(a.Id, []*model.InboundFallback{{TargetId: b.Id}}); err != nil {
+		t.Fatal(err)
+	}
+	// A→B→A
+	err := s.SetFallbacks(b.Id, []*model.InboundFallback{{TargetId: a.Id}})
+	checkFallbackErrors(t, err, "fallbacks[0].targetId: 入站 "+strconv.Itoa(a.Id)+" 会回落到当前入站，形成环")
+
+	// A→B→C→A
+	if err := s.SetFallbacks(b.Id, []*model.InboundFallback{{TargetId: c.Id}}); err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetFallbacks(c.Id, []*model.InboundFallback{{Path: "/a", TargetId: a.Id}, {Dest: "80"}})
+	checkFallbackErrors(t, err, "fallbacks[0].targetId: 入站 "+strconv.Itoa(a.Id)+" 会回落到当前入站，形成环")
+
+	// 修改 A 自身的回落时忽略其已有的回落，A→C 不形成环
+	if err := s.SetFallbacks(a.Id, []*model.InboundFallback{{TargetId: c.Id}}); err != nil {
+		t.Fatal(err)
+	}
+	fallbacks, err := s.GetFallbacks(a.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fallbacks) != 1 || fallbacks[0].TargetId != c.Id {
+		t.Fatalf("A 的回落为 %v，期望只回落到 C", fallbacks)
+	}
+}
+
+func TestSetFallbacksDuplicatePaths(t *testing.T) {
+	s, inbounds := initFallbackTest(t, 3)
+	a, b, c := inbounds[0], inbounds[1], inbounds[2]
+
+	// A 经 B 和 C 两条路径都能到达 C，不是环
+	if err := s.SetFallbacks(b.Id, []*model.InboundFallback{{TargetId: c.Id}}); err != nil {
+		t.Fatal(err)
+	}
+	err := s.SetFallbacks(a.Id, []*model.InboundFallback{
+		{Path: "/b", TargetId: b.Id},
+		{Path: "/c", TargetId: c.Id},
+		{Path: "/c2", TargetId: c.Id},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 此时 C 回落到 A 会经多条路径形成环，只报告一次
+	err = s.SetFallbacks(c.Id, []*model.InboundFallback{{TargetId: a.Id}})
+	checkFallbackErrors(t, err, "fallbacks[0].targetId: 入站 "+strconv.Itoa(a.Id)+" 会回落到当前入站，形成环")
+
+	// 匹配条件相同的回落重复
+	err = s.SetFallbacks(a.Id, []*model.InboundFallback{
+		{Path: "/b", TargetId: b.Id},
+		{Path: "/b", TargetId: c.Id},
+	})
+	checkFallbackErrors(t, err, "fallbacks[1]: 与 fallbacks[0] 的匹配条件重复")
+
+	inbound, err := s.inboundService.GetInbound(a.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"fallbacks":[{"dest":` + strconv.Itoa(b.Port) + `,"path":"/b"},{"dest":` + strconv.Itoa(c.Port) + `,"path":"/c"},{"dest":` + strconv.Itoa(c.Port) + `,"path":"/c2"}]`
+	if !strings.Contains(inbound.Settings, want) {
+		t.Fatalf("settings 为 %v，期望包含 %v", inbound.Settings, want)
+	}
+}
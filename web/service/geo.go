@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+const (
+	geoDownloadTimeout = 10 * time.Minute
+	// geo 文件的大小上限，Loyalsoldier 的 geosite.dat 约 10MB
+	geoMaxFileSize = 64 << 20
+)
+
+// GeoFileInfo geo 文件的当前状态
+type GeoFileInfo struct {
+	Name    string `json:"name"`
+	Exists  bool   `json:"exists"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"` // 毫秒时间戳
+	Sha256  string `json:"sha256"`
+}
+
+// GeoService 独立于 xray 升级管理 geosite.dat、geoip.dat，并把自定义列表编译为 custom.dat
+type GeoService struct {
+	ctx            context.Context
+	settingService SettingService
+}
+
+func NewGeoService(ctx context.Context) *GeoService {
+	return &GeoService{
+		ctx: ctx,
+	}
+}
+
+func (s *GeoService) getContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func fileSha256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名，xray 不会读到写了一半的文件
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := file.Name()
+	defer os.Remove(tmpName)
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// GetGeoFiles 获取 geosite.dat、geoip.dat 和 custom.dat 的状态
+func (s *GeoService) GetGeoFiles() ([]*GeoFileInfo, error) {
+	infos := make([]*GeoFileInfo, 0, 3)
+	for _, path := range []string{xray.GetGeositePath(), xray.GetGeoipPath(), xray.GetCustomGeoPath()} {
+		info := &GeoFileInfo{Name: filepath.Base(path)}
+		stat, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			infos = append(infos, info)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info.Exists = true
+		info.Size = stat.Size()
+		info.ModTime = stat.ModTime().UnixMilli()
+		info.Sha256, err = fileSha256(path)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (s *GeoService) download(ctx context.Context, url string, maxSize int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载 %v 返回状态码: %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("文件超过 %d 字节: %v", maxSize, url)
+	}
+	return data, nil
+}
+
+// updateGeoFile 下载 geo 文件及同路径的 .sha256sum，校验通过且内容有变化时替换本地文件
+func (s *GeoService) updateGeoFile(url string, path string, isIP bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.getContext(), geoDownloadTimeout)
+	defer cancel()
+
+	sumData, err := s.download(ctx, url+".sha256sum", 4096)
+	if err != nil {
+		return false, fmt.Errorf("下载校验文件失败: %w", err)
+	}
+	fields := strings.Fields(string(sumData))
+	if len(fields) == 0 {
+		return false, common.NewError("校验文件为空:", url+".sha256sum")
+	}
+	expected := strings.ToLower(fields[0])
+	if current, err := fileSha256(path); err == nil && current == expected {
+		return false, nil
+	}
+
+	data, err := s.download(ctx, url, geoMaxFileSize)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return false, fmt.Errorf("%v 校验失败: 期望 %v，实际 %v", filepath.Base(path), expected, actual)
+	}
+	if err := xray.CheckGeoData(data, isIP); err != nil {
+		return false, err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return false, err
+	}
+	logger.Infof("已更新 %v，sha256: %v", filepath.Base(path), expected)
+	return true, nil
+}
+
+// UpdateGeoFiles 从设置的地址更新 geosite.dat 和 geoip.dat，返回是否有文件被替换
+//
+// 两个文件分别更新，一个失败不影响另一个，xray 需要重启才会加载新文件
+func (s *GeoService) UpdateGeoFiles() (bool, error) {
+	geositeUrl, err := s.settingService.GetGeositeUrl()
+	if err != nil {
+		return false, err
+	}
+	geoipUrl, err := s.settingService.GetGeoipUrl()
+	if err != nil {
+		return false, err
+	}
+	updated := false
+	errs := make([]error, 0)
+	for _, file := range []struct {
+		url  string
+		path string
+		isIP bool
+	}{
+		{geositeUrl, xray.GetGeositePath(), false},
+		{geoipUrl, xray.GetGeoipPath(), true},
+	} {
+		changed, err := s.updateGeoFile(file.url, file.path, file.isIP)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("更新 %v 失败: %w", filepath.Base(file.path), err))
+			continue
+		}
+		updated = updated || changed
+	}
+	return updated, common.Combine(errs...)
+}
+
+func (s *GeoService) GetCustomLists() ([]*model.GeoCustomList, error) {
+	db := database.GetDB()
+	lists := make([]*model.GeoCustomList, 0)
+	err := db.Model(model.GeoCustomList{}).Order("id").Find(&lists).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (s *GeoService) GetCustomList(id int) (*model.GeoCustomList, error) {
+	db := database.GetDB()
+	list := &model.GeoCustomList{}
+	err := db.Model(model.GeoCustomList{}).First(list, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func splitGeoEntries(entries string) []string {
+	items := make([]string, 0)
+	for _, line := range strings.Split(entries, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, line)
+	}
+	return items
+}
+
+func toGeoList(list *model.GeoCustomList) *xray.GeoList {
+	return &xray.GeoList{
+		Tag:     list.Tag,
+		Type:    list.Type,
+		Entries: splitGeoEntries(list.Entries),
+	}
+}
+
+func (s *GeoService) checkCustomList(list *model.GeoCustomList) error {
+	list.Tag = strings.TrimSpace(list.Tag)
+	if err := xray.CheckGeoList(toGeoList(list)); err != nil {
+		return err
+	}
+	// xray 查找列表时不区分大小写
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.GeoCustomList{}).Where("upper(tag) = ? and id <> ?", strings.ToUpper(list.Tag), list.Id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("列表 tag 已存在:", list.Tag)
+	}
+	return nil
+}
+
+func (s *GeoService) AddCustomList(list *model.GeoCustomList) error {
+	list.Id = 0
+	if err := s.checkCustomList(list); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	if err := db.Create(list).Error; err != nil {
+		return err
+	}
+	return s.CompileCustomLists()
+}
+
+func (s *GeoService) UpdateCustomList(list *model.GeoCustomList) error {
+	if _, err := s.GetCustomList(list.Id); err != nil {
+		return err
+	}
+	if err := s.checkCustomList(list); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	if err := db.Save(list).Error; err != nil {
+		return err
+	}
+	return s.CompileCustomLists()
+}
+
+func (s *GeoService) DelCustomList(id int) error {
+	db := database.GetDB()
+	if err := db.Delete(model.GeoCustomList{}, id).Error; err != nil {
+		return err
+	}
+	return s.CompileCustomLists()
+}
+
+// CompileCustomLists 把所有自定义列表编译到 custom.dat，没有列表时删除该文件
+func (s *GeoService) CompileCustomLists() error {
+	lists, err := s.GetCustomLists()
+	if err != nil {
+		return err
+	}
+	path := xray.GetCustomGeoPath()
+	if len(lists) == 0 {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	geoLists := make([]*xray.GeoList, 0, len(lists))
+	for _, list := range lists {
+		geoLists = append(geoLists, toGeoList(list))
+	}
+	data, err := xray.BuildGeoData(geoLists)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
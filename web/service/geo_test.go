@@ -0,0 +1,152 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"x-ui/xray"
+)
+
+// geoTestServer 提供 /geosite.dat 及其 .sha256sum，并记录 dat 文件的下载次数
+type geoTestServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	data      []byte
+	sum       string
+	downloads int
+}
+
+func newGeoTestServer(t *testing.T) *geoTestServer {
+	t.Helper()
+	s := &geoTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch r.URL.Path {
+		case "/geosite.dat.sha256sum":
+			w.Write([]byte(s.sum + "  geosite.dat\n"))
+		case "/geosite.dat":
+			s.downloads++
+			w.Write(s.data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// set 设置服务端的文件内容，sum 为空时使用内容的实际校验值
+func (s *geoTestServer) set(data []byte, sum string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sum == "" {
+		hash := sha256.Sum256(data)
+		sum = hex.EncodeToString(hash[:])
+	}
+	s.data = data
+	s.sum = sum
+}
+
+func (s *geoTestServer) getDownloads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.downloads
+}
+
+func buildTestGeosite(t *testing.T, domains ...string) []byte {
+	t.Helper()
+	data, err := xray.BuildGeoData([]*xray.GeoList{{Tag: "test", Type: xray.GeoListTypeDomain, Entries: domains}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestUpdateGeoFile(t *testing.T) {
+	server := newGeoTestServer(t)
+	s := &GeoService{}
+	path := filepath.Join(t.TempDir(), "geosite.dat")
+	oldData := buildTestGeosite(t, "old.example.com")
+	if err := os.WriteFile(path, oldData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkFile := func(want []byte) {
+		t.Helper()
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatal("本地文件内容不符合预期")
+		}
+	}
+	url := server.URL + "/geosite.dat"
+
+	// 校验值不匹配时不替换文件
+	newData := buildTestGeosite(t, "new.example.com")
+	server.set(newData, strings.Repeat("0", 64))
+	updated, err := s.updateGeoFile(url, path, false)
+	if err == nil || updated {
+		t.Fatalf("校验值不匹配时返回 %v, %v", updated, err)
+	}
+	checkFile(oldData)
+
+	// 无法解析的文件不替换
+	server.set([]byte("<html>not found</html>"), "")
+	updated, err = s.updateGeoFile(url, path, false)
+	if err == nil || updated {
+		t.Fatalf("文件无法解析时返回 %v, %v", updated, err)
+	}
+	checkFile(oldData)
+
+	// 校验通过时替换
+	server.set(newData, "")
+	updated, err = s.updateGeoFile(url, path, false)
+	if err != nil || !updated {
+		t.Fatalf("更新文件返回 %v, %v", updated, err)
+	}
+	checkFile(newData)
+
+	// 本地文件与远程一致时只下载校验文件
+	downloads := server.getDownloads()
+	updated, err = s.updateGeoFile(url, path, false)
+	if err != nil || updated {
+		t.Fatalf("文件没有变化时返回 %v, %v", updated, err)
+	}
+	if server.getDownloads() != downloads {
+		t.Fatal("文件没有变化时仍然下载了 dat 文件")
+	}
+	checkFile(newData)
+
+	// 临时文件不能残留在目录中
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("目录中有 %d 个文件，期望只有 geosite.dat", len(entries))
+	}
+}
+
+func TestUpdateGeoFileMissingChecksum(t *testing.T) {
+	server := newGeoTestServer(t)
+	s := &GeoService{}
+	path := filepath.Join(t.TempDir(), "geoip.dat")
+
+	// 没有对应的校验文件时不下载也不创建本地文件
+	updated, err := s.updateGeoFile(server.URL+"/geoip.dat", path, true)
+	if err == nil || updated {
+		t.Fatalf("缺少校验文件时返回 %v, %v", updated, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("缺少校验文件时创建了本地文件: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+	"x-ui/database"
+)
+
+// HealthCheck 单项检查结果
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type HealthService struct {
+	ctx         context.Context
+	xrayService XrayService
+}
+
+func NewHealthService(ctx context.Context) *HealthService {
+	return &HealthService{
+		ctx: ctx,
+	}
+}
+
+// SetXrayService 设置XrayService依赖
+func (s *HealthService) SetXrayService(xrayService XrayService) {
+	s.xrayService = xrayService
+}
+
+func newHealthCheck(name string, err error) *HealthCheck {
+	check := &HealthCheck{
+		Name: name,
+		OK:   err == nil,
+	}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// CheckDB 检查数据库连接
+func (s *HealthService) CheckDB() error {
+	db := database.GetDB()
+	if db == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, 3*time.Second)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
+
+// CheckXray 检查xray进程状态
+func (s *HealthService) CheckXray() error {
+	if s.xrayService == nil || !s.xrayService.IsXrayRunning() {
+		return ErrXrayNotRunning
+	}
+	return nil
+}
+
+// CheckXrayAPI 检查xray API端口是否可连接
+func (s *HealthService) CheckXrayAPI() error {
+	if s.xrayService == nil {
+		return ErrXrayNotRunning
+	}
+	port := s.xrayService.GetXrayAPIPort()
+	if port <= 0 {
+		return fmt.Errorf("xray api端口无效: %d", port)
+	}
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 2*time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Liveness 面板进程存活且数据库可用
+func (s *HealthService) Liveness() ([]*HealthCheck, bool) {
+	check := newHealthCheck("db", s.CheckDB())
+	return []*HealthCheck{check}, check.OK
+}
+
+// Readiness 面板可以对外提供服务: 数据库可用、xray运行中且API可连接
+func (s *HealthService) Readiness() ([]*HealthCheck, bool) {
+	checks := []*HealthCheck{
+		newHealthCheck("db", s.CheckDB()),
+		newHealthCheck("xray", s.CheckXray()),
+		newHealthCheck("xrayApi", s.CheckXrayAPI()),
+	}
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+	return checks, ready
+}
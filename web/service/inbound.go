@@ -1,17 +1,25 @@
 package service
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"time"
 	"x-ui/database"
 	"x-ui/database/model"
+	"x-ui/logger"
 	"x-ui/util/common"
+	"x-ui/util/metrics"
 	"x-ui/xray"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type InboundService struct {
+	settingService SettingService
 }
 
 func (s *InboundService) GetInbounds(userId int) ([]*model.Inbound, error) {
@@ -34,40 +42,124 @@ func (s *InboundService) GetAllInbounds() ([]*model.Inbound, error) {
 	return inbounds, nil
 }
 
-func (s *InboundService) checkPortExist(port int, ignoreId int) (bool, error) {
-	db := database.GetDB()
-	db = db.Model(model.Inbound{}).Where("port = ?", port)
-	if ignoreId > 0 {
-		db = db.Where("id != ?", ignoreId)
+func isWildcardListen(listen string) bool {
+	return listen == "" || listen == "0.0.0.0" || listen == "::"
+}
+
+// listensOverlap 判断两个监听地址是否会争用同一端口，通配地址与所有IP地址冲突
+func listensOverlap(a string, b string) bool {
+	if model.IsUnixListen(a) || model.IsUnixListen(b) {
+		return a == b
 	}
-	var count int64
-	err := db.Count(&count).Error
+	if isWildcardListen(a) || isWildcardListen(b) {
+		return true
+	}
+	return net.ParseIP(a).Equal(net.ParseIP(b))
+}
+
+// inboundsConflict 两个入站有重叠的监听地址，且在 IP 地址上有重叠的端口
+func inboundsConflict(a *model.Inbound, b *model.Inbound) (bool, error) {
+	aPorts, err := a.GetPorts()
 	if err != nil {
 		return false, err
 	}
-	return count > 0, nil
+	bPorts, err := b.GetPorts()
+	if err != nil {
+		return false, err
+	}
+	for _, aListen := range a.GetListens() {
+		for _, bListen := range b.GetListens() {
+			if !listensOverlap(aListen, bListen) {
+				continue
+			}
+			if model.IsUnixListen(aListen) || xray.PortListsOverlap(aPorts, bPorts) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
 }
 
-func (s *InboundService) AddInbound(inbound *model.Inbound) error {
-	exist, err := s.checkPortExist(inbound.Port, 0)
+// checkConflict 检查入站与已有入站的监听地址、端口范围和 tag 是否冲突，以及与主机上的端口是否冲突，others 为本次一并添加的入站
+func (s *InboundService) checkConflict(inbound *model.Inbound, others []*model.Inbound) error {
+	inbounds, err := s.GetAllInbounds()
 	if err != nil {
 		return err
 	}
-	if exist {
-		return common.NewError("端口已存在:", inbound.Port)
+	inbounds = append(inbounds, others...)
+	for _, other := range inbounds {
+		if other == inbound || (inbound.Id > 0 && other.Id == inbound.Id) {
+			continue
+		}
+		if inbound.Tag != "" && other.Tag == inbound.Tag {
+			return common.NewError("tag 已存在:", inbound.Tag)
+		}
+		conflict, err := inboundsConflict(inbound, other)
+		if err != nil {
+			// 已有入站的端口格式错误时不影响新入站
+			continue
+		}
+		if conflict {
+			return common.NewError("监听地址和端口与入站冲突:", other.Remark, other.Listen, other.GetPortString())
+		}
 	}
-	db := database.GetDB()
-	return db.Save(inbound).Error
+	return s.checkHostPorts(inbound)
 }
 
-func (s *InboundService) AddInbounds(inbounds []*model.Inbound) error {
-	for _, inbound := range inbounds {
-		exist, err := s.checkPortExist(inbound.Port, 0)
+// normalizePort 设置端口范围时 Port 保存第一个端口，用于分享链接等只需要单个端口的场景
+func normalizePort(inbound *model.Inbound) {
+	if ports, err := inbound.GetPorts(); err == nil && inbound.PortRange != "" {
+		inbound.Port = ports[0].From
+	}
+}
+
+// assignTag 未指定 tag 时按入站ID生成，保存后不再随端口变化。
+// 旧版本按端口生成的 "inbound-<端口>" 可能与之重名，此时追加序号
+func assignTag(tx *gorm.DB, inbound *model.Inbound) error {
+	if inbound.Tag != "" {
+		return nil
+	}
+	tag := fmt.Sprintf("inbound-%d", inbound.Id)
+	for i := 1; ; i++ {
+		var count int64
+		err := tx.Model(model.Inbound{}).Where("tag = ? and id != ?", tag, inbound.Id).Count(&count).Error
 		if err != nil {
 			return err
 		}
-		if exist {
-			return common.NewError("端口已存在:", inbound.Port)
+		if count == 0 {
+			break
+		}
+		tag = fmt.Sprintf("inbound-%d-%d", inbound.Id, i)
+	}
+	inbound.Tag = tag
+	return tx.Model(inbound).Update("tag", inbound.Tag).Error
+}
+
+func (s *InboundService) AddInbound(inbound *model.Inbound) error {
+	if err := ValidateInbound(inbound); err != nil {
+		return err
+	}
+	normalizePort(inbound)
+	if err := s.checkConflict(inbound, nil); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(inbound).Error; err != nil {
+			return err
+		}
+		return assignTag(tx, inbound)
+	})
+}
+
+func (s *InboundService) AddInbounds(inbounds []*model.Inbound) error {
+	for i, inbound := range inbounds {
+		if err := ValidateInbound(inbound); err != nil {
+			return fmt.Errorf("入站 %v 配置无效: %w", inbound.Remark, err)
+		}
+		normalizePort(inbound)
+		if err := s.checkConflict(inbound, inbounds[:i]); err != nil {
+			return err
 		}
 	}
 
@@ -87,14 +179,95 @@ func (s *InboundService) AddInbounds(inbounds []*model.Inbound) error {
 		if err != nil {
 			return err
 		}
+		err = assignTag(tx, inbound)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// ReplaceInbounds 用控制端下发的入站集合替换本机全部入站，按 tag 匹配已有入站并保留其流量
+func (s *InboundService) ReplaceInbounds(inbounds []*model.Inbound) error {
+	oldInbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	oldByTag := map[string]*model.Inbound{}
+	for _, old := range oldInbounds {
+		oldByTag[old.Tag] = old
+	}
+	for i, inbound := range inbounds {
+		if inbound.Tag == "" {
+			return common.NewError("下发的入站必须指定 tag:", inbound.Remark)
+		}
+		if err := ValidateInbound(inbound); err != nil {
+			return fmt.Errorf("入站 %v 配置无效: %w", inbound.Tag, err)
+		}
+		normalizePort(inbound)
+		for _, other := range inbounds[:i] {
+			if other.Tag == inbound.Tag {
+				return common.NewError("tag 重复:", inbound.Tag)
+			}
+			if conflict, err := inboundsConflict(inbound, other); err != nil {
+				return err
+			} else if conflict {
+				return common.NewError("监听地址和端口冲突:", other.Tag, inbound.Tag)
+			}
+		}
+		inbound.Id = 0
+		if old, ok := oldByTag[inbound.Tag]; ok {
+			inbound.Id = old.Id
+			inbound.UserId = old.UserId
+			inbound.Up = old.Up
+			inbound.Down = old.Down
+			delete(oldByTag, inbound.Tag)
+		}
+		if err := s.checkHostPorts(inbound); err != nil {
+			return err
+		}
+	}
+
+	removed := make([]int, 0, len(oldByTag))
+	for _, old := range oldByTag {
+		removed = append(removed, old.Id)
+	}
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(removed) > 0 {
+			err := tx.Where("inbound_id in ? or target_id in ?", removed, removed).Delete(model.InboundFallback{}).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Delete(model.Inbound{}, removed).Error; err != nil {
+				return err
+			}
+		}
+		for _, inbound := range inbounds {
+			if err := tx.Save(inbound).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (s *InboundService) DelInbound(id int) error {
 	db := database.GetDB()
-	return db.Delete(model.Inbound{}, id).Error
+	var referrer model.InboundFallback
+	err := db.Model(model.InboundFallback{}).Where("target_id = ?", id).First(&referrer).Error
+	if err == nil {
+		return common.NewError("入站被其他入站的回落引用:", referrer.InboundId)
+	} else if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("inbound_id = ?", id).Delete(model.InboundFallback{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(model.Inbound{}, id).Error
+	})
 }
 
 func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
@@ -107,63 +280,218 @@ func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
 	return inbound, nil
 }
 
+// UpdateInbound 修改入站，旧入站中原本就存在的配置错误只记录警告
 func (s *InboundService) UpdateInbound(inbound *model.Inbound) error {
-	exist, err := s.checkPortExist(inbound.Port, inbound.Id)
-	if err != nil {
-		return err
-	}
-	if exist {
-		return common.NewError("端口已存在:", inbound.Port)
+	warnings, err := s.UpdateInboundWithWarnings(inbound)
+	for _, warning := range warnings {
+		logger.Warningf("入站 %v 配置不符合校验规则: %v: %v", inbound.Id, warning.Field, warning.Message)
 	}
+	return err
+}
 
+// UpdateInboundWithWarnings 修改入站，返回修改前就已存在、本次允许保存的配置错误
+func (s *InboundService) UpdateInboundWithWarnings(inbound *model.Inbound) ([]*FieldError, error) {
 	oldInbound, err := s.GetInbound(inbound.Id)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	warnings, err := ValidateInboundUpdate(oldInbound, inbound)
+	if err != nil {
+		return nil, err
 	}
+	normalizePort(inbound)
 	oldInbound.Up = inbound.Up
 	oldInbound.Down = inbound.Down
 	oldInbound.Total = inbound.Total
 	oldInbound.Remark = inbound.Remark
 	oldInbound.Enable = inbound.Enable
 	oldInbound.ExpiryTime = inbound.ExpiryTime
+	oldInbound.Email = inbound.Email
 	oldInbound.Listen = inbound.Listen
 	oldInbound.Port = inbound.Port
+	oldInbound.PortRange = inbound.PortRange
 	oldInbound.Protocol = inbound.Protocol
 	oldInbound.Settings = inbound.Settings
 	oldInbound.StreamSettings = inbound.StreamSettings
 	oldInbound.Sniffing = inbound.Sniffing
-	oldInbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+	if err := s.checkConflict(oldInbound, nil); err != nil {
+		return nil, err
+	}
 
 	db := database.GetDB()
-	return db.Save(oldInbound).Error
+	if err := db.Save(oldInbound).Error; err != nil {
+		return nil, err
+	}
+	return warnings, nil
 }
 
-func (s *InboundService) AddTraffic(traffics []*xray.Traffic) (err error) {
-	if len(traffics) == 0 {
+// JournalTraffic 把从 xray 读出的流量写入流量日志，写入成功后即使进程退出也不会丢失
+func (s *InboundService) JournalTraffic(traffics []*xray.Traffic) error {
+	journals := make([]*model.TrafficJournal, 0, len(traffics))
+	now := time.Now().UnixMilli()
+	for _, traffic := range traffics {
+		if traffic.Up == 0 && traffic.Down == 0 {
+			continue
+		}
+		journals = append(journals, &model.TrafficJournal{
+			IsInbound: traffic.IsInbound,
+			IsUser:    traffic.IsUser,
+			Tag:       traffic.Tag,
+			Up:        traffic.Up,
+			Down:      traffic.Down,
+			CreatedAt: now,
+		})
+	}
+	if len(journals) == 0 {
 		return nil
 	}
 	db := database.GetDB()
-	db = db.Model(model.Inbound{})
-	tx := db.Begin()
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
+	return db.Create(&journals).Error
+}
+
+// ApplyTrafficJournal 把流量日志累加到入站并删除已累加的日志，两者在同一事务中完成，重复执行不会重复计数
+func (s *InboundService) ApplyTrafficJournal() ([]*xray.Traffic, error) {
+	db := database.GetDB()
+	var journals []*model.TrafficJournal
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(model.TrafficJournal{}).Order("id").Find(&journals).Error
+		if err != nil || len(journals) == 0 {
+			return err
 		}
-	}()
-	for _, traffic := range traffics {
-		if traffic.IsInbound {
-			err = tx.Where("tag = ?", traffic.Tag).
-				UpdateColumn("up", gorm.Expr("up + ?", traffic.Up)).
-				UpdateColumn("down", gorm.Expr("down + ?", traffic.Down)).
-				Error
+		ids := make([]int, 0, len(journals))
+		for _, journal := range journals {
+			ids = append(ids, journal.Id)
+			if journal.IsUser {
+				if err := addClientTraffic(tx, journal); err != nil {
+					return err
+				}
+				continue
+			}
+			if !journal.IsInbound {
+				if err := addOutboundTraffic(tx, journal); err != nil {
+					return err
+				}
+				continue
+			}
+			err := tx.Model(model.Inbound{}).
+				Where("tag = ?", model.BaseInboundTag(journal.Tag)).
+				Updates(map[string]interface{}{
+					"up":   gorm.Expr("up + ?", journal.Up),
+					"down": gorm.Expr("down + ?", journal.Down),
+				}).Error
 			if err != nil {
-				return
+				return err
 			}
 		}
+		return tx.Delete(model.TrafficJournal{}, ids).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	traffics := make([]*xray.Traffic, 0, len(journals))
+	for _, journal := range journals {
+		if journal.IsUser {
+			inboundTag, email := SplitClientIpKey(journal.Tag)
+			labels := metrics.Labels{"inbound": inboundTag, "email": email}
+			ClientUpCounter.Add(float64(journal.Up), labels)
+			ClientDownCounter.Add(float64(journal.Down), labels)
+		}
+		traffics = append(traffics, &xray.Traffic{
+			IsInbound: journal.IsInbound,
+			IsUser:    journal.IsUser,
+			Tag:       journal.Tag,
+			Up:        journal.Up,
+			Down:      journal.Down,
+		})
 	}
-	return
+	return traffics, nil
+}
+
+func addClientTraffic(tx *gorm.DB, journal *model.TrafficJournal) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "email"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"up":   gorm.Expr("up + ?", journal.Up),
+			"down": gorm.Expr("down + ?", journal.Down),
+		}),
+	}).Create(&model.ClientTraffic{
+		Email: journal.Tag,
+		Up:    journal.Up,
+		Down:  journal.Down,
+	}).Error
+}
+
+// ClientStat 客户端的限额和累计流量
+type ClientStat struct {
+	Inbound *model.Inbound
+	Client  *xray.Client
+	Up      int64
+	Down    int64
+}
+
+// IsExhausted 客户端设置了流量上限且已用完
+func (c *ClientStat) IsExhausted() bool {
+	return c.Client.Total > 0 && c.Up+c.Down >= c.Client.Total
+}
+
+// IsExpired 客户端设置了到期时间且已到期
+func (c *ClientStat) IsExpired(now time.Time) bool {
+	return c.Client.ExpiryTime > 0 && c.Client.ExpiryTime <= now.UnixMilli()
+}
+
+// GetClientStats 获取所有入站中带 email 的客户端及其累计流量
+func (s *InboundService) GetClientStats() ([]*ClientStat, error) {
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	traffics := make([]*model.ClientTraffic, 0)
+	err = db.Model(model.ClientTraffic{}).Find(&traffics).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	trafficMap := make(map[string]*model.ClientTraffic, len(traffics))
+	for _, traffic := range traffics {
+		trafficMap[traffic.Email] = traffic
+	}
+	addTraffic := func(stat *ClientStat, key string) {
+		if traffic, ok := trafficMap[key]; ok {
+			stat.Up += traffic.Up
+			stat.Down += traffic.Down
+		}
+	}
+	stats := make([]*ClientStat, 0)
+	for _, inbound := range inbounds {
+		clients, err := inbound.GetClients()
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if client.Email == "" {
+				continue
+			}
+			stat := &ClientStat{
+				Inbound: inbound,
+				Client:  client,
+			}
+			addTraffic(stat, ClientIpKey(inbound.Tag, client.Email))
+			// 旧版本只按 email 累计的流量
+			addTraffic(stat, client.Email)
+			stats = append(stats, stat)
+		}
+	}
+	return stats, nil
+}
+
+// AddTraffic 写入流量日志后立即累加到入站，累加失败的日志在下次累加或启动时补上
+func (s *InboundService) AddTraffic(traffics []*xray.Traffic) error {
+	if err := s.JournalTraffic(traffics); err != nil {
+		return err
+	}
+	_, err := s.ApplyTrafficJournal()
+	return err
 }
 
 func (s *InboundService) DisableInvalidInbounds() (int64, error) {
@@ -176,3 +504,56 @@ func (s *InboundService) DisableInvalidInbounds() (int64, error) {
 	count := result.RowsAffected
 	return count, err
 }
+
+// GetInvalidInbounds 获取已到期或流量耗尽但仍启用的入站
+func (s *InboundService) GetInvalidInbounds() ([]*model.Inbound, error) {
+	db := database.GetDB()
+	now := time.Now().Unix() * 1000
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).
+		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
+		Find(&inbounds).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return inbounds, nil
+}
+
+func (s *InboundService) SetInboundEnable(id int, enable bool) error {
+	db := database.GetDB()
+	result := db.Model(model.Inbound{}).Where("id = ?", id).Update("enable", enable)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetSocksLinks 生成 SOCKS 入站的分享链接，每个账号一条，无认证时只有一条
+func (s *InboundService) GetSocksLinks(inboundId int, host string) ([]string, error) {
+	inbound, err := s.GetInbound(inboundId)
+	if err != nil {
+		return nil, err
+	}
+	if inbound.Protocol != model.Socks {
+		return nil, common.NewError("入站不是 SOCKS 协议:", inboundId)
+	}
+	settings, err := inbound.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	socksSettings := settings.(*xray.SocksSettings)
+	address := net.JoinHostPort(host, strconv.Itoa(inbound.Port))
+	remark := url.PathEscape(inbound.Remark)
+	if socksSettings.Auth != "password" {
+		return []string{fmt.Sprintf("socks://%v#%v", address, remark)}, nil
+	}
+	links := make([]string, 0, len(socksSettings.Accounts))
+	for _, account := range socksSettings.Accounts {
+		userInfo := base64.StdEncoding.EncodeToString([]byte(account.User + ":" + account.Pass))
+		links = append(links, fmt.Sprintf("socks://%v@%v#%v", userInfo, address, remark))
+	}
+	return links, nil
+}
@@ -0,0 +1,519 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/util/keygen"
+	"x-ui/xray"
+)
+
+var (
+	uuidRegex    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	shortIdRegex = regexp.MustCompile(`^([0-9a-fA-F]{2}){0,8}$`)
+
+	vlessFlows = []string{"", "xtls-rprx-vision", "xtls-rprx-vision-udp443"}
+	networks   = []string{"tcp", "raw", "kcp", "ws", "http", "h2", "quic", "grpc", "httpupgrade", "splithttp", "xhttp"}
+	securities = []string{"", "none", "tls", "xtls", "reality"}
+	ssMethods  = []string{
+		"aes-128-gcm", "aes-256-gcm", "chacha20-poly1305", "chacha20-ietf-poly1305",
+		"xchacha20-poly1305", "xchacha20-ietf-poly1305", "none", "plain",
+		"2022-blake3-aes-128-gcm", "2022-blake3-aes-256-gcm", "2022-blake3-chacha20-poly1305",
+	}
+)
+
+// FieldError 入站配置中某个字段的错误，Field 为 JSON 路径，如 settings.clients[0].id
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// InboundValidationError 入站配置校验失败时返回的所有字段错误
+type InboundValidationError struct {
+	Errors []*FieldError `json:"errors"`
+}
+
+func (e *InboundValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type inboundLinter struct {
+	inbound *model.Inbound
+	errors  []*FieldError
+}
+
+func (l *inboundLinter) addError(field string, format string, a ...interface{}) {
+	l.errors = append(l.errors, &FieldError{
+		Field:   field,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// unmarshal 解析 JSON 字段，为空时返回 false 但不报错
+func (l *inboundLinter) unmarshal(field string, data string, v interface{}) bool {
+	if strings.TrimSpace(data) == "" {
+		return false
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		l.addError(field, "JSON格式错误: %v", err)
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type protocolLinter func(l *inboundLinter, stream *xray.StreamSettings)
+
+var protocolLinters = map[model.Protocol]protocolLinter{
+	model.VMess:       lintVMess,
+	model.VLESS:       lintVLESS,
+	model.Trojan:      lintTrojan,
+	model.Shadowsocks: lintShadowsocks,
+	model.Dokodemo:    lintDokodemo,
+	model.Http:        lintHttp,
+	model.Socks:       lintSocks,
+	model.WireGuard:   lintWireGuard,
+	model.Tunnel:      lintDokodemo,
+}
+
+// lintClients 检查客户端列表，key 返回用于判重的字段名和值
+func (l *inboundLinter) lintClients(clients []*xray.Client, key func(c *xray.Client) (string, string)) {
+	if len(clients) == 0 {
+		l.addError("settings.clients", "至少需要一个客户端")
+		return
+	}
+	seen := map[string]int{}
+	emails := map[string]int{}
+	for i, client := range clients {
+		field, value := key(client)
+		path := fmt.Sprintf("settings.clients[%d].%v", i, field)
+		if value == "" {
+			l.addError(path, "不能为空")
+		} else if j, ok := seen[value]; ok {
+			l.addError(path, "与 clients[%d] 重复", j)
+		} else {
+			seen[value] = i
+		}
+		if client.Email != "" {
+			if j, ok := emails[client.Email]; ok {
+				l.addError(fmt.Sprintf("settings.clients[%d].email", i), "与 clients[%d] 重复", j)
+			} else {
+				emails[client.Email] = i
+			}
+		}
+	}
+}
+
+func lintVMess(l *inboundLinter, stream *xray.StreamSettings) {
+	settings := &xray.VMessSettings{}
+	if !l.unmarshal("settings", l.inbound.Settings, settings) {
+		return
+	}
+	l.lintClients(settings.Clients, func(c *xray.Client) (string, string) {
+		return "id", c.Id
+	})
+	for i, client := range settings.Clients {
+		if client.Id != "" && !uuidRegex.MatchString(client.Id) {
+			l.addError(fmt.Sprintf("settings.clients[%d].id", i), "不是有效的UUID")
+		}
+		if client.AlterId < 0 {
+			l.addError(fmt.Sprintf("settings.clients[%d].alterId", i), "不能为负数")
+		}
+	}
+}
+
+func lintVLESS(l *inboundLinter, stream *xray.StreamSettings) {
+	settings := &xray.VLESSSettings{}
+	if !l.unmarshal("settings", l.inbound.Settings, settings) {
+		return
+	}
+	if settings.Decryption != "none" {
+		l.addError("settings.decryption", "必须为 none")
+	}
+	l.lintClients(settings.Clients, func(c *xray.Client) (string, string) {
+		return "id", c.Id
+	})
+	for i, client := range settings.Clients {
+		if client.Id != "" && !uuidRegex.MatchString(client.Id) {
+			l.addError(fmt.Sprintf("settings.clients[%d].id", i), "不是有效的UUID")
+		}
+		if !contains(vlessFlows, client.Flow) {
+			l.addError(fmt.Sprintf("settings.clients[%d].flow", i), "不支持的flow: %v", client.Flow)
+		} else if client.Flow != "" {
+			network := stream.GetNetwork()
+			security := stream.GetSecurity()
+			if (network != "tcp" && network != "raw") || (security != "tls" && security != "reality") {
+				l.addError(fmt.Sprintf("settings.clients[%d].flow", i), "%v 只能用于 tcp + tls/reality", client.Flow)
+			}
+		}
+	}
+}
+
+func lintTrojan(l *inboundLinter, stream *xray.StreamSettings) {
+	settings := &xray.TrojanSettings{}
+	if !l.unmarshal("settings", l.inbound.Settings, settings) {
+		return
+	}
+	l.lintClients(settings.Clients, func(c *xray.Client) (string, string) {
+		return "password", c.Password
+	})
+}
+
+// lintSS2022Key 2022 加密方式的密码必须是对应长度密钥的 base64
+func (l *inboundLinter) lintSS2022Key(field string, method string, password string) {
+	length := keygen.SS2022KeyLength(method)
+	if length == 0 || password == "" {
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(password)
+	if err != nil || len(key) != length {
+		l.addError(field, "%v 的密钥必须是 %d 字节的 base64", method, length)
+	}
+}
+
+func lintShadowsocks(l *inboundLinter, stream *xray.StreamSettings) {
+	settings := &xray.ShadowsocksSettings{}
+	if !l.unmarshal("settings", l.inbound.Settings, settings) {
+		return
+	}
+	if len(settings.Clients) == 0 {
+		if !contains(ssMethods, settings.Method) {
+			l.addError("settings.method", "不支持的加密方式: %v", settings.Method)
+		}
+		if settings.Password == "" {
+			l.addError("settings.password", "不能为空")
+		}
+		l.lintSS2022Key("settings.password", settings.Method, settings.Password)
+		return
+	}
+
+	// 多用户模式，2022 加密方式由服务端统一指定
+	if settings.Method != "" && !contains(ssMethods, settings.Method) {
+		l.addError("settings.method", "不支持的加密方式: %v", settings.Method)
+	}
+	if keygen.SS2022KeyLength(settings.Method) > 0 {
+		l.lintSS2022Key("settings.password", settings.Method, settings.Password)
+	}
+	l.lintClients(settings.Clients, func(c *xray.Client) (string, string) {
+		return "password", c.Password
+	})
+	for i, client := range settings.Clients {
+		method := client.Method
+		if method == "" {
+			method = settings.Method
+		} else if !contains(ssMethods, method) {
+			l.addError(fmt.Sprintf("settings.clients[%d].method", i), "不支持的加密方式: %v", method)
+		}
+		l.lintSS2022Key(fmt.Sprintf("settings.clients[%d].password", i), method, client.Password)
+	}
+}
+
+func lintDokodemo(l *inboundLinter, stream *xray.StreamSettings) {
+	settings := &xray.DokodemoSettings{}
+	if !l.unmarshal("settings", l.inbound.Settings, settings) {
+		return
+	}
+	if settings.FollowRedirect {
+		return
+	}
+	if settings.Address == "" {
+		l.addError("settings.address", "未开启 followRedirect 时不能为空")
+	}
+	if settings.Port <= 0 || settings.Port > 65535 {
+		l.addError("settings.port", "端口无效: %d", settings.Port)
+	}
+}
+
+func lintHttp(l *inboundLinter, stream *xray.StreamSettings) {
+	settings := &xray.HTTPSettings{}
+	if !l.unmarshal("settings", l.inbound.Settings, settings) {
+		return
+	}
+	l.lintAccounts(settings.Accounts)
+}
+
+func lintSocks(l *inboundLinter, stream *xray.StreamSettings) {
+	settings := &xray.SocksSettings{}
+	if !l.unmarshal("settings", l.inbound.Settings, settings) {
+		return
+	}
+	switch settings.Auth {
+	case "", "noauth":
+	case "password":
+		if len(settings.Accounts) == 0 {
+			l.addError("settings.accounts", "password 认证至少需要一个账号")
+		}
+		l.lintAccounts(settings.Accounts)
+	default:
+		l.addError("settings.auth", "必须是 noauth 或 password: %v", settings.Auth)
+	}
+	if settings.IP != "" && net.ParseIP(settings.IP) == nil {
+		l.addError("settings.ip", "不是有效的IP地址: %v", settings.IP)
+	}
+}
+
+func lintWireGuard(l *inboundLinter, stream *xray.StreamSettings) {
+	settings := &xray.WireGuardSettings{}
+	if !l.unmarshal("settings", l.inbound.Settings, settings) {
+		return
+	}
+	if _, err := keygen.ParseWireGuardKey(settings.SecretKey); err != nil {
+		l.addError("settings.secretKey", "%v", err)
+	}
+	if settings.MTU < 0 || settings.MTU > 65535 {
+		l.addError("settings.mtu", "无效: %d", settings.MTU)
+	}
+	if len(settings.Peers) == 0 {
+		l.addError("settings.peers", "至少需要一个 peer")
+		return
+	}
+	keys := map[string]int{}
+	emails := map[string]int{}
+	for i, peer := range settings.Peers {
+		field := fmt.Sprintf("settings.peers[%d]", i)
+		if _, err := keygen.ParseWireGuardKey(peer.PublicKey); err != nil {
+			l.addError(field+".publicKey", "%v", err)
+		} else if j, ok := keys[peer.PublicKey]; ok {
+			l.addError(field+".publicKey", "与 peers[%d] 重复", j)
+		} else {
+			keys[peer.PublicKey] = i
+		}
+		if peer.PreSharedKey != "" {
+			if _, err := keygen.ParseWireGuardKey(peer.PreSharedKey); err != nil {
+				l.addError(field+".preSharedKey", "%v", err)
+			}
+		}
+		if peer.Email != "" {
+			if j, ok := emails[peer.Email]; ok {
+				l.addError(field+".email", "与 peers[%d] 重复", j)
+			} else {
+				emails[peer.Email] = i
+			}
+		}
+		if len(peer.AllowedIPs) == 0 {
+			l.addError(field+".allowedIPs", "不能为空")
+		}
+		for k, cidr := range peer.AllowedIPs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				l.addError(fmt.Sprintf("%v.allowedIPs[%d]", field, k), "不是有效的CIDR: %v", cidr)
+			}
+		}
+	}
+}
+
+// lintAccounts 检查 http/socks 的用户名密码账号
+func (l *inboundLinter) lintAccounts(accounts []*xray.Account) {
+	users := map[string]int{}
+	for i, account := range accounts {
+		if account.User == "" {
+			l.addError(fmt.Sprintf("settings.accounts[%d].user", i), "不能为空")
+		} else if j, ok := users[account.User]; ok {
+			l.addError(fmt.Sprintf("settings.accounts[%d].user", i), "与 accounts[%d] 重复", j)
+		} else {
+			users[account.User] = i
+		}
+		if account.Pass == "" {
+			l.addError(fmt.Sprintf("settings.accounts[%d].pass", i), "不能为空")
+		}
+	}
+}
+
+func (l *inboundLinter) lintCertificates(field string, settings *xray.TLSSettings) {
+	if settings == nil || len(settings.Certificates) == 0 {
+		l.addError(field+".certificates", "未配置证书")
+		return
+	}
+	certService := CertService{}
+	for i, cert := range settings.Certificates {
+		path := fmt.Sprintf("%v.certificates[%d]", field, i)
+		switch {
+		case cert.CertificateName != "":
+			if _, err := certService.GetCertificateByName(cert.CertificateName); err != nil {
+				l.addError(path+".certificateName", "%v", strings.TrimSpace(err.Error()))
+			}
+		case cert.CertificateFile != "" || cert.KeyFile != "":
+			if _, err := os.Stat(cert.CertificateFile); err != nil {
+				l.addError(path+".certificateFile", "证书文件不存在: %v", cert.CertificateFile)
+			}
+			if _, err := os.Stat(cert.KeyFile); err != nil {
+				l.addError(path+".keyFile", "私钥文件不存在: %v", cert.KeyFile)
+			}
+		case len(cert.Certificate) > 0 || len(cert.Key) > 0:
+			if len(cert.Certificate) == 0 {
+				l.addError(path+".certificate", "不能为空")
+			}
+			if len(cert.Key) == 0 {
+				l.addError(path+".key", "不能为空")
+			}
+		default:
+			l.addError(path, "未指定证书")
+		}
+	}
+}
+
+func (l *inboundLinter) lintReality(settings *xray.RealitySettings) {
+	protocol := l.inbound.Protocol
+	if protocol != model.VLESS && protocol != model.Trojan {
+		l.addError("streamSettings.security", "reality 只支持 vless 和 trojan")
+	}
+	if settings == nil {
+		l.addError("streamSettings.realitySettings", "不能为空")
+		return
+	}
+	if settings.GetDest() == "" {
+		l.addError("streamSettings.realitySettings.dest", "不能为空")
+	}
+	if settings.PrivateKey == "" {
+		l.addError("streamSettings.realitySettings.privateKey", "不能为空")
+	} else if _, err := keygen.X25519PublicKey(settings.PrivateKey); err != nil {
+		l.addError("streamSettings.realitySettings.privateKey", "%v", err)
+	}
+	if len(settings.ServerNames) == 0 {
+		l.addError("streamSettings.realitySettings.serverNames", "不能为空")
+	}
+	for i, shortId := range settings.ShortIds {
+		if !shortIdRegex.MatchString(shortId) {
+			l.addError(fmt.Sprintf("streamSettings.realitySettings.shortIds[%d]", i), "必须是长度不超过16的偶数位十六进制")
+		}
+	}
+}
+
+func (l *inboundLinter) lintStreamSettings() *xray.StreamSettings {
+	stream := &xray.StreamSettings{}
+	if !l.unmarshal("streamSettings", l.inbound.StreamSettings, stream) {
+		return nil
+	}
+	if !contains(networks, stream.GetNetwork()) {
+		l.addError("streamSettings.network", "不支持的传输方式: %v", stream.Network)
+	}
+	switch stream.Security {
+	case "tls":
+		l.lintCertificates("streamSettings.tlsSettings", stream.TLSSettings)
+	case "xtls":
+		l.lintCertificates("streamSettings.xtlsSettings", stream.XTLSSettings)
+	case "reality":
+		l.lintReality(stream.RealitySettings)
+	default:
+		if !contains(securities, stream.Security) {
+			l.addError("streamSettings.security", "不支持的安全类型: %v", stream.Security)
+		}
+	}
+	if stream.WSSettings != nil && stream.WSSettings.Path != "" && !strings.HasPrefix(stream.WSSettings.Path, "/") {
+		l.addError("streamSettings.wsSettings.path", "必须以 / 开头")
+	}
+	return stream
+}
+
+func (l *inboundLinter) lintListenAndPort() {
+	inbound := l.inbound
+	listenIP := false
+	for _, listen := range inbound.GetListens() {
+		switch {
+		case model.IsUnixListen(listen):
+			if len(listen) > 108 {
+				l.addError("listen", "Unix domain socket 路径过长: %v", listen)
+			}
+		case listen == "" || net.ParseIP(listen) != nil:
+			listenIP = true
+		default:
+			l.addError("listen", "不是有效的IP地址或 Unix domain socket 路径: %v", listen)
+		}
+	}
+	// 只监听 Unix domain socket 时不需要端口
+	if !listenIP {
+		if inbound.PortRange != "" {
+			l.addError("portRange", "Unix domain socket 不支持端口范围")
+		}
+		return
+	}
+	if inbound.PortRange != "" {
+		if _, err := xray.ParsePortList(inbound.PortRange); err != nil {
+			l.addError("portRange", "%v", err)
+		}
+	} else if inbound.Port <= 0 || inbound.Port > 65535 {
+		l.addError("port", "端口无效: %d", inbound.Port)
+	}
+}
+
+// lintInbound 按协议和传输方式检查入站配置，返回所有字段错误
+func lintInbound(inbound *model.Inbound) []*FieldError {
+	l := &inboundLinter{
+		inbound: inbound,
+		errors:  make([]*FieldError, 0),
+	}
+	l.lintListenAndPort()
+	if strings.Contains(inbound.Tag, model.ListenTagSeparator) {
+		l.addError("tag", "不能包含 %v", model.ListenTagSeparator)
+	} else if strings.Contains(inbound.Tag, clientIpKeySeparator) {
+		l.addError("tag", "不能包含 %v", clientIpKeySeparator)
+	} else if inbound.Tag == "api" {
+		l.addError("tag", "api 为保留的 tag")
+	}
+	l.unmarshal("sniffing", inbound.Sniffing, &xray.Sniffing{})
+
+	stream := l.lintStreamSettings()
+	linter, ok := protocolLinters[inbound.Protocol]
+	if !ok {
+		l.addError("protocol", "不支持的协议: %v", inbound.Protocol)
+	} else if strings.TrimSpace(inbound.Settings) == "" {
+		l.addError("settings", "不能为空")
+	} else {
+		linter(l, stream)
+	}
+	return l.errors
+}
+
+// ValidateInbound 按协议和传输方式校验入站配置，返回 *InboundValidationError
+func ValidateInbound(inbound *model.Inbound) error {
+	if errs := lintInbound(inbound); len(errs) > 0 {
+		return &InboundValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// ValidateInboundUpdate 校验修改后的入站。旧版本保存的入站可能不符合新的规则，
+// 修改前就已存在的错误只作为警告返回，用户可以先保存再逐步修正；新引入的错误仍然拒绝保存。
+// 客户端流量、IP 限制、封禁记录和路由规则都以 tag 关联，tag 创建后不能修改
+func ValidateInboundUpdate(oldInbound *model.Inbound, inbound *model.Inbound) ([]*FieldError, error) {
+	errs := lintInbound(inbound)
+	if inbound.Tag != "" && inbound.Tag != oldInbound.Tag {
+		errs = append(errs, &FieldError{Field: "tag", Message: "创建后不能修改"})
+	}
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	legacy := map[FieldError]bool{}
+	for _, fe := range lintInbound(oldInbound) {
+		legacy[*fe] = true
+	}
+	warnings := make([]*FieldError, 0)
+	newErrs := make([]*FieldError, 0)
+	for _, fe := range errs {
+		if legacy[*fe] {
+			warnings = append(warnings, fe)
+		} else {
+			newErrs = append(newErrs, fe)
+		}
+	}
+	if len(newErrs) > 0 {
+		return nil, &InboundValidationError{Errors: newErrs}
+	}
+	return warnings, nil
+}
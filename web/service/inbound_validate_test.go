@@ -0,0 +1,332 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+const (
+	testUUID       = "b831381d-6324-4d53-ad4f-8cda48b30811"
+	testRealityKey = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	testWgKey      = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	testSS2022Key  = "AAAAAAAAAAAAAAAAAAAAAA=="
+)
+
+type lintCase struct {
+	name    string
+	inbound *model.Inbound
+	// want 为 "字段: 错误信息"，错误信息按前缀匹配
+	want []string
+}
+
+func newLintInbound(protocol model.Protocol, settings string, stream string) *model.Inbound {
+	return &model.Inbound{
+		Port:           443,
+		Protocol:       protocol,
+		Settings:       settings,
+		StreamSettings: stream,
+	}
+}
+
+func runLintCases(t *testing.T, cases []lintCase) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			errs := lintInbound(c.inbound)
+			got := make([]string, 0, len(errs))
+			for _, fe := range errs {
+				got = append(got, fe.Field+": "+fe.Message)
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("错误为 %q，期望 %q", got, c.want)
+			}
+			for i := range got {
+				if !strings.HasPrefix(got[i], c.want[i]) {
+					t.Fatalf("错误为 %q，期望 %q", got, c.want)
+				}
+			}
+			if err := ValidateInbound(c.inbound); (err == nil) != (len(c.want) == 0) {
+				t.Fatalf("ValidateInbound 返回 %v，期望 %d 个错误", err, len(c.want))
+			}
+		})
+	}
+}
+
+func TestLintInboundCommon(t *testing.T) {
+	vmess := `{"clients":[{"id":"` + testUUID + `"}]}`
+	runLintCases(t, []lintCase{
+		{"不支持的协议", newLintInbound("foo", "{}", ""), []string{"protocol: 不支持的协议: foo"}},
+		{"settings 为空", newLintInbound(model.VMess, " ", ""), []string{"settings: 不能为空"}},
+		{"JSON格式错误", newLintInbound(model.VMess, "{", ""), []string{"settings: JSON格式错误"}},
+		{"端口无效", &model.Inbound{Port: 0, Protocol: model.VMess, Settings: vmess}, []string{"port: 端口无效: 0"}},
+		{"端口范围无效", &model.Inbound{PortRange: "2000-1000", Protocol: model.VMess, Settings: vmess}, []string{"portRange: "}},
+		{"tag 包含分隔符", &model.Inbound{Port: 443, Tag: "in@1", Protocol: model.VMess, Settings: vmess}, []string{"tag: 不能包含 @"}},
+		{"保留的 tag", &model.Inbound{Port: 443, Tag: "api", Protocol: model.VMess, Settings: vmess}, []string{"tag: api 为保留的 tag"}},
+		{"无效的监听地址", &model.Inbound{Listen: "example.com", Port: 443, Protocol: model.VMess, Settings: vmess}, []string{"listen: 不是有效的IP地址或 Unix domain socket 路径: example.com"}},
+		{"Unix domain socket 不需要端口", &model.Inbound{Listen: "/run/xray.sock", Protocol: model.VMess, Settings: vmess}, nil},
+		{"Unix domain socket 不支持端口范围", &model.Inbound{Listen: "/run/xray.sock", PortRange: "1000-2000", Protocol: model.VMess, Settings: vmess}, []string{"portRange: Unix domain socket 不支持端口范围"}},
+		{"不支持的传输方式", newLintInbound(model.VMess, vmess, `{"network":"foo"}`), []string{"streamSettings.network: 不支持的传输方式: foo"}},
+		{"不支持的安全类型", newLintInbound(model.VMess, vmess, `{"security":"foo"}`), []string{"streamSettings.security: 不支持的安全类型: foo"}},
+		{"ws 路径", newLintInbound(model.VMess, vmess, `{"network":"ws","wsSettings":{"path":"ws"}}`), []string{"streamSettings.wsSettings.path: 必须以 / 开头"}},
+		{"tls 未配置证书", newLintInbound(model.VMess, vmess, `{"security":"tls","tlsSettings":{}}`), []string{"streamSettings.tlsSettings.certificates: 未配置证书"}},
+		{"tls 证书不完整", newLintInbound(model.VMess, vmess, `{"security":"tls","tlsSettings":{"certificates":[{"certificate":["cert"]},{}]}}`), []string{
+			"streamSettings.tlsSettings.certificates[0].key: 不能为空",
+			"streamSettings.tlsSettings.certificates[1]: 未指定证书",
+		}},
+		{"tls 证书文件不存在", newLintInbound(model.VMess, vmess, `{"security":"tls","tlsSettings":{"certificates":[{"certificateFile":"/nonexistent.crt","keyFile":"/nonexistent.key"}]}}`), []string{
+			"streamSettings.tlsSettings.certificates[0].certificateFile: 证书文件不存在: /nonexistent.crt",
+			"streamSettings.tlsSettings.certificates[0].keyFile: 私钥文件不存在: /nonexistent.key",
+		}},
+	})
+}
+
+func TestLintVMess(t *testing.T) {
+	runLintCases(t, []lintCase{
+		{"有效", newLintInbound(model.VMess, `{"clients":[{"id":"`+testUUID+`","alterId":0}]}`, ""), nil},
+		{"没有客户端", newLintInbound(model.VMess, `{"clients":[]}`, ""), []string{"settings.clients: 至少需要一个客户端"}},
+		{"id 无效或重复", newLintInbound(model.VMess, `{"clients":[{"id":"bad","email":"a"},{"id":"bad","email":"a","alterId":-1},{"id":""}]}`, ""), []string{
+			"settings.clients[1].id: 与 clients[0] 重复",
+			"settings.clients[1].email: 与 clients[0] 重复",
+			"settings.clients[2].id: 不能为空",
+			"settings.clients[0].id: 不是有效的UUID",
+			"settings.clients[1].id: 不是有效的UUID",
+			"settings.clients[1].alterId: 不能为负数",
+		}},
+		{"reality 不支持 vmess", newLintInbound(model.VMess, `{"clients":[{"id":"`+testUUID+`"}]}`,
+			`{"security":"reality","realitySettings":{"dest":"example.com:443","privateKey":"`+testRealityKey+`","serverNames":["example.com"]}}`),
+			[]string{"streamSettings.security: reality 只支持 vless 和 trojan"}},
+	})
+}
+
+func TestLintVLESS(t *testing.T) {
+	reality := `{"network":"tcp","security":"reality","realitySettings":{"target":"example.com:443","privateKey":"` + testRealityKey + `","serverNames":["example.com"],"shortIds":["","0123abcd"]}}`
+	runLintCases(t, []lintCase{
+		{"vision + reality", newLintInbound(model.VLESS, `{"decryption":"none","clients":[{"id":"`+testUUID+`","flow":"xtls-rprx-vision"}]}`, reality), nil},
+		{"decryption 不是 none", newLintInbound(model.VLESS, `{"clients":[{"id":"`+testUUID+`"}]}`, ""), []string{"settings.decryption: 必须为 none"}},
+		{"不支持的 flow", newLintInbound(model.VLESS, `{"decryption":"none","clients":[{"id":"`+testUUID+`","flow":"xtls-rprx-direct"}]}`, reality), []string{
+			"settings.clients[0].flow: 不支持的flow: xtls-rprx-direct",
+		}},
+		{"vision 不能用于 ws", newLintInbound(model.VLESS, `{"decryption":"none","clients":[{"id":"`+testUUID+`","flow":"xtls-rprx-vision"}]}`, `{"network":"ws"}`), []string{
+			"settings.clients[0].flow: xtls-rprx-vision 只能用于 tcp + tls/reality",
+		}},
+		{"reality 配置不完整", newLintInbound(model.VLESS, `{"decryption":"none","clients":[{"id":"`+testUUID+`"}]}`,
+			`{"security":"reality","realitySettings":{"privateKey":"bad","shortIds":["abc","0123456789abcdef01"]}}`), []string{
+			"streamSettings.realitySettings.dest: 不能为空",
+			"streamSettings.realitySettings.privateKey: 私钥长度必须为 32 字节",
+			"streamSettings.realitySettings.serverNames: 不能为空",
+			"streamSettings.realitySettings.shortIds[0]: 必须是长度不超过16的偶数位十六进制",
+			"streamSettings.realitySettings.shortIds[1]: 必须是长度不超过16的偶数位十六进制",
+		}},
+		{"reality 缺少配置", newLintInbound(model.VLESS, `{"decryption":"none","clients":[{"id":"`+testUUID+`"}]}`, `{"security":"reality"}`), []string{
+			"streamSettings.realitySettings: 不能为空",
+		}},
+	})
+}
+
+func TestLintTrojan(t *testing.T) {
+	runLintCases(t, []lintCase{
+		{"有效", newLintInbound(model.Trojan, `{"clients":[{"password":"p1"},{"password":"p2"}]}`, ""), nil},
+		{"密码为空或重复", newLintInbound(model.Trojan, `{"clients":[{"password":"","email":"a"},{"password":"p","email":"a"},{"password":"p"}]}`, ""), []string{
+			"settings.clients[0].password: 不能为空",
+			"settings.clients[1].email: 与 clients[0] 重复",
+			"settings.clients[2].password: 与 clients[1] 重复",
+		}},
+	})
+}
+
+func TestLintShadowsocks(t *testing.T) {
+	runLintCases(t, []lintCase{
+		{"单用户", newLintInbound(model.Shadowsocks, `{"method":"aes-256-gcm","password":"p"}`, ""), nil},
+		{"单用户配置错误", newLintInbound(model.Shadowsocks, `{"method":"rc4-md5","password":""}`, ""), []string{
+			"settings.method: 不支持的加密方式: rc4-md5",
+			"settings.password: 不能为空",
+		}},
+		{"2022 单用户", newLintInbound(model.Shadowsocks, `{"method":"2022-blake3-aes-128-gcm","password":"`+testSS2022Key+`"}`, ""), nil},
+		{"2022 密钥长度错误", newLintInbound(model.Shadowsocks, `{"method":"2022-blake3-aes-128-gcm","password":"cGFzc3dvcmQ="}`, ""), []string{
+			"settings.password: 2022-blake3-aes-128-gcm 的密钥必须是 16 字节的 base64",
+		}},
+		{"2022 多用户", newLintInbound(model.Shadowsocks, `{"method":"2022-blake3-aes-128-gcm","password":"`+testSS2022Key+`","clients":[{"password":"`+testSS2022Key+`"}]}`, ""), nil},
+		{"多用户配置错误", newLintInbound(model.Shadowsocks, `{"method":"2022-blake3-aes-128-gcm","password":"`+testSS2022Key+`","clients":[{"password":"bad"},{"password":"p","method":"rc4-md5"}]}`, ""), []string{
+			"settings.clients[0].password: 2022-blake3-aes-128-gcm 的密钥必须是 16 字节的 base64",
+			"settings.clients[1].method: 不支持的加密方式: rc4-md5",
+		}},
+		{"多用户各自指定加密方式", newLintInbound(model.Shadowsocks, `{"clients":[{"password":"p","method":"aes-128-gcm"},{"password":"q","method":"chacha20-poly1305"}]}`, ""), nil},
+	})
+}
+
+func TestLintDokodemo(t *testing.T) {
+	runLintCases(t, []lintCase{
+		{"followRedirect", newLintInbound(model.Dokodemo, `{"followRedirect":true}`, ""), nil},
+		{"有效", newLintInbound(model.Dokodemo, `{"address":"1.1.1.1","port":53}`, ""), nil},
+		{"缺少地址和端口", newLintInbound(model.Dokodemo, `{"network":"tcp"}`, ""), []string{
+			"settings.address: 未开启 followRedirect 时不能为空",
+			"settings.port: 端口无效: 0",
+		}},
+		{"tunnel", newLintInbound(model.Tunnel, `{"address":"1.1.1.1","port":70000}`, ""), []string{"settings.port: 端口无效: 70000"}},
+	})
+}
+
+func TestLintHttp(t *testing.T) {
+	runLintCases(t, []lintCase{
+		{"无认证", newLintInbound(model.Http, `{}`, ""), nil},
+		{"账号错误", newLintInbound(model.Http, `{"accounts":[{"user":"a","pass":"1"},{"user":"a","pass":""},{"user":"","pass":"2"}]}`, ""), []string{
+			"settings.accounts[1].user: 与 accounts[0] 重复",
+			"settings.accounts[1].pass: 不能为空",
+			"settings.accounts[2].user: 不能为空",
+		}},
+	})
+}
+
+func TestLintSocks(t *testing.T) {
+	runLintCases(t, []lintCase{
+		{"无认证", newLintInbound(model.Socks, `{"auth":"noauth","udp":true,"ip":"127.0.0.1"}`, ""), nil},
+		{"密码认证", newLintInbound(model.Socks, `{"auth":"password","accounts":[{"user":"a","pass":"1"}]}`, ""), nil},
+		{"密码认证缺少账号", newLintInbound(model.Socks, `{"auth":"password"}`, ""), []string{"settings.accounts: password 认证至少需要一个账号"}},
+		{"无效的认证方式和IP", newLintInbound(model.Socks, `{"auth":"foo","ip":"localhost"}`, ""), []string{
+			"settings.auth: 必须是 noauth 或 password: foo",
+			"settings.ip: 不是有效的IP地址: localhost",
+		}},
+	})
+}
+
+func TestLintWireGuard(t *testing.T) {
+	runLintCases(t, []lintCase{
+		{"有效", newLintInbound(model.WireGuard, `{"secretKey":"`+testWgKey+`","mtu":1420,"peers":[{"publicKey":"`+testWgKey+`","allowedIPs":["10.0.0.2/32"]}]}`, ""), nil},
+		{"没有 peer", newLintInbound(model.WireGuard, `{"secretKey":"`+testWgKey+`"}`, ""), []string{"settings.peers: 至少需要一个 peer"}},
+		{"配置错误", newLintInbound(model.WireGuard, `{"secretKey":"bad","mtu":-1,"peers":[
+			{"publicKey":"`+testWgKey+`","preSharedKey":"cGFzc3dvcmQ=","allowedIPs":["10.0.0.2"],"email":"a"},
+			{"publicKey":"`+testWgKey+`","email":"a"}]}`, ""), []string{
+			"settings.secretKey: 无效的WireGuard密钥",
+			"settings.mtu: 无效: -1",
+			"settings.peers[0].preSharedKey: WireGuard密钥长度必须为 32 字节",
+			"settings.peers[0].allowedIPs[0]: 不是有效的CIDR: 10.0.0.2",
+			"settings.peers[1].publicKey: 与 peers[0] 重复",
+			"settings.peers[1].email: 与 peers[0] 重复",
+			"settings.peers[1].allowedIPs: 不能为空",
+		}},
+	})
+}
+
+func TestInboundValidationErrorOutput(t *testing.T) {
+	err := ValidateInbound(&model.Inbound{Port: 0, Protocol: model.Socks, Settings: `{"auth":"foo"}`})
+	var validationErr *InboundValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("返回 %T，期望 *InboundValidationError", err)
+	}
+	if want := "port: 端口无效: 0; settings.auth: 必须是 noauth 或 password: foo"; err.Error() != want {
+		t.Fatalf("Error() = %q，期望 %q", err.Error(), want)
+	}
+	data, err := json.Marshal(validationErr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"errors":[{"field":"port","message":"端口无效: 0"},{"field":"settings.auth","message":"必须是 noauth 或 password: foo"}]}`
+	if string(data) != want {
+		t.Fatalf("JSON = %s，期望 %s", data, want)
+	}
+}
+
+func TestUpdateInboundAllowsLegacyErrors(t *testing.T) {
+	initTestDB(t)
+	s := &InboundService{}
+	// 旧版本保存的入站使用已不支持的 flow，直接写入数据库模拟
+	legacy := &model.Inbound{
+		Port:     freePort(t),
+		Tag:      "legacy",
+		Remark:   "old",
+		Protocol: model.VLESS,
+		Settings: `{"decryption":"none","clients":[{"id":"` + testUUID + `","flow":"xtls-rprx-direct"}]}`,
+	}
+	if err := database.GetDB().Create(legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	inbound := *legacy
+	inbound.Remark = "new"
+	warnings, err := s.UpdateInboundWithWarnings(&inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0].Field != "settings.clients[0].flow" {
+		t.Fatalf("警告为 %v，期望 settings.clients[0].flow", warnings)
+	}
+	saved, err := s.GetInbound(legacy.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Remark != "new" {
+		t.Fatalf("备注为 %q，修改未保存", saved.Remark)
+	}
+
+	// 新引入的错误仍然拒绝保存，错误中不包含原有的警告
+	inbound = *saved
+	inbound.Settings = `{"decryption":"none","clients":[{"id":"bad","flow":"xtls-rprx-direct"}]}`
+	_, err = s.UpdateInboundWithWarnings(&inbound)
+	var validationErr *InboundValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("返回 %v，期望 *InboundValidationError", err)
+	}
+	if len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != "settings.clients[0].id" {
+		t.Fatalf("错误为 %v，期望 settings.clients[0].id", err)
+	}
+
+	// 修正后不再有警告
+	inbound = *saved
+	inbound.Settings = `{"decryption":"none","clients":[{"id":"` + testUUID + `"}]}`
+	warnings, err = s.UpdateInboundWithWarnings(&inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("修正后仍有警告 %v", warnings)
+	}
+
+	// 修正后的入站不再按旧配置放宽校验
+	inbound.Settings = `{"decryption":"none","clients":[{"id":"` + testUUID + `","flow":"xtls-rprx-direct"}]}`
+	if err := s.UpdateInbound(&inbound); err == nil {
+		t.Fatal("已修正的入站重新引入错误时应拒绝保存")
+	}
+}
+
+func TestUpdateInboundKeepsTag(t *testing.T) {
+	initTestDB(t)
+	s := &InboundService{}
+	inbound := &model.Inbound{
+		Port:     freePort(t),
+		Tag:      "stable",
+		Protocol: model.VLESS,
+		Settings: `{"decryption":"none","clients":[{"id":"` + testUUID + `"}]}`,
+	}
+	if err := database.GetDB().Create(inbound).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改端口不影响 tag，未提交 tag 时保留原有的 tag
+	update := *inbound
+	update.Port = freePort(t)
+	update.Tag = ""
+	if _, err := s.UpdateInboundWithWarnings(&update); err != nil {
+		t.Fatal(err)
+	}
+
+	update.Tag = "renamed"
+	_, err := s.UpdateInboundWithWarnings(&update)
+	var validationErr *InboundValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("返回 %v，期望 *InboundValidationError", err)
+	}
+	if len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != "tag" {
+		t.Fatalf("错误为 %v，期望 tag", err)
+	}
+	saved, err := s.GetInbound(inbound.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Tag != "stable" || saved.Port != update.Port {
+		t.Fatalf("保存后 tag 为 %q、端口为 %d，期望 stable、%d", saved.Tag, saved.Port, update.Port)
+	}
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/mail"
+	"x-ui/web/entity"
+)
+
+const (
+	reminderKindExpiry = "expiry"
+	reminderKindQuota  = "quota"
+)
+
+// 邮件模板，第一行为主题
+var mailTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"traffic": formatTraffic,
+}).Parse(`
+{{define "expiry"}}[{{.Remark}}] 将在 {{.DaysLeft}} 天后到期
+您好，
+
+您的服务 {{.Remark}} 将于 {{.ExpiryTime}} 到期，剩余 {{.DaysLeft}} 天。
+已使用流量: {{traffic .Used}}{{if gt .Total 0}} / {{traffic .Total}}{{end}}
+
+请及时续期，以免服务中断。
+{{end}}
+{{define "quota"}}[{{.Remark}}] 流量已使用 {{.Percent}}%
+您好，
+
+您的服务 {{.Remark}} 已使用流量 {{traffic .Used}} / {{traffic .Total}} ({{.Percent}}%)。
+流量耗尽后服务将被停用。
+{{end}}
+{{define "test"}}x-ui 测试邮件
+这是一封来自 x-ui 面板的测试邮件，收到说明 SMTP 配置正确。
+{{end}}`))
+
+type mailTemplateData struct {
+	Remark     string
+	ExpiryTime string
+	DaysLeft   int
+	Used       int64
+	Total      int64
+	Percent    int
+}
+
+type MailService struct {
+	ctx            context.Context
+	settingService SettingService
+	inboundService InboundService
+}
+
+func NewMailService(ctx context.Context) *MailService {
+	return &MailService{
+		ctx: ctx,
+	}
+}
+
+// newSender 未启用SMTP时返回 nil
+func (s *MailService) newSender() (*mail.Sender, error) {
+	enable, err := s.settingService.GetSmtpEnable()
+	if err != nil || !enable {
+		return nil, err
+	}
+	sender := &mail.Sender{}
+	if sender.Host, err = s.settingService.GetSmtpHost(); err != nil {
+		return nil, err
+	}
+	if sender.Port, err = s.settingService.GetSmtpPort(); err != nil {
+		return nil, err
+	}
+	if sender.Username, err = s.settingService.GetSmtpUsername(); err != nil {
+		return nil, err
+	}
+	if sender.Password, err = s.settingService.GetSmtpPassword(); err != nil {
+		return nil, err
+	}
+	if sender.From, err = s.settingService.GetSmtpFrom(); err != nil {
+		return nil, err
+	}
+	if sender.TLS, err = s.settingService.GetSmtpTls(); err != nil {
+		return nil, err
+	}
+	return sender, nil
+}
+
+func renderMail(name string, data interface{}) (string, string, error) {
+	var buf bytes.Buffer
+	if err := mailTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", "", err
+	}
+	content := strings.TrimLeft(buf.String(), "\n")
+	subject, body, _ := strings.Cut(content, "\n")
+	return subject, body, nil
+}
+
+func (s *MailService) sendTemplate(to string, name string, data interface{}) error {
+	sender, err := s.newSender()
+	if err != nil {
+		return err
+	}
+	if sender == nil {
+		return errors.New("未启用SMTP")
+	}
+	subject, body, err := renderMail(name, data)
+	if err != nil {
+		return err
+	}
+	return sender.Send(to, subject, body)
+}
+
+// SendTestMail 发送测试邮件以验证SMTP配置
+func (s *MailService) SendTestMail(to string) error {
+	return s.sendTemplate(to, "test", nil)
+}
+
+// reminderTarget 一个收件人和决定是否提醒的限额
+//
+// 入站邮箱按入站的到期时间和流量上限提醒，客户端的 notifyEmail 按该客户端自己的限额和流量提醒
+type reminderTarget struct {
+	inboundId  int
+	recipient  string
+	remark     string
+	used       int64
+	total      int64
+	expiryTime int64
+}
+
+// getReminderTargets 每个收件人单独一个提醒对象，同一入站下重复的地址只保留第一个
+func getReminderTargets(inbounds []*model.Inbound, stats []*ClientStat) []*reminderTarget {
+	targets := make([]*reminderTarget, 0)
+	seen := map[string]bool{}
+	add := func(target *reminderTarget) {
+		target.recipient = strings.TrimSpace(target.recipient)
+		key := fmt.Sprintf("%d|%v", target.inboundId, target.recipient)
+		if target.recipient == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		targets = append(targets, target)
+	}
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		add(&reminderTarget{
+			inboundId:  inbound.Id,
+			recipient:  inbound.Email,
+			remark:     inbound.Remark,
+			used:       inbound.Up + inbound.Down,
+			total:      inbound.Total,
+			expiryTime: inbound.ExpiryTime,
+		})
+	}
+	for _, stat := range stats {
+		if !stat.Inbound.Enable {
+			continue
+		}
+		add(&reminderTarget{
+			inboundId:  stat.Inbound.Id,
+			recipient:  stat.Client.NotifyEmail,
+			remark:     fmt.Sprintf("%v (%v)", stat.Inbound.Remark, stat.Client.Email),
+			used:       stat.Up + stat.Down,
+			total:      stat.Client.Total,
+			expiryTime: stat.Client.ExpiryTime,
+		})
+	}
+	return targets
+}
+
+func isReminderSent(inboundId int, email string, kind string, threshold int, reference int64) (bool, error) {
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.ReminderLog{}).
+		Where("inbound_id = ? and email = ? and kind = ? and threshold = ? and reference = ?", inboundId, email, kind, threshold, reference).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func saveReminderLog(inboundId int, email string, kind string, threshold int, reference int64) error {
+	db := database.GetDB()
+	return db.Create(&model.ReminderLog{
+		InboundId: inboundId,
+		Email:     email,
+		Kind:      kind,
+		Threshold: threshold,
+		Reference: reference,
+		CreatedAt: time.Now().UnixMilli(),
+	}).Error
+}
+
+// pickExpiryThreshold 返回满足 daysLeft <= N 的最小 N，没有则返回 0
+func pickExpiryThreshold(days []int, daysLeft int) int {
+	sort.Ints(days)
+	for _, n := range days {
+		if daysLeft <= n {
+			return n
+		}
+	}
+	return 0
+}
+
+// pickQuotaThreshold 返回满足 percent >= P 的最大 P，没有则返回 0
+func pickQuotaThreshold(percents []int, percent int) int {
+	sort.Sort(sort.Reverse(sort.IntSlice(percents)))
+	for _, p := range percents {
+		if percent >= p {
+			return p
+		}
+	}
+	return 0
+}
+
+func (s *MailService) sendReminder(target *reminderTarget, kind string, threshold int, reference int64, data *mailTemplateData) {
+	sent, err := isReminderSent(target.inboundId, target.recipient, kind, threshold, reference)
+	if err != nil {
+		logger.Warning("查询提醒记录失败:", err)
+		return
+	}
+	if sent {
+		return
+	}
+	if err := s.sendTemplate(target.recipient, kind, data); err != nil {
+		logger.Warningf("发送入站 %v 的%v提醒失败: %v", target.inboundId, kind, err)
+		return
+	}
+	logger.Infof("已向 %v 发送入站 %v 的%v提醒", target.recipient, target.inboundId, kind)
+	if err := saveReminderLog(target.inboundId, target.recipient, kind, threshold, reference); err != nil {
+		logger.Warning("保存提醒记录失败:", err)
+	}
+}
+
+// SendReminders 在到期前 N 天和流量达到阈值时向入站邮箱和客户端分别发送提醒邮件
+func (s *MailService) SendReminders() error {
+	enable, err := s.settingService.GetSmtpEnable()
+	if err != nil || !enable {
+		return err
+	}
+	daysStr, err := s.settingService.GetExpiryRemindDays()
+	if err != nil {
+		return err
+	}
+	days, err := entity.ParseIntList(daysStr)
+	if err != nil {
+		return err
+	}
+	percentStr, err := s.settingService.GetQuotaRemindPercent()
+	if err != nil {
+		return err
+	}
+	percents, err := entity.ParseIntList(percentStr)
+	if err != nil {
+		return err
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	stats, err := s.inboundService.GetClientStats()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, target := range getReminderTargets(inbounds, stats) {
+		if target.expiryTime > 0 {
+			expiry := time.UnixMilli(target.expiryTime)
+			left := expiry.Sub(now)
+			if left > 0 {
+				daysLeft := int((left + 24*time.Hour - 1) / (24 * time.Hour))
+				if threshold := pickExpiryThreshold(days, daysLeft); threshold > 0 {
+					s.sendReminder(target, reminderKindExpiry, threshold, target.expiryTime, &mailTemplateData{
+						Remark:     target.remark,
+						ExpiryTime: expiry.Format("2006-01-02 15:04"),
+						DaysLeft:   daysLeft,
+						Used:       target.used,
+						Total:      target.total,
+					})
+				}
+			}
+		}
+
+		if target.total > 0 {
+			percent := int(target.used * 100 / target.total)
+			if threshold := pickQuotaThreshold(percents, percent); threshold > 0 {
+				s.sendReminder(target, reminderKindQuota, threshold, target.total, &mailTemplateData{
+					Remark:  target.remark,
+					Used:    target.used,
+					Total:   target.total,
+					Percent: percent,
+				})
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/xray"
+)
+
+func TestClientTrafficPerInbound(t *testing.T) {
+	initTestDB(t)
+	db := database.GetDB()
+	// 两个入站中有同名客户端，限额相同
+	for i, tag := range []string{"in-a", "in-b"} {
+		inbound := &model.Inbound{
+			Port:     30000 + i,
+			Tag:      tag,
+			Remark:   tag,
+			Enable:   true,
+			Protocol: model.VMess,
+			Settings: `{"clients":[{"id":"` + testUUID + `","email":"alice","total":1000,"notifyEmail":"alice@example.com"}]}`,
+		}
+		if err := db.Create(inbound).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 旧版本只按 email 累计的流量
+	if err := db.Create(&model.ClientTraffic{Email: "alice", Up: 5}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s := &InboundService{}
+	err := s.JournalTraffic([]*xray.Traffic{
+		{IsUser: true, Tag: ClientIpKey("in-a", "alice"), Up: 800, Down: 100},
+		{IsUser: true, Tag: ClientIpKey("in-b", "alice"), Up: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ApplyTrafficJournal(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.GetClientStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := map[string]int64{}
+	for _, stat := range stats {
+		used[stat.Inbound.Tag] = stat.Up + stat.Down
+	}
+	if used["in-a"] != 905 || used["in-b"] != 15 {
+		t.Fatalf("客户端流量为 %v，期望 in-a 905、in-b 15", used)
+	}
+
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := getReminderTargets(inbounds, stats)
+	if len(targets) != 2 {
+		t.Fatalf("提醒对象有 %d 个，期望 2 个", len(targets))
+	}
+	for _, target := range targets {
+		want := used["in-a"]
+		if target.remark == "in-b (alice)" {
+			want = used["in-b"]
+		}
+		if target.used != want {
+			t.Fatalf("%v 的已用流量为 %d，期望 %d", target.remark, target.used, want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"io"
+	"time"
+	"x-ui/util/metrics"
+)
+
+var (
+	metricsRegistry = metrics.NewRegistry()
+
+	// 系统状态，每次采集时刷新
+	cpuUsageGauge       = metrics.NewGauge("xui_cpu_usage_percent", "CPU usage in percent")
+	memUsedGauge        = metrics.NewGauge("xui_memory_used_bytes", "Used memory in bytes")
+	memTotalGauge       = metrics.NewGauge("xui_memory_total_bytes", "Total memory in bytes")
+	swapUsedGauge       = metrics.NewGauge("xui_swap_used_bytes", "Used swap in bytes")
+	swapTotalGauge      = metrics.NewGauge("xui_swap_total_bytes", "Total swap in bytes")
+	diskUsedGauge       = metrics.NewGauge("xui_disk_used_bytes", "Used disk space of / in bytes")
+	diskTotalGauge      = metrics.NewGauge("xui_disk_total_bytes", "Total disk space of / in bytes")
+	loadGauge           = metrics.NewGauge("xui_load", "System load average")
+	uptimeGauge         = metrics.NewGauge("xui_uptime_seconds", "System uptime in seconds")
+	netSentCounter      = metrics.NewCounter("xui_network_sent_bytes_total", "Total bytes sent by the host")
+	netRecvCounter      = metrics.NewCounter("xui_network_received_bytes_total", "Total bytes received by the host")
+	tcpCountGauge       = metrics.NewGauge("xui_tcp_connections", "Number of TCP connections")
+	udpCountGauge       = metrics.NewGauge("xui_udp_connections", "Number of UDP connections")
+	xrayRunningGauge    = metrics.NewGauge("xui_xray_running", "Whether xray is running (1) or not (0)")
+	inboundUpCounter    = metrics.NewCounter("xui_inbound_up_bytes_total", "Uploaded bytes per inbound")
+	inboundDownCounter  = metrics.NewCounter("xui_inbound_down_bytes_total", "Downloaded bytes per inbound")
+	inboundEnableGauge  = metrics.NewGauge("xui_inbound_enabled", "Whether the inbound is enabled")
+	outboundUpCounter   = metrics.NewCounter("xui_outbound_up_bytes_total", "Uploaded bytes per outbound")
+	outboundDownCounter = metrics.NewCounter("xui_outbound_down_bytes_total", "Downloaded bytes per outbound")
+
+	// 事件计数，由各模块累加
+	ClientUpCounter     = metrics.NewCounter("xui_client_up_bytes_total", "Uploaded bytes per client since panel start")
+	ClientDownCounter   = metrics.NewCounter("xui_client_down_bytes_total", "Downloaded bytes per client since panel start")
+	XrayRestartCounter  = metrics.NewCounter("xui_xray_restarts_total", "Number of xray (re)starts")
+	LoginFailureCounter = metrics.NewCounter("xui_login_failures_total", "Number of failed panel logins")
+	JobRunCounter       = metrics.NewCounter("xui_job_runs_total", "Number of scheduled job runs")
+	JobDurationGauge    = metrics.NewGauge("xui_job_duration_seconds", "Duration of the last run of each scheduled job")
+)
+
+func init() {
+	metricsRegistry.Register(
+		cpuUsageGauge, memUsedGauge, memTotalGauge, swapUsedGauge, swapTotalGauge,
+		diskUsedGauge, diskTotalGauge, loadGauge, uptimeGauge, netSentCounter, netRecvCounter,
+		tcpCountGauge, udpCountGauge, xrayRunningGauge,
+		inboundUpCounter, inboundDownCounter, inboundEnableGauge,
+		outboundUpCounter, outboundDownCounter,
+		ClientUpCounter, ClientDownCounter, XrayRestartCounter, LoginFailureCounter,
+		JobRunCounter, JobDurationGauge,
+	)
+}
+
+// ObserveJob 记录定时任务的运行次数和耗时，用法: defer ObserveJob("name", time.Now())
+func ObserveJob(name string, start time.Time) {
+	labels := metrics.Labels{"job": name}
+	JobRunCounter.Inc(labels)
+	JobDurationGauge.Set(time.Since(start).Seconds(), labels)
+}
+
+type MetricsService struct {
+	ctx                    context.Context
+	serverService          ServerService
+	inboundService         InboundService
+	outboundTrafficService OutboundTrafficService
+}
+
+func NewMetricsService(ctx context.Context) *MetricsService {
+	return &MetricsService{
+		ctx: ctx,
+	}
+}
+
+// SetServerService 设置ServerService依赖
+func (s *MetricsService) SetServerService(serverService ServerService) {
+	s.serverService = serverService
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (s *MetricsService) collectStatus() {
+	if s.serverService == nil {
+		return
+	}
+	status := s.serverService.GetStatus(nil)
+	cpuUsageGauge.Set(status.Cpu, nil)
+	memUsedGauge.Set(float64(status.Mem.Current), nil)
+	memTotalGauge.Set(float64(status.Mem.Total), nil)
+	swapUsedGauge.Set(float64(status.Swap.Current), nil)
+	swapTotalGauge.Set(float64(status.Swap.Total), nil)
+	diskUsedGauge.Set(float64(status.Disk.Current), nil)
+	diskTotalGauge.Set(float64(status.Disk.Total), nil)
+	uptimeGauge.Set(float64(status.Uptime), nil)
+	netSentCounter.Set(float64(status.NetTraffic.Sent), nil)
+	netRecvCounter.Set(float64(status.NetTraffic.Recv), nil)
+	tcpCountGauge.Set(float64(status.TcpCount), nil)
+	udpCountGauge.Set(float64(status.UdpCount), nil)
+	xrayRunningGauge.Set(boolToFloat(status.Xray.State == 1), nil)
+	for i, period := range []string{"1", "5", "15"} {
+		if i < len(status.Loads) {
+			loadGauge.Set(status.Loads[i], metrics.Labels{"period": period})
+		}
+	}
+}
+
+func (s *MetricsService) collectInbounds() error {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	up, down, enable := metrics.NewSnapshot(), metrics.NewSnapshot(), metrics.NewSnapshot()
+	for _, inbound := range inbounds {
+		labels := metrics.Labels{
+			"tag":      inbound.Tag,
+			"remark":   inbound.Remark,
+			"protocol": string(inbound.Protocol),
+			"port":     inbound.GetPortString(),
+		}
+		up.Set(float64(inbound.Up), labels)
+		down.Set(float64(inbound.Down), labels)
+		enable.Set(boolToFloat(inbound.Enable), labels)
+	}
+	inboundUpCounter.Swap(up)
+	inboundDownCounter.Swap(down)
+	inboundEnableGauge.Swap(enable)
+	return nil
+}
+
+func (s *MetricsService) collectOutbounds() error {
+	overview, err := s.outboundTrafficService.GetOverview()
+	if err != nil {
+		return err
+	}
+	up, down := metrics.NewSnapshot(), metrics.NewSnapshot()
+	for _, outbound := range overview.Outbounds {
+		labels := metrics.Labels{
+			"tag":      outbound.Tag,
+			"protocol": outbound.Protocol,
+			"category": outbound.Category,
+		}
+		up.Set(float64(outbound.Up), labels)
+		down.Set(float64(outbound.Down), labels)
+	}
+	outboundUpCounter.Swap(up)
+	outboundDownCounter.Swap(down)
+	return nil
+}
+
+// WriteMetrics 采集当前状态并以 Prometheus 文本格式输出所有指标
+func (s *MetricsService) WriteMetrics(w io.Writer) error {
+	s.collectStatus()
+	if err := s.collectInbounds(); err != nil {
+		return err
+	}
+	if err := s.collectOutbounds(); err != nil {
+		return err
+	}
+	return metricsRegistry.WriteText(w)
+}
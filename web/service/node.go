@@ -0,0 +1,619 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const nodeRequestTimeout = 10 * time.Second
+
+// NodeSnapshot 最近一次从节点同步到的状态和入站
+type NodeSnapshot struct {
+	NodeId   int              `json:"nodeId"`
+	Status   *Status          `json:"status"`
+	Inbounds []*model.Inbound `json:"inbounds"`
+	SyncTime int64            `json:"syncTime"`
+}
+
+// NodeOverview 节点列表页展示的汇总信息
+type NodeOverview struct {
+	*model.Node
+	Inbounds int     `json:"inbounds"`
+	Up       int64   `json:"up"`
+	Down     int64   `json:"down"`
+	Status   *Status `json:"status"`
+}
+
+// 节点ID到 *NodeSnapshot，缓存数据库中保存的最近一次同步结果
+var nodeSnapshots sync.Map
+
+// loadSnapshot 返回节点最近一次同步成功的数据，优先使用缓存，没有时返回 nil
+func loadSnapshot(id int) (*NodeSnapshot, error) {
+	if snapshot, ok := nodeSnapshots.Load(id); ok {
+		return snapshot.(*NodeSnapshot), nil
+	}
+	db := database.GetDB()
+	record := &model.NodeSnapshot{}
+	err := db.Model(model.NodeSnapshot{}).Where("node_id = ?", id).First(record).Error
+	if database.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	snapshot := &NodeSnapshot{}
+	if err := json.Unmarshal([]byte(record.Data), snapshot); err != nil {
+		return nil, err
+	}
+	nodeSnapshots.Store(id, snapshot)
+	return snapshot, nil
+}
+
+// deleteSnapshot 删除节点保存的同步结果
+func deleteSnapshot(tx *gorm.DB, id int) error {
+	nodeSnapshots.Delete(id)
+	return tx.Where("node_id = ?", id).Delete(model.NodeSnapshot{}).Error
+}
+
+// nodeClient 通过远程面板的 HTTP 接口和 API Token 访问节点，agent 节点改用双向 TLS
+type nodeClient struct {
+	ctx        context.Context
+	node       *model.Node
+	httpClient *http.Client
+}
+
+func newNodeClient(ctx context.Context, node *model.Node, tlsConfig *tls.Config) *nodeClient {
+	httpClient := &http.Client{Timeout: nodeRequestTimeout}
+	if tlsConfig != nil {
+		httpClient.Transport = &http.Transport{
+			TLSClientConfig: tlsConfig,
+		}
+	}
+	return &nodeClient{
+		ctx:        ctx,
+		node:       node,
+		httpClient: httpClient,
+	}
+}
+
+// post 请求远程面板接口，path 相对于节点地址，返回的 obj 解析到 result
+func (c *nodeClient) post(path string, form url.Values, result interface{}) error {
+	u := strings.TrimSuffix(c.node.Url, "/") + "/" + path
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if !c.node.IsAgent() {
+		req.Header.Set("Authorization", "Bearer "+c.node.Token)
+	}
+	// 未登录时远程面板返回 JSON 而不是重定向
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("节点返回 HTTP %d", resp.StatusCode)
+	}
+
+	msg := struct {
+		Success bool            `json:"success"`
+		Msg     string          `json:"msg"`
+		Obj     json.RawMessage `json:"obj"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return fmt.Errorf("节点返回的数据无效: %w", err)
+	}
+	if !msg.Success {
+		return errors.New(msg.Msg)
+	}
+	if result != nil && len(msg.Obj) > 0 {
+		return json.Unmarshal(msg.Obj, result)
+	}
+	return nil
+}
+
+// inboundForm 按远程面板添加和修改入站接口的表单格式编码入站
+func inboundForm(inbound *model.Inbound) url.Values {
+	form := url.Values{}
+	form.Set("up", strconv.FormatInt(inbound.Up, 10))
+	form.Set("down", strconv.FormatInt(inbound.Down, 10))
+	form.Set("total", strconv.FormatInt(inbound.Total, 10))
+	form.Set("remark", inbound.Remark)
+	form.Set("enable", strconv.FormatBool(inbound.Enable))
+	form.Set("expiryTime", strconv.FormatInt(inbound.ExpiryTime, 10))
+	form.Set("email", inbound.Email)
+	form.Set("listen", inbound.Listen)
+	form.Set("port", strconv.Itoa(inbound.Port))
+	form.Set("portRange", inbound.PortRange)
+	form.Set("protocol", string(inbound.Protocol))
+	form.Set("settings", inbound.Settings)
+	form.Set("streamSettings", inbound.StreamSettings)
+	form.Set("tag", inbound.Tag)
+	form.Set("sniffing", inbound.Sniffing)
+	return form
+}
+
+type NodeService struct {
+	ctx            context.Context
+	settingService SettingService
+	certService    CertService
+}
+
+func NewNodeService(ctx context.Context) *NodeService {
+	return &NodeService{
+		ctx: ctx,
+	}
+}
+
+func (s *NodeService) getContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// GetNodeCertPool 返回签发 agent 证书的私有CA，未设置时返回 nil
+func (s *NodeService) GetNodeCertPool() (*x509.CertPool, error) {
+	caName, err := s.settingService.GetNodeCaName()
+	if err != nil || caName == "" {
+		return nil, err
+	}
+	ca, err := s.certService.GetCertificateByName(caName)
+	if err != nil {
+		return nil, err
+	}
+	if ca.Source != CertSourceCA {
+		return nil, common.NewError("证书不是私有CA:", caName)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(ca.CertPem)) {
+		return nil, common.NewError("无效的CA证书:", caName)
+	}
+	return pool, nil
+}
+
+// nodeTLSConfig 访问 agent 节点的双向 TLS 配置，用私有CA校验 agent 并出示控制端的客户端证书
+func (s *NodeService) nodeTLSConfig() (*tls.Config, error) {
+	pool, err := s.GetNodeCertPool()
+	if err != nil {
+		return nil, err
+	}
+	certName, err := s.settingService.GetNodeCertName()
+	if err != nil {
+		return nil, err
+	}
+	if pool == nil || certName == "" {
+		return nil, errors.New("未设置节点CA和客户端证书，无法访问 agent 节点")
+	}
+	cert, err := s.certService.GetTLSCertificate(certName)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{*cert},
+	}, nil
+}
+
+// getClient 创建访问节点的客户端，agent 节点使用双向 TLS
+func (s *NodeService) getClient(node *model.Node) (*nodeClient, error) {
+	var tlsConfig *tls.Config
+	if node.IsAgent() {
+		var err error
+		tlsConfig, err = s.nodeTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newNodeClient(s.getContext(), node, tlsConfig), nil
+}
+
+func (s *NodeService) GetNodes() ([]*model.Node, error) {
+	db := database.GetDB()
+	nodes := make([]*model.Node, 0)
+	err := db.Model(model.Node{}).Find(&nodes).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+func (s *NodeService) GetNode(id int) (*model.Node, error) {
+	db := database.GetDB()
+	node := &model.Node{}
+	err := db.Model(model.Node{}).First(node, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func checkNode(node *model.Node) error {
+	if strings.TrimSpace(node.Name) == "" {
+		return errors.New("节点名称不能为空")
+	}
+	u, err := url.Parse(node.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return common.NewError("节点地址无效:", node.Url)
+	}
+	switch node.Mode {
+	case "", model.NodeModePanel:
+		node.Mode = model.NodeModePanel
+		if node.Token == "" {
+			return errors.New("节点 API Token 不能为空")
+		}
+	case model.NodeModeAgent:
+		if u.Scheme != "https" {
+			return common.NewError("agent 节点必须使用 https:", node.Url)
+		}
+	default:
+		return common.NewError("不支持的节点类型:", node.Mode)
+	}
+	return nil
+}
+
+func (s *NodeService) AddNode(node *model.Node) error {
+	if err := checkNode(node); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Create(node).Error
+}
+
+// UpdateNode 修改节点，Token 为空时保留原 Token
+func (s *NodeService) UpdateNode(node *model.Node) error {
+	oldNode, err := s.GetNode(node.Id)
+	if err != nil {
+		return err
+	}
+	oldNode.Name = node.Name
+	oldNode.Mode = node.Mode
+	oldNode.Url = node.Url
+	oldNode.Enable = node.Enable
+	if node.Token != "" {
+		oldNode.Token = node.Token
+	}
+	if err := checkNode(oldNode); err != nil {
+		return err
+	}
+	// 节点地址可能已经改变，旧的同步结果不再有效
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(oldNode).Error; err != nil {
+			return err
+		}
+		return deleteSnapshot(tx, oldNode.Id)
+	})
+}
+
+func (s *NodeService) DelNode(id int) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("node_id = ?", id).Delete(model.NodeTraffic{}).Error; err != nil {
+			return err
+		}
+		if err := deleteSnapshot(tx, id); err != nil {
+			return err
+		}
+		return tx.Delete(model.Node{}, id).Error
+	})
+}
+
+// SyncNode 拉取节点的状态和入站，并记录连通性、延迟和同步时间
+func (s *NodeService) SyncNode(node *model.Node) (*NodeSnapshot, error) {
+	snapshot := &NodeSnapshot{
+		NodeId: node.Id,
+	}
+	start := time.Now()
+	client, err := s.getClient(node)
+	if err == nil {
+		err = client.post("server/status", nil, &snapshot.Status)
+	}
+	latency := time.Since(start).Milliseconds()
+	if err == nil {
+		err = client.post("xui/inbound/list", nil, &snapshot.Inbounds)
+	}
+
+	node.Latency = latency
+	node.Online = err == nil
+	node.LastError = ""
+	if err != nil {
+		node.LastError = err.Error()
+	} else {
+		snapshot.SyncTime = time.Now().UnixMilli()
+		node.LastSync = snapshot.SyncTime
+	}
+	db := database.GetDB()
+	dbErr := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(node).Updates(map[string]interface{}{
+			"online":     node.Online,
+			"latency":    node.Latency,
+			"last_error": node.LastError,
+			"last_sync":  node.LastSync,
+		}).Error
+		if err != nil || !node.Online {
+			return err
+		}
+		// 保存同步结果，重启后节点列表仍能显示最近一次的状态和入站
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&model.NodeSnapshot{
+			NodeId:   node.Id,
+			Data:     string(data),
+			SyncTime: snapshot.SyncTime,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dbErr == nil {
+		nodeSnapshots.Store(node.Id, snapshot)
+	}
+	return snapshot, dbErr
+}
+
+// SyncNodes 并发同步所有启用的节点，返回同步失败的节点数
+func (s *NodeService) SyncNodes() (int, error) {
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for _, node := range nodes {
+		if !node.Enable {
+			continue
+		}
+		wg.Add(1)
+		go func(node *model.Node) {
+			defer wg.Done()
+			if _, err := s.SyncNode(node); err != nil {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}(node)
+	}
+	wg.Wait()
+	return failed, nil
+}
+
+// GetSnapshot 返回节点最近一次同步的数据，尚未同步过时立即同步
+func (s *NodeService) GetSnapshot(id int) (*NodeSnapshot, error) {
+	snapshot, err := loadSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		return snapshot, nil
+	}
+	node, err := s.GetNode(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.SyncNode(node)
+}
+
+// GetOverview 汇总所有节点的连通性、入站数量和流量
+func (s *NodeService) GetOverview() ([]*NodeOverview, error) {
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+	// agent 节点的流量以控制端记录的上报累计为准，拉取到的入站流量只是 agent 本机的计数
+	agentTraffics := make([]*model.NodeTraffic, 0)
+	db := database.GetDB()
+	err = db.Model(model.NodeTraffic{}).
+		Select("node_id, sum(up) as up, sum(down) as down").
+		Where("is_user = ?", false).
+		Group("node_id").
+		Scan(&agentTraffics).Error
+	if err != nil {
+		return nil, err
+	}
+	overviews := make([]*NodeOverview, 0, len(nodes))
+	for _, node := range nodes {
+		overview := &NodeOverview{Node: node}
+		snapshot, err := loadSnapshot(node.Id)
+		if err != nil {
+			logger.Warningf("读取节点 %v 的同步结果失败: %v", node.Name, err)
+		}
+		if snapshot != nil {
+			overview.Status = snapshot.Status
+			overview.Inbounds = len(snapshot.Inbounds)
+			if !node.IsAgent() {
+				for _, inbound := range snapshot.Inbounds {
+					overview.Up += inbound.Up
+					overview.Down += inbound.Down
+				}
+			}
+		}
+		if node.IsAgent() {
+			for _, traffic := range agentTraffics {
+				if traffic.NodeId == node.Id {
+					overview.Up = traffic.Up
+					overview.Down = traffic.Down
+				}
+			}
+		}
+		overviews = append(overviews, overview)
+	}
+	return overviews, nil
+}
+
+// resync 修改节点入站后刷新缓存，失败只影响节点状态
+func (s *NodeService) resync(node *model.Node) {
+	s.SyncNode(node)
+}
+
+// AddNodeInbound 在节点上创建入站，校验由节点完成
+func (s *NodeService) AddNodeInbound(id int, inbound *model.Inbound) error {
+	node, err := s.GetNode(id)
+	if err != nil {
+		return err
+	}
+	client, err := s.getClient(node)
+	if err != nil {
+		return err
+	}
+	if err := client.post("xui/inbound/add", inboundForm(inbound), nil); err != nil {
+		return err
+	}
+	s.resync(node)
+	return nil
+}
+
+// UpdateNodeInbound 修改节点上的入站，inbound.Id 为节点上的入站ID
+func (s *NodeService) UpdateNodeInbound(id int, inbound *model.Inbound) error {
+	node, err := s.GetNode(id)
+	if err != nil {
+		return err
+	}
+	client, err := s.getClient(node)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("xui/inbound/update/%d", inbound.Id)
+	if err := client.post(path, inboundForm(inbound), nil); err != nil {
+		return err
+	}
+	s.resync(node)
+	return nil
+}
+
+func (s *NodeService) DelNodeInbound(id int, inboundId int) error {
+	node, err := s.GetNode(id)
+	if err != nil {
+		return err
+	}
+	client, err := s.getClient(node)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("xui/inbound/del/%d", inboundId)
+	if err := client.post(path, nil, nil); err != nil {
+		return err
+	}
+	s.resync(node)
+	return nil
+}
+
+// SetNodeInbounds 向 agent 节点下发完整的入站集合，agent 按 tag 保留已有入站的流量并删除集合外的入站
+func (s *NodeService) SetNodeInbounds(id int, inbounds []*model.Inbound) error {
+	node, err := s.GetNode(id)
+	if err != nil {
+		return err
+	}
+	if !node.IsAgent() {
+		return common.NewError("只有 agent 节点支持下发入站集合:", node.Name)
+	}
+	data, err := json.Marshal(inbounds)
+	if err != nil {
+		return err
+	}
+	client, err := s.getClient(node)
+	if err != nil {
+		return err
+	}
+	form := url.Values{}
+	form.Set("inbounds", string(data))
+	if err := client.post("agent/inbounds", form, nil); err != nil {
+		return err
+	}
+	s.resync(node)
+	return nil
+}
+
+// GetAgentNode 按客户端证书的 CommonName 查找启用的 agent 节点
+func (s *NodeService) GetAgentNode(name string) (*model.Node, error) {
+	db := database.GetDB()
+	node := &model.Node{}
+	err := db.Model(model.Node{}).
+		Where("name = ? and mode = ? and enable = ?", name, model.NodeModeAgent, true).
+		First(node).Error
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// AddAgentTraffic 在一个事务中累加 agent 上报的流量增量，并把节点记为在线
+//
+// seq 由 agent 为每批增量分配且单调递增，不大于已记录序号的批次是超时后的重试，只确认不累加
+func (s *NodeService) AddAgentTraffic(node *model.Node, seq int64, traffics []*xray.Traffic) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		current := &model.Node{}
+		if err := tx.Model(model.Node{}).Select("traffic_seq").First(current, node.Id).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"online":     true,
+			"last_error": "",
+			"last_sync":  time.Now().UnixMilli(),
+		}
+		if seq > current.TrafficSeq {
+			for _, traffic := range traffics {
+				if !traffic.IsInbound && !traffic.IsUser {
+					continue
+				}
+				tag := traffic.Tag
+				if traffic.IsInbound {
+					tag = model.BaseInboundTag(tag)
+				}
+				err := tx.Clauses(clause.OnConflict{
+					Columns: []clause.Column{{Name: "node_id"}, {Name: "is_user"}, {Name: "tag"}},
+					DoUpdates: clause.Assignments(map[string]interface{}{
+						"up":   gorm.Expr("up + ?", traffic.Up),
+						"down": gorm.Expr("down + ?", traffic.Down),
+					}),
+				}).Create(&model.NodeTraffic{
+					NodeId: node.Id,
+					IsUser: traffic.IsUser,
+					Tag:    tag,
+					Up:     traffic.Up,
+					Down:   traffic.Down,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			updates["traffic_seq"] = seq
+		}
+		return tx.Model(node).Updates(updates).Error
+	})
+}
+
+// GetNodeTraffics 返回 agent 节点上报的入站和客户端累计流量
+func (s *NodeService) GetNodeTraffics(id int) ([]*model.NodeTraffic, error) {
+	db := database.GetDB()
+	traffics := make([]*model.NodeTraffic, 0)
+	err := db.Model(model.NodeTraffic{}).Where("node_id = ?", id).Order("is_user, tag").Find(&traffics).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return traffics, nil
+}
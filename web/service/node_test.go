@@ -0,0 +1,138 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+// newPanelServer 模拟远程面板的状态和入站列表接口，校验 API Token
+func newPanelServer(t *testing.T, token string, cpu float64, inbounds []*model.Inbound) *httptest.Server {
+	t.Helper()
+	reply := func(w http.ResponseWriter, obj interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "obj": obj})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/server/status", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, &Status{Cpu: cpu})
+	})
+	mux.HandleFunc("/xui/inbound/list", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, inbounds)
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// clearSnapshotCache 清空内存中的同步结果，模拟面板重启
+func clearSnapshotCache() {
+	nodeSnapshots.Range(func(key, value interface{}) bool {
+		nodeSnapshots.Delete(key)
+		return true
+	})
+}
+
+func TestSyncTwoNodes(t *testing.T) {
+	initTestDB(t)
+	t.Cleanup(clearSnapshotCache)
+
+	servers := []*httptest.Server{
+		newPanelServer(t, "token-a", 10, []*model.Inbound{
+			{Id: 1, Tag: "inbound-1", Up: 100, Down: 200},
+			{Id: 2, Tag: "inbound-2", Up: 1, Down: 2},
+		}),
+		newPanelServer(t, "token-b", 20, []*model.Inbound{
+			{Id: 1, Tag: "inbound-1", Up: 1000, Down: 2000},
+		}),
+	}
+	s := &NodeService{}
+	nodes := []*model.Node{
+		{Name: "a", Url: servers[0].URL + "/", Token: "token-a", Enable: true},
+		{Name: "b", Url: servers[1].URL + "/", Token: "token-b", Enable: true},
+	}
+	for _, node := range nodes {
+		if err := s.AddNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failed, err := s.SyncNodes()
+	if err != nil || failed != 0 {
+		t.Fatalf("同步节点失败: %d 个, %v", failed, err)
+	}
+
+	type want struct {
+		cpu      float64
+		inbounds int
+		up, down int64
+	}
+	wants := map[string]want{
+		"a": {10, 2, 101, 202},
+		"b": {20, 1, 1000, 2000},
+	}
+	check := func() {
+		t.Helper()
+		overviews, err := s.GetOverview()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(overviews) != len(wants) {
+			t.Fatalf("节点数为 %d，期望 %d", len(overviews), len(wants))
+		}
+		for _, overview := range overviews {
+			w := wants[overview.Name]
+			if !overview.Online || overview.LastSync == 0 {
+				t.Errorf("节点 %v 未记录为在线: %+v", overview.Name, overview.Node)
+			}
+			if overview.Status == nil || overview.Status.Cpu != w.cpu {
+				t.Errorf("节点 %v 的状态为 %+v，期望 cpu %v", overview.Name, overview.Status, w.cpu)
+			}
+			if overview.Inbounds != w.inbounds || overview.Up != w.up || overview.Down != w.down {
+				t.Errorf("节点 %v 的汇总为 %d/%d/%d，期望 %d/%d/%d", overview.Name,
+					overview.Inbounds, overview.Up, overview.Down, w.inbounds, w.up, w.down)
+			}
+		}
+	}
+	check()
+
+	// 关闭节点并清空缓存后，仍能从数据库读到最近一次同步的结果
+	for _, server := range servers {
+		server.Close()
+	}
+	clearSnapshotCache()
+	check()
+	snapshot, err := s.GetSnapshot(nodes[1].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Inbounds) != 1 || snapshot.Inbounds[0].Up != 1000 {
+		t.Errorf("节点 b 的入站为 %+v", snapshot.Inbounds)
+	}
+
+	// 同步失败不覆盖已保存的结果
+	if _, err := s.SyncNode(nodes[0]); err == nil {
+		t.Fatal("节点已关闭时同步应失败")
+	}
+	clearSnapshotCache()
+	if snapshot, err := loadSnapshot(nodes[0].Id); err != nil || snapshot == nil || len(snapshot.Inbounds) != 2 {
+		t.Errorf("同步失败后保存的结果为 %+v, %v", snapshot, err)
+	}
+
+	if err := s.DelNode(nodes[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	database.GetDB().Model(model.NodeSnapshot{}).Where("node_id = ?", nodes[0].Id).Count(&count)
+	if count != 0 {
+		t.Errorf("删除节点后仍保存了 %d 条同步结果", count)
+	}
+}
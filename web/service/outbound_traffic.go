@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 出站每小时流量的保留天数
+const outboundHistoryDays = 30
+
+// OutboundTrafficSummary 单个出站的累计流量
+type OutboundTrafficSummary struct {
+	Tag      string `json:"tag"`
+	Protocol string `json:"protocol"` // 已从配置中删除的出站为空
+	Category string `json:"category"`
+	Up       int64  `json:"up"`
+	Down     int64  `json:"down"`
+}
+
+// TrafficTotal 上传和下载流量合计
+type TrafficTotal struct {
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+// OutboundTrafficOverview 各出站及直连、阻断、代理三类出站的累计流量
+type OutboundTrafficOverview struct {
+	Outbounds  []*OutboundTrafficSummary `json:"outbounds"`
+	Categories map[string]*TrafficTotal  `json:"categories"`
+}
+
+// addOutboundTraffic 在累加流量日志的事务中累加出站的总流量和所在小时的流量
+func addOutboundTraffic(tx *gorm.DB, journal *model.TrafficJournal) error {
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "tag"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"up":   gorm.Expr("up + ?", journal.Up),
+			"down": gorm.Expr("down + ?", journal.Down),
+		}),
+	}).Create(&model.OutboundTraffic{
+		Tag:  journal.Tag,
+		Up:   journal.Up,
+		Down: journal.Down,
+	}).Error
+	if err != nil {
+		return err
+	}
+	hour := time.UnixMilli(journal.CreatedAt).Truncate(time.Hour).UnixMilli()
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "tag"}, {Name: "hour"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"up":   gorm.Expr("up + ?", journal.Up),
+			"down": gorm.Expr("down + ?", journal.Down),
+		}),
+	}).Create(&model.OutboundTrafficHistory{
+		Tag:  journal.Tag,
+		Hour: hour,
+		Up:   journal.Up,
+		Down: journal.Down,
+	}).Error
+}
+
+type OutboundTrafficService struct {
+	ctx            context.Context
+	settingService SettingService
+}
+
+func NewOutboundTrafficService(ctx context.Context) *OutboundTrafficService {
+	return &OutboundTrafficService{
+		ctx: ctx,
+	}
+}
+
+// getTemplateOutbounds 按生成 xray 配置时的规则读取模板中的出站
+func (s *OutboundTrafficService) getTemplateOutbounds() ([]*xray.Outbound, error) {
+	template, err := s.settingService.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, err
+	}
+	config := &xray.Config{}
+	if err := json.Unmarshal([]byte(template), config); err != nil {
+		return nil, err
+	}
+	if err := config.TagOutbounds(); err != nil {
+		return nil, err
+	}
+	return config.GetOutbounds()
+}
+
+// getOutbounds 获取生成的 xray 配置中的出站，包括模板中的出站和面板管理的 WireGuard 出站
+func (s *OutboundTrafficService) getOutbounds() ([]*xray.Outbound, error) {
+	outbounds, err := s.getTemplateOutbounds()
+	if err != nil {
+		return nil, err
+	}
+	managedOutbounds, err := getManagedOutbounds()
+	if err != nil {
+		return nil, err
+	}
+	return append(outbounds, managedOutbounds...), nil
+}
+
+// GetOverview 汇总所有出站的累计流量，配置中尚无流量的出站也会列出
+func (s *OutboundTrafficService) GetOverview() (*OutboundTrafficOverview, error) {
+	db := database.GetDB()
+	var traffics []*model.OutboundTraffic
+	err := db.Model(model.OutboundTraffic{}).Find(&traffics).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	outbounds, err := s.getOutbounds()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := map[string]*OutboundTrafficSummary{}
+	for _, outbound := range outbounds {
+		summaries[outbound.Tag] = &OutboundTrafficSummary{
+			Tag:      outbound.Tag,
+			Protocol: outbound.Protocol,
+			Category: xray.OutboundCategory(outbound.Protocol),
+		}
+	}
+	for _, traffic := range traffics {
+		summary, ok := summaries[traffic.Tag]
+		if !ok {
+			summary = &OutboundTrafficSummary{
+				Tag:      traffic.Tag,
+				Category: xray.OutboundCategoryProxy,
+			}
+			summaries[traffic.Tag] = summary
+		}
+		summary.Up = traffic.Up
+		summary.Down = traffic.Down
+	}
+
+	overview := &OutboundTrafficOverview{
+		Outbounds: make([]*OutboundTrafficSummary, 0, len(summaries)),
+		Categories: map[string]*TrafficTotal{
+			xray.OutboundCategoryDirect:  {},
+			xray.OutboundCategoryBlocked: {},
+			xray.OutboundCategoryProxy:   {},
+		},
+	}
+	for _, summary := range summaries {
+		overview.Outbounds = append(overview.Outbounds, summary)
+		total := overview.Categories[summary.Category]
+		total.Up += summary.Up
+		total.Down += summary.Down
+	}
+	sort.Slice(overview.Outbounds, func(i, j int) bool {
+		a, b := overview.Outbounds[i], overview.Outbounds[j]
+		return a.Up+a.Down > b.Up+b.Down
+	})
+	return overview, nil
+}
+
+// GetHistory 获取出站最近 hours 小时的每小时流量，tag 为空时返回所有出站
+func (s *OutboundTrafficService) GetHistory(tag string, hours int) ([]*model.OutboundTrafficHistory, error) {
+	if hours <= 0 || hours > outboundHistoryDays*24 {
+		hours = 24
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour).Truncate(time.Hour).UnixMilli()
+	db := database.GetDB()
+	query := db.Model(model.OutboundTrafficHistory{}).Where("hour >= ?", since)
+	if tag != "" {
+		query = query.Where("tag = ?", tag)
+	}
+	histories := make([]*model.OutboundTrafficHistory, 0)
+	err := query.Order("hour").Find(&histories).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return histories, nil
+}
+
+// ResetTraffic 清空出站的累计流量和历史，tag 为空时清空所有出站
+func (s *OutboundTrafficService) ResetTraffic(tag string) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		traffic := tx.Where("1 = 1")
+		history := tx.Where("1 = 1")
+		if tag != "" {
+			traffic = tx.Where("tag = ?", tag)
+			history = tx.Where("tag = ?", tag)
+		}
+		if err := traffic.Delete(model.OutboundTraffic{}).Error; err != nil {
+			return err
+		}
+		return history.Delete(model.OutboundTrafficHistory{}).Error
+	})
+}
+
+// PruneHistory 删除超过保留期的每小时流量
+func (s *OutboundTrafficService) PruneHistory() (int64, error) {
+	before := time.Now().AddDate(0, 0, -outboundHistoryDays).UnixMilli()
+	db := database.GetDB()
+	result := db.Where("hour < ?", before).Delete(model.OutboundTrafficHistory{})
+	return result.RowsAffected, result.Error
+}
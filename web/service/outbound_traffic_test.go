@@ -0,0 +1,209 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/xray"
+)
+
+func checkOutboundTraffic(t *testing.T, tag string, up int64, down int64) {
+	t.Helper()
+	traffic := &model.OutboundTraffic{}
+	if err := database.GetDB().Where("tag = ?", tag).First(traffic).Error; err != nil {
+		t.Fatalf("读取出站 %v 流量失败: %v", tag, err)
+	}
+	if traffic.Up != up || traffic.Down != down {
+		t.Fatalf("出站 %v 流量为 %d/%d，应为 %d/%d", tag, traffic.Up, traffic.Down, up, down)
+	}
+}
+
+func addTestJournal(t *testing.T, tag string, up int64, down int64, createdAt time.Time) {
+	t.Helper()
+	journal := &model.TrafficJournal{Tag: tag, Up: up, Down: down, CreatedAt: createdAt.UnixMilli()}
+	if err := database.GetDB().Create(journal).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutboundTrafficPersistence(t *testing.T) {
+	s := initTrafficTest(t, "in-a")
+	source := &fakeTrafficSource{counters: map[string]*xray.Traffic{
+		"in-a":   {IsInbound: true, Tag: "in-a", Up: 1, Down: 2},
+		"direct": {Tag: "direct", Up: 10, Down: 20},
+		"proxy":  {Tag: "proxy", Up: 100, Down: 200},
+	}}
+	if err := s.journalTraffic(source); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.inboundService.ApplyTrafficJournal(); err != nil {
+		t.Fatal(err)
+	}
+	checkInboundTraffic(t, "in-a", 1, 2)
+	checkOutboundTraffic(t, "direct", 10, 20)
+	checkOutboundTraffic(t, "proxy", 100, 200)
+
+	// 再次读取时累加增量，重复累加日志不会重复计数
+	source.counters["proxy"].Up += 5
+	source.counters["proxy"].Down += 6
+	if err := s.journalTraffic(source); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.inboundService.ApplyTrafficJournal(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkOutboundTraffic(t, "direct", 10, 20)
+	checkOutboundTraffic(t, "proxy", 105, 206)
+	if count := countJournals(t); count != 0 {
+		t.Fatalf("累加后剩余 %d 条流量日志", count)
+	}
+}
+
+func TestOutboundTrafficHourlyRollup(t *testing.T) {
+	initTrafficTest(t)
+	inboundService := &InboundService{}
+	hour := time.Now().Truncate(time.Hour).Add(-2 * time.Hour)
+	addTestJournal(t, "proxy", 1, 2, hour.Add(10*time.Minute))
+	addTestJournal(t, "proxy", 3, 4, hour.Add(59*time.Minute))
+	addTestJournal(t, "proxy", 5, 6, hour.Add(time.Hour))
+	addTestJournal(t, "direct", 7, 8, hour.Add(time.Hour+30*time.Minute))
+	if _, err := inboundService.ApplyTrafficJournal(); err != nil {
+		t.Fatal(err)
+	}
+	// 之后的统计累加到已有的小时
+	addTestJournal(t, "proxy", 10, 10, hour.Add(time.Hour+5*time.Minute))
+	if _, err := inboundService.ApplyTrafficJournal(); err != nil {
+		t.Fatal(err)
+	}
+	checkOutboundTraffic(t, "proxy", 19, 22)
+
+	s := &OutboundTrafficService{}
+	histories, err := s.GetHistory("proxy", 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.OutboundTrafficHistory{
+		{Tag: "proxy", Hour: hour.UnixMilli(), Up: 4, Down: 6},
+		{Tag: "proxy", Hour: hour.Add(time.Hour).UnixMilli(), Up: 15, Down: 16},
+	}
+	if len(histories) != len(want) {
+		t.Fatalf("proxy 有 %d 个小时的流量，应为 %d 个", len(histories), len(want))
+	}
+	for i, w := range want {
+		got := histories[i]
+		if got.Tag != w.Tag || got.Hour != w.Hour || got.Up != w.Up || got.Down != w.Down {
+			t.Fatalf("第 %d 个小时为 %+v，应为 %+v", i, got, w)
+		}
+	}
+
+	all, err := s.GetHistory("", 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("所有出站共 %d 个小时的流量，应为 3 个", len(all))
+	}
+	// 只取最近一小时时不包含更早的记录
+	recent, err := s.GetHistory("proxy", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 1 || recent[0].Hour != hour.Add(time.Hour).UnixMilli() {
+		t.Fatalf("最近一小时的流量为 %+v", recent)
+	}
+}
+
+func TestPruneOutboundHistory(t *testing.T) {
+	initTrafficTest(t)
+	now := time.Now()
+	addTestJournal(t, "proxy", 1, 1, now.AddDate(0, 0, -outboundHistoryDays-1))
+	addTestJournal(t, "proxy", 2, 2, now.AddDate(0, 0, -outboundHistoryDays+1))
+	addTestJournal(t, "proxy", 3, 3, now)
+	if _, err := (&InboundService{}).ApplyTrafficJournal(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &OutboundTrafficService{}
+	count, err := s.PruneHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("删除了 %d 条历史，应为 1 条", count)
+	}
+	var remaining int64
+	if err := database.GetDB().Model(model.OutboundTrafficHistory{}).Count(&remaining).Error; err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 2 {
+		t.Fatalf("剩余 %d 条历史，应为 2 条", remaining)
+	}
+	// 清理历史不影响累计流量
+	checkOutboundTraffic(t, "proxy", 6, 6)
+}
+
+func TestOutboundTrafficOverviewAndReset(t *testing.T) {
+	initTrafficTest(t)
+	now := time.Now()
+	addTestJournal(t, "direct", 10, 20, now)
+	addTestJournal(t, "blocked", 1, 0, now)
+	addTestJournal(t, "removed-proxy", 100, 200, now)
+	if _, err := (&InboundService{}).ApplyTrafficJournal(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &OutboundTrafficService{}
+	overview, err := s.GetOverview()
+	if err != nil {
+		t.Fatal(err)
+	}
+	summaries := map[string]*OutboundTrafficSummary{}
+	for _, summary := range overview.Outbounds {
+		summaries[summary.Tag] = summary
+	}
+	// 按流量从大到小排序，已从配置中删除的出站也会列出
+	if overview.Outbounds[0].Tag != "removed-proxy" || summaries["removed-proxy"].Protocol != "" {
+		t.Fatalf("出站流量为 %+v", overview.Outbounds[0])
+	}
+	if summaries["direct"] == nil || summaries["direct"].Protocol != "freedom" || summaries["blocked"] == nil {
+		t.Fatalf("模板中的出站没有列出: %v", summaries)
+	}
+	categories := map[string]TrafficTotal{
+		xray.OutboundCategoryDirect:  {Up: 10, Down: 20},
+		xray.OutboundCategoryBlocked: {Up: 1, Down: 0},
+		xray.OutboundCategoryProxy:   {Up: 100, Down: 200},
+	}
+	for category, want := range categories {
+		if got := overview.Categories[category]; *got != want {
+			t.Fatalf("%v 类出站流量为 %+v，应为 %+v", category, got, want)
+		}
+	}
+
+	if err := s.ResetTraffic("removed-proxy"); err != nil {
+		t.Fatal(err)
+	}
+	histories, err := s.GetHistory("", 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, history := range histories {
+		if history.Tag == "removed-proxy" {
+			t.Fatal("重置后仍有 removed-proxy 的历史")
+		}
+	}
+	checkOutboundTraffic(t, "direct", 10, 20)
+
+	if err := s.ResetTraffic(""); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := database.GetDB().Model(model.OutboundTraffic{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("全部重置后剩余 %d 个出站的流量", count)
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/sys"
+	"x-ui/xray"
+)
+
+// inboundNetworks 入站实际占用的传输层协议
+func inboundNetworks(inbound *model.Inbound) (tcp bool, udp bool) {
+	if inbound.Protocol == model.WireGuard {
+		return false, true
+	}
+	settings, err := inbound.GetSettings()
+	if err == nil {
+		switch settings := settings.(type) {
+		case *xray.ShadowsocksSettings:
+			return settings.Network == "" || strings.Contains(settings.Network, "tcp"), strings.Contains(settings.Network, "udp")
+		case *xray.DokodemoSettings:
+			return settings.Network == "" || strings.Contains(settings.Network, "tcp"), strings.Contains(settings.Network, "udp")
+		case *xray.SocksSettings:
+			return true, settings.UDP
+		}
+	}
+	stream, err := inbound.GetStreamSettings()
+	if err == nil {
+		switch stream.GetNetwork() {
+		case "kcp", "quic":
+			return false, true
+		}
+	}
+	return true, false
+}
+
+func portsContain(ports []xray.PortRange, port int) bool {
+	return xray.PortListsOverlap(ports, []xray.PortRange{{From: port, To: port}})
+}
+
+// runningXrayPorts 正在运行的 xray 占用的端口，这些套接字由 xray 持有，不算作冲突
+func runningXrayPorts() (int, []xray.PortRange) {
+	lock.Lock()
+	defer lock.Unlock()
+	if p == nil || !p.IsRunning() {
+		return 0, nil
+	}
+	ports := make([]xray.PortRange, 0)
+	for _, inbound := range p.GetConfig().InboundConfigs {
+		if inboundPorts, err := inbound.GetPorts(); err == nil {
+			ports = append(ports, inboundPorts...)
+		}
+	}
+	return p.GetPid(), ports
+}
+
+// checkHostPorts 检查入站端口是否与面板监听、模板中的入站或主机上其他进程冲突
+func (s *InboundService) checkHostPorts(inbound *model.Inbound) error {
+	listens := make([]string, 0)
+	for _, listen := range inbound.GetListens() {
+		if !model.IsUnixListen(listen) {
+			listens = append(listens, listen)
+		}
+	}
+	// 只监听 Unix domain socket 时没有端口
+	if len(listens) == 0 {
+		return nil
+	}
+	ports, err := inbound.GetPorts()
+	if err != nil {
+		return err
+	}
+	useTCP, useUDP := inboundNetworks(inbound)
+
+	webListen, _ := s.settingService.GetListen()
+	webPort, _ := s.settingService.GetPort()
+	for _, listen := range listens {
+		if useTCP && listensOverlap(webListen, listen) && portsContain(ports, webPort) {
+			return common.NewError("端口与面板端口冲突:", webPort)
+		}
+	}
+
+	if template, err := s.settingService.GetXrayConfigTemplate(); err == nil {
+		config := &xray.Config{}
+		if err := json.Unmarshal([]byte(template), config); err == nil {
+			for _, templateInbound := range config.InboundConfigs {
+				templatePorts, err := templateInbound.GetPorts()
+				if err != nil || !xray.PortListsOverlap(ports, templatePorts) {
+					continue
+				}
+				for _, listen := range listens {
+					if listensOverlap(templateInbound.GetListen(), listen) {
+						return common.NewError("端口与 xray 模板中的入站冲突:", templateInbound.Tag)
+					}
+				}
+			}
+		}
+	}
+
+	sockets, err := sys.GetListenSockets()
+	if err != nil {
+		logger.Warning("获取主机监听端口失败:", err)
+		return nil
+	}
+	xrayPid, xrayPorts := runningXrayPorts()
+	for _, socket := range sockets {
+		if (socket.Network == "tcp" && !useTCP) || (socket.Network == "udp" && !useUDP) {
+			continue
+		}
+		if !portsContain(ports, socket.Port) {
+			continue
+		}
+		if socket.Pid == os.Getpid() || (xrayPid > 0 && socket.Pid == xrayPid) {
+			continue
+		}
+		// 无权限确定所属进程时，xray 已占用的端口视为 xray 自身
+		if socket.Pid == 0 && portsContain(xrayPorts, socket.Port) {
+			continue
+		}
+		for _, listen := range listens {
+			if listensOverlap(socket.IP.String(), listen) {
+				return common.NewError("端口已被占用:", socket.String())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/xray"
+)
+
+func newPortCheckInbound(listen string, port int, portRange string) *model.Inbound {
+	return &model.Inbound{
+		Listen:    listen,
+		Port:      port,
+		PortRange: portRange,
+		Protocol:  model.Socks,
+		Settings:  `{"auth":"noauth"}`,
+	}
+}
+
+func TestPortListsOverlap(t *testing.T) {
+	cases := []struct {
+		a    string
+		b    string
+		want bool
+	}{
+		{"443", "443", true},
+		{"443", "444", false},
+		{"1000-2000", "2000", true},
+		{"1000-2000", "2001-3000", false},
+		{"1000-2000", "1500-1600", true},
+		{"80,443", "81-442", false},
+		{"80,443,1000-2000", "1999-2100", true},
+	}
+	for _, c := range cases {
+		a, err := xray.ParsePortList(c.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := xray.ParsePortList(c.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := xray.PortListsOverlap(a, b); got != c.want {
+			t.Fatalf("%v 与 %v 重叠为 %v，期望 %v", c.a, c.b, got, c.want)
+		}
+		if got := xray.PortListsOverlap(b, a); got != c.want {
+			t.Fatalf("%v 与 %v 重叠为 %v，期望 %v", c.b, c.a, got, c.want)
+		}
+	}
+}
+
+func TestCheckHostPorts(t *testing.T) {
+	initTestDB(t)
+	s := &InboundService{}
+	if err := s.settingService.setString("webListen", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.settingService.SetPort(54321); err != nil {
+		t.Fatal(err)
+	}
+
+	udpOnly := newPortCheckInbound("", 54321, "")
+	udpOnly.Protocol = model.Dokodemo
+	udpOnly.Settings = `{"address":"127.0.0.1","port":53,"network":"udp"}`
+	cases := []struct {
+		name    string
+		inbound *model.Inbound
+		// 期望的错误前缀，为空时期望没有冲突
+		want string
+	}{
+		{"与面板端口相同", newPortCheckInbound("", 54321, ""), "端口与面板端口冲突"},
+		{"端口范围包含面板端口", newPortCheckInbound("127.0.0.1", 54000, "54000-55000"), "端口与面板端口冲突"},
+		{"面板端口但监听地址不同", newPortCheckInbound("127.0.0.2", 54321, ""), ""},
+		{"面板端口但只使用 UDP", udpOnly, ""},
+		{"与模板中的 api 入站相同", newPortCheckInbound("", 62789, ""), "端口与 xray 模板中的入站冲突: api"},
+		{"端口范围包含模板端口", newPortCheckInbound("127.0.0.1", 62000, "62000-63000"), "端口与 xray 模板中的入站冲突: api"},
+		{"模板端口但监听地址不同", newPortCheckInbound("127.0.0.2", 62789, ""), ""},
+		{"Unix domain socket", newPortCheckInbound("/run/x-ui-test.sock", 0, ""), ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := s.checkHostPorts(c.inbound)
+			if c.want == "" {
+				if err != nil {
+					t.Fatalf("返回 %v，期望没有冲突", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), c.want) {
+				t.Fatalf("返回 %v，期望 %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestCheckConflictPortRange(t *testing.T) {
+	initTestDB(t)
+	s := &InboundService{}
+	existing := newPortCheckInbound("", 20000, "20000-20010")
+	existing.Tag = "inbound-20000"
+	if err := database.GetDB().Create(existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		inbound  *model.Inbound
+		conflict bool
+	}{
+		{"范围内的单个端口", newPortCheckInbound("", 20005, ""), true},
+		{"范围部分重叠", newPortCheckInbound("", 20010, "20010-20020"), true},
+		{"范围相邻", newPortCheckInbound("", 20011, "20011-20020"), false},
+		{"指定地址与全部地址重叠", newPortCheckInbound("127.0.0.1", 20000, ""), true},
+		{"范围外的端口", newPortCheckInbound("", 19999, ""), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := s.checkConflict(c.inbound, nil)
+			if c.conflict && (err == nil || !strings.HasPrefix(err.Error(), "监听地址和端口与入站冲突")) {
+				t.Fatalf("返回 %v，期望与已有入站冲突", err)
+			}
+			if !c.conflict && err != nil && strings.HasPrefix(err.Error(), "监听地址和端口与入站冲突") {
+				t.Fatalf("返回 %v，期望不冲突", err)
+			}
+		})
+	}
+
+	// 本次一并添加的入站之间也要检查
+	err := s.checkConflict(newPortCheckInbound("", 30005, ""), []*model.Inbound{newPortCheckInbound("", 30000, "30000-30010")})
+	if err == nil || !strings.HasPrefix(err.Error(), "监听地址和端口与入站冲突") {
+		t.Fatalf("与同批入站冲突时返回 %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/keygen"
+	"x-ui/xray"
+)
+
+const (
+	realityProbeTimeout = 10 * time.Second
+	realityDefaultFlow  = "xtls-rprx-vision"
+)
+
+// DestProbeResult 对 Reality dest 的探测结果
+type DestProbeResult struct {
+	Dest       string   `json:"dest"`
+	ServerName string   `json:"serverName"`
+	TLSVersion string   `json:"tlsVersion"`
+	ALPN       string   `json:"alpn"`
+	DNSNames   []string `json:"dnsNames"`
+	// 不满足 Reality 要求的原因，为空表示可用
+	Problems []string `json:"problems"`
+}
+
+func (r *DestProbeResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// DestProbe 与 dest 建立 TLS 连接并返回协商结果，测试时可替换为连接本地 TLS 服务器的实现
+type DestProbe interface {
+	Probe(ctx context.Context, dest string, serverName string) (*tls.ConnectionState, error)
+}
+
+// TLSDestProbe 默认的探测实现，只关心协商参数，不校验证书链
+type TLSDestProbe struct {
+	Timeout time.Duration
+}
+
+func (p *TLSDestProbe) Probe(ctx context.Context, dest string, serverName string) (*tls.ConnectionState, error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = realityProbeTimeout
+	}
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: timeout},
+		Config: &tls.Config{
+			ServerName:         serverName,
+			NextProtos:         []string{"h2", "http/1.1"},
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: true,
+		},
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", dest)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	state := conn.(*tls.Conn).ConnectionState()
+	return &state, nil
+}
+
+// RealityInboundOptions Reality 入站向导的参数
+type RealityInboundOptions struct {
+	Remark string `json:"remark" form:"remark"`
+	Listen string `json:"listen" form:"listen"`
+	Port   int    `json:"port" form:"port"`
+	// 目标网站，host:port，端口默认443
+	Dest string `json:"dest" form:"dest"`
+	// 逗号分隔，默认使用 dest 的域名
+	ServerNames  string `json:"serverNames" form:"serverNames"`
+	Fingerprint  string `json:"fingerprint" form:"fingerprint"`
+	ShortIdCount int    `json:"shortIdCount" form:"shortIdCount"`
+	Email        string `json:"email" form:"email"`
+	Total        int64  `json:"total" form:"total"`
+	ExpiryTime   int64  `json:"expiryTime" form:"expiryTime"`
+	// 跳过 dest 探测，用于离线环境
+	SkipProbe bool `json:"skipProbe" form:"skipProbe"`
+}
+
+type RealityService struct {
+	ctx            context.Context
+	inboundService InboundService
+	probe          DestProbe
+}
+
+func NewRealityService(ctx context.Context) *RealityService {
+	return &RealityService{
+		ctx: ctx,
+	}
+}
+
+// SetDestProbe 替换 dest 探测实现
+func (s *RealityService) SetDestProbe(probe DestProbe) {
+	s.probe = probe
+}
+
+func (s *RealityService) getProbe() DestProbe {
+	if s.probe == nil {
+		return &TLSDestProbe{}
+	}
+	return s.probe
+}
+
+func (s *RealityService) getContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// normalizeDest 补全 dest 端口，返回 dest 和其中的域名
+func normalizeDest(dest string) (string, string, error) {
+	dest = strings.TrimSpace(dest)
+	if dest == "" {
+		return "", "", errors.New("dest 不能为空")
+	}
+	host, port, err := net.SplitHostPort(dest)
+	if err != nil {
+		host = dest
+		port = "443"
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", "", common.NewError("dest 端口无效:", dest)
+	}
+	return net.JoinHostPort(host, port), host, nil
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS13:
+		return "TLS1.3"
+	case tls.VersionTLS12:
+		return "TLS1.2"
+	case tls.VersionTLS11:
+		return "TLS1.1"
+	case tls.VersionTLS10:
+		return "TLS1.0"
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// ProbeDest 检查 dest 是否支持 TLS1.3、h2，且证书包含所有 serverNames
+func (s *RealityService) ProbeDest(dest string, serverNames []string) (*DestProbeResult, error) {
+	dest, host, err := normalizeDest(dest)
+	if err != nil {
+		return nil, err
+	}
+	serverNames = splitDomains(strings.Join(serverNames, ","))
+	if len(serverNames) == 0 {
+		serverNames = []string{host}
+	}
+	result := &DestProbeResult{
+		Dest:       dest,
+		ServerName: serverNames[0],
+		Problems:   make([]string, 0),
+	}
+	state, err := s.getProbe().Probe(s.getContext(), dest, serverNames[0])
+	if err != nil {
+		result.Problems = append(result.Problems, fmt.Sprintf("TLS连接失败: %v", err))
+		return result, nil
+	}
+	result.TLSVersion = tlsVersionName(state.Version)
+	result.ALPN = state.NegotiatedProtocol
+	if state.Version != tls.VersionTLS13 {
+		result.Problems = append(result.Problems, "不支持TLS1.3: "+result.TLSVersion)
+	}
+	if state.NegotiatedProtocol != "h2" {
+		result.Problems = append(result.Problems, "不支持h2")
+	}
+	if len(state.PeerCertificates) == 0 {
+		result.Problems = append(result.Problems, "未返回证书")
+		return result, nil
+	}
+	leaf := state.PeerCertificates[0]
+	result.DNSNames = leaf.DNSNames
+	for _, name := range serverNames {
+		if err := leaf.VerifyHostname(name); err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("证书不包含 %v", name))
+		}
+	}
+	return result, nil
+}
+
+// BuildRealityStreamSettings 生成完整的 Reality StreamSettings，返回 JSON 和客户端使用的公钥
+//
+// serverNames 为空时使用 dest 的域名
+func BuildRealityStreamSettings(dest string, serverNames []string, fingerprint string, shortIdCount int) (string, string, error) {
+	serverNames = splitDomains(strings.Join(serverNames, ","))
+	if len(serverNames) == 0 {
+		_, host, err := normalizeDest(dest)
+		if err != nil {
+			return "", "", err
+		}
+		serverNames = []string{host}
+	}
+	privateKey, publicKey, err := keygen.GenerateX25519()
+	if err != nil {
+		return "", "", err
+	}
+	if shortIdCount <= 0 {
+		shortIdCount = 1
+	}
+	shortIds := make([]string, 0, shortIdCount)
+	for i := 0; i < shortIdCount; i++ {
+		// 长度在 2-16 之间变化，避免客户端特征一致
+		shortId, err := keygen.GenerateShortId(2 * (i%8 + 1))
+		if err != nil {
+			return "", "", err
+		}
+		shortIds = append(shortIds, shortId)
+	}
+	if fingerprint == "" {
+		fingerprint = "chrome"
+	}
+	stream := &xray.StreamSettings{
+		Network:  "tcp",
+		Security: "reality",
+		RealitySettings: &xray.RealitySettings{
+			Dest:        dest,
+			ServerNames: serverNames,
+			PrivateKey:  privateKey,
+			ShortIds:    shortIds,
+			Settings: &xray.RealityClientSettings{
+				PublicKey:   publicKey,
+				Fingerprint: fingerprint,
+				ServerName:  serverNames[0],
+				SpiderX:     "/",
+			},
+		},
+		TCPSettings: &xray.TCPSettings{
+			Header: json.RawMessage(`{"type":"none"}`),
+		},
+	}
+	data, err := json.Marshal(stream)
+	if err != nil {
+		return "", "", err
+	}
+	return string(data), publicKey, nil
+}
+
+// CreateRealityInbound 探测 dest 后创建 VLESS+Reality 入站，探测不通过时返回探测结果和错误
+func (s *RealityService) CreateRealityInbound(userId int, opts *RealityInboundOptions) (*model.Inbound, *DestProbeResult, error) {
+	if opts.Port <= 0 || opts.Port > 65535 {
+		return nil, nil, common.NewError("端口无效:", opts.Port)
+	}
+	dest, host, err := normalizeDest(opts.Dest)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverNames := splitDomains(opts.ServerNames)
+	if len(serverNames) == 0 {
+		serverNames = []string{host}
+	}
+
+	var result *DestProbeResult
+	if !opts.SkipProbe {
+		result, err = s.ProbeDest(dest, serverNames)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !result.OK() {
+			return nil, result, common.NewError("dest 不满足 Reality 要求:", strings.Join(result.Problems, "; "))
+		}
+	}
+
+	streamSettings, _, err := BuildRealityStreamSettings(dest, serverNames, opts.Fingerprint, opts.ShortIdCount)
+	if err != nil {
+		return nil, result, err
+	}
+	uuid, err := keygen.GenerateUUID()
+	if err != nil {
+		return nil, result, err
+	}
+	settings := &xray.VLESSSettings{
+		Clients: []*xray.Client{
+			{Id: uuid, Flow: realityDefaultFlow, Email: opts.Email},
+		},
+		Decryption: "none",
+	}
+
+	inbound := &model.Inbound{
+		UserId:         userId,
+		Remark:         opts.Remark,
+		Enable:         true,
+		Email:          opts.Email,
+		Total:          opts.Total,
+		ExpiryTime:     opts.ExpiryTime,
+		Listen:         opts.Listen,
+		Port:           opts.Port,
+		Protocol:       model.VLESS,
+		StreamSettings: streamSettings,
+		Sniffing:       `{"enabled":true,"destOverride":["http","tls","quic"]}`,
+	}
+	if err := inbound.SetSettings(settings); err != nil {
+		return nil, result, err
+	}
+	if err := s.inboundService.AddInbound(inbound); err != nil {
+		return nil, result, err
+	}
+	return inbound, result, nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"x-ui/xray"
+)
+
+// newDestServer 启动本地 TLS 服务器作为 dest，证书包含 example.com 和 127.0.0.1
+func newDestServer(t *testing.T, maxVersion uint16, h2 bool) string {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = h2
+	server.TLS = &tls.Config{MaxVersion: maxVersion}
+	// 探测完成握手后直接断开，服务器会记录握手错误
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+func hasProblem(result *DestProbeResult, substr string) bool {
+	for _, problem := range result.Problems {
+		if strings.Contains(problem, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProbeDest(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxVersion  uint16
+		h2          bool
+		serverNames []string
+		problems    []string
+	}{
+		{"ok", tls.VersionTLS13, true, []string{"example.com"}, nil},
+		{"tls12 only", tls.VersionTLS12, true, []string{"example.com"}, []string{"TLS1.3"}},
+		{"no h2", tls.VersionTLS13, false, []string{"example.com"}, []string{"h2"}},
+		{"sni mismatch", tls.VersionTLS13, true, []string{"example.com", "www.apple.com"}, []string{"www.apple.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := newDestServer(t, tt.maxVersion, tt.h2)
+			s := &RealityService{}
+			result, err := s.ProbeDest(dest, tt.serverNames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Problems) != len(tt.problems) {
+				t.Fatalf("探测结果问题为 %v，期望 %d 个", result.Problems, len(tt.problems))
+			}
+			for _, problem := range tt.problems {
+				if !hasProblem(result, problem) {
+					t.Errorf("探测结果 %v 中缺少 %v", result.Problems, problem)
+				}
+			}
+			if result.ServerName != tt.serverNames[0] {
+				t.Errorf("ServerName 为 %v，期望 %v", result.ServerName, tt.serverNames[0])
+			}
+		})
+	}
+}
+
+func TestProbeDestConnectFailed(t *testing.T) {
+	// 关闭服务器后端口不再监听
+	server := httptest.NewUnstartedServer(nil)
+	dest := server.Listener.Addr().String()
+	server.Close()
+	s := &RealityService{}
+	result, err := s.ProbeDest(dest, []string{"example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OK() || !hasProblem(result, "TLS连接失败") {
+		t.Errorf("连接失败时探测结果为 %v", result.Problems)
+	}
+}
+
+func TestBuildRealityStreamSettingsDefaultServerName(t *testing.T) {
+	for _, serverNames := range [][]string{nil, {}, {" "}} {
+		data, publicKey, err := BuildRealityStreamSettings("www.example.com:443", serverNames, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream := &xray.StreamSettings{}
+		if err := json.Unmarshal([]byte(data), stream); err != nil {
+			t.Fatal(err)
+		}
+		reality := stream.RealitySettings
+		if len(reality.ServerNames) != 1 || reality.ServerNames[0] != "www.example.com" {
+			t.Errorf("serverNames 为 %v，期望使用 dest 的域名", reality.ServerNames)
+		}
+		if reality.Settings.ServerName != "www.example.com" || reality.Settings.PublicKey != publicKey {
+			t.Errorf("客户端配置不正确: %+v", reality.Settings)
+		}
+		if len(reality.ShortIds) != 1 {
+			t.Errorf("shortIds 为 %v，期望 1 个", reality.ShortIds)
+		}
+	}
+	if _, _, err := BuildRealityStreamSettings("", nil, "", 1); err == nil {
+		t.Error("dest 和 serverNames 都为空时应返回错误")
+	}
+}
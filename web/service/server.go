@@ -4,13 +4,18 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 	"x-ui/logger"
 	"x-ui/util/sys"
@@ -65,6 +70,7 @@ type Status struct {
 		Sent uint64 `json:"sent"` // 总发送流量
 		Recv uint64 `json:"recv"` // 总接收流量
 	} `json:"netTraffic"`
+	ExpiringCerts []*CertInfo `json:"expiringCerts"` // 即将到期的证书
 }
 
 // Release 表示GitHub发布信息
@@ -72,10 +78,15 @@ type Release struct {
 	TagName string `json:"tag_name"`
 }
 
+// xrayStartCheckDelay 安装后等待多久确认 xray 没有退出
+var xrayStartCheckDelay = 3 * time.Second
+
 // ServerServiceImpl 提供服务器状态和管理功能
 type ServerServiceImpl struct {
-	ctx         context.Context
-	xrayService XrayService
+	ctx            context.Context
+	xrayService    XrayService
+	certService    CertService
+	settingService SettingService
 }
 
 // NewServerService 创建新的ServerService实例
@@ -220,6 +231,12 @@ func (s *ServerServiceImpl) GetStatus(lastStatus *Status) *Status {
 		}
 	}
 
+	// 获取即将到期的证书
+	status.ExpiringCerts, err = s.certService.GetExpiringCertificates()
+	if err != nil {
+		logger.Warning("获取证书到期信息失败:", err)
+	}
+
 	return status
 }
 
@@ -268,8 +285,8 @@ func (s *ServerServiceImpl) GetXrayVersions() ([]string, error) {
 	return versions, nil
 }
 
-// downloadXRay 下载指定版本的Xray
-func (s *ServerServiceImpl) downloadXRay(version string) (string, error) {
+// xrayReleaseURL 返回当前平台指定版本的 Xray 安装包地址
+func xrayReleaseURL(version string) string {
 	osName := runtime.GOOS
 	arch := runtime.GOARCH
 
@@ -287,9 +304,13 @@ func (s *ServerServiceImpl) downloadXRay(version string) (string, error) {
 		arch = "arm64-v8a"
 	}
 
-	// 构建下载URL
 	fileName := fmt.Sprintf("Xray-%s-%s.zip", osName, arch)
-	url := fmt.Sprintf("https://github.com/XTLS/Xray-core/releases/download/%s/%s", version, fileName)
+	return fmt.Sprintf("https://github.com/XTLS/Xray-core/releases/download/%s/%s", version, fileName)
+}
+
+// downloadXRay 下载指定版本的Xray
+func (s *ServerServiceImpl) downloadXRay(version string) (string, error) {
+	url := xrayReleaseURL(version)
 
 	// 创建带超时的请求
 	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Minute) // 下载可能需要更长时间
@@ -311,97 +332,349 @@ func (s *ServerServiceImpl) downloadXRay(version string) (string, error) {
 	}
 
 	// 保存文件
-	os.Remove(fileName) // 删除可能存在的旧文件
-	file, err := os.Create(fileName)
+	file, err := os.CreateTemp("", "xray-*.zip")
 	if err != nil {
 		return "", fmt.Errorf("创建文件失败: %w", err)
 	}
 	defer file.Close()
 
 	if _, err := io.Copy(file, resp.Body); err != nil {
+		os.Remove(file.Name())
 		return "", fmt.Errorf("保存文件失败: %w", err)
 	}
 
-	return fileName, nil
+	return file.Name(), nil
+}
+
+// downloadXrayDigest 下载安装包同路径的 .dgst 文件，返回其中的 SHA2-256
+func (s *ServerServiceImpl) downloadXrayDigest(version string) (string, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, xrayReleaseURL(version)+".dgst", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("下载返回状态码: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	return ParseXrayDigest(string(data))
+}
+
+// ParseXrayDigest 解析 Xray 发布的 .dgst 文件内容，也接受单独的 sha256 十六进制字符串
+func ParseXrayDigest(digest string) (string, error) {
+	digest = strings.TrimSpace(digest)
+	for _, line := range strings.Split(digest, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "SHA2-256") {
+			digest = strings.TrimSpace(value)
+			break
+		}
+	}
+	digest = strings.ToLower(digest)
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+		return "", errors.New("无效的 sha256 摘要")
+	}
+	return digest, nil
 }
 
-// UpdateXray 更新Xray到指定版本
+// UpdateXray 从 GitHub 下载指定版本的Xray，校验摘要后安装
 func (s *ServerServiceImpl) UpdateXray(version string) error {
-	// 下载Xray
+	digest, err := s.downloadXrayDigest(version)
+	if err != nil {
+		return fmt.Errorf("下载摘要文件失败: %w", err)
+	}
 	zipFileName, err := s.downloadXRay(version)
 	if err != nil {
 		return fmt.Errorf("下载Xray失败: %w", err)
 	}
+	defer os.Remove(zipFileName) // 清理下载的文件
+
+	return s.InstallXrayZip(zipFileName, digest)
+}
+
+// xrayInstallLock 同一时间只允许一个安装或回滚
+var xrayInstallLock sync.Mutex
 
-	// 打开ZIP文件
-	zipFile, err := os.Open(zipFileName)
+// extractZipFile 把 ZIP 内的文件解压到 path，读取时会校验 CRC
+func extractZipFile(reader *zip.Reader, zipName string, path string, perm fs.FileMode) error {
+	zipFile, err := reader.Open(zipName)
 	if err != nil {
-		return fmt.Errorf("打开ZIP文件失败: %w", err)
+		return fmt.Errorf("打开ZIP内文件失败: %w", err)
 	}
-	defer func() {
-		zipFile.Close()
-		os.Remove(zipFileName) // 清理下载的文件
-	}()
-
-	// 读取ZIP文件内容
-	stat, err := zipFile.Stat()
+	defer zipFile.Close()
+	data, err := io.ReadAll(zipFile)
 	if err != nil {
-		return fmt.Errorf("获取文件状态失败: %w", err)
+		return fmt.Errorf("读取ZIP内文件失败: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	return os.Chmod(path, perm)
+}
+
+// InstallXrayZip 安装 Xray 发布的 ZIP 安装包，digest 为空时只校验 ZIP 自身的 CRC
+//
+// 新版本先用 xray -test 检查能否加载当前配置，替换前把旧版本保留为备份，
+// 新版本启动失败时自动换回旧版本并重启
+func (s *ServerServiceImpl) InstallXrayZip(zipFileName string, digest string) error {
+	xrayInstallLock.Lock()
+	defer xrayInstallLock.Unlock()
+
+	if digest != "" {
+		expected, err := ParseXrayDigest(digest)
+		if err != nil {
+			return err
+		}
+		actual, err := fileSha256(zipFileName)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			return fmt.Errorf("安装包校验失败: 期望 %v，实际 %v", expected, actual)
+		}
 	}
-	reader, err := zip.NewReader(zipFile, stat.Size())
+
+	reader, err := zip.OpenReader(zipFileName)
 	if err != nil {
 		return fmt.Errorf("解析ZIP文件失败: %w", err)
 	}
+	defer reader.Close()
+
+	// 新版本和 geo 文件解压到原文件旁的 .new，和 geo 文件一起检查通过后再替换
+	binaryPath := xray.GetBinaryPath()
+	newBinaryPath := binaryPath + ".new"
+	defer os.Remove(newBinaryPath)
+	if err := extractZipFile(&reader.Reader, "xray", newBinaryPath, 0755); err != nil {
+		return fmt.Errorf("解压xray二进制文件失败: %w", err)
+	}
+	geoFiles := s.getInstallGeoFiles(&reader.Reader)
+	assets := map[string]string{}
+	for _, geoFile := range geoFiles {
+		newPath := geoFile.path + ".new"
+		defer os.Remove(newPath)
+		if err := extractZipFile(&reader.Reader, geoFile.name, newPath, 0644); err != nil {
+			return fmt.Errorf("解压%v失败: %w", geoFile.name, err)
+		}
+		assets[geoFile.name] = newPath
+	}
 
-	// 停止当前运行的Xray
-	if s.xrayService != nil {
-		s.xrayService.StopXray()
+	xrayConfig, err := s.xrayService.GetXrayConfig()
+	if err != nil {
+		return fmt.Errorf("生成 xray 配置失败: %w", err)
+	}
+	version, err := xray.TestBinary(newBinaryPath, assets, xrayConfig)
+	if err != nil {
+		return err
 	}
 
-	// 安装完成后重启Xray
-	defer func() {
-		if s.xrayService != nil {
-			if err := s.xrayService.RestartXray(true); err != nil {
-				logger.Error("重启Xray失败:", err)
-			}
+	// 备份只对应本次替换的文件，先清理上次安装留下的 geo 文件备份
+	for _, geoFile := range xrayGeoFiles {
+		os.Remove(geoFile.path + ".bak")
+	}
+	// 保留旧版本，原地覆盖正在运行的二进制文件会失败，这里使用重命名
+	hasBackup := false
+	if _, err := os.Stat(binaryPath); err == nil {
+		if err := os.Rename(binaryPath, xray.GetBinaryBackupPath()); err != nil {
+			return fmt.Errorf("备份旧版本失败: %w", err)
+		}
+		hasBackup = true
+	}
+	if err := os.Rename(newBinaryPath, binaryPath); err != nil {
+		if hasBackup {
+			os.Rename(xray.GetBinaryBackupPath(), binaryPath)
+		}
+		return fmt.Errorf("安装xray二进制文件失败: %w", err)
+	}
+	for _, geoFile := range geoFiles {
+		if err := installFileWithBackup(geoFile.path+".new", geoFile.path); err != nil {
+			logger.Warningf("安装%v失败: %v", geoFile.name, err)
 		}
-	}()
+	}
 
-	// 从ZIP文件中复制文件的辅助函数
-	copyZipFile := func(zipName string, fileName string) error {
-		zipFile, err := reader.Open(zipName)
-		if err != nil {
-			return fmt.Errorf("打开ZIP内文件失败: %w", err)
+	if err := s.restartAndCheckXray(); err != nil {
+		if !hasBackup {
+			return err
+		}
+		logger.Warningf("xray %v 启动失败，回滚到旧版本: %v", version, err)
+		if rollbackErr := s.swapXrayBackup(); rollbackErr != nil {
+			return fmt.Errorf("xray %v 启动失败: %v，回滚失败: %w", version, err, rollbackErr)
 		}
-		defer zipFile.Close()
+		if restartErr := s.restartAndCheckXray(); restartErr != nil {
+			logger.Error("回滚后重启Xray失败:", restartErr)
+		}
+		return fmt.Errorf("xray %v 启动失败，已回滚到旧版本: %w", version, err)
+	}
+	logger.Infof("成功更新Xray到版本: %s", version)
+	return nil
+}
 
-		os.Remove(fileName) // 删除可能存在的旧文件
-		file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|os.O_TRUNC, fs.ModePerm)
-		if err != nil {
-			return fmt.Errorf("创建目标文件失败: %w", err)
+type xrayGeoFile struct {
+	name string
+	path string
+}
+
+// xrayGeoFiles Xray 安装包中随附的 geo 文件
+var xrayGeoFiles = []xrayGeoFile{
+	{"geosite.dat", xray.GetGeositePath()},
+	{"geoip.dat", xray.GetGeoipPath()},
+}
+
+// getInstallGeoFiles 返回需要安装的 geo 文件
+//
+// 文件缺失时总是安装；开启 geo 文件自动更新时由 GeoService 管理，不覆盖已有文件；
+// 否则只在安装包中的版本比现有文件新时安装，避免覆盖用户自行更新的文件
+func (s *ServerServiceImpl) getInstallGeoFiles(reader *zip.Reader) []xrayGeoFile {
+	geoUpdateEnable, err := s.settingService.GetGeoUpdateEnable()
+	if err != nil {
+		logger.Warning("获取 geo 文件更新设置失败:", err)
+	}
+	geoFiles := make([]xrayGeoFile, 0, len(xrayGeoFiles))
+	for _, geoFile := range xrayGeoFiles {
+		var zipFile *zip.File
+		for _, f := range reader.File {
+			if f.Name == geoFile.name {
+				zipFile = f
+				break
+			}
 		}
-		defer file.Close()
+		if zipFile == nil {
+			continue
+		}
+		info, err := os.Stat(geoFile.path)
+		if err == nil && (geoUpdateEnable || !zipFile.Modified.After(info.ModTime())) {
+			continue
+		}
+		geoFiles = append(geoFiles, geoFile)
+	}
+	return geoFiles
+}
 
-		if _, err := io.Copy(file, zipFile); err != nil {
-			return fmt.Errorf("复制文件内容失败: %w", err)
+// installFileWithBackup 用 newPath 替换 path，原文件保留为 path.bak
+func installFileWithBackup(newPath string, path string) error {
+	hasBackup := false
+	if _, err := os.Stat(path); err == nil {
+		if err := os.Rename(path, path+".bak"); err != nil {
+			return err
+		}
+		hasBackup = true
+	}
+	if err := os.Rename(newPath, path); err != nil {
+		if hasBackup {
+			os.Rename(path+".bak", path)
 		}
+		return err
+	}
+	return nil
+}
 
-		return nil
+// restartAndCheckXray 重启 xray，并确认启动后没有立即退出
+func (s *ServerServiceImpl) restartAndCheckXray() error {
+	if err := s.xrayService.RestartXray(true); err != nil {
+		return err
+	}
+	time.Sleep(xrayStartCheckDelay)
+	if !s.xrayService.IsXrayRunning() {
+		if err := s.xrayService.GetXrayErr(); err != nil {
+			return fmt.Errorf("xray 启动后退出: %w", err)
+		}
+		return errors.New("xray 启动后退出")
 	}
+	return nil
+}
 
-	// 复制必要的文件
-	if err := copyZipFile("xray", xray.GetBinaryPath()); err != nil {
-		return fmt.Errorf("安装xray二进制文件失败: %w", err)
+// swapFile 交换 path 和 backupPath 两个文件
+func swapFile(path string, backupPath string) error {
+	tmpPath := path + ".swap"
+	if err := os.Rename(path, tmpPath); err != nil {
+		return err
 	}
+	if err := os.Rename(backupPath, path); err != nil {
+		os.Rename(tmpPath, path)
+		return err
+	}
+	return os.Rename(tmpPath, backupPath)
+}
 
-	if err := copyZipFile("geosite.dat", xray.GetGeositePath()); err != nil {
-		return fmt.Errorf("安装geosite.dat失败: %w", err)
+// swapXrayBackup 交换当前版本和备份版本，有备份的 geo 文件一起交换，再次调用即可恢复
+func (s *ServerServiceImpl) swapXrayBackup() error {
+	if err := swapFile(xray.GetBinaryPath(), xray.GetBinaryBackupPath()); err != nil {
+		return err
+	}
+	// 二进制文件已经交换，geo 文件交换失败时保持原样，不影响 xray 启动
+	for _, geoFile := range xrayGeoFiles {
+		if _, err := os.Stat(geoFile.path + ".bak"); err != nil {
+			continue
+		}
+		if err := swapFile(geoFile.path, geoFile.path+".bak"); err != nil {
+			logger.Warningf("交换%v失败: %v", geoFile.name, err)
+		}
 	}
+	return nil
+}
 
-	if err := copyZipFile("geoip.dat", xray.GetGeoipPath()); err != nil {
-		return fmt.Errorf("安装geoip.dat失败: %w", err)
+// backupAssets 返回备份的 geo 文件，用于和备份版本一起检查
+func backupAssets() map[string]string {
+	assets := map[string]string{}
+	for _, geoFile := range xrayGeoFiles {
+		if _, err := os.Stat(geoFile.path + ".bak"); err == nil {
+			assets[geoFile.name] = geoFile.path + ".bak"
+		}
 	}
+	return assets
+}
+
+// RollbackXray 换回安装前保留的版本，换下的版本成为新的备份
+func (s *ServerServiceImpl) RollbackXray() error {
+	xrayInstallLock.Lock()
+	defer xrayInstallLock.Unlock()
 
-	logger.Info("成功更新Xray到版本: %s", version)
+	backupPath := xray.GetBinaryBackupPath()
+	if _, err := os.Stat(backupPath); err != nil {
+		return errors.New("没有可回滚的旧版本")
+	}
+	xrayConfig, err := s.xrayService.GetXrayConfig()
+	if err != nil {
+		return fmt.Errorf("生成 xray 配置失败: %w", err)
+	}
+	version, err := xray.TestBinary(backupPath, backupAssets(), xrayConfig)
+	if err != nil {
+		return err
+	}
+	if err := s.swapXrayBackup(); err != nil {
+		return err
+	}
+	if err := s.restartAndCheckXray(); err != nil {
+		logger.Warningf("回滚到 xray %v 后启动失败，恢复原版本: %v", version, err)
+		if swapErr := s.swapXrayBackup(); swapErr == nil {
+			if restartErr := s.restartAndCheckXray(); restartErr != nil {
+				logger.Error("恢复后重启Xray失败:", restartErr)
+			}
+		}
+		return fmt.Errorf("xray %v 启动失败: %w", version, err)
+	}
+	logger.Infof("已回滚Xray到版本: %s", version)
 	return nil
 }
+
+// GetXrayBackupVersion 获取备份版本的版本号，没有备份时返回空
+func (s *ServerServiceImpl) GetXrayBackupVersion() string {
+	backupPath := xray.GetBinaryBackupPath()
+	if _, err := os.Stat(backupPath); err != nil {
+		return ""
+	}
+	version, err := xray.GetBinaryVersion(backupPath)
+	if err != nil {
+		return "Unknown"
+	}
+	return version
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"x-ui/xray"
+)
+
+// fakeXrayScript 模拟 xray 二进制文件：-version 输出版本号，-test 按 testOk 返回，crash 为真时启动后立即退出
+func fakeXrayScript(version string, testOk bool, crash bool) []byte {
+	testExit := "0"
+	if !testOk {
+		testExit = "1"
+	}
+	script := "#!/bin/sh\n" +
+		"# crash=" + map[bool]string{true: "yes", false: "no"}[crash] + "\n" +
+		"case \"$1\" in\n" +
+		"-version) echo \"Xray " + version + " (Xray, Penetrates Everything.)\" ;;\n" +
+		"-test) echo \"test result\"; exit " + testExit + " ;;\n" +
+		"esac\n"
+	return []byte(script)
+}
+
+// fakeInstallXrayService 按当前安装的二进制文件判断 xray 重启后能否保持运行
+type fakeInstallXrayService struct {
+	XrayService
+	restarts []string
+	running  bool
+}
+
+func (s *fakeInstallXrayService) GetXrayConfig() (*xray.Config, error) {
+	return &xray.Config{}, nil
+}
+
+func (s *fakeInstallXrayService) RestartXray(force bool) error {
+	data, err := os.ReadFile(xray.GetBinaryPath())
+	if err != nil {
+		return err
+	}
+	version, err := xray.GetBinaryVersion(xray.GetBinaryPath())
+	if err != nil {
+		return err
+	}
+	s.restarts = append(s.restarts, version)
+	s.running = !bytes.Contains(data, []byte("crash=yes"))
+	return nil
+}
+
+func (s *fakeInstallXrayService) IsXrayRunning() bool {
+	return s.running
+}
+
+func (s *fakeInstallXrayService) GetXrayErr() error {
+	if s.running {
+		return nil
+	}
+	return errors.New("exit status 1")
+}
+
+// initInstallTest 在临时目录中安装 1.0.0 版本，返回使用假 xray 服务的 ServerServiceImpl
+func initInstallTest(t *testing.T) (*ServerServiceImpl, *fakeInstallXrayService) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("需要 /bin/sh")
+	}
+	initTestDB(t)
+	// xray 的文件路径相对于工作目录
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.MkdirAll(filepath.Dir(xray.GetBinaryPath()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(xray.GetBinaryPath(), fakeXrayScript("1.0.0", true, false), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	delay := xrayStartCheckDelay
+	xrayStartCheckDelay = 0
+	t.Cleanup(func() { xrayStartCheckDelay = delay })
+
+	xrayService := &fakeInstallXrayService{running: true}
+	s := &ServerServiceImpl{}
+	s.SetXrayService(xrayService)
+	return s, xrayService
+}
+
+// writeXrayZip 生成安装包，files 为 ZIP 内的文件名和内容
+func writeXrayZip(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	writer := zip.NewWriter(buf)
+	for name, data := range files {
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "Xray-linux-64.zip")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func checkBinaryVersion(t *testing.T, path string, want string) {
+	t.Helper()
+	version, err := xray.GetBinaryVersion(path)
+	if err != nil {
+		t.Fatalf("读取 %v 的版本失败: %v", path, err)
+	}
+	if version != want {
+		t.Fatalf("%v 的版本为 %v，期望 %v", path, version, want)
+	}
+}
+
+// checkNoLeftovers 检查 bin 目录中没有残留的 .new、.swap 和测试目录
+func checkNoLeftovers(t *testing.T) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Dir(xray.GetBinaryPath()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".new") || strings.HasSuffix(name, ".swap") || strings.HasPrefix(name, ".") {
+			t.Fatalf("bin 目录中残留了 %v", name)
+		}
+	}
+}
+
+func TestInstallXrayZip(t *testing.T) {
+	s, xrayService := initInstallTest(t)
+	zipPath := writeXrayZip(t, map[string][]byte{
+		"xray":        fakeXrayScript("1.1.0", true, false),
+		"geoip.dat":   []byte("geoip"),
+		"LICENSE":     []byte("license"),
+		"geosite.dat": []byte("geosite"),
+	})
+	sum, err := fileSha256(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.InstallXrayZip(zipPath, "MD5= 0\nSHA2-256= "+sum+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	checkBinaryVersion(t, xray.GetBinaryPath(), "1.1.0")
+	checkBinaryVersion(t, xray.GetBinaryBackupPath(), "1.0.0")
+	if len(xrayService.restarts) != 1 || xrayService.restarts[0] != "1.1.0" {
+		t.Fatalf("重启记录为 %v，期望只重启 1.1.0", xrayService.restarts)
+	}
+	// 本地没有 geo 文件时随安装包安装
+	for _, geoFile := range xrayGeoFiles {
+		if _, err := os.Stat(geoFile.path); err != nil {
+			t.Fatalf("没有安装 %v: %v", geoFile.name, err)
+		}
+	}
+	checkNoLeftovers(t)
+	if version := s.GetXrayBackupVersion(); version != "1.0.0" {
+		t.Fatalf("备份版本为 %v，期望 1.0.0", version)
+	}
+}
+
+func TestInstallXrayZipRejectsBadPackage(t *testing.T) {
+	s, xrayService := initInstallTest(t)
+	notZip := filepath.Join(t.TempDir(), "xray.zip")
+	if err := os.WriteFile(notZip, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	validZip := writeXrayZip(t, map[string][]byte{"xray": fakeXrayScript("1.1.0", true, false)})
+
+	cases := []struct {
+		name   string
+		path   string
+		digest string
+		want   string
+	}{
+		{"不是ZIP文件", notZip, "", "解析ZIP文件失败"},
+		{"缺少xray", writeXrayZip(t, map[string][]byte{"geoip.dat": []byte("geoip")}), "", "解压xray二进制文件失败"},
+		{"摘要格式错误", validZip, "SHA2-256= xyz", "无效的 sha256 摘要"},
+		{"摘要不匹配", validZip, strings.Repeat("0", 64), "安装包校验失败"},
+		{"无法加载当前配置", writeXrayZip(t, map[string][]byte{"xray": fakeXrayScript("1.1.0", false, false)}), "", "xray 1.1.0 无法加载当前配置"},
+		{"无法运行", writeXrayZip(t, map[string][]byte{"xray": []byte("#!/bin/sh\nexit 1\n")}), "", "运行 xray 失败"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := s.InstallXrayZip(c.path, c.digest)
+			if err == nil || !strings.HasPrefix(err.Error(), c.want) {
+				t.Fatalf("返回 %v，期望 %v", err, c.want)
+			}
+			checkBinaryVersion(t, xray.GetBinaryPath(), "1.0.0")
+			if _, err := os.Stat(xray.GetBinaryBackupPath()); !os.IsNotExist(err) {
+				t.Fatalf("安装失败时创建了备份: %v", err)
+			}
+			checkNoLeftovers(t)
+		})
+	}
+	if len(xrayService.restarts) != 0 {
+		t.Fatalf("安装失败时重启了 xray: %v", xrayService.restarts)
+	}
+}
+
+func TestInstallXrayZipRollsBackWhenStartFails(t *testing.T) {
+	s, xrayService := initInstallTest(t)
+	zipPath := writeXrayZip(t, map[string][]byte{"xray": fakeXrayScript("1.1.0", true, true)})
+
+	err := s.InstallXrayZip(zipPath, "")
+	if err == nil || !strings.HasPrefix(err.Error(), "xray 1.1.0 启动失败，已回滚到旧版本") {
+		t.Fatalf("返回 %v，期望回滚", err)
+	}
+	checkBinaryVersion(t, xray.GetBinaryPath(), "1.0.0")
+	// 启动失败的版本留作备份，可以再次切换
+	checkBinaryVersion(t, xray.GetBinaryBackupPath(), "1.1.0")
+	if strings.Join(xrayService.restarts, ",") != "1.1.0,1.0.0" {
+		t.Fatalf("重启记录为 %v，期望先启动 1.1.0 再恢复 1.0.0", xrayService.restarts)
+	}
+	if !xrayService.IsXrayRunning() {
+		t.Fatal("回滚后 xray 没有运行")
+	}
+	checkNoLeftovers(t)
+}
+
+func TestRollbackXray(t *testing.T) {
+	s, xrayService := initInstallTest(t)
+	if err := s.RollbackXray(); err == nil || err.Error() != "没有可回滚的旧版本" {
+		t.Fatalf("没有备份时返回 %v", err)
+	}
+
+	if err := s.InstallXrayZip(writeXrayZip(t, map[string][]byte{"xray": fakeXrayScript("1.1.0", true, false)}), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RollbackXray(); err != nil {
+		t.Fatal(err)
+	}
+	checkBinaryVersion(t, xray.GetBinaryPath(), "1.0.0")
+	checkBinaryVersion(t, xray.GetBinaryBackupPath(), "1.1.0")
+
+	// 再次回滚换回新版本
+	if err := s.RollbackXray(); err != nil {
+		t.Fatal(err)
+	}
+	checkBinaryVersion(t, xray.GetBinaryPath(), "1.1.0")
+	if strings.Join(xrayService.restarts, ",") != "1.1.0,1.0.0,1.1.0" {
+		t.Fatalf("重启记录为 %v", xrayService.restarts)
+	}
+	checkNoLeftovers(t)
+}
+
+func TestParseXrayDigest(t *testing.T) {
+	sum := sha256.Sum256([]byte("xray"))
+	want := hex.EncodeToString(sum[:])
+	for _, digest := range []string{
+		want,
+		strings.ToUpper(want),
+		"MD5= 0123\nSHA1= 4567\nSHA2-256= " + want + "\nSHA2-512= 89ab\n",
+	} {
+		got, err := ParseXrayDigest(digest)
+		if err != nil || got != want {
+			t.Fatalf("解析 %q 得到 %v, %v，期望 %v", digest, got, err, want)
+		}
+	}
+	for _, digest := range []string{"", "MD5= 0123", want[:10]} {
+		if _, err := ParseXrayDigest(digest); err == nil {
+			t.Fatalf("解析无效摘要 %q 没有返回错误", digest)
+		}
+	}
+}
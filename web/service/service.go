@@ -21,43 +21,23 @@ type XrayService interface {
 	GetXrayErr() error
 	GetXrayResult() string
 	GetXrayVersion() string
-	
+	GetXrayAPIPort() int
+
 	// 配置管理
 	GetXrayConfig() (*xray.Config, error)
-	GetXrayTraffic() (map[string]int64, error)
-	
+	GetXrayTraffic() ([]*xray.Traffic, error)
+	ReconcileTraffic() error
+
 	// 操作
 	RestartXray(force bool) error
 	StopXray() error
 	SetToNeedRestart()
 	IsNeedRestartAndSetFalse() bool
 	InvalidateCache()
-	
-	// 设置依赖
-	SetInboundService(inboundService InboundService)
-	SetSettingService(settingService SettingService)
-}
 
-// SettingService 定义设置服务接口
-type SettingService interface {
-	GetSecret() ([]byte, error)
-	GetBasePath() (string, error)
-	GetPort() (int, error)
-	GetListen() (string, error)
-	GetCertFile() (string, error)
-	GetKeyFile() (string, error)
-	GetXrayConfigTemplate() (string, error)
-	GetTimeLocation() (string, error)
-	ResetSettings() error
-	SetPort(port int) error
-}
-
-// InboundService 定义入站服务接口
-type InboundService interface {
-	GetAllInbounds() ([]Inbound, error)
-	AddTraffic(traffics map[string]int64) error
-	DisableInvalidInbounds() (int, error)
-	DisableExhaustedInbounds() (int, error)
+	// 设置依赖
+	SetInboundService(inboundService *InboundService)
+	SetSettingService(settingService *SettingService)
 }
 
 // ServerService 定义服务器状态服务接口
@@ -65,15 +45,8 @@ type ServerService interface {
 	GetStatus(lastStatus *Status) *Status
 	GetXrayVersions() ([]string, error)
 	UpdateXray(version string) error
+	InstallXrayZip(zipFileName string, digest string) error
+	RollbackXray() error
+	GetXrayBackupVersion() string
 	SetXrayService(xrayService XrayService)
 }
-
-// Inbound 入站配置
-type Inbound struct {
-	ID      int    `json:"id" gorm:"primaryKey;autoIncrement"`
-	Enable  bool   `json:"enable"`
-	// 其他必要字段...
-	
-	// 生成Xray配置
-	GenXrayInboundConfig() *xray.InboundConfig
-}
@@ -0,0 +1,15 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"x-ui/database"
+)
+
+// initTestDB 在临时目录中初始化数据库，测试结束后随目录删除
+func initTestDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDB(filepath.Join(t.TempDir(), "x-ui.db")); err != nil {
+		t.Fatal(err)
+	}
+}
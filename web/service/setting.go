@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -11,6 +12,7 @@ import (
 	"x-ui/database"
 	"x-ui/database/model"
 	"x-ui/logger"
+	"x-ui/util/acme"
 	"x-ui/util/common"
 	"x-ui/util/random"
 	"x-ui/util/reflect_util"
@@ -21,14 +23,52 @@ import (
 var xrayTemplateConfig string
 
 var defaultValueMap = map[string]string{
-	"xrayTemplateConfig": xrayTemplateConfig,
-	"webListen":          "",
-	"webPort":            "54321",
-	"webCertFile":        "",
-	"webKeyFile":         "",
-	"secret":             random.Seq(32),
-	"webBasePath":        "/",
-	"timeLocation":       "Asia/Shanghai",
+	"xrayTemplateConfig":       xrayTemplateConfig,
+	"webListen":                "",
+	"webPort":                  "54321",
+	"webCertFile":              "",
+	"webKeyFile":               "",
+	"secret":                   random.Seq(32),
+	"webBasePath":              "/",
+	"timeLocation":             "Asia/Shanghai",
+	"ipLimitCooldown":          "30",
+	"metricsEnable":            "false",
+	"metricsToken":             "",
+	"apiToken":                 "",
+	"nodeCaName":               "",
+	"nodeCertName":             "",
+	"tgBotEnable":              "false",
+	"tgBotToken":               "",
+	"tgBotChatId":              "",
+	"tgBotApiUrl":              "https://api.telegram.org",
+	"tgRunTime":                "@daily",
+	"smtpEnable":               "false",
+	"smtpHost":                 "",
+	"smtpPort":                 "587",
+	"smtpUsername":             "",
+	"smtpPassword":             "",
+	"smtpFrom":                 "",
+	"smtpTls":                  "false",
+	"expiryRemindDays":         "7,3,1",
+	"quotaRemindPercent":       "80,90",
+	"webCertName":              "",
+	"acmeDirectoryUrl":         "https://acme-v02.api.letsencrypt.org/directory",
+	"acmeEmail":                "",
+	"acmeHttpPort":             "80",
+	"acmeSkipVerify":           "false",
+	"acmeRenewDays":            "30",
+	"certAlertDays":            "14",
+	"observatoryMode":          "",
+	"observatoryProbeUrl":      "https://www.google.com/generate_204",
+	"observatoryProbeInterval": "1m",
+	"geoUpdateEnable":          "false",
+	"geoUpdateTime":            "@weekly",
+	"geositeUrl":               "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geosite.dat",
+	"geoipUrl":                 "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geoip.dat",
+	"warpApiUrl":               "https://api.cloudflareclient.com/v0a2158",
+	"tgKnownLoginIps":          "",
+	"tgQuotaNotified":          "{}",
+	"clientNotified":           "{}",
 }
 
 type SettingService struct {
@@ -86,6 +126,12 @@ func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
 			fieldV.SetInt(n)
 		case string:
 			fieldV.SetString(value)
+		case bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			fieldV.SetBool(b)
 		default:
 			return common.NewErrorf("unknown field %v type %v", key, t)
 		}
@@ -111,6 +157,14 @@ func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
 		}
 	}
 
+	// 密钥只返回是否已设置
+	for _, field := range fields {
+		fieldV := v.FieldByName(field.Name)
+		if field.Tag.Get("secret") == "true" && fieldV.String() != "" {
+			fieldV.SetString(entity.SecretMask)
+		}
+	}
+
 	return allSetting, nil
 }
 
@@ -230,14 +284,270 @@ func (s *SettingService) GetTimeLocation() (string, error) {
 	return s.getString("timeLocation")
 }
 
-func (s *SettingService) UpdateAllSetting(allSetting *entity.AllSetting) error {
-	if err := allSetting.CheckValid(); err != nil {
+// GetIpLimitCooldown 获取超出IP限制后的封禁时长(分钟)
+func (s *SettingService) GetIpLimitCooldown() (int, error) {
+	return s.getInt("ipLimitCooldown")
+}
+
+func (s *SettingService) getBool(key string) (bool, error) {
+	str, err := s.getString(key)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(str)
+}
+
+func (s *SettingService) GetMetricsEnable() (bool, error) {
+	return s.getBool("metricsEnable")
+}
+
+func (s *SettingService) GetMetricsToken() (string, error) {
+	return s.getString("metricsToken")
+}
+
+// GetApiToken 其他面板以节点方式管理本面板时使用的 Bearer Token，为空时不允许 Token 访问
+func (s *SettingService) GetApiToken() (string, error) {
+	return s.getString("apiToken")
+}
+
+// GetNodeCaName 与 agent 节点双向 TLS 认证使用的私有CA名称
+func (s *SettingService) GetNodeCaName() (string, error) {
+	return s.getString("nodeCaName")
+}
+
+// GetNodeCertName 访问 agent 节点时出示的客户端证书名称，需由 nodeCaName 签发
+func (s *SettingService) GetNodeCertName() (string, error) {
+	return s.getString("nodeCertName")
+}
+
+func (s *SettingService) GetTgBotEnable() (bool, error) {
+	return s.getBool("tgBotEnable")
+}
+
+func (s *SettingService) GetTgBotToken() (string, error) {
+	return s.getString("tgBotToken")
+}
+
+// GetTgBotChatId 获取接收通知的管理员 chat id，多个以逗号分隔
+func (s *SettingService) GetTgBotChatId() (string, error) {
+	return s.getString("tgBotChatId")
+}
+
+func (s *SettingService) GetTgBotApiUrl() (string, error) {
+	return s.getString("tgBotApiUrl")
+}
+
+// GetTgRunTime 获取每日流量报告的 cron 表达式
+func (s *SettingService) GetTgRunTime() (string, error) {
+	return s.getString("tgRunTime")
+}
+
+func (s *SettingService) GetSmtpEnable() (bool, error) {
+	return s.getBool("smtpEnable")
+}
+
+func (s *SettingService) GetSmtpHost() (string, error) {
+	return s.getString("smtpHost")
+}
+
+func (s *SettingService) GetSmtpPort() (int, error) {
+	return s.getInt("smtpPort")
+}
+
+func (s *SettingService) GetSmtpUsername() (string, error) {
+	return s.getString("smtpUsername")
+}
+
+func (s *SettingService) GetSmtpPassword() (string, error) {
+	return s.getString("smtpPassword")
+}
+
+func (s *SettingService) GetSmtpFrom() (string, error) {
+	return s.getString("smtpFrom")
+}
+
+func (s *SettingService) GetSmtpTls() (bool, error) {
+	return s.getBool("smtpTls")
+}
+
+// GetExpiryRemindDays 获取到期前提醒的天数，逗号分隔
+func (s *SettingService) GetExpiryRemindDays() (string, error) {
+	return s.getString("expiryRemindDays")
+}
+
+// GetQuotaRemindPercent 获取流量使用率提醒阈值，逗号分隔
+func (s *SettingService) GetQuotaRemindPercent() (string, error) {
+	return s.getString("quotaRemindPercent")
+}
+
+// GetCertName 获取面板使用的托管证书名称，优先于证书文件
+func (s *SettingService) GetCertName() (string, error) {
+	return s.getString("webCertName")
+}
+
+func (s *SettingService) SetCertName(name string) error {
+	return s.setString("webCertName", name)
+}
+
+func (s *SettingService) GetAcmeDirectoryUrl() (string, error) {
+	return s.getString("acmeDirectoryUrl")
+}
+
+func (s *SettingService) GetAcmeEmail() (string, error) {
+	return s.getString("acmeEmail")
+}
+
+// GetAcmeHttpPort 获取 HTTP-01 验证时临时监听的端口
+func (s *SettingService) GetAcmeHttpPort() (int, error) {
+	return s.getInt("acmeHttpPort")
+}
+
+// GetAcmeSkipVerify 是否跳过ACME服务器证书校验，仅用于本地测试(如 Pebble)
+func (s *SettingService) GetAcmeSkipVerify() (bool, error) {
+	return s.getBool("acmeSkipVerify")
+}
+
+// GetAcmeRenewDays 获取证书到期前多少天自动续期
+func (s *SettingService) GetAcmeRenewDays() (int, error) {
+	return s.getInt("acmeRenewDays")
+}
+
+// GetCertAlertDays 获取证书到期前多少天开始告警
+func (s *SettingService) GetCertAlertDays() (int, error) {
+	return s.getInt("certAlertDays")
+}
+
+// GetObservatoryMode 出站观测方式，observatory、burst 或为空
+func (s *SettingService) GetObservatoryMode() (string, error) {
+	return s.getString("observatoryMode")
+}
+
+func (s *SettingService) GetObservatoryProbeUrl() (string, error) {
+	return s.getString("observatoryProbeUrl")
+}
+
+func (s *SettingService) GetObservatoryProbeInterval() (string, error) {
+	return s.getString("observatoryProbeInterval")
+}
+
+func (s *SettingService) GetGeoUpdateEnable() (bool, error) {
+	return s.getBool("geoUpdateEnable")
+}
+
+// GetGeoUpdateTime geo 文件自动更新的 cron 表达式
+func (s *SettingService) GetGeoUpdateTime() (string, error) {
+	return s.getString("geoUpdateTime")
+}
+
+func (s *SettingService) GetGeositeUrl() (string, error) {
+	return s.getString("geositeUrl")
+}
+
+func (s *SettingService) GetGeoipUrl() (string, error) {
+	return s.getString("geoipUrl")
+}
+
+func (s *SettingService) GetWarpApiUrl() (string, error) {
+	return s.getString("warpApiUrl")
+}
+
+// GetTgKnownLoginIps 已登录过面板的IP，用于新IP登录提醒
+func (s *SettingService) GetTgKnownLoginIps() ([]string, error) {
+	str, err := s.getString("tgKnownLoginIps")
+	if err != nil || str == "" {
+		return nil, err
+	}
+	return strings.Split(str, ","), nil
+}
+
+func (s *SettingService) SetTgKnownLoginIps(ips []string) error {
+	return s.setString("tgKnownLoginIps", strings.Join(ips, ","))
+}
+
+// GetTgQuotaNotified 入站id到已提醒过的最高流量阈值
+func (s *SettingService) GetTgQuotaNotified() (map[int]int, error) {
+	str, err := s.getString("tgQuotaNotified")
+	if err != nil {
+		return nil, err
+	}
+	notified := map[int]int{}
+	if err := json.Unmarshal([]byte(str), &notified); err != nil {
+		return nil, err
+	}
+	return notified, nil
+}
+
+func (s *SettingService) SetTgQuotaNotified(notified map[int]int) error {
+	data, err := json.Marshal(notified)
+	if err != nil {
 		return err
 	}
+	return s.setString("tgQuotaNotified", string(data))
+}
 
+// GetClientNotified 客户端的 ClientIpKey 到已发布过的流量用完或到期事件类型
+func (s *SettingService) GetClientNotified() (map[string]string, error) {
+	str, err := s.getString("clientNotified")
+	if err != nil {
+		return nil, err
+	}
+	notified := map[string]string{}
+	if err := json.Unmarshal([]byte(str), &notified); err != nil {
+		return nil, err
+	}
+	return notified, nil
+}
+
+func (s *SettingService) SetClientNotified(notified map[string]string) error {
+	data, err := json.Marshal(notified)
+	if err != nil {
+		return err
+	}
+	return s.setString("clientNotified", string(data))
+}
+
+// GetAcmeAccountKey 获取ACME账户私钥，不存在时生成并保存
+func (s *SettingService) GetAcmeAccountKey() (string, error) {
+	setting, err := s.getSetting("acmeAccountKey")
+	if err == nil {
+		return setting.Value, nil
+	}
+	if !database.IsNotFound(err) {
+		return "", err
+	}
+	_, keyPem, err := acme.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	err = s.saveSetting("acmeAccountKey", string(keyPem))
+	if err != nil {
+		return "", err
+	}
+	return string(keyPem), nil
+}
+
+func (s *SettingService) UpdateAllSetting(allSetting *entity.AllSetting) error {
 	v := reflect.ValueOf(allSetting).Elem()
 	t := reflect.TypeOf(allSetting).Elem()
 	fields := reflect_util.GetFields(t)
+
+	// 前端提交空值或占位符的密钥保留原有的值
+	for _, field := range fields {
+		fieldV := v.FieldByName(field.Name)
+		if field.Tag.Get("secret") != "true" || (fieldV.String() != "" && fieldV.String() != entity.SecretMask) {
+			continue
+		}
+		value, err := s.getString(field.Tag.Get("json"))
+		if err != nil {
+			return err
+		}
+		fieldV.SetString(value)
+	}
+
+	if err := allSetting.CheckValid(); err != nil {
+		return err
+	}
+
 	errs := make([]error, 0)
 	for _, field := range fields {
 		key := field.Tag.Get("json")
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+	"x-ui/web/entity"
+)
+
+func TestAllSettingMasksSecrets(t *testing.T) {
+	initTestDB(t)
+	s := &SettingService{}
+	if err := s.setString("smtpPassword", "smtp-password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.setString("apiToken", "0123456789abcdef"); err != nil {
+		t.Fatal(err)
+	}
+
+	allSetting, err := s.GetAllSetting()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allSetting.SmtpPassword != entity.SecretMask || allSetting.ApiToken != entity.SecretMask {
+		t.Fatalf("已设置的密钥返回 %q、%q，期望 %q", allSetting.SmtpPassword, allSetting.ApiToken, entity.SecretMask)
+	}
+	if allSetting.TgBotToken != "" || allSetting.MetricsToken != "" {
+		t.Fatalf("未设置的密钥返回 %q、%q，期望为空", allSetting.TgBotToken, allSetting.MetricsToken)
+	}
+
+	// 原样提交占位符或提交空值时保留原有的密钥
+	allSetting.ApiToken = ""
+	allSetting.TgBotToken = "123456:new-token"
+	if err := s.UpdateAllSetting(allSetting); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"smtpPassword": "smtp-password",
+		"apiToken":     "0123456789abcdef",
+		"tgBotToken":   "123456:new-token",
+		"metricsToken": "",
+	}
+	for key, value := range want {
+		got, err := s.getString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != value {
+			t.Fatalf("%v 保存为 %q，期望 %q", key, got, value)
+		}
+	}
+}
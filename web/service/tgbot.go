@@ -0,0 +1,527 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+	"x-ui/config"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util"
+	"x-ui/util/telegram"
+	"x-ui/web/event"
+)
+
+var (
+	tgbotLock   sync.Mutex
+	tgbotCancel context.CancelFunc
+
+	// 保护保存在设置中的已登录IP列表
+	tgLoginIpLock sync.Mutex
+)
+
+const (
+	// Telegram 单条消息的字符数上限
+	tgMaxMessageLength = 4096
+	// 最多记住的登录IP数量，超出后丢弃最早的
+	tgMaxKnownLoginIps = 256
+)
+
+const tgbotHelp = `可用命令:
+/status - 服务器状态
+/usage [入站id] - 入站流量使用情况
+/enable &lt;入站id&gt; - 启用入站
+/disable &lt;入站id&gt; - 禁用入站
+/backup - 备份数据库`
+
+// Tgbot 通过 Telegram 向管理员推送通知并响应管理命令
+type Tgbot struct {
+	ctx            context.Context
+	inboundService InboundService
+	settingService SettingService
+	serverService  ServerService
+	xrayService    XrayService
+}
+
+func NewTgbot(ctx context.Context) *Tgbot {
+	return &Tgbot{
+		ctx: ctx,
+	}
+}
+
+// SetServerService 设置ServerService依赖
+func (t *Tgbot) SetServerService(serverService ServerService) {
+	t.serverService = serverService
+}
+
+// SetXrayService 设置XrayService依赖
+func (t *Tgbot) SetXrayService(xrayService XrayService) {
+	t.xrayService = xrayService
+}
+
+func (t *Tgbot) getContext() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// newClient 未启用机器人时返回 nil
+func (t *Tgbot) newClient() (*telegram.Client, []int64, error) {
+	enable, err := t.settingService.GetTgBotEnable()
+	if err != nil || !enable {
+		return nil, nil, err
+	}
+	token, err := t.settingService.GetTgBotToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	apiUrl, err := t.settingService.GetTgBotApiUrl()
+	if err != nil {
+		return nil, nil, err
+	}
+	chatIdStr, err := t.settingService.GetTgBotChatId()
+	if err != nil {
+		return nil, nil, err
+	}
+	chatIds := make([]int64, 0)
+	for _, s := range strings.Split(chatIdStr, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("telegram chat id 无效: %v", s)
+		}
+		chatIds = append(chatIds, id)
+	}
+	return telegram.NewClient(apiUrl, token), chatIds, nil
+}
+
+// Start 启用机器人时开始接收命令
+func (t *Tgbot) Start() error {
+	client, chatIds, err := t.newClient()
+	if err != nil || client == nil {
+		return err
+	}
+
+	tgbotLock.Lock()
+	defer tgbotLock.Unlock()
+	if tgbotCancel != nil {
+		tgbotCancel()
+	}
+	ctx, cancel := context.WithCancel(t.getContext())
+	tgbotCancel = cancel
+	go t.poll(ctx, client, chatIds)
+	logger.Info("Telegram 机器人已启动")
+	return nil
+}
+
+func (t *Tgbot) Stop() {
+	tgbotLock.Lock()
+	defer tgbotLock.Unlock()
+	if tgbotCancel != nil {
+		tgbotCancel()
+		tgbotCancel = nil
+	}
+}
+
+func (t *Tgbot) poll(ctx context.Context, client *telegram.Client, chatIds []int64) {
+	var offset int64
+	for !util.IsDone(ctx) {
+		updates, err := client.GetUpdates(ctx, offset, 30)
+		if err != nil {
+			if util.IsDone(ctx) {
+				return
+			}
+			logger.Warning("获取 Telegram 消息失败:", err)
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateId + 1
+			msg := update.Message
+			if msg == nil || !containsChatId(chatIds, msg.Chat.Id) {
+				continue
+			}
+			t.handleCommand(ctx, client, msg.Chat.Id, msg.Text)
+		}
+	}
+}
+
+func containsChatId(chatIds []int64, id int64) bool {
+	for _, chatId := range chatIds {
+		if chatId == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Tgbot) handleCommand(ctx context.Context, client *telegram.Client, chatId int64, text string) {
+	args := strings.Fields(text)
+	if len(args) == 0 {
+		return
+	}
+	// 群组中命令形如 /status@bot_name
+	cmd := strings.SplitN(args[0], "@", 2)[0]
+
+	var reply string
+	switch cmd {
+	case "/start", "/help":
+		reply = tgbotHelp
+	case "/status":
+		reply = t.formatStatus()
+	case "/usage":
+		reply = t.formatUsage(args[1:])
+	case "/enable", "/disable":
+		reply = t.setInboundEnable(args[1:], cmd == "/enable")
+	case "/backup":
+		if err := t.sendBackup(ctx, client, chatId); err != nil {
+			reply = "备份数据库失败: " + html.EscapeString(err.Error())
+		}
+	default:
+		reply = "未知命令\n\n" + tgbotHelp
+	}
+	for _, chunk := range splitMessage(reply, tgMaxMessageLength) {
+		if err := client.SendMessage(ctx, chatId, chunk); err != nil {
+			logger.Warning("发送 Telegram 消息失败:", err)
+			return
+		}
+	}
+}
+
+func (t *Tgbot) formatStatus() string {
+	if t.serverService == nil {
+		return "服务器状态不可用"
+	}
+	status := t.serverService.GetStatus(nil)
+	xrayState := "运行中"
+	if status.Xray.State != 1 {
+		xrayState = "未运行"
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("<b>%s</b>\nCPU: %.1f%%\n内存: %s / %s\n硬盘: %s / %s\n负载: %.2f %.2f %.2f\nTCP/UDP: %d / %d\n运行时间: %s\nXray: %s %s",
+		html.EscapeString(hostname),
+		status.Cpu,
+		formatTraffic(int64(status.Mem.Current)), formatTraffic(int64(status.Mem.Total)),
+		formatTraffic(int64(status.Disk.Current)), formatTraffic(int64(status.Disk.Total)),
+		status.Loads[0], status.Loads[1], status.Loads[2],
+		status.TcpCount, status.UdpCount,
+		time.Duration(status.Uptime)*time.Second,
+		xrayState, html.EscapeString(status.Xray.Version))
+}
+
+func formatInboundUsage(inbound *model.Inbound) string {
+	total := "无限制"
+	if inbound.Total > 0 {
+		total = formatTraffic(inbound.Total)
+	}
+	expiry := "永久"
+	if inbound.ExpiryTime > 0 {
+		expiry = time.UnixMilli(inbound.ExpiryTime).Format("2006-01-02 15:04")
+	}
+	state := "启用"
+	if !inbound.Enable {
+		state = "禁用"
+	}
+	return fmt.Sprintf("#%d <b>%s</b> (%s:%s) %s\n↑%s ↓%s / %s，到期: %s",
+		inbound.Id, html.EscapeString(inbound.Remark), inbound.Protocol, inbound.GetPortString(), state,
+		formatTraffic(inbound.Up), formatTraffic(inbound.Down), total, expiry)
+}
+
+func (t *Tgbot) formatUsage(args []string) string {
+	if len(args) > 0 {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "入站id无效: " + html.EscapeString(args[0])
+		}
+		inbound, err := t.inboundService.GetInbound(id)
+		if err != nil {
+			return "获取入站失败: " + html.EscapeString(err.Error())
+		}
+		return formatInboundUsage(inbound)
+	}
+	inbounds, err := t.inboundService.GetAllInbounds()
+	if err != nil {
+		return "获取入站失败: " + html.EscapeString(err.Error())
+	}
+	if len(inbounds) == 0 {
+		return "没有入站"
+	}
+	lines := make([]string, 0, len(inbounds))
+	for _, inbound := range inbounds {
+		lines = append(lines, formatInboundUsage(inbound))
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+func (t *Tgbot) setInboundEnable(args []string, enable bool) string {
+	if len(args) == 0 {
+		return tgbotHelp
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "入站id无效: " + html.EscapeString(args[0])
+	}
+	if err := t.inboundService.SetInboundEnable(id, enable); err != nil {
+		return "修改入站失败: " + html.EscapeString(err.Error())
+	}
+	if t.xrayService != nil {
+		t.xrayService.InvalidateCache()
+		t.xrayService.SetToNeedRestart()
+	}
+	if inbound, err := t.inboundService.GetInbound(id); err == nil {
+		event.Publish(event.InboundUpdated, inbound)
+	} else {
+		event.Publish(event.InboundUpdated, map[string]interface{}{"id": id})
+	}
+	if enable {
+		return fmt.Sprintf("已启用入站 #%d", id)
+	}
+	return fmt.Sprintf("已禁用入站 #%d", id)
+}
+
+func (t *Tgbot) sendBackup(ctx context.Context, client *telegram.Client, chatId int64) error {
+	dbPath := config.GetDBPath()
+	file, err := os.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fileName := fmt.Sprintf("%s-%s", time.Now().Format("20060102-150405"), filepath.Base(dbPath))
+	return client.SendDocument(ctx, chatId, fileName, file)
+}
+
+// htmlToken Telegram HTML 消息中不能拆开的最小单位：标签、实体或单个字符
+type htmlToken struct {
+	text    string
+	length  int
+	tag     string // 标签名，不是标签时为空
+	closing bool
+}
+
+// tokenizeHTML 把 Telegram HTML 消息拆成标签、实体和单个字符
+func tokenizeHTML(msg string) []htmlToken {
+	tokens := make([]htmlToken, 0, len(msg))
+	for i := 0; i < len(msg); {
+		text := ""
+		switch msg[i] {
+		case '<':
+			if end := strings.IndexByte(msg[i:], '>'); end > 0 {
+				text = msg[i : i+end+1]
+			}
+		case '&':
+			if end := strings.IndexByte(msg[i:], ';'); end > 1 && !strings.ContainsAny(msg[i+1:i+end], " \n<&") {
+				text = msg[i : i+end+1]
+			}
+		}
+		if text == "" {
+			_, size := utf8.DecodeRuneInString(msg[i:])
+			text = msg[i : i+size]
+		}
+		token := htmlToken{text: text, length: utf8.RuneCountInString(text)}
+		if len(text) > 2 && text[0] == '<' {
+			name := strings.TrimSuffix(text[1:], ">")
+			name, token.closing = strings.CutPrefix(name, "/")
+			token.tag, _, _ = strings.Cut(name, " ")
+		}
+		tokens = append(tokens, token)
+		i += len(text)
+	}
+	return tokens
+}
+
+// splitMessage 把 Telegram HTML 消息拆成不超过 limit 个字符的多段。
+// 优先在空行处拆分，其次在不处于任何标签内的换行处拆分，标签内的内容超过上限时才在标签内的换行处拆分，
+// 单行过长时按字符截断。在标签内拆分时关闭未闭合的标签并在下一段重新打开，保证每段都是合法的 HTML
+func splitMessage(msg string, limit int) []string {
+	tokens := tokenizeHTML(msg)
+	chunks := make([]string, 0, 1)
+	var open []htmlToken // 上一段截断时未闭合的标签
+	for i := 0; i < len(tokens); {
+		var chunk strings.Builder
+		length, closeLength := 0, 0
+		for _, tag := range open {
+			chunk.WriteString(tag.text)
+			length += tag.length
+			closeLength += len(tag.tag) + 3
+		}
+		stack := append([]htmlToken(nil), open...)
+		// 可以拆分的换行位置：空行、不在标签内的换行、标签内的换行及其未闭合的标签
+		blockCut, lineCut, tagLineCut := -1, -1, -1
+		var tagLineStack []htmlToken
+		j := i
+		for ; j < len(tokens); j++ {
+			token := tokens[j]
+			if token.text == "\n" && j > i {
+				if len(stack) > 0 {
+					tagLineCut, tagLineStack = j, stack
+				} else {
+					lineCut = j
+					if tokens[j-1].text == "\n" {
+						blockCut = j
+					}
+				}
+			}
+			nextStack, nextCloseLength := stack, closeLength
+			if token.tag != "" && !token.closing {
+				nextStack = append(stack[:len(stack):len(stack)], token)
+				nextCloseLength += len(token.tag) + 3
+			} else if token.tag != "" {
+				for k := len(stack) - 1; k >= 0; k-- {
+					if stack[k].tag == token.tag {
+						nextStack = append(stack[:k:k], stack[k+1:]...)
+						nextCloseLength -= len(token.tag) + 3
+						break
+					}
+				}
+			}
+			// 至少放入一个单位，避免标签本身超过上限时死循环
+			if length+token.length+nextCloseLength > limit && j > i {
+				break
+			}
+			stack, closeLength = nextStack, nextCloseLength
+			length += token.length
+		}
+
+		cut, cutStack := j, stack
+		if j < len(tokens) {
+			if blockCut > 0 {
+				cut, cutStack = blockCut, nil
+			} else if lineCut > 0 {
+				cut, cutStack = lineCut, nil
+			} else if tagLineCut > 0 {
+				cut, cutStack = tagLineCut, tagLineStack
+			}
+		}
+		for _, token := range tokens[i:cut] {
+			chunk.WriteString(token.text)
+		}
+		open = nil
+		if j < len(tokens) {
+			// 在标签内拆分时关闭未闭合的标签，下一段重新打开
+			for k := len(cutStack) - 1; k >= 0; k-- {
+				chunk.WriteString("</" + cutStack[k].tag + ">")
+			}
+			open = cutStack
+		}
+		if text := strings.Trim(chunk.String(), "\n"); text != "" {
+			chunks = append(chunks, text)
+		}
+		i = cut
+		for i < len(tokens) && tokens[i].text == "\n" {
+			i++
+		}
+	}
+	return chunks
+}
+
+// SendMsgToAdmins 向所有管理员发送消息，超过 Telegram 长度上限时分多条发送，未启用机器人时忽略
+func (t *Tgbot) SendMsgToAdmins(msg string) {
+	client, chatIds, err := t.newClient()
+	if err != nil {
+		logger.Warning("初始化 Telegram 机器人失败:", err)
+		return
+	}
+	if client == nil {
+		return
+	}
+	hostname, _ := os.Hostname()
+	header := fmt.Sprintf("[%s]\n", html.EscapeString(hostname))
+	chunks := splitMessage(msg, tgMaxMessageLength-len([]rune(header)))
+	for _, chatId := range chatIds {
+		for _, chunk := range chunks {
+			ctx, cancel := context.WithTimeout(t.getContext(), 30*time.Second)
+			err := client.SendMessage(ctx, chatId, header+chunk)
+			cancel()
+			if err != nil {
+				logger.Warning("发送 Telegram 通知失败:", err)
+				break
+			}
+		}
+	}
+}
+
+func (t *Tgbot) NotifyXrayCrash(errMsg string) {
+	t.SendMsgToAdmins("⚠️ Xray 异常退出:\n<pre>" + html.EscapeString(errMsg) + "</pre>")
+}
+
+func (t *Tgbot) NotifyInboundsDisabled(inbounds []*model.Inbound) {
+	if len(inbounds) == 0 {
+		return
+	}
+	lines := []string{"以下入站已到期或流量耗尽，已被禁用:"}
+	for _, inbound := range inbounds {
+		lines = append(lines, formatInboundUsage(inbound))
+	}
+	t.SendMsgToAdmins(strings.Join(lines, "\n\n"))
+}
+
+func (t *Tgbot) NotifyQuota(inbound *model.Inbound, percent int) {
+	t.SendMsgToAdmins(fmt.Sprintf("📊 入站流量已使用 %d%%\n%s", percent, formatInboundUsage(inbound)))
+}
+
+// isNewLoginIp 检查并记住登录IP，IP列表保存在设置中，重启后不会重复提醒
+func (t *Tgbot) isNewLoginIp(ip string) bool {
+	tgLoginIpLock.Lock()
+	defer tgLoginIpLock.Unlock()
+	ips, err := t.settingService.GetTgKnownLoginIps()
+	if err != nil {
+		logger.Warning("获取已登录IP失败:", err)
+		return false
+	}
+	for _, known := range ips {
+		if known == ip {
+			return false
+		}
+	}
+	ips = append(ips, ip)
+	if len(ips) > tgMaxKnownLoginIps {
+		ips = ips[len(ips)-tgMaxKnownLoginIps:]
+	}
+	if err := t.settingService.SetTgKnownLoginIps(ips); err != nil {
+		logger.Warning("保存已登录IP失败:", err)
+	}
+	return true
+}
+
+// NotifyLogin 从未登录过的IP登录成功时提醒
+func (t *Tgbot) NotifyLogin(username string, ip string) {
+	if !t.isNewLoginIp(ip) {
+		return
+	}
+	t.SendMsgToAdmins(fmt.Sprintf("🔑 用户 <b>%s</b> 从新IP登录面板: %s\n时间: %s",
+		html.EscapeString(username), html.EscapeString(ip), time.Now().Format("2006-01-02 15:04:05")))
+}
+
+// SendReport 发送每日流量报告
+func (t *Tgbot) SendReport() {
+	msg := "📅 每日报告\n\n" + t.formatStatus() + "\n\n" + t.formatUsage(nil)
+	t.SendMsgToAdmins(msg)
+}
+
+func formatTraffic(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f%cB", float64(b)/float64(div), "KMGTP"[exp])
+}
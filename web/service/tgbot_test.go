@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+type tgSentMessage struct {
+	ChatId    int64  `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode"`
+}
+
+// tgAPIServer 模拟 Telegram Bot API，记录发送的消息
+type tgAPIServer struct {
+	*httptest.Server
+	lock sync.Mutex
+	sent []*tgSentMessage
+}
+
+func newTgAPIServer(t *testing.T, token string) *tgAPIServer {
+	t.Helper()
+	s := &tgAPIServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot"+token+"/sendMessage" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "description": "Not Found"})
+			return
+		}
+		msg := &tgSentMessage{}
+		if err := json.NewDecoder(r.Body).Decode(msg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.lock.Lock()
+		s.sent = append(s.sent, msg)
+		s.lock.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": map[string]interface{}{"message_id": 1}})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *tgAPIServer) messages() []*tgSentMessage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*tgSentMessage(nil), s.sent...)
+}
+
+func initTgbotTest(t *testing.T, chatIds string) (*Tgbot, *tgAPIServer) {
+	t.Helper()
+	initTestDB(t)
+	server := newTgAPIServer(t, "123:abc")
+	bot := &Tgbot{}
+	settings := map[string]string{
+		"tgBotEnable": "true",
+		"tgBotToken":  "123:abc",
+		"tgBotChatId": chatIds,
+		"tgBotApiUrl": server.URL + "/",
+	}
+	for key, value := range settings {
+		if err := bot.settingService.setString(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return bot, server
+}
+
+func TestSplitMessage(t *testing.T) {
+	cases := []struct {
+		name  string
+		msg   string
+		limit int
+		want  []string
+	}{
+		{"短消息", "hello", 10, []string{"hello"}},
+		{"恰好等于上限", "0123456789", 10, []string{"0123456789"}},
+		{"在空行处拆分", "aaaa\n\nbbbb\n\ncccc", 10, []string{"aaaa", "bbbb\n\ncccc"}},
+		{"段落过长时按行拆分", "aaaa\nbbbb\ncccc", 10, []string{"aaaa\nbbbb", "cccc"}},
+		{"单行过长时按字符截断", "abcdefghijklmnopqrstuvwxy", 10, []string{"abcdefghij", "klmnopqrst", "uvwxy"}},
+		{"按字符而不是字节计数", "流量流量流量", 4, []string{"流量流量", "流量"}},
+		{"空消息", "", 10, []string{}},
+		{"标签跨越上限时整体移到下一段", "aaaa\n<b>bbbb</b>", 12, []string{"aaaa", "<b>bbbb</b>"}},
+		{"不在标签内的换行处拆分", "aa\n<pre>b\nc</pre>\nd", 14, []string{"aa", "<pre>b\nc</pre>", "d"}},
+		{"实体不拆开", "abcdefgh&amp;", 10, []string{"abcdefgh", "&amp;"}},
+		{"标签内容过长时在标签内的换行处拆分", "<pre>aaa\nbbb\nccc</pre>", 20, []string{"<pre>aaa\nbbb</pre>", "<pre>ccc</pre>"}},
+		{"标签内单行过长时截断并重新打开标签", "<b>abcdefghij</b>", 10, []string{"<b>abc</b>", "<b>def</b>", "<b>ghi</b>", "<b>j</b>"}},
+		{"带属性的标签", "<a href=\"https://x\">link</a>\nmore", 30, []string{"<a href=\"https://x\">link</a>", "more"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := splitMessage(c.msg, c.limit)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("splitMessage(%q, %d) = %q，期望 %q", c.msg, c.limit, got, c.want)
+			}
+			for _, chunk := range got {
+				if n := utf8.RuneCountInString(chunk); n > c.limit {
+					t.Fatalf("分段长度 %d 超过上限 %d", n, c.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestTgbotNotifyLoginEscapesAndPersists(t *testing.T) {
+	bot, server := initTgbotTest(t, "1, 2")
+
+	bot.NotifyLogin("<admin>&", "1.2.3.4")
+	sent := server.messages()
+	if len(sent) != 2 || sent[0].ChatId != 1 || sent[1].ChatId != 2 {
+		t.Fatalf("应向两个管理员各发送一条消息，实际发送 %d 条", len(sent))
+	}
+	for _, msg := range sent {
+		if msg.ParseMode != "HTML" {
+			t.Errorf("parse_mode 为 %q，期望 HTML", msg.ParseMode)
+		}
+		if !strings.Contains(msg.Text, "<b>&lt;admin&gt;&amp;</b>") || strings.Contains(msg.Text, "<admin>") {
+			t.Errorf("用户名未转义: %q", msg.Text)
+		}
+	}
+
+	// 已提醒过的IP不再提醒，新的机器人实例模拟面板重启
+	bot.NotifyLogin("admin", "1.2.3.4")
+	(&Tgbot{}).NotifyLogin("admin", "1.2.3.4")
+	if n := len(server.messages()); n != 2 {
+		t.Fatalf("已知IP重复提醒，共发送 %d 条消息", n)
+	}
+	ips, err := bot.settingService.GetTgKnownLoginIps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ips, []string{"1.2.3.4"}) {
+		t.Fatalf("保存的登录IP为 %v", ips)
+	}
+
+	bot.NotifyLogin("admin", "5.6.7.8")
+	if n := len(server.messages()); n != 4 {
+		t.Fatalf("新IP应提醒，共发送 %d 条消息", n)
+	}
+}
+
+func TestTgbotSendLongMessage(t *testing.T) {
+	bot, server := initTgbotTest(t, "1")
+
+	blocks := make([]string, 0)
+	for i := 0; i < 300; i++ {
+		blocks = append(blocks, strings.Repeat("流", 40))
+	}
+	bot.SendMsgToAdmins(strings.Join(blocks, "\n\n"))
+
+	sent := server.messages()
+	if len(sent) < 2 {
+		t.Fatalf("超长消息应拆分为多条，实际发送 %d 条", len(sent))
+	}
+	total := 0
+	for _, msg := range sent {
+		if n := utf8.RuneCountInString(msg.Text); n > tgMaxMessageLength {
+			t.Fatalf("消息长度 %d 超过 Telegram 上限", n)
+		}
+		total += strings.Count(msg.Text, strings.Repeat("流", 40))
+	}
+	if total != len(blocks) {
+		t.Fatalf("拆分后共 %d 段内容，期望 %d 段", total, len(blocks))
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	warpClientVersion = "a-6.10-2158"
+	warpTimeout       = 30 * time.Second
+)
+
+// WarpAccount 注册 WARP 设备得到的 WireGuard 参数
+type WarpAccount struct {
+	DeviceId      string
+	Token         string
+	PeerPublicKey string
+	Endpoint      string
+	AddressV4     string
+	AddressV6     string
+	Reserved      []int
+}
+
+// WarpRegistrar 用 WireGuard 公钥注册和注销 WARP 设备，测试时可替换为不访问网络的实现
+type WarpRegistrar interface {
+	Register(ctx context.Context, publicKey string) (*WarpAccount, error)
+	Unregister(ctx context.Context, deviceId string, token string) error
+}
+
+// CloudflareWarpRegistrar 默认实现，与 wgcf 相同，调用 Cloudflare WARP 客户端 API 注册免费账户
+type CloudflareWarpRegistrar struct {
+	// APIURL 为空时使用设置中的 warpApiUrl
+	APIURL         string
+	HTTPClient     *http.Client
+	settingService SettingService
+}
+
+func (r *CloudflareWarpRegistrar) apiURL() (string, error) {
+	apiURL := r.APIURL
+	if apiURL == "" {
+		var err error
+		apiURL, err = r.settingService.GetWarpApiUrl()
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(apiURL, "/"), nil
+}
+
+func (r *CloudflareWarpRegistrar) httpClient() *http.Client {
+	if r.HTTPClient == nil {
+		return &http.Client{Timeout: warpTimeout}
+	}
+	return r.HTTPClient
+}
+
+func (r *CloudflareWarpRegistrar) do(ctx context.Context, method string, path string, token string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	apiURL, err := r.apiURL()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, apiURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "okhttp/3.12.1")
+	req.Header.Set("CF-Client-Version", warpClientVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := r.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("warp api 返回状态码 %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("warp api 返回的数据无效: %w", err)
+	}
+	return nil
+}
+
+type warpRegResponse struct {
+	Id     string `json:"id"`
+	Token  string `json:"token"`
+	Config struct {
+		ClientId string `json:"client_id"`
+		Peers    []struct {
+			PublicKey string `json:"public_key"`
+			Endpoint  struct {
+				Host string `json:"host"`
+			} `json:"endpoint"`
+		} `json:"peers"`
+		Interface struct {
+			Addresses struct {
+				V4 string `json:"v4"`
+				V6 string `json:"v6"`
+			} `json:"addresses"`
+		} `json:"interface"`
+	} `json:"config"`
+}
+
+func (r *CloudflareWarpRegistrar) Register(ctx context.Context, publicKey string) (*WarpAccount, error) {
+	body := map[string]interface{}{
+		"key":        publicKey,
+		"install_id": "",
+		"fcm_token":  "",
+		"tos":        time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		"model":      "PC",
+		"type":       "Android",
+		"locale":     "en_US",
+	}
+	resp := &warpRegResponse{}
+	if err := r.do(ctx, http.MethodPost, "/reg", "", body, resp); err != nil {
+		return nil, err
+	}
+	if resp.Id == "" || len(resp.Config.Peers) == 0 {
+		return nil, fmt.Errorf("warp api 未返回设备信息")
+	}
+	account := &WarpAccount{
+		DeviceId:      resp.Id,
+		Token:         resp.Token,
+		PeerPublicKey: resp.Config.Peers[0].PublicKey,
+		Endpoint:      resp.Config.Peers[0].Endpoint.Host,
+		AddressV4:     resp.Config.Interface.Addresses.V4,
+		AddressV6:     resp.Config.Interface.Addresses.V6,
+	}
+	if clientId, err := base64.StdEncoding.DecodeString(resp.Config.ClientId); err == nil {
+		for _, b := range clientId {
+			account.Reserved = append(account.Reserved, int(b))
+		}
+	}
+	return account, nil
+}
+
+func (r *CloudflareWarpRegistrar) Unregister(ctx context.Context, deviceId string, token string) error {
+	return r.do(ctx, http.MethodDelete, "/reg/"+deviceId, token, nil, nil)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"x-ui/database"
+	"x-ui/util/keygen"
+)
+
+// warpAPIServer 模拟 Cloudflare WARP 客户端 API 的注册和注销接口
+type warpAPIServer struct {
+	*httptest.Server
+	peerPublicKey string
+
+	mu           sync.Mutex
+	registered   []string
+	unregistered []string
+}
+
+func newWarpAPIServer(t *testing.T) *warpAPIServer {
+	t.Helper()
+	_, peerPublicKey, err := keygen.GenerateWireGuardKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &warpAPIServer{peerPublicKey: peerPublicKey}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.handle))
+	// 未设置 HTTP 客户端的请求不信任测试证书，服务器会记录握手错误
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *warpAPIServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("CF-Client-Version") != warpClientVersion {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/reg":
+		body := struct {
+			Key string `json:"key"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Key == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.registered = append(s.registered, body.Key)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":    "device-1",
+			"token": "token-1",
+			"config": map[string]interface{}{
+				"client_id": "AQID",
+				"peers": []interface{}{
+					map[string]interface{}{
+						"public_key": s.peerPublicKey,
+						"endpoint":   map[string]interface{}{"host": "engage.cloudflareclient.com:2408"},
+					},
+				},
+				"interface": map[string]interface{}{
+					"addresses": map[string]interface{}{"v4": "172.16.0.2", "v6": "2606:4700:110:8a36::2"},
+				},
+			},
+		})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/reg/"):
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.unregistered = append(s.unregistered, strings.TrimPrefix(r.URL.Path, "/reg/"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRegisterWarp(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "x-ui.db")); err != nil {
+		t.Fatal(err)
+	}
+	server := newWarpAPIServer(t)
+	s := &WireGuardOutboundService{}
+	if err := s.settingService.setString("warpApiUrl", server.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 测试服务器使用自签名证书，没有设置 HTTP 客户端时注册会失败
+	if _, err := s.RegisterWarp("warp", ""); err == nil {
+		t.Fatal("未设置 HTTP 客户端时注册应失败")
+	}
+	s.SetWarpHTTPClient(server.Client())
+
+	outbound, err := s.RegisterWarp("warp", "geosite:openai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.registered) != 1 {
+		t.Fatalf("注册了 %d 个设备，期望 1 个", len(server.registered))
+	}
+	publicKey, err := keygen.WireGuardPublicKey(outbound.SecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publicKey != server.registered[0] {
+		t.Errorf("注册的公钥为 %v，期望 %v", server.registered[0], publicKey)
+	}
+	if outbound.PeerPublicKey != server.peerPublicKey || outbound.Endpoint != "engage.cloudflareclient.com:2408" {
+		t.Errorf("peer 为 %v %v", outbound.PeerPublicKey, outbound.Endpoint)
+	}
+	if outbound.Reserved != "1,2,3" || outbound.WarpDeviceId != "device-1" || outbound.WarpToken != "token-1" {
+		t.Errorf("WARP 设备信息为 %v %v %v", outbound.Reserved, outbound.WarpDeviceId, outbound.WarpToken)
+	}
+	if !strings.HasPrefix(outbound.Address, "172.16.0.2") || !strings.Contains(outbound.Address, "2606:4700:110:8a36::2") {
+		t.Errorf("地址为 %v", outbound.Address)
+	}
+
+	if err := s.DelOutbound(outbound.Id); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.unregistered) != 1 || server.unregistered[0] != "device-1" {
+		t.Errorf("注销的设备为 %v，期望 device-1", server.unregistered)
+	}
+}
+
+func TestWarpApiUrlFromSettings(t *testing.T) {
+	initTestDB(t)
+	r := &CloudflareWarpRegistrar{}
+	apiURL, err := r.apiURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apiURL != defaultValueMap["warpApiUrl"] {
+		t.Fatalf("未设置时 API 地址为 %v，期望设置的默认值", apiURL)
+	}
+
+	if err := r.settingService.setString("warpApiUrl", "https://warp.example.com/v0/"); err != nil {
+		t.Fatal(err)
+	}
+	if apiURL, err = r.apiURL(); err != nil || apiURL != "https://warp.example.com/v0" {
+		t.Fatalf("API 地址为 %v, %v", apiURL, err)
+	}
+	r.APIURL = "https://other.example.com"
+	if apiURL, err = r.apiURL(); err != nil || apiURL != r.APIURL {
+		t.Fatalf("指定 APIURL 时 API 地址为 %v, %v", apiURL, err)
+	}
+}
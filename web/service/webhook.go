@@ -0,0 +1,317 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/event"
+)
+
+const (
+	webhookMaxAttempts  = 5
+	webhookInitialDelay = 2 * time.Second
+	webhookTimeout      = 10 * time.Second
+	// 每个 Webhook 保留的投递记录数
+	webhookDeliveryKeep = 200
+	// 投递 goroutine 数量和等待投递的队列长度，队列满时丢弃新的投递
+	webhookWorkers   = 4
+	webhookQueueSize = 256
+)
+
+type webhookJob struct {
+	webhook   *model.Webhook
+	eventType event.Type
+	payload   []byte
+}
+
+type WebhookService struct {
+	ctx    context.Context
+	client *http.Client
+	queue  chan *webhookJob
+}
+
+func NewWebhookService(ctx context.Context) *WebhookService {
+	s := &WebhookService{
+		ctx: ctx,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+		},
+		queue: make(chan *webhookJob, webhookQueueSize),
+	}
+	for i := 0; i < webhookWorkers; i++ {
+		go s.runWorker()
+	}
+	return s
+}
+
+// runWorker 依次投递队列中的事件，重试等待期间占用当前 goroutine，ctx 结束时退出
+func (s *WebhookService) runWorker() {
+	for {
+		select {
+		case job := <-s.queue:
+			func() {
+				defer common.Recover("webhook 投递")
+				s.deliver(job.webhook, job.eventType, job.payload)
+			}()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func checkWebhook(webhook *model.Webhook) error {
+	u, err := url.ParseRequestURI(webhook.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return common.NewError("webhook url 无效:", webhook.Url)
+	}
+	for _, t := range splitWebhookEvents(webhook.Events) {
+		if !event.IsValidType(event.Type(t)) {
+			return common.NewError("未知的事件类型:", t)
+		}
+	}
+	return nil
+}
+
+func splitWebhookEvents(events string) []string {
+	result := make([]string, 0)
+	for _, t := range strings.Split(events, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func webhookAccepts(webhook *model.Webhook, t event.Type) bool {
+	events := splitWebhookEvents(webhook.Events)
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if event.Type(e) == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *WebhookService) GetWebhooks() ([]*model.Webhook, error) {
+	db := database.GetDB()
+	webhooks := make([]*model.Webhook, 0)
+	err := db.Model(model.Webhook{}).Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) GetWebhook(id int) (*model.Webhook, error) {
+	db := database.GetDB()
+	webhook := &model.Webhook{}
+	err := db.Model(model.Webhook{}).First(webhook, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) AddWebhook(webhook *model.Webhook) error {
+	if err := checkWebhook(webhook); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Create(webhook).Error
+}
+
+func (s *WebhookService) UpdateWebhook(webhook *model.Webhook) error {
+	if err := checkWebhook(webhook); err != nil {
+		return err
+	}
+	oldWebhook, err := s.GetWebhook(webhook.Id)
+	if err != nil {
+		return err
+	}
+	oldWebhook.Name = webhook.Name
+	oldWebhook.Url = webhook.Url
+	oldWebhook.Secret = webhook.Secret
+	oldWebhook.Events = webhook.Events
+	oldWebhook.Enable = webhook.Enable
+	db := database.GetDB()
+	return db.Save(oldWebhook).Error
+}
+
+func (s *WebhookService) DelWebhook(id int) error {
+	db := database.GetDB()
+	err := db.Where("webhook_id = ?", id).Delete(model.WebhookDelivery{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Delete(model.Webhook{}, id).Error
+}
+
+func (s *WebhookService) GetDeliveries(webhookId int) ([]*model.WebhookDelivery, error) {
+	db := database.GetDB()
+	deliveries := make([]*model.WebhookDelivery, 0)
+	err := db.Model(model.WebhookDelivery{}).
+		Where("webhook_id = ?", webhookId).
+		Order("id desc").
+		Limit(webhookDeliveryKeep).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Dispatch 将事件加入所有订阅了该类型的 Webhook 的投递队列，作为事件总线的处理函数
+func (s *WebhookService) Dispatch(e *event.Event) {
+	webhooks, err := s.GetWebhooks()
+	if err != nil {
+		logger.Warning("获取 webhook 失败:", err)
+		return
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		logger.Warning("序列化事件失败:", err)
+		return
+	}
+	for _, webhook := range webhooks {
+		if !webhook.Enable || !webhookAccepts(webhook, e.Type) {
+			continue
+		}
+		job := &webhookJob{
+			webhook:   webhook,
+			eventType: e.Type,
+			payload:   payload,
+		}
+		select {
+		case s.queue <- job:
+		default:
+			err := errors.New("投递队列已满，已丢弃")
+			logger.Warningf("webhook %v 投递 %v 失败: %v", webhook.Name, e.Type, err)
+			s.saveDelivery(webhook.Id, e.Type, payload, 0, 0, err)
+		}
+	}
+}
+
+// Test 向指定 Webhook 发送一条测试事件
+func (s *WebhookService) Test(id int) error {
+	webhook, err := s.GetWebhook(id)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(&event.Event{
+		Type: "test",
+		Time: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.send(webhook, "test", payload)
+	return err
+}
+
+// signWebhookPayload 对 "<时间戳>.<请求体>" 签名，接收方校验签名并拒绝时间戳过旧的请求，防止重放
+func signWebhookPayload(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookService) send(webhook *model.Webhook, eventType event.Type, payload []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "x-ui-webhook")
+	req.Header.Set("X-XUI-Event", string(eventType))
+	// 每次尝试使用当前时间，重试的请求同样能通过接收方的时间窗口检查
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-XUI-Timestamp", timestamp)
+	if webhook.Secret != "" {
+		req.Header.Set("X-XUI-Signature", signWebhookPayload(webhook.Secret, timestamp, payload))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook 返回状态码: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// deliver 失败时按指数退避重试，每次尝试都写入投递记录
+func (s *WebhookService) deliver(webhook *model.Webhook, eventType event.Type, payload []byte) {
+	delay := webhookInitialDelay
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		statusCode, err := s.send(webhook, eventType, payload)
+		s.saveDelivery(webhook.Id, eventType, payload, attempt, statusCode, err)
+		if err == nil {
+			return
+		}
+		logger.Warningf("webhook %v 投递 %v 失败(第 %d 次): %v", webhook.Name, eventType, attempt, err)
+		if attempt == webhookMaxAttempts {
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			return
+		}
+		delay *= 2
+	}
+}
+
+func (s *WebhookService) saveDelivery(webhookId int, eventType event.Type, payload []byte, attempt int, statusCode int, err error) {
+	delivery := &model.WebhookDelivery{
+		WebhookId:  webhookId,
+		EventType:  string(eventType),
+		Payload:    string(payload),
+		Attempt:    attempt,
+		StatusCode: statusCode,
+		Success:    err == nil,
+		CreatedAt:  time.Now().UnixMilli(),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	db := database.GetDB()
+	if err := db.Create(delivery).Error; err != nil {
+		logger.Warning("保存 webhook 投递记录失败:", err)
+		return
+	}
+	// 只保留该 webhook 最近的记录，ID 由所有 webhook 共用，不能按 ID 差值清理
+	keep := db.Model(model.WebhookDelivery{}).Select("id").
+		Where("webhook_id = ?", webhookId).
+		Order("id desc").
+		Limit(webhookDeliveryKeep)
+	err = db.Where("webhook_id = ? and id not in (?)", webhookId, keep).
+		Delete(model.WebhookDelivery{}).Error
+	if err != nil {
+		logger.Warning("清理 webhook 投递记录失败:", err)
+	}
+}
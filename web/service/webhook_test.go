@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/web/event"
+)
+
+// waitFor 轮询直到 cond 成立，超时则失败
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待超时:", msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookDispatchBoundedQueue(t *testing.T) {
+	initTestDB(t)
+	var inFlight, maxInFlight, received int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&inFlight, -1)
+		atomic.AddInt32(&received, 1)
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	s := NewWebhookService(ctx)
+	webhook := &model.Webhook{Name: "test", Url: server.URL, Enable: true}
+	if err := s.AddWebhook(webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	// 接收方阻塞时，超出投递 goroutine 和队列容量的事件被丢弃
+	total := webhookWorkers + webhookQueueSize + 10
+	for i := 0; i < total; i++ {
+		s.Dispatch(&event.Event{Type: event.InboundCreated})
+	}
+	waitFor(t, "投递 goroutine 全部占用", func() bool {
+		return atomic.LoadInt32(&inFlight) == webhookWorkers
+	})
+	var dropped int64
+	err := database.GetDB().Model(model.WebhookDelivery{}).Where("attempt = 0 and success = ?", false).Count(&dropped).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped < 10 {
+		t.Fatalf("队列已满时只丢弃了 %d 个投递", dropped)
+	}
+
+	close(release)
+	waitFor(t, "队列中的事件全部投递", func() bool {
+		return int64(atomic.LoadInt32(&received)) == int64(total)-dropped
+	})
+	// 每次投递写入一条记录，旧记录会被清理，按最大ID判断全部写入
+	waitFor(t, "投递记录全部写入", func() bool {
+		var lastId int64
+		database.GetDB().Model(model.WebhookDelivery{}).Select("coalesce(max(id), 0)").Row().Scan(&lastId)
+		return lastId == int64(total)
+	})
+	if max := atomic.LoadInt32(&maxInFlight); max > webhookWorkers {
+		t.Fatalf("同时投递 %d 个请求，超过 %d 个投递 goroutine", max, webhookWorkers)
+	}
+}
+
+func TestWebhookDeliveryPrunePerWebhook(t *testing.T) {
+	initTestDB(t)
+	s := &WebhookService{}
+	// 两个 webhook 的投递交替写入，ID 交错
+	for i := 0; i < webhookDeliveryKeep+50; i++ {
+		s.saveDelivery(1, event.InboundCreated, nil, 1, http.StatusOK, nil)
+		if i < 20 {
+			s.saveDelivery(2, event.InboundCreated, nil, 1, http.StatusOK, nil)
+		}
+	}
+
+	for webhookId, want := range map[int]int{1: webhookDeliveryKeep, 2: 20} {
+		deliveries := make([]*model.WebhookDelivery, 0)
+		err := database.GetDB().Where("webhook_id = ?", webhookId).Order("id desc").Find(&deliveries).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) != want {
+			t.Fatalf("webhook %d 保留了 %d 条记录，期望 %d", webhookId, len(deliveries), want)
+		}
+	}
+	// 清理的是最旧的记录
+	var lastId, firstId int
+	database.GetDB().Model(model.WebhookDelivery{}).Where("webhook_id = 1").Select("max(id)").Row().Scan(&lastId)
+	database.GetDB().Model(model.WebhookDelivery{}).Where("webhook_id = 1").Select("min(id)").Row().Scan(&firstId)
+	if lastId != webhookDeliveryKeep+70 || firstId != 71 {
+		t.Fatalf("webhook 1 保留的记录 ID 为 %d~%d，期望 71~%d", firstId, lastId, webhookDeliveryKeep+70)
+	}
+}
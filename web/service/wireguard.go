@@ -0,0 +1,183 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/keygen"
+	"x-ui/xray"
+)
+
+const (
+	// wireGuardPeerNetwork 自动分配 peer 地址的网段，.1 保留给服务端
+	wireGuardPeerNetwork   = "10.0.0.0/24"
+	wireGuardDefaultDNS    = "1.1.1.1"
+	wireGuardKeepAlive     = 25
+	wireGuardClientAllowed = "0.0.0.0/0, ::/0"
+)
+
+// WireGuardPeerOptions 添加 peer 的参数，公钥为空时由服务端生成密钥对
+type WireGuardPeerOptions struct {
+	Email      string `json:"email" form:"email"`
+	PublicKey  string `json:"publicKey" form:"publicKey"`
+	AllowedIPs string `json:"allowedIPs" form:"allowedIPs"` // 逗号分隔，为空时自动分配
+	KeepAlive  int    `json:"keepAlive" form:"keepAlive"`
+	PreShared  bool   `json:"preShared" form:"preShared"`
+}
+
+// WireGuardService 管理 WireGuard 入站的 peer 和客户端配置
+type WireGuardService struct {
+	inboundService InboundService
+}
+
+func (s *WireGuardService) getWireGuardSettings(inboundId int) (*model.Inbound, *xray.WireGuardSettings, error) {
+	inbound, err := s.inboundService.GetInbound(inboundId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if inbound.Protocol != model.WireGuard {
+		return nil, nil, common.NewError("入站不是 WireGuard 协议:", inboundId)
+	}
+	settings, err := inbound.GetSettings()
+	if err != nil {
+		return nil, nil, err
+	}
+	return inbound, settings.(*xray.WireGuardSettings), nil
+}
+
+// nextPeerAddress 在默认网段中分配未被已有 peer 使用的地址
+func nextPeerAddress(peers []*xray.WireGuardPeer) (string, error) {
+	used := map[string]bool{}
+	for _, peer := range peers {
+		for _, cidr := range peer.AllowedIPs {
+			if ip, _, err := net.ParseCIDR(cidr); err == nil {
+				used[ip.String()] = true
+			}
+		}
+	}
+	base, _, _ := net.ParseCIDR(wireGuardPeerNetwork)
+	base = base.To4()
+	for i := 2; i < 255; i++ {
+		ip := net.IPv4(base[0], base[1], base[2], byte(i)).String()
+		if !used[ip] {
+			return ip + "/32", nil
+		}
+	}
+	return "", common.NewError("网段已无可用地址:", wireGuardPeerNetwork)
+}
+
+// AddPeer 为 WireGuard 入站添加 peer，未提供公钥时生成密钥对并保存私钥用于生成客户端配置
+func (s *WireGuardService) AddPeer(inboundId int, opts *WireGuardPeerOptions) (*xray.WireGuardPeer, error) {
+	inbound, settings, err := s.getWireGuardSettings(inboundId)
+	if err != nil {
+		return nil, err
+	}
+	peer := &xray.WireGuardPeer{
+		PublicKey: opts.PublicKey,
+		Email:     strings.TrimSpace(opts.Email),
+		KeepAlive: opts.KeepAlive,
+	}
+	if peer.PublicKey == "" {
+		peer.PrivateKey, peer.PublicKey, err = keygen.GenerateWireGuardKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.PreShared {
+		peer.PreSharedKey, err = keygen.GenerateWireGuardPSK()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if strings.TrimSpace(opts.AllowedIPs) != "" {
+		for _, cidr := range strings.Split(opts.AllowedIPs, ",") {
+			peer.AllowedIPs = append(peer.AllowedIPs, strings.TrimSpace(cidr))
+		}
+	} else {
+		address, err := nextPeerAddress(settings.Peers)
+		if err != nil {
+			return nil, err
+		}
+		peer.AllowedIPs = []string{address}
+	}
+	settings.Peers = append(settings.Peers, peer)
+	if err := inbound.SetSettings(settings); err != nil {
+		return nil, err
+	}
+	if err := s.inboundService.UpdateInbound(inbound); err != nil {
+		return nil, err
+	}
+	return peer, nil
+}
+
+// DelPeer 按公钥删除 WireGuard 入站的 peer
+func (s *WireGuardService) DelPeer(inboundId int, publicKey string) error {
+	inbound, settings, err := s.getWireGuardSettings(inboundId)
+	if err != nil {
+		return err
+	}
+	peers := make([]*xray.WireGuardPeer, 0, len(settings.Peers))
+	for _, peer := range settings.Peers {
+		if peer.PublicKey != publicKey {
+			peers = append(peers, peer)
+		}
+	}
+	if len(peers) == len(settings.Peers) {
+		return common.NewError("peer 不存在:", publicKey)
+	}
+	settings.Peers = peers
+	if err := inbound.SetSettings(settings); err != nil {
+		return err
+	}
+	return s.inboundService.UpdateInbound(inbound)
+}
+
+// GetPeerConfig 生成 wg-quick 格式的客户端配置，host 为客户端连接使用的服务器地址
+func (s *WireGuardService) GetPeerConfig(inboundId int, publicKey string, host string) (string, error) {
+	inbound, settings, err := s.getWireGuardSettings(inboundId)
+	if err != nil {
+		return "", err
+	}
+	var peer *xray.WireGuardPeer
+	for _, p := range settings.Peers {
+		if p.PublicKey == publicKey {
+			peer = p
+			break
+		}
+	}
+	if peer == nil {
+		return "", common.NewError("peer 不存在:", publicKey)
+	}
+	if peer.PrivateKey == "" {
+		return "", common.NewError("peer 的私钥不由面板保存，无法生成配置:", publicKey)
+	}
+	serverPublicKey, err := keygen.WireGuardPublicKey(settings.SecretKey)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(&b, "PrivateKey = %v\n", peer.PrivateKey)
+	fmt.Fprintf(&b, "Address = %v\n", strings.Join(peer.AllowedIPs, ", "))
+	fmt.Fprintf(&b, "DNS = %v\n", wireGuardDefaultDNS)
+	if settings.MTU > 0 {
+		fmt.Fprintf(&b, "MTU = %d\n", settings.MTU)
+	}
+	b.WriteString("\n[Peer]\n")
+	fmt.Fprintf(&b, "PublicKey = %v\n", serverPublicKey)
+	if peer.PreSharedKey != "" {
+		fmt.Fprintf(&b, "PresharedKey = %v\n", peer.PreSharedKey)
+	}
+	fmt.Fprintf(&b, "AllowedIPs = %v\n", wireGuardClientAllowed)
+	fmt.Fprintf(&b, "Endpoint = %v\n", net.JoinHostPort(host, strconv.Itoa(inbound.Port)))
+	keepAlive := peer.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = wireGuardKeepAlive
+	}
+	fmt.Fprintf(&b, "PersistentKeepalive = %d\n", keepAlive)
+	return b.String(), nil
+}
@@ -0,0 +1,430 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/keygen"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+const (
+	wireGuardOutboundProtocol = "wireguard"
+	wireGuardOutboundAllowed  = "0.0.0.0/0,::/0"
+	warpDefaultMTU            = 1280
+)
+
+// WireGuardOutboundService 管理 WireGuard 出站，支持导入 wgcf 格式的配置、填写密钥或直接注册 WARP
+type WireGuardOutboundService struct {
+	ctx                    context.Context
+	outboundTrafficService OutboundTrafficService
+	settingService         SettingService
+	registrar              WarpRegistrar
+	warpHTTPClient         *http.Client
+}
+
+func NewWireGuardOutboundService(ctx context.Context) *WireGuardOutboundService {
+	return &WireGuardOutboundService{
+		ctx: ctx,
+	}
+}
+
+// SetWarpRegistrar 替换 WARP 注册实现
+func (s *WireGuardOutboundService) SetWarpRegistrar(registrar WarpRegistrar) {
+	s.registrar = registrar
+}
+
+// SetWarpHTTPClient 设置默认 WARP 注册实现使用的 HTTP 客户端，如需经代理访问 API
+func (s *WireGuardOutboundService) SetWarpHTTPClient(client *http.Client) {
+	s.warpHTTPClient = client
+}
+
+// getRegistrar 未替换注册实现时，按设置中的 API 地址访问 Cloudflare
+func (s *WireGuardOutboundService) getRegistrar() WarpRegistrar {
+	if s.registrar != nil {
+		return s.registrar
+	}
+	return &CloudflareWarpRegistrar{
+		HTTPClient:     s.warpHTTPClient,
+		settingService: s.settingService,
+	}
+}
+
+func (s *WireGuardOutboundService) getContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// getManagedOutbounds 获取启用的 WireGuard 出站的 tag 和协议
+func getManagedOutbounds() ([]*xray.Outbound, error) {
+	db := database.GetDB()
+	var tags []string
+	err := db.Model(model.WireGuardOutbound{}).Where("enable = ?", true).Order("id").Pluck("tag", &tags).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	outbounds := make([]*xray.Outbound, 0, len(tags))
+	for _, tag := range tags {
+		outbounds = append(outbounds, &xray.Outbound{
+			Tag:      tag,
+			Protocol: wireGuardOutboundProtocol,
+		})
+	}
+	return outbounds, nil
+}
+
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// normalizeAddress 不带前缀长度的地址补全为单个地址的 CIDR
+func normalizeAddress(address string) (string, error) {
+	if _, _, err := net.ParseCIDR(address); err == nil {
+		return address, nil
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", common.NewError("无效的地址:", address)
+	}
+	if ip.To4() != nil {
+		return address + "/32", nil
+	}
+	return address + "/128", nil
+}
+
+func parseReserved(reserved string) ([]int, error) {
+	items := splitList(reserved)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	if len(items) != 3 {
+		return nil, common.NewError("reserved 必须是 3 个字节:", reserved)
+	}
+	bytes := make([]int, 0, len(items))
+	for _, item := range items {
+		b, err := strconv.Atoi(item)
+		if err != nil || b < 0 || b > 255 {
+			return nil, common.NewError("reserved 必须是 3 个字节:", reserved)
+		}
+		bytes = append(bytes, b)
+	}
+	return bytes, nil
+}
+
+// ParseWireGuardProfile 解析 wgcf 或 wg-quick 格式的配置，只读取出站需要的字段
+func ParseWireGuardProfile(profile string) (*model.WireGuardOutbound, error) {
+	outbound := &model.WireGuardOutbound{}
+	addresses := make([]string, 0)
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(profile))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		// base64 密钥以 = 结尾，只按第一个 = 分隔
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, common.NewError("无效的配置行:", line)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch section + "." + key {
+		case "interface.privatekey":
+			outbound.SecretKey = value
+		case "interface.address":
+			addresses = append(addresses, splitList(value)...)
+		case "interface.mtu":
+			mtu, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, common.NewError("无效的 MTU:", value)
+			}
+			outbound.MTU = mtu
+		case "peer.publickey":
+			if outbound.PeerPublicKey != "" {
+				return nil, common.NewError("只支持一个 peer")
+			}
+			outbound.PeerPublicKey = value
+		case "peer.presharedkey":
+			outbound.PreSharedKey = value
+		case "peer.endpoint":
+			outbound.Endpoint = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	outbound.Address = strings.Join(addresses, ",")
+	return outbound, nil
+}
+
+func (s *WireGuardOutboundService) checkOutbound(outbound *model.WireGuardOutbound) error {
+	outbound.Tag = strings.TrimSpace(outbound.Tag)
+	if outbound.Tag == "" || outbound.Tag == "api" {
+		return common.NewError("出站 tag 无效:", outbound.Tag)
+	}
+	if _, err := keygen.ParseWireGuardKey(outbound.SecretKey); err != nil {
+		return err
+	}
+	if _, err := keygen.ParseWireGuardKey(outbound.PeerPublicKey); err != nil {
+		return common.NewError("peer 公钥无效:", err)
+	}
+	if outbound.PreSharedKey != "" {
+		if _, err := keygen.ParseWireGuardKey(outbound.PreSharedKey); err != nil {
+			return common.NewError("预共享密钥无效:", err)
+		}
+	}
+	addresses := make([]string, 0)
+	for _, address := range splitList(outbound.Address) {
+		address, err := normalizeAddress(address)
+		if err != nil {
+			return err
+		}
+		addresses = append(addresses, address)
+	}
+	if len(addresses) == 0 {
+		return common.NewError("出站未设置地址:", outbound.Tag)
+	}
+	outbound.Address = strings.Join(addresses, ",")
+	host, port, err := net.SplitHostPort(outbound.Endpoint)
+	if err != nil || host == "" {
+		return common.NewError("无效的 endpoint:", outbound.Endpoint)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return common.NewError("无效的 endpoint:", outbound.Endpoint)
+	}
+	if _, err := parseReserved(outbound.Reserved); err != nil {
+		return err
+	}
+	if outbound.MTU != 0 && (outbound.MTU < 576 || outbound.MTU > 65535) {
+		return common.NewError("无效的 MTU:", outbound.MTU)
+	}
+	domains := splitList(outbound.Domains)
+	for _, domain := range domains {
+		if strings.ContainsAny(domain, " \t") {
+			return common.NewError("无效的域名规则:", domain)
+		}
+	}
+	outbound.Domains = strings.Join(domains, ",")
+
+	// tag 不能与模板中的出站、负载均衡器或其他 WireGuard 出站重复
+	outbounds, err := s.outboundTrafficService.getTemplateOutbounds()
+	if err != nil {
+		return err
+	}
+	for _, o := range outbounds {
+		if o.Tag == outbound.Tag {
+			return common.NewError("出站 tag 与模板中的出站重复:", outbound.Tag)
+		}
+	}
+	db := database.GetDB()
+	var count int64
+	err = db.Model(model.Balancer{}).Where("tag = ?", outbound.Tag).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("出站 tag 与负载均衡器重复:", outbound.Tag)
+	}
+	err = db.Model(model.WireGuardOutbound{}).Where("tag = ? and id <> ?", outbound.Tag, outbound.Id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("出站 tag 已存在:", outbound.Tag)
+	}
+	return nil
+}
+
+func (s *WireGuardOutboundService) GetOutbounds() ([]*model.WireGuardOutbound, error) {
+	db := database.GetDB()
+	outbounds := make([]*model.WireGuardOutbound, 0)
+	err := db.Model(model.WireGuardOutbound{}).Order("id").Find(&outbounds).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return outbounds, nil
+}
+
+func (s *WireGuardOutboundService) GetOutbound(id int) (*model.WireGuardOutbound, error) {
+	db := database.GetDB()
+	outbound := &model.WireGuardOutbound{}
+	err := db.Model(model.WireGuardOutbound{}).First(outbound, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return outbound, nil
+}
+
+// AddOutbound 用填写的密钥添加出站
+func (s *WireGuardOutboundService) AddOutbound(outbound *model.WireGuardOutbound) error {
+	outbound.Id = 0
+	if err := s.checkOutbound(outbound); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Create(outbound).Error
+}
+
+// ImportProfile 导入 wgcf-profile.conf 等配置文件，wgcf 的配置中没有 reserved，可另外填写
+func (s *WireGuardOutboundService) ImportProfile(tag string, profile string, reserved string, domains string) (*model.WireGuardOutbound, error) {
+	outbound, err := ParseWireGuardProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	outbound.Tag = tag
+	outbound.Reserved = reserved
+	outbound.Domains = domains
+	outbound.Enable = true
+	if err := s.AddOutbound(outbound); err != nil {
+		return nil, err
+	}
+	return outbound, nil
+}
+
+// RegisterWarp 生成密钥并注册新的 WARP 设备，用得到的参数添加出站
+func (s *WireGuardOutboundService) RegisterWarp(tag string, domains string) (*model.WireGuardOutbound, error) {
+	secretKey, publicKey, err := keygen.GenerateWireGuardKey()
+	if err != nil {
+		return nil, err
+	}
+	account, err := s.getRegistrar().Register(s.getContext(), publicKey)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, 0, 2)
+	for _, address := range []string{account.AddressV4, account.AddressV6} {
+		if address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	reserved := make([]string, 0, len(account.Reserved))
+	for _, b := range account.Reserved {
+		reserved = append(reserved, strconv.Itoa(b))
+	}
+	outbound := &model.WireGuardOutbound{
+		Tag:           tag,
+		SecretKey:     secretKey,
+		Address:       strings.Join(addresses, ","),
+		PeerPublicKey: account.PeerPublicKey,
+		Endpoint:      account.Endpoint,
+		Reserved:      strings.Join(reserved, ","),
+		MTU:           warpDefaultMTU,
+		Domains:       domains,
+		Enable:        true,
+		WarpDeviceId:  account.DeviceId,
+		WarpToken:     account.Token,
+	}
+	if err := s.AddOutbound(outbound); err != nil {
+		s.unregisterWarp(outbound)
+		return nil, err
+	}
+	return outbound, nil
+}
+
+// UpdateOutbound 修改出站，保留面板注册的 WARP 设备信息
+func (s *WireGuardOutboundService) UpdateOutbound(outbound *model.WireGuardOutbound) error {
+	oldOutbound, err := s.GetOutbound(outbound.Id)
+	if err != nil {
+		return err
+	}
+	outbound.WarpDeviceId = oldOutbound.WarpDeviceId
+	outbound.WarpToken = oldOutbound.WarpToken
+	if err := s.checkOutbound(outbound); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Save(outbound).Error
+}
+
+// DelOutbound 删除出站，面板注册的 WARP 设备同时注销，注销失败不影响删除
+func (s *WireGuardOutboundService) DelOutbound(id int) error {
+	outbound, err := s.GetOutbound(id)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	if err := db.Delete(model.WireGuardOutbound{}, id).Error; err != nil {
+		return err
+	}
+	s.unregisterWarp(outbound)
+	return nil
+}
+
+func (s *WireGuardOutboundService) unregisterWarp(outbound *model.WireGuardOutbound) {
+	if outbound.WarpDeviceId == "" {
+		return
+	}
+	err := s.getRegistrar().Unregister(s.getContext(), outbound.WarpDeviceId, outbound.WarpToken)
+	if err != nil {
+		logger.Warning("注销 WARP 设备失败:", outbound.WarpDeviceId, err)
+	}
+}
+
+// ApplyToConfig 把启用的 WireGuard 出站追加到出站列表，并把其域名的路由规则插入到已有规则之前
+func (s *WireGuardOutboundService) ApplyToConfig(config *xray.Config) error {
+	outbounds, err := s.GetOutbounds()
+	if err != nil {
+		return err
+	}
+	outboundConfigs := make([]*xray.OutboundConfig, 0, len(outbounds))
+	rules := make([]interface{}, 0)
+	for _, outbound := range outbounds {
+		if !outbound.Enable {
+			continue
+		}
+		reserved, err := parseReserved(outbound.Reserved)
+		if err != nil {
+			logger.Warningf("出站 %v 的 reserved 无效，已跳过: %v", outbound.Tag, err)
+			continue
+		}
+		outboundConfigs = append(outboundConfigs, &xray.OutboundConfig{
+			Tag:      outbound.Tag,
+			Protocol: wireGuardOutboundProtocol,
+			Settings: &xray.WireGuardOutboundSettings{
+				SecretKey: outbound.SecretKey,
+				Address:   splitList(outbound.Address),
+				Peers: []*xray.WireGuardOutboundPeer{{
+					PublicKey:    outbound.PeerPublicKey,
+					PreSharedKey: outbound.PreSharedKey,
+					Endpoint:     outbound.Endpoint,
+					AllowedIPs:   splitList(wireGuardOutboundAllowed),
+				}},
+				Reserved: reserved,
+				MTU:      outbound.MTU,
+			},
+		})
+		if domains := splitList(outbound.Domains); len(domains) > 0 {
+			rules = append(rules, map[string]interface{}{
+				"type":        "field",
+				"domain":      domains,
+				"outboundTag": outbound.Tag,
+			})
+		}
+	}
+	if err := config.AppendOutbounds(outboundConfigs...); err != nil {
+		return err
+	}
+	return config.PrependRoutingRules(rules...)
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"os/exec"
+	"fmt"
 	"runtime"
-	"strings"
 	"sync"
 	"time"
 	"x-ui/logger"
+	"x-ui/util/json_util"
+	"x-ui/util/keygen"
+	"x-ui/web/event"
 	"x-ui/xray"
 
 	"go.uber.org/atomic"
@@ -26,8 +28,13 @@ var (
 	ErrXrayNotRunning = errors.New("xray未运行")
 
 	// 缓存控制
-	trafficCacheTTL = time.Second * 10
-	configCacheTTL  = time.Minute * 5
+	configCacheTTL = time.Minute * 5
+
+	// 清零时多读出的、写入流量日志失败的流量，按 tag 合并，数量不超过入站、出站和客户端的总数
+	pendingTraffics = map[string]*xray.Traffic{}
+	// 已写入流量日志但尚未在 xray 中清零的计数，属于 unresetSource，下次读取时扣除
+	unresetTraffics map[string]*xray.Traffic
+	unresetSource   trafficSource
 
 	// 内存控制
 	lastGCTime = time.Now()
@@ -36,20 +43,20 @@ var (
 
 // XrayServiceImpl 实现XrayService接口
 type XrayServiceImpl struct {
-	ctx            context.Context
-	inboundService InboundService
-	settingService SettingService
+	ctx               context.Context
+	inboundService    *InboundService
+	settingService    *SettingService
+	clientIpService   ClientIpService
+	certService       CertService
+	fallbackService   FallbackService
+	balancerService   BalancerService
+	wgOutboundService WireGuardOutboundService
 
 	// 配置缓存
 	configCache     *xray.Config
 	configCacheTime time.Time
 	configMutex     sync.RWMutex
 
-	// 流量缓存
-	trafficCache     map[string]int64
-	trafficCacheTime time.Time
-	trafficMutex     sync.RWMutex
-
 	// 资源统计
 	memStats     runtime.MemStats
 	lastMemStats runtime.MemStats
@@ -59,11 +66,9 @@ type XrayServiceImpl struct {
 // NewXrayService 创建新的XrayService实例
 func NewXrayService(ctx context.Context) XrayService {
 	service := &XrayServiceImpl{
-		ctx:              ctx,
-		configCacheTime:  time.Time{}, // 零值，表示未缓存
-		trafficCacheTime: time.Time{},
-		trafficCache:     make(map[string]int64),
-		memStatsTime:     time.Now(),
+		ctx:             ctx,
+		configCacheTime: time.Time{}, // 零值，表示未缓存
+		memStatsTime:    time.Now(),
 	}
 
 	// 启动内存监控
@@ -109,12 +114,12 @@ func (s *XrayServiceImpl) monitorMemory(ctx context.Context) {
 }
 
 // SetInboundService 设置InboundService依赖
-func (s *XrayServiceImpl) SetInboundService(inboundService InboundService) {
+func (s *XrayServiceImpl) SetInboundService(inboundService *InboundService) {
 	s.inboundService = inboundService
 }
 
 // SetSettingService 设置SettingService依赖
-func (s *XrayServiceImpl) SetSettingService(settingService SettingService) {
+func (s *XrayServiceImpl) SetSettingService(settingService *SettingService) {
 	s.settingService = settingService
 }
 
@@ -154,6 +159,14 @@ func (s *XrayServiceImpl) GetXrayVersion() string {
 	return p.GetVersion()
 }
 
+// GetXrayAPIPort 获取Xray API端口
+func (s *XrayServiceImpl) GetXrayAPIPort() int {
+	if p == nil {
+		return 0
+	}
+	return p.GetAPIPort()
+}
+
 // GetXrayConfig 获取Xray配置
 func (s *XrayServiceImpl) GetXrayConfig() (*xray.Config, error) {
 	// 检查服务依赖
@@ -196,13 +209,79 @@ func (s *XrayServiceImpl) GetXrayConfig() (*xray.Config, error) {
 		return nil, err
 	}
 
-	// 添加启用的入站配置
+	// 添加启用的入站配置，记录多监听地址生成的 tag 供路由规则引用
+	inboundTags := make(map[string][]string)
 	for _, inbound := range inbounds {
 		if !inbound.Enable {
 			continue
 		}
-		inboundConfig := inbound.GenXrayInboundConfig()
-		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
+		// 替换入站引用的托管证书
+		streamSettings, err := s.certService.ResolveStreamSettings(inbound.StreamSettings)
+		if err != nil {
+			logger.Warningf("入站 %v 的证书配置无效，已跳过: %v", inbound.Tag, err)
+			continue
+		}
+		// 按回落目标的当前监听地址生成 fallbacks
+		settings, err := s.fallbackService.ResolveSettings(inbound)
+		if err != nil {
+			logger.Warningf("入站 %v 的回落配置无效，已跳过: %v", inbound.Tag, err)
+			continue
+		}
+		// 客户端流量按入站分别统计
+		settings, err = genClientStatsSettings(inbound.Tag, settings)
+		if err != nil {
+			logger.Warningf("入站 %v 的客户端配置无效，已跳过: %v", inbound.Tag, err)
+			continue
+		}
+		for _, inboundConfig := range inbound.GenXrayInboundConfigs() {
+			inboundConfig.Settings = json_util.RawMessage(settings)
+			inboundConfig.StreamSettings = json_util.RawMessage(streamSettings)
+			xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
+			inboundTags[inbound.Tag] = append(inboundTags[inbound.Tag], inboundConfig.Tag)
+		}
+	}
+
+	// 添加 WireGuard 出站及其域名路由
+	if err = s.wgOutboundService.ApplyToConfig(xrayConfig); err != nil {
+		return nil, err
+	}
+
+	// 出站需要 tag 才能统计流量
+	if err = xrayConfig.TagOutbounds(); err != nil {
+		return nil, err
+	}
+	if err = xrayConfig.EnableOutboundStats(); err != nil {
+		return nil, err
+	}
+
+	// 负载均衡器和出站观测
+	if err = s.balancerService.ApplyToConfig(xrayConfig); err != nil {
+		return nil, err
+	}
+
+	// 有客户端设置了IP数量限制时开启访问日志，用于统计客户端IP
+	ipLimits, err := s.clientIpService.GetClientIpLimits()
+	if err != nil {
+		return nil, err
+	}
+	if len(ipLimits) > 0 {
+		if err = xrayConfig.SetAccessLog(xray.GetAccessLogPath()); err != nil {
+			return nil, err
+		}
+	}
+
+	// 添加超出IP限制的封禁规则
+	blockRules, err := s.clientIpService.GenBlockRules()
+	if err != nil {
+		return nil, err
+	}
+	if err = xrayConfig.PrependRoutingRules(blockRules...); err != nil {
+		return nil, err
+	}
+
+	// 规则只引用数据库中的 tag，扩展到额外监听地址生成的入站，避免绕过封禁等规则
+	if err = xrayConfig.ExpandInboundTags(inboundTags); err != nil {
+		return nil, err
 	}
 
 	// 更新缓存
@@ -212,42 +291,123 @@ func (s *XrayServiceImpl) GetXrayConfig() (*xray.Config, error) {
 	return xrayConfig, nil
 }
 
-// GetXrayTraffic 获取Xray流量统计
-func (s *XrayServiceImpl) GetXrayTraffic() (map[string]int64, error) {
-	if !s.IsXrayRunning() {
-		return nil, ErrXrayNotRunning
+func trafficKey(traffic *xray.Traffic) string {
+	return fmt.Sprintf("%v|%v|%v", traffic.IsInbound, traffic.IsUser, traffic.Tag)
+}
+
+// subTraffics 返回 traffics 中超出 base 的部分，计数只增不减，差值为负时按 0 处理
+func subTraffics(traffics []*xray.Traffic, base map[string]*xray.Traffic) []*xray.Traffic {
+	result := make([]*xray.Traffic, 0, len(traffics))
+	for _, traffic := range traffics {
+		t := *traffic
+		if old, ok := base[trafficKey(traffic)]; ok {
+			t.Up = max(t.Up-old.Up, 0)
+			t.Down = max(t.Down-old.Down, 0)
+		}
+		result = append(result, &t)
 	}
+	return result
+}
 
-	// 先尝试读取缓存
-	s.trafficMutex.RLock()
-	if time.Since(s.trafficCacheTime) < trafficCacheTTL {
-		result := make(map[string]int64, len(s.trafficCache))
-		for k, v := range s.trafficCache {
-			result[k] = v
+func addPendingTraffics(traffics []*xray.Traffic) {
+	for _, traffic := range traffics {
+		key := trafficKey(traffic)
+		if pending, ok := pendingTraffics[key]; ok {
+			pending.Up += traffic.Up
+			pending.Down += traffic.Down
+			continue
 		}
-		s.trafficMutex.RUnlock()
-		return result, nil
+		t := *traffic
+		pendingTraffics[key] = &t
 	}
-	s.trafficMutex.RUnlock()
+}
+
+// trafficSource 可读出并清零流量计数的 xray 进程
+type trafficSource interface {
+	GetTraffic(reset bool) ([]*xray.Traffic, error)
+}
+
+// collectTraffic 把 xray 的流量计数写入流量日志后再清零，调用方需持有 lock
+func (s *XrayServiceImpl) collectTraffic() error {
+	if p == nil || !p.IsRunning() {
+		return nil
+	}
+	return s.journalTraffic(p)
+}
 
-	// 获取新的流量数据
-	traffic, err := p.GetTraffic(true)
+// journalTraffic 先不清零地读取并写入流量日志，写入成功后再清零；清零时读出的是清零前的值，与已写入部分的差值再写一次日志。
+// 任何一步失败时计数仍保留在 xray 中，或记入 unresetTraffics、pendingTraffics，不会丢失或重复计数
+func (s *XrayServiceImpl) journalTraffic(source trafficSource) error {
+	if unresetSource != source {
+		unresetTraffics = nil
+		unresetSource = source
+	}
+	traffics, err := source.GetTraffic(false)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	journals := subTraffics(traffics, unresetTraffics)
+	for _, pending := range pendingTraffics {
+		journals = append(journals, pending)
+	}
+	if err := s.inboundService.JournalTraffic(journals); err != nil {
+		return err
+	}
+	pendingTraffics = map[string]*xray.Traffic{}
+	unresetTraffics = make(map[string]*xray.Traffic, len(traffics))
+	for _, traffic := range traffics {
+		unresetTraffics[trafficKey(traffic)] = traffic
 	}
 
-	// 更新缓存
-	s.trafficMutex.Lock()
-	defer s.trafficMutex.Unlock()
+	traffics, err = source.GetTraffic(true)
+	if err != nil {
+		return err
+	}
+	extra := subTraffics(traffics, unresetTraffics)
+	unresetTraffics = nil
+	if err := s.inboundService.JournalTraffic(extra); err != nil {
+		addPendingTraffics(extra)
+		return err
+	}
+	return nil
+}
+
+// GetXrayTraffic 读出自上次读取以来的流量并累加到入站，返回本次累加的流量
+func (s *XrayServiceImpl) GetXrayTraffic() ([]*xray.Traffic, error) {
+	lock.Lock()
+	if !s.IsXrayRunning() {
+		lock.Unlock()
+		return nil, ErrXrayNotRunning
+	}
+	err := s.collectTraffic()
+	lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.inboundService.ApplyTrafficJournal()
+}
 
-	result := make(map[string]int64, len(traffic))
-	for _, t := range traffic {
-		result[t.Tag] = t.Value
-		s.trafficCache[t.Tag] = t.Value
+// ReconcileTraffic 启动时累加上次退出前已写入日志但未累加的流量
+func (s *XrayServiceImpl) ReconcileTraffic() error {
+	traffics, err := s.inboundService.ApplyTrafficJournal()
+	if err != nil {
+		return err
+	}
+	if len(traffics) > 0 {
+		logger.Info("补记上次退出前未累加的流量记录:", len(traffics))
 	}
-	s.trafficCacheTime = time.Now()
+	return nil
+}
 
-	return result, nil
+// flushTrafficBeforeStop 停止 xray 前读出最后一次流量，调用方需持有 lock
+func (s *XrayServiceImpl) flushTrafficBeforeStop() {
+	if err := s.collectTraffic(); err != nil {
+		logger.Warning("停止 xray 前记录流量失败:", err)
+		return
+	}
+	if _, err := s.inboundService.ApplyTrafficJournal(); err != nil {
+		logger.Warning("累加流量失败，将在下次统计时补记:", err)
+	}
 }
 
 // RestartXray 重启Xray服务
@@ -268,7 +428,8 @@ func (s *XrayServiceImpl) RestartXray(force bool) error {
 			logger.Debug("配置未变化，无需重启xray")
 			return nil
 		}
-		// 停止当前运行的进程
+		// 停止当前运行的进程，新进程的计数从零开始
+		s.flushTrafficBeforeStop()
 		if err := p.Stop(); err != nil {
 			logger.Warning("停止xray时发生错误:", err)
 		}
@@ -285,7 +446,12 @@ func (s *XrayServiceImpl) RestartXray(force bool) error {
 	runtime.GC()
 	lastGCTime = time.Now()
 
-	return p.Start()
+	if err := p.Start(); err != nil {
+		return err
+	}
+	XrayRestartCounter.Inc(nil)
+	event.Publish(event.XrayRestarted, map[string]string{"version": p.GetVersion()})
+	return nil
 }
 
 // StopXray 停止Xray服务
@@ -301,6 +467,7 @@ func (s *XrayServiceImpl) StopXray() error {
 	// 清除缓存
 	s.InvalidateCache()
 
+	s.flushTrafficBeforeStop()
 	return p.Stop()
 }
 
@@ -321,42 +488,12 @@ func (s *XrayServiceImpl) InvalidateCache() {
 	s.configCacheTime = time.Time{}
 	s.configMutex.Unlock()
 
-	s.trafficMutex.Lock()
-	s.trafficCache = make(map[string]int64)
-	s.trafficCacheTime = time.Time{}
-	s.trafficMutex.Unlock()
-
 	// 做一次GC
 	runtime.GC()
 	lastGCTime = time.Now()
 }
 
-// 生成Reality密钥对
-func (s *XrayService) GenerateRealityKeyPair() (string, string, error) {
-	// 调用xray命令生成密钥对
-	cmd := exec.Command("xray", "x25519")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", "", err
-	}
-
-	// 解析输出
-	outputStr := string(output)
-	lines := strings.Split(outputStr, "\n")
-
-	// 提取私钥和公钥
-	var privateKey, publicKey string
-	for _, line := range lines {
-		if strings.Contains(line, "Private key:") {
-			privateKey = strings.TrimSpace(strings.TrimPrefix(line, "Private key:"))
-		} else if strings.Contains(line, "Public key:") {
-			publicKey = strings.TrimSpace(strings.TrimPrefix(line, "Public key:"))
-		}
-	}
-
-	if privateKey == "" || publicKey == "" {
-		return "", "", errors.New("无法生成Reality密钥对")
-	}
-
-	return privateKey, publicKey, nil
+// GenerateRealityKeyPair 生成Reality密钥对，返回私钥和公钥
+func (s *XrayServiceImpl) GenerateRealityKeyPair() (string, string, error) {
+	return keygen.GenerateX25519()
 }
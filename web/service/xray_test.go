@@ -0,0 +1,240 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/xray"
+)
+
+// fakeTrafficSource 模拟 xray 的流量计数，读出时按 reset 清零
+type fakeTrafficSource struct {
+	counters map[string]*xray.Traffic
+	err      error
+	// beforeReset 在清零读取前调用，resetErr 不为空时清零失败
+	beforeReset func()
+	resetErr    error
+}
+
+func (f *fakeTrafficSource) add(tag string, up int64, down int64) {
+	traffic, ok := f.counters[tag]
+	if !ok {
+		traffic = &xray.Traffic{IsInbound: true, Tag: tag}
+		f.counters[tag] = traffic
+	}
+	traffic.Up += up
+	traffic.Down += down
+}
+
+func (f *fakeTrafficSource) GetTraffic(reset bool) ([]*xray.Traffic, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if reset {
+		if f.beforeReset != nil {
+			f.beforeReset()
+		}
+		if f.resetErr != nil {
+			return nil, f.resetErr
+		}
+	}
+	traffics := make([]*xray.Traffic, 0, len(f.counters))
+	for _, traffic := range f.counters {
+		t := *traffic
+		traffics = append(traffics, &t)
+		if reset {
+			traffic.Up, traffic.Down = 0, 0
+		}
+	}
+	return traffics, nil
+}
+
+func initTrafficTest(t *testing.T, tags ...string) *XrayServiceImpl {
+	t.Helper()
+	initTestDB(t)
+	resetTrafficState := func() {
+		pendingTraffics = map[string]*xray.Traffic{}
+		unresetTraffics = nil
+		unresetSource = nil
+	}
+	resetTrafficState()
+	t.Cleanup(resetTrafficState)
+	for i, tag := range tags {
+		inbound := &model.Inbound{Port: 10000 + i, Tag: tag, Protocol: model.VMess}
+		if err := database.GetDB().Create(inbound).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &XrayServiceImpl{inboundService: &InboundService{}}
+}
+
+func checkInboundTraffic(t *testing.T, tag string, up int64, down int64) {
+	t.Helper()
+	inbound := &model.Inbound{}
+	if err := database.GetDB().Where("tag = ?", tag).First(inbound).Error; err != nil {
+		t.Fatal(err)
+	}
+	if inbound.Up != up || inbound.Down != down {
+		t.Fatalf("入站 %v 流量为 %d/%d，应为 %d/%d", tag, inbound.Up, inbound.Down, up, down)
+	}
+}
+
+func countJournals(t *testing.T) int64 {
+	t.Helper()
+	var count int64
+	if err := database.GetDB().Model(model.TrafficJournal{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// journaledTraffic 流量日志中 tag 的累计流量
+func journaledTraffic(t *testing.T, tag string) (int64, int64) {
+	t.Helper()
+	var up, down int64
+	err := database.GetDB().Model(model.TrafficJournal{}).
+		Select("coalesce(sum(up), 0), coalesce(sum(down), 0)").
+		Where("tag = ?", tag).
+		Row().Scan(&up, &down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return up, down
+}
+
+func TestJournalTrafficBeforeReset(t *testing.T) {
+	s := initTrafficTest(t, "in-a", "in-b")
+	source := &fakeTrafficSource{counters: map[string]*xray.Traffic{}}
+	source.add("in-a", 100, 200)
+	source.add("in-b", 1, 2)
+
+	// 清零前流量日志中已有全部流量；读取和清零之间新增的流量在清零后补写
+	resets := 0
+	source.beforeReset = func() {
+		resets++
+		if up, down := journaledTraffic(t, "in-a"); up != 100 || down != 200 {
+			t.Fatalf("清零前流量日志中 in-a 为 %d/%d，应为 100/200", up, down)
+		}
+		source.add("in-a", 5, 5)
+	}
+	if err := s.journalTraffic(source); err != nil {
+		t.Fatal(err)
+	}
+	if resets != 1 {
+		t.Fatalf("清零了 %d 次，应为 1 次", resets)
+	}
+	if up, down := journaledTraffic(t, "in-a"); up != 105 || down != 205 {
+		t.Fatalf("流量日志中 in-a 为 %d/%d，应为 105/205", up, down)
+	}
+	source.beforeReset = nil
+
+	if err := s.ReconcileTraffic(); err != nil {
+		t.Fatal(err)
+	}
+	checkInboundTraffic(t, "in-a", 105, 205)
+	checkInboundTraffic(t, "in-b", 1, 2)
+}
+
+func TestJournalTrafficResetError(t *testing.T) {
+	s := initTrafficTest(t, "in-a")
+	source := &fakeTrafficSource{counters: map[string]*xray.Traffic{}, resetErr: errors.New("api unavailable")}
+	source.add("in-a", 100, 200)
+
+	// 写入流量日志后清零失败，流量已保存，计数仍在 xray 中
+	if err := s.journalTraffic(source); err == nil {
+		t.Fatal("清零失败时应返回错误")
+	}
+	if up, down := journaledTraffic(t, "in-a"); up != 100 || down != 200 {
+		t.Fatalf("流量日志中 in-a 为 %d/%d，应为 100/200", up, down)
+	}
+
+	// 下次读取时扣除已写入的部分，不重复计数
+	source.resetErr = nil
+	source.add("in-a", 10, 20)
+	if err := s.journalTraffic(source); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.inboundService.ApplyTrafficJournal(); err != nil {
+		t.Fatal(err)
+	}
+	checkInboundTraffic(t, "in-a", 110, 220)
+}
+
+func TestJournalTrafficReadError(t *testing.T) {
+	s := initTrafficTest(t, "in-a")
+	source := &fakeTrafficSource{counters: map[string]*xray.Traffic{}, err: errors.New("api unavailable")}
+	source.add("in-a", 100, 200)
+
+	if err := s.journalTraffic(source); err == nil {
+		t.Fatal("读取失败时应返回错误")
+	}
+	if count := countJournals(t); count != 0 {
+		t.Fatalf("读取失败时写入了 %d 条流量日志", count)
+	}
+
+	// 计数仍保留在 xray 中，恢复后读出
+	source.err = nil
+	if err := s.journalTraffic(source); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.inboundService.ApplyTrafficJournal(); err != nil {
+		t.Fatal(err)
+	}
+	checkInboundTraffic(t, "in-a", 100, 200)
+}
+
+func TestJournalTrafficWriteErrorKeepsPending(t *testing.T) {
+	s := initTrafficTest(t, "in-a")
+	source := &fakeTrafficSource{counters: map[string]*xray.Traffic{}}
+	source.add("in-a", 100, 200)
+
+	db := database.GetDB()
+	if err := db.Migrator().DropTable(&model.TrafficJournal{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.journalTraffic(source); err == nil {
+		t.Fatal("写入流量日志失败时应返回错误")
+	}
+	if err := db.AutoMigrate(&model.TrafficJournal{}); err != nil {
+		t.Fatal(err)
+	}
+
+	source.add("in-a", 10, 20)
+	if err := s.journalTraffic(source); err != nil {
+		t.Fatal(err)
+	}
+	if len(pendingTraffics) != 0 {
+		t.Fatalf("写入成功后仍有 %d 条待写入流量", len(pendingTraffics))
+	}
+	if _, err := s.inboundService.ApplyTrafficJournal(); err != nil {
+		t.Fatal(err)
+	}
+	checkInboundTraffic(t, "in-a", 110, 220)
+}
+
+func TestReconcileTraffic(t *testing.T) {
+	s := initTrafficTest(t, "in-a")
+	// 上次退出前已写入流量日志但未累加，多监听地址的 tag 累加到数据库中的入站
+	journals := []*model.TrafficJournal{
+		{IsInbound: true, Tag: "in-a", Up: 100, Down: 200},
+		{IsInbound: true, Tag: "in-a@1", Up: 1, Down: 2},
+	}
+	if err := database.GetDB().Create(&journals).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ReconcileTraffic(); err != nil {
+		t.Fatal(err)
+	}
+	checkInboundTraffic(t, "in-a", 101, 202)
+	if count := countJournals(t); count != 0 {
+		t.Fatalf("累加后仍有 %d 条流量日志", count)
+	}
+
+	// 重复执行不会重复计数
+	if err := s.ReconcileTraffic(); err != nil {
+		t.Fatal(err)
+	}
+	checkInboundTraffic(t, "in-a", 101, 202)
+}
@@ -9,6 +9,7 @@ import (
 
 const (
 	loginUser = "LOGIN_USER"
+	apiUser   = "API_USER"
 )
 
 func init() {
@@ -21,7 +22,15 @@ func SetLoginUser(c *gin.Context, user *model.User) error {
 	return s.Save()
 }
 
+// SetApiUser 通过 API Token 认证的请求只在本次请求内视为已登录
+func SetApiUser(c *gin.Context, user *model.User) {
+	c.Set(apiUser, user)
+}
+
 func GetLoginUser(c *gin.Context) *model.User {
+	if obj, ok := c.Get(apiUser); ok {
+		return obj.(*model.User)
+	}
 	s := sessions.Default(c)
 	obj := s.Get(loginUser)
 	if obj == nil {
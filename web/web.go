@@ -2,6 +2,8 @@ package web
 
 import (
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"embed"
 	"errors"
 	"fmt"
@@ -17,8 +19,11 @@ import (
 	"x-ui/config"
 	"x-ui/logger"
 	"x-ui/web/controller"
+	"x-ui/web/event"
 	"x-ui/web/job"
+	"x-ui/web/network"
 	"x-ui/web/service"
+	"x-ui/web/session"
 
 	"github.com/BurntSushi/toml"
 	"github.com/gin-contrib/sessions"
@@ -92,15 +97,36 @@ type Server struct {
 	listener   net.Listener
 
 	// 控制器
-	index  *controller.IndexController
-	server *controller.ServerController
-	xui    *controller.XUIController
+	index   *controller.IndexController
+	server  *controller.ServerController
+	xui     *controller.XUIController
+	metrics *controller.MetricsController
+	health  *controller.HealthController
+	webhook *controller.WebhookController
+	cert    *controller.CertController
+	node    *controller.NodeController
 
 	// 服务
-	xrayService    *service.XrayService
+	xrayService    service.XrayService
 	settingService *service.SettingService
 	inboundService *service.InboundService
 
+	clientIpService *service.ClientIpService
+	serverService   service.ServerService
+	metricsService  *service.MetricsService
+	healthService   *service.HealthService
+	tgbot           *service.Tgbot
+	webhookService  *service.WebhookService
+	mailService     *service.MailService
+	certService     *service.CertService
+	nodeService     *service.NodeService
+
+	outboundTrafficService *service.OutboundTrafficService
+	geoService             *service.GeoService
+
+	// 取消事件订阅
+	unsubscribeWebhook func()
+
 	// 定时任务
 	cron *cron.Cron
 
@@ -128,23 +154,52 @@ func (s *Server) initializeServices() error {
 	s.xrayService = service.NewXrayService(s.ctx)
 	s.settingService = service.NewSettingService(s.ctx)
 	s.inboundService = service.NewInboundService(s.ctx)
+	s.clientIpService = service.NewClientIpService(s.ctx)
 
 	// 设置服务之间的依赖关系
 	s.xrayService.SetInboundService(s.inboundService)
 	s.xrayService.SetSettingService(s.settingService)
 
 	// 初始化serverService
-	serverService := service.NewServerService(s.ctx)
-	serverService.SetXrayService(s.xrayService)
+	s.serverService = service.NewServerService(s.ctx)
+	s.serverService.SetXrayService(s.xrayService)
+
+	s.metricsService = service.NewMetricsService(s.ctx)
+	s.metricsService.SetServerService(s.serverService)
+
+	s.healthService = service.NewHealthService(s.ctx)
+	s.healthService.SetXrayService(s.xrayService)
+
+	s.tgbot = service.NewTgbot(s.ctx)
+	s.tgbot.SetServerService(s.serverService)
+	s.tgbot.SetXrayService(s.xrayService)
+
+	s.mailService = service.NewMailService(s.ctx)
+
+	s.certService = service.NewCertService(s.ctx)
+
+	s.nodeService = service.NewNodeService(s.ctx)
+
+	s.outboundTrafficService = service.NewOutboundTrafficService(s.ctx)
+
+	s.geoService = service.NewGeoService(s.ctx)
+
+	s.webhookService = service.NewWebhookService(s.ctx)
+	s.unsubscribeWebhook = event.Subscribe(s.webhookService.Dispatch)
 
 	return nil
 }
 
 // 初始化控制器
 func (s *Server) initializeControllers(router *gin.RouterGroup) {
+	s.metrics = controller.NewMetricsController(router, s.metricsService)
+	s.health = controller.NewHealthController(router, s.healthService)
+	s.webhook = controller.NewWebhookController(router, s.webhookService)
+	s.cert = controller.NewCertController(router, s.certService, s.xrayService)
+	s.node = controller.NewNodeController(router, s.nodeService)
 	s.index = controller.NewIndexController(router)
-	s.server = controller.NewServerController(router)
-	s.xui = controller.NewXUIController(router)
+	s.server = controller.NewServerController(router, s.serverService)
+	s.xui = controller.NewXUIController(router, s.xrayService)
 }
 
 // 获取HTML文件列表
@@ -222,6 +277,7 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	assetsBasePath := basePath + "assets/"
 	store := cookie.NewStore([]byte(secret))
 	engine.Use(sessions.Sessions("session", store))
+	engine.Use(s.apiTokenMiddleware())
 
 	if len(basePath) > 0 && basePath != "/" {
 		engine.GET("/", func(c *gin.Context) {
@@ -301,6 +357,32 @@ func (s *Server) corsMiddleware() gin.HandlerFunc {
 	}
 }
 
+// API Token 中间件 - 带 Bearer Token 的请求按第一个用户登录处理，用于多节点管理
+// Token 不匹配时不拦截，交给路由自己的鉴权处理，例如 /metrics 使用单独的 metricsToken
+func (s *Server) apiTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			c.Next()
+			return
+		}
+		token, err := s.settingService.GetApiToken()
+		if err != nil || token == "" ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			c.Next()
+			return
+		}
+		userService := service.UserService{}
+		user, err := userService.GetFirstUser()
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		session.SetApiUser(c, user)
+		c.Next()
+	}
+}
+
 // 安全头中间件 - 添加安全相关的HTTP头
 func (s *Server) securityHeadersMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -443,12 +525,19 @@ func (s *Server) startTask() error {
 	// 添加定时任务
 	var err error
 	// 统计和通知任务
-	statsNotifyJob := job.NewStatsNotifyJob(s.xrayService, s.settingService, s.inboundService)
+	statsNotifyJob := job.NewStatsNotifyJob(s.xrayService, s.settingService, s.inboundService, s.tgbot)
 	err = statsNotifyJob.Add(c)
 	if err != nil {
 		return fmt.Errorf("添加统计通知任务失败: %v", err)
 	}
 
+	// 流量统计任务
+	xrayTrafficJob := job.NewXrayTrafficJob(s.xrayService)
+	err = xrayTrafficJob.Add(c)
+	if err != nil {
+		return fmt.Errorf("添加流量统计任务失败: %v", err)
+	}
+
 	// Xray 重载任务
 	xrayReloadJob := job.NewXrayReloadJob(s.xrayService)
 	err = xrayReloadJob.Add(c)
@@ -456,6 +545,76 @@ func (s *Server) startTask() error {
 		return fmt.Errorf("添加Xray重载任务失败: %v", err)
 	}
 
+	// 客户端IP数量限制任务
+	checkClientIpJob := job.NewCheckClientIpJob(s.xrayService, s.clientIpService)
+	err = checkClientIpJob.Add(c)
+	if err != nil {
+		return fmt.Errorf("添加客户端IP检查任务失败: %v", err)
+	}
+
+	// Xray 运行状态检查任务
+	checkXrayRunningJob := job.NewCheckXrayRunningJob(s.xrayService, s.tgbot)
+	err = checkXrayRunningJob.Add(c)
+	if err != nil {
+		return fmt.Errorf("添加Xray运行检查任务失败: %v", err)
+	}
+
+	// 流量使用率提醒任务
+	checkQuotaJob := job.NewCheckQuotaJob(s.inboundService, s.settingService, s.tgbot)
+	err = checkQuotaJob.Add(c)
+	if err != nil {
+		return fmt.Errorf("添加流量提醒任务失败: %v", err)
+	}
+
+	// Telegram 每日报告任务
+	tgbotReportJob := job.NewTgbotReportJob(s.settingService, s.tgbot)
+	err = tgbotReportJob.Add(c)
+	if err != nil {
+		logger.Warning("添加Telegram报告任务失败:", err)
+	}
+
+	// 到期与流量提醒邮件任务
+	emailReminderJob := job.NewEmailReminderJob(s.mailService)
+	err = emailReminderJob.Add(c)
+	if err != nil {
+		return fmt.Errorf("添加邮件提醒任务失败: %v", err)
+	}
+
+	// 证书自动续期任务
+	certRenewJob := job.NewCertRenewJob(s.xrayService, s.certService)
+	err = certRenewJob.Add(c)
+	if err != nil {
+		return fmt.Errorf("添加证书续期任务失败: %v", err)
+	}
+
+	// 证书到期检查任务
+	checkCertExpiryJob := job.NewCheckCertExpiryJob(s.certService)
+	err = checkCertExpiryJob.Add(c)
+	if err != nil {
+		return fmt.Errorf("添加证书到期检查任务失败: %v", err)
+	}
+
+	// 出站流量历史清理任务
+	pruneOutboundHistoryJob := job.NewPruneOutboundHistoryJob(s.outboundTrafficService)
+	err = pruneOutboundHistoryJob.Add(c)
+	if err != nil {
+		return fmt.Errorf("添加出站流量历史清理任务失败: %v", err)
+	}
+
+	// geo 文件更新任务
+	geoUpdateJob := job.NewGeoUpdateJob(s.xrayService, s.settingService, s.geoService)
+	err = geoUpdateJob.Add(c)
+	if err != nil {
+		logger.Warning("添加geo文件更新任务失败:", err)
+	}
+
+	// 节点同步任务
+	nodeSyncJob := job.NewNodeSyncJob(s.nodeService)
+	err = nodeSyncJob.Add(c)
+	if err != nil {
+		return fmt.Errorf("添加节点同步任务失败: %v", err)
+	}
+
 	c.Start()
 	logger.Info("定时任务初始化完成")
 	return nil
@@ -477,11 +636,26 @@ func (s *Server) Start() error {
 		return err
 	}
 
+	// custom.dat 可能被删除或来自旧版本，按数据库中的列表重新编译
+	if err := s.geoService.CompileCustomLists(); err != nil {
+		logger.Warning("编译自定义 geo 列表失败:", err)
+	}
+
+	// 补记上次退出前已读出但未累加的流量
+	if err := s.xrayService.ReconcileTraffic(); err != nil {
+		logger.Warning("补记流量失败:", err)
+	}
+
 	// 启动定时任务
 	if err := s.startTask(); err != nil {
 		return err
 	}
 
+	// 启动 Telegram 机器人
+	if err := s.tgbot.Start(); err != nil {
+		logger.Warning("启动Telegram机器人失败:", err)
+	}
+
 	// 获取端口
 	port, err := s.settingService.GetPort()
 	if err != nil {
@@ -493,6 +667,17 @@ func (s *Server) Start() error {
 	if err != nil {
 		return err
 	}
+
+	// 配置 HTTPS，优先使用托管证书
+	tlsConfig, err := s.getTLSConfig()
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	if tlsConfig != nil {
+		listener = network.NewAutoHttpsListener(listener)
+		listener = tls.NewListener(listener, tlsConfig)
+	}
 	s.listener = listener
 
 	s.httpServer = &http.Server{
@@ -512,6 +697,62 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// getTLSConfig 未配置证书时返回 nil
+func (s *Server) getTLSConfig() (*tls.Config, error) {
+	tlsConfig, err := s.getCertConfig()
+	if err != nil || tlsConfig == nil {
+		return tlsConfig, err
+	}
+	// 设置了节点CA时索取 agent 上报流量出示的客户端证书，由 checkAgentCert 校验，浏览器访问不受影响。
+	// 不设置 ClientCAs，客户端不会因为CA不匹配而不出示证书，CA配置错误时得到 403 而不是 401
+	pool, err := s.nodeService.GetNodeCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("加载节点CA失败: %v", err)
+	}
+	if pool != nil {
+		tlsConfig.ClientAuth = tls.RequestClientCert
+	}
+	return tlsConfig, nil
+}
+
+// getCertConfig 使用托管证书或证书文件，托管证书优先
+func (s *Server) getCertConfig() (*tls.Config, error) {
+	certName, err := s.settingService.GetCertName()
+	if err != nil {
+		return nil, err
+	}
+	if certName != "" {
+		if _, err := s.certService.GetTLSCertificate(certName); err != nil {
+			return nil, fmt.Errorf("加载证书 %v 失败: %v", certName, err)
+		}
+		return &tls.Config{
+			// 每次握手读取，续期后无需重启面板
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return s.certService.GetTLSCertificate(certName)
+			},
+		}, nil
+	}
+
+	certFile, err := s.settingService.GetCertFile()
+	if err != nil {
+		return nil, err
+	}
+	keyFile, err := s.settingService.GetKeyFile()
+	if err != nil {
+		return nil, err
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载证书文件失败: %v", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
+
 // 停止Web服务
 func (s *Server) Stop() error {
 	s.mu.Lock()
@@ -528,6 +769,20 @@ func (s *Server) Stop() error {
 		s.cron.Stop()
 	}
 
+	// 停止 Telegram 机器人
+	if s.tgbot != nil {
+		s.tgbot.Stop()
+	}
+
+	if s.unsubscribeWebhook != nil {
+		s.unsubscribeWebhook()
+	}
+
+	// 记录最后一次流量，退出后 xray 可能随面板一起被结束
+	if _, err := s.xrayService.GetXrayTraffic(); err != nil && err != service.ErrXrayNotRunning {
+		logger.Warning("停止前记录流量失败:", err)
+	}
+
 	// 取消上下文
 	s.cancel()
 
@@ -554,6 +809,15 @@ func (s *Server) GetCtx() context.Context {
 	return s.ctx
 }
 
+// IsHealthy 面板是否存活，用于 systemd watchdog
+func (s *Server) IsHealthy() bool {
+	if s.healthService == nil {
+		return false
+	}
+	_, ok := s.healthService.Liveness()
+	return ok
+}
+
 // GetCron 获取定时任务调度器
 func (s *Server) GetCron() *cron.Cron {
 	return s.cron
@@ -141,6 +141,7 @@ uninstall() {
     systemctl stop x-ui
     systemctl disable x-ui
     rm /etc/systemd/system/x-ui.service -f
+    rm /etc/logrotate.d/x-ui -f
     systemctl daemon-reload
     systemctl reset-failed
     rm /etc/x-ui/ -rf
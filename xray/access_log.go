@@ -0,0 +1,136 @@
+package xray
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 示例: 2023/01/02 15:04:05 1.2.3.4:5678 accepted tcp:example.com:443 [inbound-443 >> direct] email: user@example.com
+var accessLogRegex = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})(?:\.\d+)? (?:from )?(\S+) accepted \S+ \[([^\]\s]+)[^\]]*\](?: email: (\S+))?`)
+
+const accessLogTimeLayout = "2006/01/02 15:04:05"
+
+func GetAccessLogPath() string {
+	return "bin/access.log"
+}
+
+// AccessLogRotatedSuffix logrotate 轮转出的上一份日志的后缀，需配合 delaycompress 保持未压缩
+const AccessLogRotatedSuffix = ".1"
+
+// AccessRecord 表示访问日志中的一条连接记录
+type AccessRecord struct {
+	Time       time.Time
+	IP         string
+	InboundTag string
+	Email      string
+}
+
+func parseAccessLine(line string) *AccessRecord {
+	matchs := accessLogRegex.FindStringSubmatch(line)
+	if matchs == nil {
+		return nil
+	}
+	t, err := time.ParseInLocation(accessLogTimeLayout, matchs[1], time.Local)
+	if err != nil {
+		return nil
+	}
+	addr := strings.TrimPrefix(strings.TrimPrefix(matchs[2], "tcp:"), "udp:")
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		ip = addr
+	}
+	return &AccessRecord{
+		Time:       t,
+		IP:         ip,
+		InboundTag: matchs[3],
+		Email:      matchs[4],
+	}
+}
+
+// AccessLogReader 增量读取访问日志，不修改日志文件，大小由 logrotate 控制。
+// 记录读取位置、所读的文件和轮转出的文件，日志轮转后先读完轮转出的文件中剩余的记录，再从新文件开头读取
+type AccessLogReader struct {
+	path    string
+	offset  int64
+	file    os.FileInfo
+	rotated os.FileInfo
+}
+
+func NewAccessLogReader(path string) *AccessLogReader {
+	return &AccessLogReader{path: path}
+}
+
+func (r *AccessLogReader) GetPath() string {
+	return r.path
+}
+
+// Read 读取上次读取之后新增的记录
+func (r *AccessLogReader) Read() ([]*AccessRecord, error) {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	rotated, _ := os.Stat(r.path + AccessLogRotatedSuffix)
+
+	records := make([]*AccessRecord, 0)
+	// copytruncate 轮转后原文件可能已重新写入超过上次读取的位置，需同时以轮转文件是否更新来判断
+	rotatedChanged := rotated != nil && (r.rotated == nil || !os.SameFile(r.rotated, rotated))
+	if r.file != nil && (!os.SameFile(r.file, stat) || stat.Size() < r.offset || rotatedChanged) {
+		if rotatedChanged && (os.SameFile(r.file, rotated) || os.SameFile(r.file, stat)) {
+			records = append(records, r.readRotated()...)
+		}
+		r.offset = 0
+	}
+	r.file = stat
+	r.rotated = rotated
+
+	tail, offset, err := readAccessLog(file, r.offset)
+	r.offset = offset
+	records = append(records, tail...)
+	return records, err
+}
+
+// readRotated 读取轮转出的文件中上次读取之后的记录。
+// 按名称轮转时旧文件被重命名，copytruncate 轮转时旧内容被复制后原文件被清空
+func (r *AccessLogReader) readRotated() []*AccessRecord {
+	file, err := os.Open(r.path + AccessLogRotatedSuffix)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	records, _, _ := readAccessLog(file, r.offset)
+	return records
+}
+
+// readAccessLog 从 offset 处开始读取，返回解析出的记录和新的偏移量
+func readAccessLog(file *os.File, offset int64) ([]*AccessRecord, int64, error) {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+
+	records := make([]*AccessRecord, 0)
+	reader := bufio.NewReaderSize(file, 8192)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// 不完整的最后一行留到下次读取
+			break
+		}
+		offset += int64(len(line))
+		record := parseAccessLine(strings.TrimSpace(line))
+		if record != nil && record.Email != "" {
+			records = append(records, record)
+		}
+	}
+	return records, offset, nil
+}
@@ -0,0 +1,128 @@
+package xray
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func accessLine(n int) string {
+	return fmt.Sprintf("2024/01/02 15:04:05 1.2.3.%d:5678 accepted tcp:example.com:443 [inbound-443 >> direct] email: user@example.com\n", n)
+}
+
+func appendLines(t *testing.T, path string, from int, to int) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for n := from; n < to; n++ {
+		if _, err := file.WriteString(accessLine(n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readIPs(t *testing.T, reader *AccessLogReader) []string {
+	t.Helper()
+	records, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips := make([]string, 0, len(records))
+	for _, record := range records {
+		ips = append(ips, record.IP)
+	}
+	return ips
+}
+
+func checkIPs(t *testing.T, got []string, from int, to int) {
+	t.Helper()
+	if len(got) != to-from {
+		t.Fatalf("read %v, want 1.2.3.%d to 1.2.3.%d", got, from, to-1)
+	}
+	for i, ip := range got {
+		if want := fmt.Sprintf("1.2.3.%d", from+i); ip != want {
+			t.Fatalf("record %d is %v, want %v", i, ip, want)
+		}
+	}
+}
+
+func TestAccessLogReaderIncremental(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	appendLines(t, path, 0, 3)
+	reader := NewAccessLogReader(path)
+	checkIPs(t, readIPs(t, reader), 0, 3)
+
+	appendLines(t, path, 3, 5)
+	checkIPs(t, readIPs(t, reader), 3, 5)
+	checkIPs(t, readIPs(t, reader), 5, 5)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 {
+		t.Fatal("access log should not be truncated by the reader")
+	}
+}
+
+func TestAccessLogReaderCopyTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	appendLines(t, path, 0, 2)
+	reader := NewAccessLogReader(path)
+	checkIPs(t, readIPs(t, reader), 0, 2)
+
+	// 读取后、轮转前写入的记录只存在于复制出的文件中
+	appendLines(t, path, 2, 4)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+AccessLogRotatedSuffix, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, 4, 5)
+	checkIPs(t, readIPs(t, reader), 2, 5)
+}
+
+func TestAccessLogReaderRename(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	appendLines(t, path, 0, 2)
+	reader := NewAccessLogReader(path)
+	checkIPs(t, readIPs(t, reader), 0, 2)
+
+	appendLines(t, path, 2, 3)
+	if err := os.Rename(path, path+AccessLogRotatedSuffix); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, 3, 6)
+	checkIPs(t, readIPs(t, reader), 2, 6)
+}
+
+func TestAccessLogReaderCopyTruncateRewritten(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	appendLines(t, path, 0, 2)
+	reader := NewAccessLogReader(path)
+	checkIPs(t, readIPs(t, reader), 0, 2)
+
+	appendLines(t, path, 2, 3)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+AccessLogRotatedSuffix, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	// 下次读取前新文件已超过上次读取的位置
+	appendLines(t, path, 3, 8)
+	checkIPs(t, readIPs(t, reader), 2, 8)
+}
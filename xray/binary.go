@@ -0,0 +1,97 @@
+package xray
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const binaryTestTimeout = 30 * time.Second
+
+// GetBinaryBackupPath 安装新版本前保留的上一个版本
+func GetBinaryBackupPath() string {
+	return GetBinaryPath() + ".bak"
+}
+
+// GetBinaryVersion 运行 xray -version 获取版本号
+func GetBinaryVersion(binaryPath string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), binaryTestTimeout)
+	defer cancel()
+	data, err := exec.CommandContext(ctx, binaryPath, "-version").Output()
+	if err != nil {
+		return "", err
+	}
+	fields := bytes.Fields(data)
+	if len(fields) <= 1 {
+		return "", fmt.Errorf("无法识别的版本输出: %s", strings.TrimSpace(string(data)))
+	}
+	return string(fields[1]), nil
+}
+
+// TestBinary 用 xray -test 检查二进制文件能否加载配置，不会启动代理
+//
+// xray 通过 XRAY_LOCATION_ASSET 从临时目录查找 geo 文件，目录中链接了二进制文件所在目录的
+// *.dat 文件，assets 中的文件名会改为链接到指定路径，用于和待安装的 geo 文件一起检查
+func TestBinary(binaryPath string, assets map[string]string, config *Config) (string, error) {
+	version, err := GetBinaryVersion(binaryPath)
+	if err != nil {
+		return "", fmt.Errorf("运行 xray 失败: %w", err)
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	assetDir, err := os.MkdirTemp(filepath.Dir(binaryPath), ".xray-test-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(assetDir)
+	if err := linkAssets(assetDir, filepath.Dir(binaryPath), assets); err != nil {
+		return "", err
+	}
+	configPath := filepath.Join(assetDir, "config.json")
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), binaryTestTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binaryPath, "-test", "-c", configPath)
+	cmd.Env = append(os.Environ(), "XRAY_LOCATION_ASSET="+assetDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("xray %v 无法加载当前配置: %w\n%s", version, err, strings.TrimSpace(string(output)))
+	}
+	return version, nil
+}
+
+// linkAssets 在 assetDir 中创建指向 geo 文件的符号链接
+func linkAssets(assetDir string, binaryDir string, assets map[string]string) error {
+	paths, err := filepath.Glob(filepath.Join(binaryDir, "*.dat"))
+	if err != nil {
+		return err
+	}
+	links := map[string]string{}
+	for _, path := range paths {
+		links[filepath.Base(path)] = path
+	}
+	for name, path := range assets {
+		links[name] = path
+	}
+	for name, path := range links {
+		target, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, filepath.Join(assetDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
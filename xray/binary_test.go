@@ -0,0 +1,103 @@
+package xray
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeScript(t *testing.T, dir string, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("requires /bin/sh")
+	}
+	path := filepath.Join(dir, "xray")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGetBinaryVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := writeScript(t, dir, `echo "Xray 1.8.9 (Xray, Penetrates Everything.) 1b8e2a1 (go1.22.0 linux/amd64)"`)
+	version, err := GetBinaryVersion(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "1.8.9" {
+		t.Fatalf("got %q, want %q", version, "1.8.9")
+	}
+
+	path = writeScript(t, dir, "echo xray\n")
+	if _, err := GetBinaryVersion(path); err == nil {
+		t.Fatal("unexpected output: got nil error")
+	}
+	path = writeScript(t, dir, "exit 1\n")
+	if _, err := GetBinaryVersion(path); err == nil {
+		t.Fatal("failing binary: got nil error")
+	}
+}
+
+func TestTestBinary(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"geoip.dat": "old geoip", "geosite.dat": "old geosite"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newGeoip := filepath.Join(t.TempDir(), "geoip.dat.new")
+	if err := os.WriteFile(newGeoip, []byte("new geoip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// -test 时输出配置文件所在目录中的 geo 文件内容，确认 XRAY_LOCATION_ASSET 指向的链接
+	path := writeScript(t, dir, `case "$1" in
+-version) echo "Xray 1.8.9 (Xray, Penetrates Everything.)" ;;
+-test)
+	[ -f "$3" ] || exit 2
+	[ "$(dirname "$3")" = "$XRAY_LOCATION_ASSET" ] || exit 3
+	cat "$XRAY_LOCATION_ASSET/geoip.dat" "$XRAY_LOCATION_ASSET/geosite.dat" > "$XRAY_LOCATION_ASSET/../assets.txt"
+	;;
+esac
+`)
+
+	version, err := TestBinary(path, map[string]string{"geoip.dat": newGeoip}, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "1.8.9" {
+		t.Fatalf("got version %q, want %q", version, "1.8.9")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "assets.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new geoipold geosite" {
+		t.Fatalf("got assets %q, want the new geoip and the existing geosite", data)
+	}
+	// 临时目录在检查后删除
+	matches, err := filepath.Glob(filepath.Join(dir, ".xray-test-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Fatalf("got leftover test directories %v", matches)
+	}
+}
+
+func TestTestBinaryConfigError(t *testing.T) {
+	path := writeScript(t, t.TempDir(), `case "$1" in
+-version) echo "Xray 1.8.9 (Xray, Penetrates Everything.)" ;;
+-test) echo "failed to load config: unknown protocol"; exit 23 ;;
+esac
+`)
+	_, err := TestBinary(path, nil, &Config{})
+	if err == nil {
+		t.Fatal("got nil error")
+	}
+	if !strings.HasPrefix(err.Error(), "xray 1.8.9 无法加载当前配置") || !strings.Contains(err.Error(), "unknown protocol") {
+		t.Fatalf("got %q, want the version and xray output", err)
+	}
+}
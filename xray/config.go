@@ -2,6 +2,8 @@ package xray
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"x-ui/util/json_util"
 )
 
@@ -17,6 +19,9 @@ type Config struct {
 	Stats           json_util.RawMessage `json:"stats"`
 	Reverse         json_util.RawMessage `json:"reverse"`
 	FakeDNS         json_util.RawMessage `json:"fakeDns"`
+
+	Observatory      json_util.RawMessage `json:"observatory"`
+	BurstObservatory json_util.RawMessage `json:"burstObservatory"`
 }
 
 func (c *Config) Equals(other *Config) bool {
@@ -58,5 +63,273 @@ func (c *Config) Equals(other *Config) bool {
 	if !bytes.Equal(c.FakeDNS, other.FakeDNS) {
 		return false
 	}
+	if !bytes.Equal(c.Observatory, other.Observatory) {
+		return false
+	}
+	if !bytes.Equal(c.BurstObservatory, other.BurstObservatory) {
+		return false
+	}
 	return true
 }
+
+// SetAccessLog 在未配置访问日志时设置访问日志路径
+func (c *Config) SetAccessLog(path string) error {
+	logConfig := map[string]interface{}{}
+	if len(c.LogConfig) > 0 && string(c.LogConfig) != "null" {
+		if err := json.Unmarshal(c.LogConfig, &logConfig); err != nil {
+			return err
+		}
+	}
+	if access, ok := logConfig["access"].(string); ok && access != "" && access != "none" {
+		return nil
+	}
+	logConfig["access"] = path
+	data, err := json.Marshal(logConfig)
+	if err != nil {
+		return err
+	}
+	c.LogConfig = data
+	return nil
+}
+
+// GetAccessLog 获取配置中的访问日志路径
+func (c *Config) GetAccessLog() string {
+	logConfig := struct {
+		Access string `json:"access"`
+	}{}
+	if err := json.Unmarshal(c.LogConfig, &logConfig); err != nil {
+		return ""
+	}
+	if logConfig.Access == "none" {
+		return ""
+	}
+	return logConfig.Access
+}
+
+// PrependRoutingRules 将路由规则插入到已有规则之前
+func (c *Config) PrependRoutingRules(rules ...interface{}) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	routerConfig := map[string]json.RawMessage{}
+	if len(c.RouterConfig) > 0 && string(c.RouterConfig) != "null" {
+		if err := json.Unmarshal(c.RouterConfig, &routerConfig); err != nil {
+			return err
+		}
+	}
+	oldRules := make([]json.RawMessage, 0)
+	if raw, ok := routerConfig["rules"]; ok {
+		if err := json.Unmarshal(raw, &oldRules); err != nil {
+			return err
+		}
+	}
+	newRules := make([]interface{}, 0, len(rules)+len(oldRules))
+	newRules = append(newRules, rules...)
+	for _, rule := range oldRules {
+		newRules = append(newRules, rule)
+	}
+	data, err := json.Marshal(newRules)
+	if err != nil {
+		return err
+	}
+	routerConfig["rules"] = data
+	data, err = json.Marshal(routerConfig)
+	if err != nil {
+		return err
+	}
+	c.RouterConfig = data
+	return nil
+}
+
+// ExpandInboundTags 把路由规则中引用的入站 tag 扩展为该入站生成的所有 tag，
+// tags 的键为数据库中的入站 tag，值为多监听地址生成的全部入站 tag
+func (c *Config) ExpandInboundTags(tags map[string][]string) error {
+	if len(tags) == 0 || len(c.RouterConfig) == 0 || string(c.RouterConfig) == "null" {
+		return nil
+	}
+	routerConfig := map[string]json.RawMessage{}
+	if err := json.Unmarshal(c.RouterConfig, &routerConfig); err != nil {
+		return err
+	}
+	raw, ok := routerConfig["rules"]
+	if !ok {
+		return nil
+	}
+	rules := make([]map[string]interface{}, 0)
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return err
+	}
+	changed := false
+	for _, rule := range rules {
+		inboundTags, ok := rule["inboundTag"].([]interface{})
+		if !ok {
+			continue
+		}
+		expanded := make([]interface{}, 0, len(inboundTags))
+		seen := make(map[string]bool)
+		for _, inboundTag := range inboundTags {
+			tag, ok := inboundTag.(string)
+			if !ok {
+				expanded = append(expanded, inboundTag)
+				continue
+			}
+			generated, ok := tags[tag]
+			if !ok {
+				generated = []string{tag}
+			}
+			for _, t := range generated {
+				if !seen[t] {
+					seen[t] = true
+					expanded = append(expanded, t)
+				}
+			}
+		}
+		if len(expanded) != len(inboundTags) {
+			rule["inboundTag"] = expanded
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	routerConfig["rules"] = data
+	data, err = json.Marshal(routerConfig)
+	if err != nil {
+		return err
+	}
+	c.RouterConfig = data
+	return nil
+}
+
+// Outbound 出站的 tag 和协议
+type Outbound struct {
+	Tag      string `json:"tag"`
+	Protocol string `json:"protocol"`
+}
+
+const (
+	OutboundCategoryDirect  = "direct"
+	OutboundCategoryBlocked = "blocked"
+	OutboundCategoryProxy   = "proxy"
+)
+
+// OutboundCategory 按协议区分直连、阻断和代理出站
+func OutboundCategory(protocol string) string {
+	switch protocol {
+	case "freedom", "dns", "loopback":
+		return OutboundCategoryDirect
+	case "blackhole":
+		return OutboundCategoryBlocked
+	default:
+		return OutboundCategoryProxy
+	}
+}
+
+// defaultOutboundTag 未设置 tag 的出站使用的默认 tag
+func defaultOutboundTag(protocol string) string {
+	switch protocol {
+	case "freedom":
+		return "direct"
+	case "blackhole":
+		return "blocked"
+	case "":
+		return "outbound"
+	default:
+		return protocol
+	}
+}
+
+// TagOutbounds 为未设置 tag 的出站生成 tag，xray 只统计有 tag 的出站的流量
+func (c *Config) TagOutbounds() error {
+	if len(c.OutboundConfigs) == 0 || string(c.OutboundConfigs) == "null" {
+		return nil
+	}
+	outbounds := make([]map[string]json.RawMessage, 0)
+	if err := json.Unmarshal(c.OutboundConfigs, &outbounds); err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, outbound := range outbounds {
+		tag := ""
+		json.Unmarshal(outbound["tag"], &tag)
+		used[tag] = true
+	}
+	changed := false
+	for i, outbound := range outbounds {
+		tag := ""
+		json.Unmarshal(outbound["tag"], &tag)
+		if tag != "" {
+			continue
+		}
+		protocol := ""
+		json.Unmarshal(outbound["protocol"], &protocol)
+		tag = defaultOutboundTag(protocol)
+		if used[tag] {
+			tag = fmt.Sprintf("%v-%d", tag, i)
+		}
+		used[tag] = true
+		data, err := json.Marshal(tag)
+		if err != nil {
+			return err
+		}
+		outbound["tag"] = data
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	data, err := json.Marshal(outbounds)
+	if err != nil {
+		return err
+	}
+	c.OutboundConfigs = data
+	return nil
+}
+
+// GetOutbounds 获取出站的 tag 和协议
+func (c *Config) GetOutbounds() ([]*Outbound, error) {
+	outbounds := make([]*Outbound, 0)
+	if len(c.OutboundConfigs) == 0 || string(c.OutboundConfigs) == "null" {
+		return outbounds, nil
+	}
+	if err := json.Unmarshal(c.OutboundConfigs, &outbounds); err != nil {
+		return nil, err
+	}
+	return outbounds, nil
+}
+
+// EnableOutboundStats 开启出站流量统计，保留 policy 中的其他配置
+func (c *Config) EnableOutboundStats() error {
+	policy := map[string]json.RawMessage{}
+	if len(c.Policy) > 0 && string(c.Policy) != "null" {
+		if err := json.Unmarshal(c.Policy, &policy); err != nil {
+			return err
+		}
+	}
+	system := map[string]interface{}{}
+	if raw, ok := policy["system"]; ok {
+		if err := json.Unmarshal(raw, &system); err != nil {
+			return err
+		}
+	}
+	if system["statsOutboundUplink"] == true && system["statsOutboundDownlink"] == true {
+		return nil
+	}
+	system["statsOutboundUplink"] = true
+	system["statsOutboundDownlink"] = true
+	data, err := json.Marshal(system)
+	if err != nil {
+		return err
+	}
+	policy["system"] = data
+	data, err = json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	c.Policy = data
+	return nil
+}
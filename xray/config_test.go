@@ -0,0 +1,44 @@
+package xray
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExpandInboundTags(t *testing.T) {
+	config := &Config{
+		RouterConfig: []byte(`{"domainStrategy":"AsIs","rules":[
+			{"type":"field","inboundTag":["in-1"],"source":["1.2.3.4"],"outboundTag":"blocked"},
+			{"type":"field","inboundTag":["api"],"outboundTag":"api"},
+			{"type":"field","domain":["example.com"],"outboundTag":"warp"}
+		]}`),
+	}
+	err := config.ExpandInboundTags(map[string][]string{
+		"in-1": {"in-1", "in-1@1", "in-1@2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routerConfig := struct {
+		DomainStrategy string                   `json:"domainStrategy"`
+		Rules          []map[string]interface{} `json:"rules"`
+	}{}
+	if err := json.Unmarshal(config.RouterConfig, &routerConfig); err != nil {
+		t.Fatal(err)
+	}
+	if routerConfig.DomainStrategy != "AsIs" {
+		t.Fatalf("domainStrategy = %q, want AsIs", routerConfig.DomainStrategy)
+	}
+	want := []interface{}{"in-1", "in-1@1", "in-1@2"}
+	if got := routerConfig.Rules[0]["inboundTag"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("block rule inboundTag = %v, want %v", got, want)
+	}
+	if got := routerConfig.Rules[1]["inboundTag"]; !reflect.DeepEqual(got, []interface{}{"api"}) {
+		t.Fatalf("api rule inboundTag = %v, want [api]", got)
+	}
+	if _, ok := routerConfig.Rules[2]["inboundTag"]; ok {
+		t.Fatal("domain rule should not get an inboundTag")
+	}
+}
@@ -0,0 +1,171 @@
+package xray
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/xtls/xray-core/app/router"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	GeoListTypeDomain = "domain"
+	GeoListTypeIP     = "ip"
+
+	// CustomGeoFileName 自定义列表编译成的文件，路由中以 ext:custom.dat:tag 引用
+	CustomGeoFileName = "custom.dat"
+)
+
+// GeoList 自定义的域名或 IP 列表
+type GeoList struct {
+	Tag     string
+	Type    string
+	Entries []string
+}
+
+// parseGeoDomain 按 domain-list-community 的写法解析域名，不带前缀时匹配域名及其子域名
+func parseGeoDomain(entry string) (*router.Domain, error) {
+	domainType := router.Domain_Domain
+	value := entry
+	if prefix, rest, ok := strings.Cut(entry, ":"); ok {
+		switch prefix {
+		case "domain":
+			domainType = router.Domain_Domain
+		case "full":
+			domainType = router.Domain_Full
+		case "keyword":
+			domainType = router.Domain_Plain
+		case "regexp":
+			domainType = router.Domain_Regex
+			if _, err := regexp.Compile(rest); err != nil {
+				return nil, fmt.Errorf("无效的正则表达式 %v: %w", rest, err)
+			}
+		default:
+			return nil, fmt.Errorf("不支持的域名类型: %v", entry)
+		}
+		value = rest
+	}
+	if value == "" {
+		return nil, fmt.Errorf("无效的域名: %v", entry)
+	}
+	if domainType != router.Domain_Regex {
+		value = strings.ToLower(value)
+	}
+	return &router.Domain{Type: domainType, Value: value}, nil
+}
+
+func parseGeoCIDR(entry string) (*router.CIDR, error) {
+	ip := net.ParseIP(entry)
+	bits := 0
+	if ip == nil {
+		var ipNet *net.IPNet
+		var err error
+		ip, ipNet, err = net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 IP 或 CIDR: %v", entry)
+		}
+		bits, _ = ipNet.Mask.Size()
+	} else if ip.To4() != nil {
+		bits = 32
+	} else {
+		bits = 128
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &router.CIDR{Ip: ip, Prefix: uint32(bits)}, nil
+}
+
+// CheckGeoList 检查列表的 tag 和条目
+func CheckGeoList(list *GeoList) error {
+	if list.Tag == "" || len(list.Tag) > 64 || strings.ContainsAny(list.Tag, ":@, \t") {
+		return fmt.Errorf("无效的列表 tag: %v", list.Tag)
+	}
+	if list.Type != GeoListTypeDomain && list.Type != GeoListTypeIP {
+		return fmt.Errorf("不支持的列表类型: %v", list.Type)
+	}
+	for _, entry := range list.Entries {
+		var err error
+		if list.Type == GeoListTypeDomain {
+			_, err = parseGeoDomain(entry)
+		} else {
+			_, err = parseGeoCIDR(entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildGeoData 把自定义列表编译成 dat 文件
+//
+// 域名列表按 GeoSiteList、IP 列表按 GeoIPList 编码后拼接，二者的条目都是字段 1，
+// xray 按 tag 找到条目后再按引用处的类型解析，所以同一文件可以同时提供两种列表，tag 不能重复
+func BuildGeoData(lists []*GeoList) ([]byte, error) {
+	sites := &router.GeoSiteList{}
+	ips := &router.GeoIPList{}
+	tags := map[string]bool{}
+	for _, list := range lists {
+		if err := CheckGeoList(list); err != nil {
+			return nil, err
+		}
+		// xray 查找时会把 tag 转为大写
+		tag := strings.ToUpper(list.Tag)
+		if tags[tag] {
+			return nil, fmt.Errorf("列表 tag 重复: %v", list.Tag)
+		}
+		tags[tag] = true
+		switch list.Type {
+		case GeoListTypeDomain:
+			site := &router.GeoSite{CountryCode: tag}
+			for _, entry := range list.Entries {
+				domain, _ := parseGeoDomain(entry)
+				site.Domain = append(site.Domain, domain)
+			}
+			sites.Entry = append(sites.Entry, site)
+		case GeoListTypeIP:
+			geoip := &router.GeoIP{CountryCode: tag}
+			for _, entry := range list.Entries {
+				cidr, _ := parseGeoCIDR(entry)
+				geoip.Cidr = append(geoip.Cidr, cidr)
+			}
+			ips.Entry = append(ips.Entry, geoip)
+		}
+	}
+	options := proto.MarshalOptions{Deterministic: true}
+	siteData, err := options.Marshal(sites)
+	if err != nil {
+		return nil, err
+	}
+	ipData, err := options.Marshal(ips)
+	if err != nil {
+		return nil, err
+	}
+	return append(siteData, ipData...), nil
+}
+
+// CheckGeoData 检查下载的 geosite.dat 或 geoip.dat 能否解析且不为空
+func CheckGeoData(data []byte, isIP bool) error {
+	var count int
+	if isIP {
+		list := &router.GeoIPList{}
+		if err := proto.Unmarshal(data, list); err != nil {
+			return fmt.Errorf("解析 geoip 数据失败: %w", err)
+		}
+		count = len(list.Entry)
+	} else {
+		list := &router.GeoSiteList{}
+		if err := proto.Unmarshal(data, list); err != nil {
+			return fmt.Errorf("解析 geosite 数据失败: %w", err)
+		}
+		count = len(list.Entry)
+	}
+	if count == 0 {
+		return errors.New("geo 数据为空")
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package xray
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/app/router"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBuildGeoData(t *testing.T) {
+	data, err := BuildGeoData([]*GeoList{
+		{Tag: "Ads", Type: GeoListTypeDomain, Entries: []string{
+			"Example.com",
+			"domain:ads.example.org",
+			"full:Tracker.Example.net",
+			"keyword:doubleclick",
+			"regexp:^ad[0-9]+\\.Example\\.com$",
+		}},
+		{Tag: "office", Type: GeoListTypeIP, Entries: []string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32", "2001:db8::1"}},
+		{Tag: "empty", Type: GeoListTypeDomain},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// xray 按 tag 查找条目，域名列表按 GeoSite 解析，IP 列表按 GeoIP 解析
+	sites := &router.GeoSiteList{}
+	if err := proto.Unmarshal(data, sites); err != nil {
+		t.Fatal(err)
+	}
+	ips := &router.GeoIPList{}
+	if err := proto.Unmarshal(data, ips); err != nil {
+		t.Fatal(err)
+	}
+	if len(sites.Entry) != 3 || len(ips.Entry) != 3 {
+		t.Fatalf("got %d geosite and %d geoip entries, want 3 of each", len(sites.Entry), len(ips.Entry))
+	}
+
+	var ads, empty *router.GeoSite
+	for _, site := range sites.Entry {
+		switch site.CountryCode {
+		case "ADS":
+			ads = site
+		case "EMPTY":
+			empty = site
+		}
+	}
+	if ads == nil || empty == nil {
+		t.Fatalf("geosite tags are not upper-cased: %v", sites.Entry)
+	}
+	if len(empty.Domain) != 0 {
+		t.Fatalf("got %v domains for empty list, want none", empty.Domain)
+	}
+	wantDomains := []*router.Domain{
+		{Type: router.Domain_Domain, Value: "example.com"},
+		{Type: router.Domain_Domain, Value: "ads.example.org"},
+		{Type: router.Domain_Full, Value: "tracker.example.net"},
+		{Type: router.Domain_Plain, Value: "doubleclick"},
+		{Type: router.Domain_Regex, Value: "^ad[0-9]+\\.Example\\.com$"},
+	}
+	if len(ads.Domain) != len(wantDomains) {
+		t.Fatalf("got %v, want %v", ads.Domain, wantDomains)
+	}
+	for i, want := range wantDomains {
+		if got := ads.Domain[i]; got.Type != want.Type || got.Value != want.Value {
+			t.Fatalf("domain %d: got %v %q, want %v %q", i, got.Type, got.Value, want.Type, want.Value)
+		}
+	}
+
+	var office *router.GeoIP
+	for _, geoip := range ips.Entry {
+		if geoip.CountryCode == "OFFICE" {
+			office = geoip
+		}
+	}
+	if office == nil {
+		t.Fatalf("geoip tag OFFICE not found: %v", ips.Entry)
+	}
+	wantCIDRs := []struct {
+		ip     string
+		length int
+		prefix uint32
+	}{
+		{"10.0.0.0", net.IPv4len, 8},
+		{"192.168.1.1", net.IPv4len, 32},
+		{"2001:db8::", net.IPv6len, 32},
+		{"2001:db8::1", net.IPv6len, 128},
+	}
+	if len(office.Cidr) != len(wantCIDRs) {
+		t.Fatalf("got %v, want %v", office.Cidr, wantCIDRs)
+	}
+	for i, want := range wantCIDRs {
+		got := office.Cidr[i]
+		if len(got.Ip) != want.length || !net.IP(got.Ip).Equal(net.ParseIP(want.ip)) || got.Prefix != want.prefix {
+			t.Fatalf("cidr %d: got %v/%d (%d bytes), want %v/%d (%d bytes)", i, net.IP(got.Ip), got.Prefix, len(got.Ip), want.ip, want.prefix, want.length)
+		}
+	}
+}
+
+func TestBuildGeoDataRejectsInvalidLists(t *testing.T) {
+	cases := []struct {
+		name  string
+		lists []*GeoList
+		want  string
+	}{
+		{"duplicate tag", []*GeoList{
+			{Tag: "ads", Type: GeoListTypeDomain},
+			{Tag: "ADS", Type: GeoListTypeIP},
+		}, "列表 tag 重复"},
+		{"invalid tag", []*GeoList{{Tag: "a:b", Type: GeoListTypeDomain}}, "无效的列表 tag"},
+		{"unknown type", []*GeoList{{Tag: "ads", Type: "asn"}}, "不支持的列表类型"},
+		{"unknown domain prefix", []*GeoList{{Tag: "ads", Type: GeoListTypeDomain, Entries: []string{"geosite:cn"}}}, "不支持的域名类型"},
+		{"invalid regexp", []*GeoList{{Tag: "ads", Type: GeoListTypeDomain, Entries: []string{"regexp:("}}}, "无效的正则表达式"},
+		{"empty domain", []*GeoList{{Tag: "ads", Type: GeoListTypeDomain, Entries: []string{"full:"}}}, "无效的域名"},
+		{"invalid cidr", []*GeoList{{Tag: "office", Type: GeoListTypeIP, Entries: []string{"10.0.0.0/33"}}}, "无效的 IP 或 CIDR"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := BuildGeoData(c.lists)
+			if err == nil || !strings.HasPrefix(err.Error(), c.want) {
+				t.Fatalf("got error %v, want %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestCheckGeoData(t *testing.T) {
+	siteData, err := proto.Marshal(&router.GeoSiteList{Entry: []*router.GeoSite{{CountryCode: "CN"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipData, err := proto.Marshal(&router.GeoIPList{Entry: []*router.GeoIP{{CountryCode: "CN"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckGeoData(siteData, false); err != nil {
+		t.Fatalf("geosite: got %v, want nil", err)
+	}
+	if err := CheckGeoData(ipData, true); err != nil {
+		t.Fatalf("geoip: got %v, want nil", err)
+	}
+	if err := CheckGeoData(nil, false); err == nil {
+		t.Fatal("empty data: got nil error")
+	}
+	if err := CheckGeoData([]byte("<html>not found</html>"), true); err == nil {
+		t.Fatal("html page: got nil error")
+	}
+}
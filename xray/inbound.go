@@ -2,12 +2,13 @@ package xray
 
 import (
 	"bytes"
+	"encoding/json"
 	"x-ui/util/json_util"
 )
 
 type InboundConfig struct {
 	Listen         json_util.RawMessage `json:"listen"` // listen 不能为空字符串
-	Port           int                  `json:"port"`
+	Port           json_util.RawMessage `json:"port"`   // 端口号，或 "1000-2000" 形式的端口范围字符串
 	Protocol       string               `json:"protocol"`
 	Settings       json_util.RawMessage `json:"settings"`
 	StreamSettings json_util.RawMessage `json:"streamSettings"`
@@ -19,7 +20,7 @@ func (c *InboundConfig) Equals(other *InboundConfig) bool {
 	if !bytes.Equal(c.Listen, other.Listen) {
 		return false
 	}
-	if c.Port != other.Port {
+	if !bytes.Equal(c.Port, other.Port) {
 		return false
 	}
 	if c.Protocol != other.Protocol {
@@ -39,3 +40,33 @@ func (c *InboundConfig) Equals(other *InboundConfig) bool {
 	}
 	return true
 }
+
+// GetPort 返回数字形式的端口，端口范围或未设置时返回 0
+func (c *InboundConfig) GetPort() int {
+	port := 0
+	if err := json.Unmarshal(c.Port, &port); err != nil {
+		return 0
+	}
+	return port
+}
+
+// GetPorts 解析端口号或端口范围字符串
+func (c *InboundConfig) GetPorts() ([]PortRange, error) {
+	if port := c.GetPort(); port > 0 {
+		return []PortRange{{From: port, To: port}}, nil
+	}
+	var ports string
+	if err := json.Unmarshal(c.Port, &ports); err != nil {
+		return nil, err
+	}
+	return ParsePortList(ports)
+}
+
+// GetListen 返回监听地址，未设置时为空
+func (c *InboundConfig) GetListen() string {
+	var listen string
+	if len(c.Listen) > 0 {
+		json.Unmarshal(c.Listen, &listen)
+	}
+	return listen
+}
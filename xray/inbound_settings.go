@@ -0,0 +1,305 @@
+package xray
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Client vmess/vless/trojan/shadowsocks 的客户端，limitIp 和 notifyEmail 为面板扩展字段
+type Client struct {
+	Id          string `json:"id"`
+	Password    string `json:"password"`
+	Flow        string `json:"flow"`
+	Email       string `json:"email"`
+	Level       int    `json:"level"`
+	AlterId     int    `json:"alterId"`
+	Method      string `json:"method"`
+	LimitIp     int    `json:"limitIp"`
+	NotifyEmail string `json:"notifyEmail"`
+	// 客户端自己的流量上限(字节)和到期时间(毫秒时间戳)，为 0 时不限制
+	Total      int64 `json:"total"`
+	ExpiryTime int64 `json:"expiryTime"`
+
+	fields rawFields
+}
+
+func (c *Client) UnmarshalJSON(data []byte) error {
+	type alias Client
+	return unmarshalObject(data, (*alias)(c), &c.fields)
+}
+
+func (c Client) MarshalJSON() ([]byte, error) {
+	type alias Client
+	return marshalObject((*alias)(&c), c.fields)
+}
+
+// Fallback vless/trojan 回落，dest 可以是端口号或地址
+type Fallback struct {
+	Name string          `json:"name"`
+	Alpn string          `json:"alpn"`
+	Path string          `json:"path"`
+	Dest json.RawMessage `json:"dest"`
+	Xver int             `json:"xver"`
+
+	fields rawFields
+}
+
+func (f *Fallback) UnmarshalJSON(data []byte) error {
+	type alias Fallback
+	return unmarshalObject(data, (*alias)(f), &f.fields)
+}
+
+func (f Fallback) MarshalJSON() ([]byte, error) {
+	type alias Fallback
+	return marshalObject((*alias)(&f), f.fields)
+}
+
+// FallbackSettings 支持回落的协议设置
+type FallbackSettings interface {
+	GetFallbacks() []*Fallback
+	SetFallbacks(fallbacks []*Fallback)
+}
+
+// ClientSettings 带客户端列表的协议设置
+type ClientSettings interface {
+	GetClients() []*Client
+}
+
+type VMessSettings struct {
+	Clients []*Client `json:"clients"`
+
+	fields rawFields
+}
+
+func (s *VMessSettings) UnmarshalJSON(data []byte) error {
+	type alias VMessSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s VMessSettings) MarshalJSON() ([]byte, error) {
+	type alias VMessSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+func (s *VMessSettings) GetClients() []*Client {
+	return s.Clients
+}
+
+type VLESSSettings struct {
+	Clients    []*Client   `json:"clients"`
+	Decryption string      `json:"decryption"`
+	Fallbacks  []*Fallback `json:"fallbacks"`
+
+	fields rawFields
+}
+
+func (s *VLESSSettings) UnmarshalJSON(data []byte) error {
+	type alias VLESSSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s VLESSSettings) MarshalJSON() ([]byte, error) {
+	type alias VLESSSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+func (s *VLESSSettings) GetClients() []*Client {
+	return s.Clients
+}
+
+func (s *VLESSSettings) GetFallbacks() []*Fallback {
+	return s.Fallbacks
+}
+
+func (s *VLESSSettings) SetFallbacks(fallbacks []*Fallback) {
+	s.Fallbacks = fallbacks
+}
+
+type TrojanSettings struct {
+	Clients   []*Client   `json:"clients"`
+	Fallbacks []*Fallback `json:"fallbacks"`
+
+	fields rawFields
+}
+
+func (s *TrojanSettings) UnmarshalJSON(data []byte) error {
+	type alias TrojanSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s TrojanSettings) MarshalJSON() ([]byte, error) {
+	type alias TrojanSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+func (s *TrojanSettings) GetClients() []*Client {
+	return s.Clients
+}
+
+func (s *TrojanSettings) GetFallbacks() []*Fallback {
+	return s.Fallbacks
+}
+
+func (s *TrojanSettings) SetFallbacks(fallbacks []*Fallback) {
+	s.Fallbacks = fallbacks
+}
+
+// ShadowsocksSettings clients 为空时为单用户模式
+type ShadowsocksSettings struct {
+	Method   string    `json:"method"`
+	Password string    `json:"password"`
+	Network  string    `json:"network"`
+	Clients  []*Client `json:"clients"`
+
+	fields rawFields
+}
+
+func (s *ShadowsocksSettings) UnmarshalJSON(data []byte) error {
+	type alias ShadowsocksSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s ShadowsocksSettings) MarshalJSON() ([]byte, error) {
+	type alias ShadowsocksSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+func (s *ShadowsocksSettings) GetClients() []*Client {
+	return s.Clients
+}
+
+type DokodemoSettings struct {
+	Address        string `json:"address"`
+	Port           int    `json:"port"`
+	Network        string `json:"network"`
+	FollowRedirect bool   `json:"followRedirect"`
+
+	fields rawFields
+}
+
+func (s *DokodemoSettings) UnmarshalJSON(data []byte) error {
+	type alias DokodemoSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s DokodemoSettings) MarshalJSON() ([]byte, error) {
+	type alias DokodemoSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+type Account struct {
+	User string `json:"user"`
+	Pass string `json:"pass"`
+
+	fields rawFields
+}
+
+func (a *Account) UnmarshalJSON(data []byte) error {
+	type alias Account
+	return unmarshalObject(data, (*alias)(a), &a.fields)
+}
+
+func (a Account) MarshalJSON() ([]byte, error) {
+	type alias Account
+	return marshalObject((*alias)(&a), a.fields)
+}
+
+type HTTPSettings struct {
+	Accounts         []*Account `json:"accounts"`
+	AllowTransparent bool       `json:"allowTransparent"`
+
+	fields rawFields
+}
+
+func (s *HTTPSettings) UnmarshalJSON(data []byte) error {
+	type alias HTTPSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s HTTPSettings) MarshalJSON() ([]byte, error) {
+	type alias HTTPSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+// SocksSettings auth 为 noauth 或 password
+type SocksSettings struct {
+	Auth     string     `json:"auth"`
+	Accounts []*Account `json:"accounts"`
+	UDP      bool       `json:"udp"`
+	IP       string     `json:"ip"`
+
+	fields rawFields
+}
+
+func (s *SocksSettings) UnmarshalJSON(data []byte) error {
+	type alias SocksSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s SocksSettings) MarshalJSON() ([]byte, error) {
+	type alias SocksSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+// WireGuardPeer email 和 privateKey 为面板扩展字段，用于统计流量和生成客户端配置
+type WireGuardPeer struct {
+	PublicKey    string   `json:"publicKey"`
+	PreSharedKey string   `json:"preSharedKey"`
+	AllowedIPs   []string `json:"allowedIPs"`
+	KeepAlive    int      `json:"keepAlive"`
+	Email        string   `json:"email"`
+	PrivateKey   string   `json:"privateKey"`
+
+	fields rawFields
+}
+
+func (p *WireGuardPeer) UnmarshalJSON(data []byte) error {
+	type alias WireGuardPeer
+	return unmarshalObject(data, (*alias)(p), &p.fields)
+}
+
+func (p WireGuardPeer) MarshalJSON() ([]byte, error) {
+	type alias WireGuardPeer
+	return marshalObject((*alias)(&p), p.fields)
+}
+
+type WireGuardSettings struct {
+	SecretKey string           `json:"secretKey"`
+	Peers     []*WireGuardPeer `json:"peers"`
+	MTU       int              `json:"mtu"`
+
+	fields rawFields
+}
+
+func (s *WireGuardSettings) UnmarshalJSON(data []byte) error {
+	type alias WireGuardSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s WireGuardSettings) MarshalJSON() ([]byte, error) {
+	type alias WireGuardSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+// NewInboundSettings 返回协议对应的设置结构指针，协议名不区分大小写，不支持时返回 nil
+func NewInboundSettings(protocol string) interface{} {
+	switch strings.ToLower(protocol) {
+	case "vmess":
+		return &VMessSettings{}
+	case "vless":
+		return &VLESSSettings{}
+	case "trojan":
+		return &TrojanSettings{}
+	case "shadowsocks":
+		return &ShadowsocksSettings{}
+	case "dokodemo-door", "tunnel":
+		return &DokodemoSettings{}
+	case "http":
+		return &HTTPSettings{}
+	case "socks":
+		return &SocksSettings{}
+	case "wireguard":
+		return &WireGuardSettings{}
+	}
+	return nil
+}
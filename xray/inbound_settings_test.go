@@ -0,0 +1,125 @@
+package xray
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// checkRoundTrip 解析后重新序列化，与原始 JSON 比较是否等价
+func checkRoundTrip(t *testing.T, v interface{}, data string) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJSONEqual(t, string(out), data)
+}
+
+func checkJSONEqual(t *testing.T, got string, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestInboundSettingsRoundTrip(t *testing.T) {
+	cases := []struct {
+		protocol string
+		settings string
+	}{
+		{"vmess", `{
+			"clients": [
+				{"id": "b831381d-6324-4d53-ad4f-8cda48b30811", "alterId": 0, "email": "a@example.com", "level": 0, "limitIp": 2, "total": 0, "expiryTime": 0, "subId": "x1", "tgId": ""},
+				{"id": "8f1c9e62-5d7b-4a4a-9f65-1a7bb0f8f7c2", "security": "auto", "enable": false}
+			],
+			"disableInsecureEncryption": false,
+			"default": {"level": 1, "alterId": 0}
+		}`},
+		{"vless", `{
+			"clients": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811", "flow": "xtls-rprx-vision", "email": "a", "reverse": {"tag": "r"}}],
+			"decryption": "none",
+			"fallbacks": [
+				{"dest": 8080, "xver": 1},
+				{"path": "/ws", "dest": "/dev/shm/ws.sock", "xver": 0, "type": "unix"},
+				{"name": "a.example.com", "alpn": "h2", "dest": "127.0.0.1:8443"}
+			],
+			"flow": "xtls-rprx-vision"
+		}`},
+		{"trojan", `{
+			"clients": [{"password": "secret", "email": "t", "flow": "", "level": 0, "comment": "legacy"}],
+			"fallbacks": [{"dest": 80}],
+			"network": "tcp,udp"
+		}`},
+		{"shadowsocks", `{
+			"method": "2022-blake3-aes-128-gcm",
+			"password": "Wm1xdGhlbGF6eWRvZ3F1aWNrYnI=",
+			"network": "tcp,udp",
+			"clients": [{"password": "c2VjcmV0c2VjcmV0c2VjcmV0", "email": "s", "ivCheck": true}],
+			"level": 0
+		}`},
+		{"shadowsocks", `{"method": "aes-256-gcm", "password": "secret", "network": "tcp", "ota": false}`},
+		{"dokodemo-door", `{"address": "1.1.1.1", "port": 53, "network": "udp", "followRedirect": false, "timeout": 300, "userLevel": 0}`},
+		{"tunnel", `{"address": "127.0.0.1", "port": 22, "network": "tcp", "portMap": {"5555": "1.1.1.1:7777"}}`},
+		{"http", `{"accounts": [{"user": "u", "pass": "p", "level": 1}], "allowTransparent": false, "userLevel": 0, "timeout": 300}`},
+		{"socks", `{"auth": "password", "accounts": [{"user": "u", "pass": "p"}], "udp": true, "ip": "127.0.0.1", "userLevel": 0}`},
+		{"socks", `{"auth": "noauth", "udp": false}`},
+		{"wireguard", `{
+			"secretKey": "cBqX0B4uU5bU8AH1pgGGJk6yqkP6l0BnDk8oaNshqkU=",
+			"peers": [{"publicKey": "Y4bxhG6a6GO0ZK+L4mXqdF8p4gMQw1t7gNbs8k7lSUE=", "allowedIPs": ["10.0.0.2/32"], "keepAlive": 25, "email": "w", "privateKey": "k", "endpoint": "peer.example.com:51820"}],
+			"mtu": 1420,
+			"kernelMode": false,
+			"reserved": [0, 0, 0]
+		}`},
+	}
+	for _, c := range cases {
+		t.Run(c.protocol, func(t *testing.T) {
+			checkRoundTrip(t, NewInboundSettings(c.protocol), c.settings)
+		})
+	}
+}
+
+func TestInboundSettingsKeepUnknownFieldsOnChange(t *testing.T) {
+	settings := &VLESSSettings{}
+	data := `{
+		"clients": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811", "email": "a", "subId": "x1"}],
+		"decryption": "none",
+		"fallbacks": [{"dest": 80, "type": "tcp"}],
+		"future": {"enabled": true}
+	}`
+	if err := json.Unmarshal([]byte(data), settings); err != nil {
+		t.Fatal(err)
+	}
+	settings.Clients[0].Email = "b"
+	settings.Clients[0].LimitIp = 3
+	settings.Fallbacks[0].Path = "/a"
+	out, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJSONEqual(t, string(out), `{
+		"clients": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811", "email": "b", "limitIp": 3, "subId": "x1"}],
+		"decryption": "none",
+		"fallbacks": [{"dest": 80, "path": "/a", "type": "tcp"}],
+		"future": {"enabled": true}
+	}`)
+}
+
+func TestNewInboundSettingsUnknownProtocol(t *testing.T) {
+	if settings := NewInboundSettings("hysteria"); settings != nil {
+		t.Fatalf("NewInboundSettings(hysteria) = %T, want nil", settings)
+	}
+	if _, ok := NewInboundSettings("VLESS").(*VLESSSettings); !ok {
+		t.Fatal("NewInboundSettings(VLESS) is not *VLESSSettings")
+	}
+}
@@ -0,0 +1,66 @@
+package xray
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// rawFields 解析时遇到的全部字段。
+// 序列化时未知字段原样输出，已知字段使用结构体中的当前值，实现无损往返
+type rawFields map[string]json.RawMessage
+
+func jsonFieldName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "" {
+		return f.Name
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// unmarshalObject v 为不带 JSON 方法的别名类型指针，避免递归
+func unmarshalObject(data []byte, v interface{}, fields *rawFields) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	raw := rawFields{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*fields = raw
+	return nil
+}
+
+// marshalObject 已知字段为零值且原始数据中没有时省略
+func marshalObject(v interface{}, fields rawFields) ([]byte, error) {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	out := make(map[string]json.RawMessage, len(fields)+rt.NumField())
+	for name, raw := range fields {
+		out[name] = raw
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := jsonFieldName(f)
+		if name == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		if _, ok := fields[name]; !ok && fv.IsZero() {
+			continue
+		}
+		data, err := json.Marshal(fv.Interface())
+		if err != nil {
+			return nil, err
+		}
+		out[name] = data
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,199 @@
+package xray
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"x-ui/util/common"
+
+	observatoryservice "github.com/xtls/xray-core/app/observatory/command"
+	"google.golang.org/grpc"
+)
+
+// Balancer 路由中的负载均衡器，Selector 为出站 tag 前缀
+type Balancer struct {
+	Tag         string            `json:"tag"`
+	Selector    []string          `json:"selector"`
+	Strategy    *BalancerStrategy `json:"strategy,omitempty"`
+	FallbackTag string            `json:"fallbackTag,omitempty"`
+}
+
+type BalancerStrategy struct {
+	Type string `json:"type"`
+}
+
+// ObservatoryConfig 定期用 ProbeURL 探测出站的连通性和延迟
+type ObservatoryConfig struct {
+	SubjectSelector   []string `json:"subjectSelector"`
+	ProbeURL          string   `json:"probeURL"`
+	ProbeInterval     string   `json:"probeInterval"`
+	EnableConcurrency bool     `json:"enableConcurrency"`
+}
+
+// BurstObservatoryConfig 按采样统计出站的延迟和连通性，供 leastLoad 使用
+type BurstObservatoryConfig struct {
+	SubjectSelector []string         `json:"subjectSelector"`
+	PingConfig      *BurstPingConfig `json:"pingConfig"`
+}
+
+type BurstPingConfig struct {
+	Destination string `json:"destination"`
+	Interval    string `json:"interval"`
+	Sampling    int    `json:"sampling"`
+	Timeout     string `json:"timeout"`
+}
+
+// OutboundStatus 观测到的出站状态
+type OutboundStatus struct {
+	Tag          string `json:"tag"`
+	Alive        bool   `json:"alive"`
+	Delay        int64  `json:"delay"` // 毫秒
+	LastError    string `json:"lastError"`
+	LastSeenTime int64  `json:"lastSeenTime"` // 秒级时间戳
+	LastTryTime  int64  `json:"lastTryTime"`
+}
+
+// SetBalancers 把负载均衡器写入路由配置，与模板中同 tag 的负载均衡器以传入的为准
+func (c *Config) SetBalancers(balancers []*Balancer) error {
+	if len(balancers) == 0 {
+		return nil
+	}
+	routerConfig := map[string]json.RawMessage{}
+	if len(c.RouterConfig) > 0 && string(c.RouterConfig) != "null" {
+		if err := json.Unmarshal(c.RouterConfig, &routerConfig); err != nil {
+			return err
+		}
+	}
+	oldBalancers := make([]json.RawMessage, 0)
+	if raw, ok := routerConfig["balancers"]; ok {
+		if err := json.Unmarshal(raw, &oldBalancers); err != nil {
+			return err
+		}
+	}
+	tags := map[string]bool{}
+	for _, balancer := range balancers {
+		tags[balancer.Tag] = true
+	}
+	newBalancers := make([]interface{}, 0, len(balancers)+len(oldBalancers))
+	for _, raw := range oldBalancers {
+		old := struct {
+			Tag string `json:"tag"`
+		}{}
+		if err := json.Unmarshal(raw, &old); err == nil && tags[old.Tag] {
+			continue
+		}
+		newBalancers = append(newBalancers, raw)
+	}
+	for _, balancer := range balancers {
+		newBalancers = append(newBalancers, balancer)
+	}
+	data, err := json.Marshal(newBalancers)
+	if err != nil {
+		return err
+	}
+	routerConfig["balancers"] = data
+	data, err = json.Marshal(routerConfig)
+	if err != nil {
+		return err
+	}
+	c.RouterConfig = data
+	return nil
+}
+
+// SetObservatory 设置 observatory 或 burstObservatory，并清空另一种，二者只能使用一种
+func (c *Config) SetObservatory(observatory *ObservatoryConfig, burst *BurstObservatoryConfig) error {
+	c.Observatory = nil
+	c.BurstObservatory = nil
+	if observatory != nil {
+		data, err := json.Marshal(observatory)
+		if err != nil {
+			return err
+		}
+		c.Observatory = data
+	}
+	if burst != nil {
+		data, err := json.Marshal(burst)
+		if err != nil {
+			return err
+		}
+		c.BurstObservatory = data
+	}
+	return nil
+}
+
+// HasObservatory 配置中是否启用了任意一种观测
+func (c *Config) HasObservatory() bool {
+	isSet := func(raw []byte) bool {
+		return len(raw) > 0 && string(raw) != "null"
+	}
+	return isSet(c.Observatory) || isSet(c.BurstObservatory)
+}
+
+// EnableAPIService 在 api.services 中加入服务，已存在时不修改
+func (c *Config) EnableAPIService(name string) error {
+	api := map[string]json.RawMessage{}
+	if len(c.API) > 0 && string(c.API) != "null" {
+		if err := json.Unmarshal(c.API, &api); err != nil {
+			return err
+		}
+	}
+	services := make([]string, 0)
+	if raw, ok := api["services"]; ok {
+		if err := json.Unmarshal(raw, &services); err != nil {
+			return err
+		}
+	}
+	for _, service := range services {
+		if strings.EqualFold(service, name) {
+			return nil
+		}
+	}
+	data, err := json.Marshal(append(services, name))
+	if err != nil {
+		return err
+	}
+	api["services"] = data
+	data, err = json.Marshal(api)
+	if err != nil {
+		return err
+	}
+	c.API = data
+	return nil
+}
+
+// GetObservatoryStatus 通过 xray API 读取观测结果，配置中未启用观测时返回空
+func (p *process) GetObservatoryStatus() ([]*OutboundStatus, error) {
+	if !p.config.HasObservatory() {
+		return []*OutboundStatus{}, nil
+	}
+	if p.apiPort == 0 {
+		return nil, common.NewError("xray api port wrong:", p.apiPort)
+	}
+	conn, err := grpc.Dial(fmt.Sprintf("127.0.0.1:%v", p.apiPort), grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	client := observatoryservice.NewObservatoryServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	resp, err := client.GetOutboundStatus(ctx, &observatoryservice.GetOutboundStatusRequest{})
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*OutboundStatus, 0)
+	for _, status := range resp.GetStatus().GetStatus() {
+		statuses = append(statuses, &OutboundStatus{
+			Tag:          status.GetOutboundTag(),
+			Alive:        status.GetAlive(),
+			Delay:        status.GetDelay(),
+			LastError:    status.GetLastErrorReason(),
+			LastSeenTime: status.GetLastSeenTime(),
+			LastTryTime:  status.GetLastTryTime(),
+		})
+	}
+	return statuses, nil
+}
@@ -0,0 +1,55 @@
+package xray
+
+import (
+	"encoding/json"
+)
+
+// OutboundConfig 面板生成的出站
+type OutboundConfig struct {
+	Tag      string      `json:"tag"`
+	Protocol string      `json:"protocol"`
+	Settings interface{} `json:"settings"`
+}
+
+// WireGuardOutboundSettings WireGuard 出站设置，Reserved 为 WARP 的 client_id
+type WireGuardOutboundSettings struct {
+	SecretKey string                   `json:"secretKey"`
+	Address   []string                 `json:"address"`
+	Peers     []*WireGuardOutboundPeer `json:"peers"`
+	Reserved  []int                    `json:"reserved,omitempty"`
+	MTU       int                      `json:"mtu,omitempty"`
+}
+
+type WireGuardOutboundPeer struct {
+	PublicKey    string   `json:"publicKey"`
+	PreSharedKey string   `json:"preSharedKey,omitempty"`
+	Endpoint     string   `json:"endpoint"`
+	AllowedIPs   []string `json:"allowedIPs,omitempty"`
+	KeepAlive    int      `json:"keepAlive,omitempty"`
+}
+
+// AppendOutbounds 将出站追加到已有出站之后，第一个出站仍是默认出站
+func (c *Config) AppendOutbounds(outbounds ...*OutboundConfig) error {
+	if len(outbounds) == 0 {
+		return nil
+	}
+	oldOutbounds := make([]json.RawMessage, 0)
+	if len(c.OutboundConfigs) > 0 && string(c.OutboundConfigs) != "null" {
+		if err := json.Unmarshal(c.OutboundConfigs, &oldOutbounds); err != nil {
+			return err
+		}
+	}
+	newOutbounds := make([]interface{}, 0, len(oldOutbounds)+len(outbounds))
+	for _, outbound := range oldOutbounds {
+		newOutbounds = append(newOutbounds, outbound)
+	}
+	for _, outbound := range outbounds {
+		newOutbounds = append(newOutbounds, outbound)
+	}
+	data, err := json.Marshal(newOutbounds)
+	if err != nil {
+		return err
+	}
+	c.OutboundConfigs = data
+	return nil
+}
@@ -0,0 +1,70 @@
+package xray
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortRange 闭区间端口范围，单个端口时 From 与 To 相同
+type PortRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+func (r PortRange) String() string {
+	if r.From == r.To {
+		return strconv.Itoa(r.From)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+func (r PortRange) Overlaps(other PortRange) bool {
+	return r.From <= other.To && other.From <= r.To
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("端口无效: %v", s)
+	}
+	return port, nil
+}
+
+// ParsePortList 解析 xray 的端口写法，如 "443"、"1000-2000" 或 "80,443,1000-2000"
+func ParsePortList(s string) ([]PortRange, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("端口不能为空")
+	}
+	ranges := make([]PortRange, 0)
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := parsePort(from)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = parsePort(to); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, fmt.Errorf("端口范围无效: %v", strings.TrimSpace(part))
+			}
+		}
+		ranges = append(ranges, PortRange{From: start, To: end})
+	}
+	return ranges, nil
+}
+
+// PortListsOverlap 判断两组端口范围是否有重叠
+func PortListsOverlap(a []PortRange, b []PortRange) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Overlaps(y) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -20,7 +20,7 @@ import (
 	"x-ui/util/common"
 )
 
-var trafficRegex = regexp.MustCompile("(inbound|outbound)>>>([^>]+)>>>traffic>>>(downlink|uplink)")
+var trafficRegex = regexp.MustCompile("(inbound|outbound|user)>>>([^>]+)>>>traffic>>>(downlink|uplink)")
 
 func GetBinaryName() string {
 	return fmt.Sprintf("xray-%s-%s", runtime.GOOS, runtime.GOARCH)
@@ -42,6 +42,10 @@ func GetGeoipPath() string {
 	return "bin/geoip.dat"
 }
 
+func GetCustomGeoPath() string {
+	return "bin/" + CustomGeoFileName
+}
+
 func stopProcess(p *Process) {
 	p.Stop()
 }
@@ -85,6 +89,14 @@ func (p *process) IsRunning() bool {
 	return false
 }
 
+// GetPid 返回 xray 进程ID，未运行时返回 0
+func (p *process) GetPid() int {
+	if !p.IsRunning() {
+		return 0
+	}
+	return p.cmd.Process.Pid
+}
+
 func (p *process) GetErr() error {
 	return p.exitErr
 }
@@ -118,7 +130,7 @@ func (p *Process) GetConfig() *Config {
 func (p *process) refreshAPIPort() {
 	for _, inbound := range p.config.InboundConfigs {
 		if inbound.Tag == "api" {
-			p.apiPort = inbound.Port
+			p.apiPort = inbound.GetPort()
 			break
 		}
 	}
@@ -252,19 +264,25 @@ func (p *process) GetTraffic(reset bool) ([]*Traffic, error) {
 	traffics := make([]*Traffic, 0)
 	for _, stat := range resp.GetStat() {
 		matchs := trafficRegex.FindStringSubmatch(stat.Name)
+		if matchs == nil {
+			continue
+		}
 		isInbound := matchs[1] == "inbound"
+		isUser := matchs[1] == "user"
 		tag := matchs[2]
 		isDown := matchs[3] == "downlink"
 		if tag == "api" {
 			continue
 		}
-		traffic, ok := tagTrafficMap[tag]
+		key := matchs[1] + ">>>" + tag
+		traffic, ok := tagTrafficMap[key]
 		if !ok {
 			traffic = &Traffic{
 				IsInbound: isInbound,
+				IsUser:    isUser,
 				Tag:       tag,
 			}
-			tagTrafficMap[tag] = traffic
+			tagTrafficMap[key] = traffic
 			traffics = append(traffics, traffic)
 		}
 		if isDown {
@@ -0,0 +1,291 @@
+package xray
+
+import (
+	"encoding/json"
+)
+
+// StreamSettings 入站传输设置，未列出的字段(如 sockopt)在往返时原样保留
+type StreamSettings struct {
+	Network             string               `json:"network"`
+	Security            string               `json:"security"`
+	TLSSettings         *TLSSettings         `json:"tlsSettings"`
+	XTLSSettings        *TLSSettings         `json:"xtlsSettings"`
+	RealitySettings     *RealitySettings     `json:"realitySettings"`
+	TCPSettings         *TCPSettings         `json:"tcpSettings"`
+	KCPSettings         *KCPSettings         `json:"kcpSettings"`
+	WSSettings          *WSSettings          `json:"wsSettings"`
+	HTTPSettings        *HTTPStreamSettings  `json:"httpSettings"`
+	GRPCSettings        *GRPCSettings        `json:"grpcSettings"`
+	HTTPUpgradeSettings *HTTPUpgradeSettings `json:"httpupgradeSettings"`
+
+	fields rawFields
+}
+
+func (s *StreamSettings) UnmarshalJSON(data []byte) error {
+	type alias StreamSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s StreamSettings) MarshalJSON() ([]byte, error) {
+	type alias StreamSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+// GetNetwork 未设置时为 tcp
+func (s *StreamSettings) GetNetwork() string {
+	if s == nil || s.Network == "" {
+		return "tcp"
+	}
+	return s.Network
+}
+
+func (s *StreamSettings) GetSecurity() string {
+	if s == nil {
+		return ""
+	}
+	return s.Security
+}
+
+// GetTLSSettings 按 security 返回 tlsSettings 或 xtlsSettings
+func (s *StreamSettings) GetTLSSettings() *TLSSettings {
+	switch s.GetSecurity() {
+	case "tls":
+		return s.TLSSettings
+	case "xtls":
+		return s.XTLSSettings
+	}
+	return nil
+}
+
+type TLSSettings struct {
+	ServerName       string            `json:"serverName"`
+	RejectUnknownSni bool              `json:"rejectUnknownSni"`
+	ALPN             []string          `json:"alpn"`
+	MinVersion       string            `json:"minVersion"`
+	MaxVersion       string            `json:"maxVersion"`
+	Certificates     []*TLSCertificate `json:"certificates"`
+
+	fields rawFields
+}
+
+func (s *TLSSettings) UnmarshalJSON(data []byte) error {
+	type alias TLSSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s TLSSettings) MarshalJSON() ([]byte, error) {
+	type alias TLSSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+// TLSCertificate 证书可以是文件、内联PEM(按行分割)或面板证书库中的名称
+type TLSCertificate struct {
+	CertificateFile string   `json:"certificateFile"`
+	KeyFile         string   `json:"keyFile"`
+	Certificate     []string `json:"certificate"`
+	Key             []string `json:"key"`
+	CertificateName string   `json:"certificateName"`
+	Usage           string   `json:"usage"`
+
+	fields rawFields
+}
+
+func (c *TLSCertificate) UnmarshalJSON(data []byte) error {
+	type alias TLSCertificate
+	return unmarshalObject(data, (*alias)(c), &c.fields)
+}
+
+func (c TLSCertificate) MarshalJSON() ([]byte, error) {
+	type alias TLSCertificate
+	return marshalObject((*alias)(&c), c.fields)
+}
+
+// UseFiles 改为使用证书文件，同时移除 xray 不认识的 certificateName
+func (c *TLSCertificate) UseFiles(certFile string, keyFile string) {
+	c.CertificateFile = certFile
+	c.KeyFile = keyFile
+	c.CertificateName = ""
+	delete(c.fields, "certificateName")
+}
+
+type RealitySettings struct {
+	Show         bool                   `json:"show"`
+	Dest         string                 `json:"dest"`
+	Target       string                 `json:"target"`
+	Xver         int                    `json:"xver"`
+	ServerNames  []string               `json:"serverNames"`
+	PrivateKey   string                 `json:"privateKey"`
+	MinClientVer string                 `json:"minClientVer"`
+	MaxClientVer string                 `json:"maxClientVer"`
+	MaxTimeDiff  int64                  `json:"maxTimeDiff"`
+	ShortIds     []string               `json:"shortIds"`
+	Settings     *RealityClientSettings `json:"settings"`
+
+	fields rawFields
+}
+
+func (s *RealitySettings) UnmarshalJSON(data []byte) error {
+	type alias RealitySettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s RealitySettings) MarshalJSON() ([]byte, error) {
+	type alias RealitySettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+// GetDest 新版 xray 使用 target 代替 dest
+func (s *RealitySettings) GetDest() string {
+	if s.Dest != "" {
+		return s.Dest
+	}
+	return s.Target
+}
+
+// RealityClientSettings 面板保存的客户端参数，xray 不读取
+type RealityClientSettings struct {
+	PublicKey   string `json:"publicKey"`
+	Fingerprint string `json:"fingerprint"`
+	ServerName  string `json:"serverName"`
+	SpiderX     string `json:"spiderX"`
+
+	fields rawFields
+}
+
+func (s *RealityClientSettings) UnmarshalJSON(data []byte) error {
+	type alias RealityClientSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s RealityClientSettings) MarshalJSON() ([]byte, error) {
+	type alias RealityClientSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+type TCPSettings struct {
+	AcceptProxyProtocol bool            `json:"acceptProxyProtocol"`
+	Header              json.RawMessage `json:"header"`
+
+	fields rawFields
+}
+
+func (s *TCPSettings) UnmarshalJSON(data []byte) error {
+	type alias TCPSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s TCPSettings) MarshalJSON() ([]byte, error) {
+	type alias TCPSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+type KCPSettings struct {
+	Mtu        int             `json:"mtu"`
+	Tti        int             `json:"tti"`
+	Seed       string          `json:"seed"`
+	Congestion bool            `json:"congestion"`
+	Header     json.RawMessage `json:"header"`
+
+	fields rawFields
+}
+
+func (s *KCPSettings) UnmarshalJSON(data []byte) error {
+	type alias KCPSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s KCPSettings) MarshalJSON() ([]byte, error) {
+	type alias KCPSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+type WSSettings struct {
+	AcceptProxyProtocol bool              `json:"acceptProxyProtocol"`
+	Path                string            `json:"path"`
+	Host                string            `json:"host"`
+	Headers             map[string]string `json:"headers"`
+
+	fields rawFields
+}
+
+func (s *WSSettings) UnmarshalJSON(data []byte) error {
+	type alias WSSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s WSSettings) MarshalJSON() ([]byte, error) {
+	type alias WSSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+type HTTPStreamSettings struct {
+	Path string   `json:"path"`
+	Host []string `json:"host"`
+
+	fields rawFields
+}
+
+func (s *HTTPStreamSettings) UnmarshalJSON(data []byte) error {
+	type alias HTTPStreamSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s HTTPStreamSettings) MarshalJSON() ([]byte, error) {
+	type alias HTTPStreamSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+type GRPCSettings struct {
+	ServiceName string `json:"serviceName"`
+	MultiMode   bool   `json:"multiMode"`
+
+	fields rawFields
+}
+
+func (s *GRPCSettings) UnmarshalJSON(data []byte) error {
+	type alias GRPCSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s GRPCSettings) MarshalJSON() ([]byte, error) {
+	type alias GRPCSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+type HTTPUpgradeSettings struct {
+	AcceptProxyProtocol bool   `json:"acceptProxyProtocol"`
+	Path                string `json:"path"`
+	Host                string `json:"host"`
+
+	fields rawFields
+}
+
+func (s *HTTPUpgradeSettings) UnmarshalJSON(data []byte) error {
+	type alias HTTPUpgradeSettings
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s HTTPUpgradeSettings) MarshalJSON() ([]byte, error) {
+	type alias HTTPUpgradeSettings
+	return marshalObject((*alias)(&s), s.fields)
+}
+
+// Sniffing 入站流量探测设置
+type Sniffing struct {
+	Enabled      bool     `json:"enabled"`
+	DestOverride []string `json:"destOverride"`
+	MetadataOnly bool     `json:"metadataOnly"`
+	RouteOnly    bool     `json:"routeOnly"`
+
+	fields rawFields
+}
+
+func (s *Sniffing) UnmarshalJSON(data []byte) error {
+	type alias Sniffing
+	return unmarshalObject(data, (*alias)(s), &s.fields)
+}
+
+func (s Sniffing) MarshalJSON() ([]byte, error) {
+	type alias Sniffing
+	return marshalObject((*alias)(&s), s.fields)
+}
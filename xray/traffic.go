@@ -2,6 +2,7 @@ package xray
 
 type Traffic struct {
 	IsInbound bool
+	IsUser    bool // Tag 为客户端 email
 	Tag       string
 	Up        int64
 	Down      int64